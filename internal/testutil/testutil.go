@@ -0,0 +1,48 @@
+// Package testutil holds the helpers shared by the tests of the
+// partner-charts-ci packages
+package testutil
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// AssertGolden compares actual with the golden file name in the testdata
+// directory of the package under test, or writes it with -update
+func AssertGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	goldenPath := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("output differs from %s:\n%s", goldenPath, actual)
+	}
+}
+
+// ChartVersions returns versions of the example chart with the given
+// versions, in order
+func ChartVersions(versions ...string) repo.ChartVersions {
+	chartVersions := make(repo.ChartVersions, 0, len(versions))
+	for _, version := range versions {
+		chartVersions = append(chartVersions, &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "example", Version: version},
+		})
+	}
+
+	return chartVersions
+}
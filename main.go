@@ -1,22 +1,70 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/rancher/partner-charts-ci/pkg/assetindex"
+	"github.com/rancher/partner-charts-ci/pkg/attest"
+	"github.com/rancher/partner-charts-ci/pkg/audit"
+	"github.com/rancher/partner-charts-ci/pkg/bundle"
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/catalog"
+	"github.com/rancher/partner-charts-ci/pkg/charts"
+	"github.com/rancher/partner-charts-ci/pkg/checksums"
+	"github.com/rancher/partner-charts-ci/pkg/codeowners"
+	"github.com/rancher/partner-charts-ci/pkg/compat"
 	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/rancher/partner-charts-ci/pkg/dialer"
+	"github.com/rancher/partner-charts-ci/pkg/events"
 	"github.com/rancher/partner-charts-ci/pkg/fetcher"
+	"github.com/rancher/partner-charts-ci/pkg/fixture"
+	"github.com/rancher/partner-charts-ci/pkg/hooks"
 	"github.com/rancher/partner-charts-ci/pkg/icons"
+	"github.com/rancher/partner-charts-ci/pkg/indexcache"
+	"github.com/rancher/partner-charts-ci/pkg/install"
+	"github.com/rancher/partner-charts-ci/pkg/migrate"
+	"github.com/rancher/partner-charts-ci/pkg/output"
 	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/progress"
+	"github.com/rancher/partner-charts-ci/pkg/prompt"
+	"github.com/rancher/partner-charts-ci/pkg/pullrequest"
+	"github.com/rancher/partner-charts-ci/pkg/questions"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/rancher/partner-charts-ci/pkg/rendercheck"
+	"github.com/rancher/partner-charts-ci/pkg/report"
+	"github.com/rancher/partner-charts-ci/pkg/sandbox"
+	"github.com/rancher/partner-charts-ci/pkg/schedule"
+	"github.com/rancher/partner-charts-ci/pkg/selection"
+	"github.com/rancher/partner-charts-ci/pkg/snapshot"
+	"github.com/rancher/partner-charts-ci/pkg/state"
+	"github.com/rancher/partner-charts-ci/pkg/storage"
+	"github.com/rancher/partner-charts-ci/pkg/summary"
+	"github.com/rancher/partner-charts-ci/pkg/tgzdiff"
+	"github.com/rancher/partner-charts-ci/pkg/tidy"
+	"github.com/rancher/partner-charts-ci/pkg/transaction"
 	"github.com/rancher/partner-charts-ci/pkg/validate"
+	"github.com/rancher/partner-charts-ci/pkg/valuesdiff"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
@@ -24,35 +72,101 @@ import (
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/repo"
+
+	"sigs.k8s.io/yaml"
 )
 
 const (
-	annotationAutoInstall  = "catalog.cattle.io/auto-install"
-	annotationCertified    = "catalog.cattle.io/certified"
-	annotationDisplayName  = "catalog.cattle.io/display-name"
-	annotationExperimental = "catalog.cattle.io/experimental"
-	annotationFeatured     = "catalog.cattle.io/featured"
-	annotationHidden       = "catalog.cattle.io/hidden"
-	annotationKubeVersion  = "catalog.cattle.io/kube-version"
-	annotationNamespace    = "catalog.cattle.io/namespace"
-	annotationReleaseName  = "catalog.cattle.io/release-name"
+	annotationAliases         = "catalog.cattle.io/aliases"
+	annotationAutoInstall     = "catalog.cattle.io/auto-install"
+	annotationCertified       = "catalog.cattle.io/certified"
+	annotationCreateNamespace = "catalog.cattle.io/create-namespace"
+	annotationDeprecated      = "catalog.cattle.io/deprecated"
+	annotationDisplayName     = "catalog.cattle.io/display-name"
+	annotationEOLDate         = "catalog.cattle.io/eol-date"
+	annotationEULARequired    = "catalog.cattle.io/eula-required"
+	annotationEULAURL         = "catalog.cattle.io/eula-url"
+	annotationExperimental    = "catalog.cattle.io/experimental"
+	annotationFeatured        = "catalog.cattle.io/featured"
+	annotationHidden          = "catalog.cattle.io/hidden"
+	annotationKubeVersion     = "catalog.cattle.io/kube-version"
+	annotationNamespace       = "catalog.cattle.io/namespace"
+	annotationReleaseName     = "catalog.cattle.io/release-name"
 	//indexFile sets the filename for the repo index yaml
 	indexFile = "index.yaml"
 	//packageEnvVariable sets the environment variable to check for a package name
 	packageEnvVariable = "PACKAGE"
 	//repositoryAssetsDir sets the directory name for chart asset files
 	repositoryAssetsDir = "assets"
+	//repositoryIconsDir sets the path of downloaded icons
+	repositoryIconsDir = repositoryAssetsDir + "/icons"
 	//repositoryChartsDir sets the directory name for stored charts
 	repositoryChartsDir = "charts"
 	//repositoryPackagesDir sets the directory name for package configurations
 	repositoryPackagesDir = "packages"
 	configOptionsFile     = "configuration.yaml"
 	featuredMax           = 5
+	//eolDateLayout sets the date format of EOL dates in upstream.yaml
+	eolDateLayout = "2006-01-02"
+	//commitStrategySingle commits all changes at once
+	commitStrategySingle = "single"
+	//commitStrategyPerPackage commits each package on its own, then the index
+	commitStrategyPerPackage = "per-package"
+	//commitStrategyByType commits icons, then charts, then the index
+	commitStrategyByType = "by-type"
 )
 
 var (
 	version = "v0.0.0"
 	commit  = "HEAD"
+	//localSourceOverride replaces the upstream of the selected package
+	//with a local chart, set by --local-source
+	localSourceOverride string
+	//indexOverride replaces the upstream index.yaml of the selected
+	//package with a snapshot URL or file, set by --index
+	indexOverride string
+	//maxDownloadBytes and maxTempBytes cap the bytes downloaded and
+	//the temporary disk used by a run, set by --max-download-bytes and
+	//--max-temp-bytes. Zero means no cap.
+	maxDownloadBytes int64
+	maxTempBytes     int64
+	//runTempDir holds the temporary files of a run with maxTempBytes
+	runTempDir string
+	//commitStrategy groups changes into commits, set by --commit-strategy
+	commitStrategy = commitStrategySingle
+	//savedChartVersions are the index entries of archives saved with a
+	//storage backend that does not keep them in the assets directory
+	savedChartVersions repo.ChartVersions
+	//indexBatchDepth counts the batchIndexWrites calls in progress,
+	//during which writeIndex only sets indexWritePending and
+	//removeVersionFromIndex records the <chart, version> entries to
+	//remove in pendingIndexRemovals
+	indexBatchDepth      int
+	indexWritePending    bool
+	pendingIndexRemovals [][2]string
+	//indexBatchTx tracks the changes made during the outermost
+	//batchIndexWrites, so that they are rolled back if its deferred
+	//index write fails
+	indexBatchTx *transaction.Transaction
+	//storageConfigured configures the storage backend on the first
+	//call of archiveStorage
+	storageConfigured sync.Once
+	//dryRun integrates packages in a sandbox of the repository and
+	//reports the changes instead of keeping them, set by --dry-run
+	dryRun bool
+	//strictIndex fails index writes when an asset can not be indexed,
+	//instead of leaving it out, set by --strict-index
+	strictIndex bool
+	//skipRenderCheck writes new chart versions without linting and
+	//rendering them first, set by --skip-render-check
+	skipRenderCheck bool
+	//updateReportPath is the file the update report of auto and stage
+	//is written to, set by --report, or empty to not write it
+	updateReportPath string
+	//concurrency is the number of packages whose upstreams are fetched,
+	//and whose new versions are downloaded, at once by auto and stage,
+	//set by --concurrency
+	concurrency = 1
 )
 
 // PackageWrapper is a representation of relevant package metadata
@@ -75,6 +189,16 @@ type PackageWrapper struct {
 	Vendor string
 	//Formatted version of chart vendor
 	ParsedVendor string
+	//resolution records how FetchVersions was selected, if set
+	resolution *versionResolution
+	//checkDuration is the time spent populating the package
+	checkDuration time.Duration
+	//rebuild marks stored chart versions being re-conformed, whose
+	//annotations are replaced by the configured ones
+	rebuild bool
+	//renderCheck lints and renders each version before it is written,
+	//leaving out the versions that fail
+	renderCheck bool
 }
 
 type PackageList []PackageWrapper
@@ -87,15 +211,38 @@ func (p PackageList) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// Less orders packages by vendor, then chart name, then path, so that
+// packages that are not populated yet, or share a chart name, still
+// have a stable order
 func (p PackageList) Less(i, j int) bool {
-	if p[i].SourceMetadata != nil && p[j].SourceMetadata != nil {
-		if p[i].ParsedVendor != p[j].ParsedVendor {
-			return p[i].ParsedVendor < p[j].ParsedVendor
-		}
+	if p[i].ParsedVendor != p[j].ParsedVendor {
+		return p[i].ParsedVendor < p[j].ParsedVendor
+	}
+	if p[i].Name != p[j].Name {
 		return p[i].Name < p[j].Name
 	}
 
-	return false
+	return p[i].Path < p[j].Path
+}
+
+// Returns a copy of packageList in the order of Less, leaving the
+// order of packageList to its caller
+func sortedPackages(packageList PackageList) PackageList {
+	sorted := make(PackageList, len(packageList))
+	copy(sorted, packageList)
+	sort.Sort(sorted)
+
+	return sorted
+}
+
+// Returns a copy of versions sorted newest first, as the FetchVersions
+// of packages with TrackVersions are in the order of TrackVersions
+func newestFirst(versions repo.ChartVersions) repo.ChartVersions {
+	sorted := make(repo.ChartVersions, len(versions))
+	copy(sorted, versions)
+	sort.Stable(sort.Reverse(sorted))
+
+	return sorted
 }
 
 // Populates PackageWrapper with relevant data from upstream and
@@ -107,6 +254,21 @@ func (packageWrapper *PackageWrapper) populate(onlyLatest bool) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to parse upstream.yaml: %w", err)
 	}
+	if localSourceOverride != "" {
+		upstreamYaml.LocalPath = localSourceOverride
+	}
+	if upstreamYaml.LocalPath != "" && !filepath.IsAbs(upstreamYaml.LocalPath) {
+		upstreamYaml.LocalPath = filepath.Join(packageWrapper.Path, upstreamYaml.LocalPath)
+	}
+	if indexOverride != "" {
+		if upstreamYaml.HelmChart == "" {
+			return false, fmt.Errorf("--index requires a package with HelmChart set")
+		}
+		upstreamYaml.HelmRepoIndex = indexOverride
+	}
+	if upstreamYaml.HelmRepoIndex != "" && !strings.HasPrefix(upstreamYaml.HelmRepoIndex, "http://") && !strings.HasPrefix(upstreamYaml.HelmRepoIndex, "https://") && !filepath.IsAbs(upstreamYaml.HelmRepoIndex) {
+		upstreamYaml.HelmRepoIndex = filepath.Join(packageWrapper.Path, upstreamYaml.HelmRepoIndex)
+	}
 	packageWrapper.UpstreamYaml = &upstreamYaml
 
 	sourceMetadata, err := generateChartSourceMetadata(*packageWrapper.UpstreamYaml)
@@ -115,11 +277,14 @@ func (packageWrapper *PackageWrapper) populate(onlyLatest bool) (bool, error) {
 	}
 
 	packageWrapper.SourceMetadata = sourceMetadata
+	if sourceMetadata.Source == fetcher.SourceManifest && packageWrapper.UpstreamYaml.Fetch == "" {
+		packageWrapper.UpstreamYaml.Fetch = selection.FetchAll
+	}
 	packageWrapper.Name = sourceMetadata.Versions[0].Name
 	packageWrapper.Vendor, packageWrapper.ParsedVendor = parseVendor(packageWrapper.UpstreamYaml.Vendor, packageWrapper.Name, packageWrapper.Path)
 
 	if onlyLatest {
-		packageWrapper.UpstreamYaml.Fetch = "latest"
+		packageWrapper.UpstreamYaml.Fetch = selection.FetchLatest
 		if packageWrapper.UpstreamYaml.TrackVersions != nil {
 			packageWrapper.UpstreamYaml.TrackVersions = []string{packageWrapper.UpstreamYaml.TrackVersions[0]}
 		}
@@ -127,23 +292,24 @@ func (packageWrapper *PackageWrapper) populate(onlyLatest bool) (bool, error) {
 
 	packageWrapper.FetchVersions, err = filterVersions(
 		packageWrapper.SourceMetadata.Versions,
-		packageWrapper.UpstreamYaml.Fetch,
-		packageWrapper.UpstreamYaml.TrackVersions,
+		*packageWrapper.UpstreamYaml,
+		packageWrapper.resolution,
 	)
 	if err != nil {
 		return false, err
 	}
+	for _, version := range packageWrapper.FetchVersions {
+		if version.Deprecated {
+			logrus.Warnf("%s (%s) is marked deprecated in upstream", packageWrapper.Name, version.Version)
+		}
+	}
 
 	packageWrapper.LatestStored, err = getLatestStoredVersion(packageWrapper.Name)
 	if err != nil {
 		return false, err
 	}
 
-	if packageWrapper.UpstreamYaml.DisplayName != "" {
-		packageWrapper.DisplayName = packageWrapper.UpstreamYaml.DisplayName
-	} else {
-		packageWrapper.DisplayName = packageWrapper.Name
-	}
+	packageWrapper.setDisplayName()
 
 	if len(packageWrapper.FetchVersions) == 0 {
 		return false, nil
@@ -152,6 +318,50 @@ func (packageWrapper *PackageWrapper) populate(onlyLatest bool) (bool, error) {
 	return true, nil
 }
 
+// Populates PackageWrapper from upstream.yaml and the stored charts only,
+// without contacting the upstream. The chart name is taken from
+// ChartMetadata.name, HelmChart, ArtifactHubPackage or the package
+// directory name, in that order.
+func (packageWrapper *PackageWrapper) populateFromStored() error {
+	upstreamYaml, err := parse.ParseUpstreamYaml(packageWrapper.Path)
+	if err != nil {
+		return fmt.Errorf("failed to parse upstream.yaml: %w", err)
+	}
+	packageWrapper.UpstreamYaml = &upstreamYaml
+	packageWrapper.Name = upstreamYaml.ChartName(packageWrapper.Path)
+	packageWrapper.Vendor, packageWrapper.ParsedVendor = parseVendor(upstreamYaml.Vendor, packageWrapper.Name, packageWrapper.Path)
+
+	packageWrapper.LatestStored, err = getLatestStoredVersion(packageWrapper.Name)
+	if err != nil {
+		return err
+	}
+	if packageWrapper.LatestStored.Version == "" {
+		return fmt.Errorf("no stored versions of %s in %s", packageWrapper.Name, indexFile)
+	}
+
+	packageWrapper.setDisplayName()
+
+	return nil
+}
+
+// Sets the display name from upstream.yaml. Without one, packages that
+// are already stored keep the chart name they were published with, and
+// new packages get a name derived from it.
+func (packageWrapper *PackageWrapper) setDisplayName() {
+	if packageWrapper.UpstreamYaml.DisplayName != "" {
+		packageWrapper.DisplayName = packageWrapper.UpstreamYaml.DisplayName
+	} else if packageWrapper.LatestStored.Metadata != nil {
+		packageWrapper.DisplayName = packageWrapper.Name
+	} else {
+		packageWrapper.DisplayName = conform.DeriveDisplayName(packageWrapper.Name)
+	}
+}
+
+// Returns the package name in the <vendor>/<chart> format printed by list
+func (packageWrapper PackageWrapper) packageName() string {
+	return strings.TrimPrefix(getRelativePath(packageWrapper.Path), "/")
+}
+
 func annotate(vendor, chartName, annotation, value string, remove, onlyLatest bool) error {
 	var versionsToUpdate repo.ChartVersions
 
@@ -166,14 +376,14 @@ func annotate(vendor, chartName, annotation, value string, remove, onlyLatest bo
 		versionsToUpdate = allStoredVersions
 	}
 
-	for _, version := range versionsToUpdate {
+	storedCharts := charts.New(versionsToUpdate, archiveStorage().Load)
+	for storedCharts.Next() {
 		modified := false
-
-		assetsPath := filepath.Join(
-			getRepoRoot(),
-			repositoryAssetsDir,
-			vendor,
-		)
+		version := storedCharts.Version()
+		if !annotationChanges(version.Annotations, annotation, value, remove) {
+			logrus.Debugf("Annotations of %s (%s) already up to date\n", chartName, version.Version)
+			continue
+		}
 
 		versionPath := path.Join(
 			getRepoRoot(),
@@ -181,7 +391,7 @@ func annotate(vendor, chartName, annotation, value string, remove, onlyLatest bo
 			vendor,
 			chartName,
 		)
-		helmChart, err := loader.LoadFile(version.URLs[0])
+		helmChart, err := storedCharts.Chart()
 		if err != nil {
 			return err
 		}
@@ -192,34 +402,83 @@ func annotate(vendor, chartName, annotation, value string, remove, onlyLatest bo
 			modified = conform.ApplyChartAnnotations(helmChart, map[string]string{annotation: value}, true)
 		}
 
-		if modified {
-			logrus.Debugf("Modified annotations of %s (%s)\n", chartName, helmChart.Metadata.Version)
-
-			err = os.RemoveAll(versionPath)
-			if err != nil {
-				return err
-			}
+		if !modified {
+			logrus.Debugf("Annotations of %s (%s) already up to date\n", chartName, helmChart.Metadata.Version)
+			continue
+		}
 
-			_, err := chartutil.Save(helmChart, assetsPath)
-			if err != nil {
-				return fmt.Errorf("failed to save chart %q version %q: %w", helmChart.Name(), helmChart.Metadata.Version, err)
-			}
-			err = conform.ExportChartDirectory(helmChart, versionPath)
-			if err != nil {
-				return err
-			}
+		logrus.Debugf("Modified annotations of %s (%s)\n", chartName, helmChart.Metadata.Version)
 
-			err = removeVersionFromIndex(chartName, *version)
-			if err != nil {
-				return err
-			}
+		_, err = saveChartArchive(helmChart, vendor)
+		if err != nil {
+			return err
+		}
+		err = conform.ExportChartDirectory(helmChart, versionPath)
+		if err != nil {
+			return err
 		}
 
+		err = removeVersionFromIndex(chartName, *version)
+		if err != nil {
+			return err
+		}
 	}
 
 	return err
 }
 
+// Returns true if setting annotation to value, or removing it if
+// remove is true, would change annotations, the index metadata of a
+// stored chart version, so that unchanged versions are not loaded
+func annotationChanges(annotations map[string]string, annotation, value string, remove bool) bool {
+	currentValue, ok := annotations[annotation]
+	if remove {
+		return ok && (value == "" || currentValue == value)
+	}
+
+	return !ok || currentValue != value
+}
+
+// Runs fn, which annotates stored charts with annotateTracked, then
+// rewrites the index. If any step fails, the index and every chart
+// tracked by tx are restored so the repository is not left with
+// partially written charts.
+func updateAnnotations(fn func(tx *transaction.Transaction) error) error {
+	tx := transaction.New()
+	if indexBatchTx != nil {
+		tx = indexBatchTx.Nest()
+	}
+	if err := tx.Track(filepath.Join(getRepoRoot(), indexFile)); err != nil {
+		return err
+	}
+
+	return tx.Run(func() error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := writeIndex(); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+		return nil
+	})
+}
+
+// Calls annotate after tracking the assets and chart directory it
+// rewrites in tx
+func annotateTracked(tx *transaction.Transaction, vendor, chartName, annotation, value string, remove, onlyLatest bool) error {
+	trackedPaths := []string{
+		filepath.Join(getRepoRoot(), repositoryAssetsDir, vendor),
+		filepath.Join(getRepoRoot(), repositoryChartsDir, vendor, chartName),
+	}
+	for _, trackedPath := range trackedPaths {
+		if err := tx.Track(trackedPath); err != nil {
+			return err
+		}
+	}
+
+	return annotate(vendor, chartName, annotation, value, remove, onlyLatest)
+}
+
 // Fetches absolute repository root path
 func getRepoRoot() string {
 	repoRoot, err := os.Getwd()
@@ -272,9 +531,41 @@ func gitCleanup() error {
 	return err
 }
 
+// Lists the changes that gitCleanup discards
+func gitCleanupPlan() ([]string, error) {
+	r, err := git.PlainOpen(getRepoRoot())
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]string, 0, len(status))
+	for filePath, fileStatus := range status {
+		switch {
+		case fileStatus.Worktree == git.Untracked:
+			plan = append(plan, fmt.Sprintf("delete untracked %s", filePath))
+		case fileStatus.Staging == git.Added:
+			plan = append(plan, fmt.Sprintf("delete added %s", filePath))
+		case fileStatus.Worktree != git.Unmodified || fileStatus.Staging != git.Unmodified:
+			plan = append(plan, fmt.Sprintf("revert %s", filePath))
+		}
+	}
+	sort.Strings(plan)
+
+	return plan, nil
+}
+
 // Commits changes to index file, assets, charts, and packages
 func commitChanges(updatedList PackageList, iconOverride bool) error {
-	var additions, updates string
 	commitOptions := git.CommitOptions{}
 
 	r, err := git.PlainOpen(getRepoRoot())
@@ -289,75 +580,278 @@ func commitChanges(updatedList PackageList, iconOverride bool) error {
 
 	logrus.Info("Committing changes")
 
-	for _, packageWrapper := range updatedList {
-		assetsPath := path.Join(
-			repositoryAssetsDir,
-			packageWrapper.ParsedVendor)
+	for _, group := range commitGroups(updatedList, iconOverride) {
+		staged, err := stagePaths(wt, group.paths)
+		if err != nil {
+			return err
+		}
+		if !staged {
+			logrus.Debugf("Nothing to commit for %q\n", strings.SplitN(group.message, "\n", 2)[0])
+			continue
+		}
 
-		chartsPath := path.Join(
-			repositoryChartsDir,
-			packageWrapper.ParsedVendor,
-			packageWrapper.Name)
+		commitHash, err := wt.Commit(group.message+commitTrailers(group.packages), &commitOptions)
+		if err != nil {
+			return err
+		}
+		events.Emit(events.Event{Type: events.TypeCommitCreated, Commit: commitHash.String()})
+	}
 
-		packagesPath := path.Join(
-			repositoryPackagesDir,
-			packageWrapper.ParsedVendor,
-			packageWrapper.Name)
+	gitStatus, err := wt.Status()
+	if err != nil {
+		return err
+	}
 
-		for _, path := range []string{assetsPath, chartsPath, packagesPath} {
-			if _, err := wt.Add(path); err != nil {
-				return fmt.Errorf("failed to add %q to working tree: %w", path, err)
-			}
+	if !gitStatus.IsClean() {
+		logrus.Fatal("Git status is not clean")
+	}
+
+	return nil
+}
+
+// A set of paths committed together, and the packages they belong to
+type commitGroup struct {
+	message  string
+	paths    []string
+	packages []string
+}
+
+// Returns the trailers appended to commit messages for automation to
+// parse: the updated packages, the version of partner-charts-ci, and
+// the GitHub Actions run that made the commit, if any
+func commitTrailers(packages []string) string {
+	trailers := "\n\n"
+	if len(packages) > 0 {
+		trailers += fmt.Sprintf("Updated-Packages: %s\n", strings.Join(packages, ", "))
+	}
+	trailers += fmt.Sprintf("Tool-Version: %s (%s)\n", version, commit)
+	if runId := os.Getenv("GITHUB_RUN_ID"); runId != "" {
+		trailers += fmt.Sprintf("Run-Id: %s\n", runId)
+	}
+
+	return trailers
+}
+
+// Groups the changes of updatedList into commits according to
+// commitStrategy
+func commitGroups(updatedList PackageList, iconOverride bool) []commitGroup {
+	indexPaths := []string{indexFile}
+	if _, err := os.Stat(filepath.Join(getRepoRoot(), state.StateFile)); err == nil {
+		indexPaths = append(indexPaths, state.StateFile)
+	}
+	iconsPaths := []string{}
+	if _, err := os.Stat(filepath.Join(getRepoRoot(), repositoryIconsDir)); err == nil {
+		iconsPaths = append(iconsPaths, repositoryIconsDir)
+	}
+
+	updatedList = sortedPackages(updatedList)
+	packageNames := make([]string, 0, len(updatedList))
+	for _, packageWrapper := range updatedList {
+		packageNames = append(packageNames, packageWrapper.packageName())
+	}
+	sort.Strings(packageNames)
+
+	switch commitStrategy {
+	case commitStrategyPerPackage:
+		groups := make([]commitGroup, 0, len(updatedList)+1)
+		for _, packageWrapper := range updatedList {
+			groups = append(groups, commitGroup{
+				message:  generateCommitMessage(PackageList{packageWrapper}, iconOverride),
+				paths:    packagePaths(packageWrapper),
+				packages: []string{packageWrapper.packageName()},
+			})
+		}
+		return append(groups, commitGroup{
+			message:  generateIndexCommitMessage(iconOverride),
+			paths:    append(iconsPaths, indexPaths...),
+			packages: packageNames,
+		})
+	case commitStrategyByType:
+		packagesPaths := make([]string, 0)
+		for _, packageWrapper := range updatedList {
+			packagesPaths = append(packagesPaths, packagePaths(packageWrapper)...)
+		}
+		return []commitGroup{
+			{message: "Update icons", paths: iconsPaths, packages: packageNames},
+			{message: generateCommitMessage(updatedList, iconOverride), paths: packagesPaths, packages: packageNames},
+			{message: generateIndexCommitMessage(iconOverride), paths: indexPaths, packages: packageNames},
+		}
+	default:
+		paths := make([]string, 0)
+		for _, packageWrapper := range updatedList {
+			paths = append(paths, packagePaths(packageWrapper)...)
 		}
+		paths = append(paths, iconsPaths...)
+		return []commitGroup{{
+			message:  generateCommitMessage(updatedList, iconOverride),
+			paths:    append(paths, indexPaths...),
+			packages: packageNames,
+		}}
+	}
+}
 
-		gitStatus, err := wt.Status()
-		if err != nil {
-			return err
+// Returns the paths of the assets, charts and package configuration of
+// packageWrapper, relative to the repository root
+func packagePaths(packageWrapper PackageWrapper) []string {
+	assetsPath := path.Join(
+		repositoryAssetsDir,
+		packageWrapper.ParsedVendor)
+
+	chartsPath := path.Join(
+		repositoryChartsDir,
+		packageWrapper.ParsedVendor,
+		packageWrapper.Name)
+
+	packagesPath := path.Join(
+		repositoryPackagesDir,
+		packageWrapper.ParsedVendor,
+		packageWrapper.Name)
+
+	paths := []string{assetsPath, chartsPath, packagesPath}
+	crdChartsPath := chartsPath + conform.CRDChartSuffix
+	if _, err := os.Stat(filepath.Join(getRepoRoot(), crdChartsPath)); err == nil {
+		paths = append(paths, crdChartsPath)
+	}
+
+	return paths
+}
+
+// Stages paths, including files deleted beneath them, and reports
+// whether anything is staged for commit
+func stagePaths(wt *git.Worktree, paths []string) (bool, error) {
+	for _, path := range paths {
+		if _, err := wt.Add(path); err != nil {
+			return false, fmt.Errorf("failed to add %q to working tree: %w", path, err)
 		}
+	}
 
-		for f, s := range gitStatus {
-			if s.Worktree == git.Deleted {
-				_, err = wt.Remove(f)
-				if err != nil {
-					return err
-				}
+	gitStatus, err := wt.Status()
+	if err != nil {
+		return false, err
+	}
+
+	for f, s := range gitStatus {
+		if s.Worktree == git.Deleted && isBeneath(f, paths) {
+			if _, err := wt.Remove(f); err != nil {
+				return false, err
 			}
 		}
+	}
+
+	gitStatus, err = wt.Status()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range gitStatus {
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
 
+// Reports whether file is one of paths or lies beneath one of them
+func isBeneath(file string, paths []string) bool {
+	for _, p := range paths {
+		if file == p || strings.HasPrefix(file, p+"/") {
+			return true
+		}
 	}
 
-	if _, err := wt.Add(indexFile); err != nil {
-		return fmt.Errorf("failed to add %q to working tree: %w", indexFile, err)
+	return false
+}
+
+// Generates the message of the commit that regenerates the index
+func generateIndexCommitMessage(iconOverride bool) string {
+	if iconOverride {
+		return "Icon Override CI\n```\nUpdated index.yaml\n```"
 	}
+
+	return "Charts CI\n```\nUpdated index.yaml\n```"
+}
+
+// Generates the commit message listing added and updated charts
+func generateCommitMessage(updatedList PackageList, iconOverride bool) string {
 	commitMessage := "Charts CI\n```"
 	if iconOverride {
 		commitMessage = "Icon Override CI\n```"
 	}
-	sort.Sort(updatedList)
+	updatedList = sortedPackages(updatedList)
+	var additions, updates PackageList
+	releases := make([]string, 0)
 	for _, packageWrapper := range updatedList {
-		lineItem := fmt.Sprintf("  %s/%s:\n",
-			packageWrapper.ParsedVendor,
-			packageWrapper.Name)
-		for _, version := range packageWrapper.FetchVersions {
-			lineItem += fmt.Sprintf("    - %s\n", version.Version)
-		}
 		if packageWrapper.LatestStored.Digest == "" {
-			additions += lineItem
+			additions = append(additions, packageWrapper)
 		} else {
-			updates += lineItem
+			updates = append(updates, packageWrapper)
+		}
+		if packageWrapper.UpstreamYaml == nil || packageWrapper.SourceMetadata == nil {
+			continue
+		}
+		for _, version := range newestFirst(packageWrapper.FetchVersions) {
+			releaseURL := fetcher.ReleaseURL(*packageWrapper.UpstreamYaml, *packageWrapper.SourceMetadata, version.Version)
+			if releaseURL != "" {
+				releases = append(releases, fmt.Sprintf("- %s %s: %s\n", packageWrapper.packageName(), version.Version, releaseURL))
+			}
 		}
 	}
 
-	if additions != "" {
-		commitMessage += fmt.Sprintf("\nAdded:\n%s", additions)
+	if len(additions) > 0 {
+		commitMessage += fmt.Sprintf("\nAdded:\n%s", groupByVendor(additions))
 	}
-	if updates != "" {
-		commitMessage += fmt.Sprintf("\nUpdated:\n%s", updates)
+	if len(updates) > 0 {
+		commitMessage += fmt.Sprintf("\nUpdated:\n%s", groupByVendor(updates))
 	}
 
 	commitMessage += "```"
+	if len(releases) > 0 {
+		commitMessage += "\n\nUpstream releases:\n" + strings.Join(releases, "")
+	}
+
+	return commitMessage
+}
+
+// Lists the new versions of packageList, sorted by vendor, under a
+// heading for each vendor with its number of charts and versions
+func groupByVendor(packageList PackageList) string {
+	var list string
+	for i := 0; i < len(packageList); {
+		vendor := packageList[i].ParsedVendor
+		var lineItems string
+		charts, versions := 0, 0
+		for ; i < len(packageList) && packageList[i].ParsedVendor == vendor; i++ {
+			lineItems += fmt.Sprintf("    %s:\n", packageList[i].Name)
+			for _, version := range newestFirst(packageList[i].FetchVersions) {
+				lineItems += fmt.Sprintf("      - %s\n", version.Version)
+			}
+			charts++
+			versions += len(packageList[i].FetchVersions)
+		}
+		list += fmt.Sprintf("  %s (%s, %s):\n%s", vendor, plural(charts, "chart"), plural(versions, "version"), lineItems)
+	}
+
+	return list
+}
+
+// Returns count followed by noun, pluralized unless count is 1
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// Commits the state file on its own, for runs that produced no chart
+// changes. Does nothing if the state file is unchanged.
+func commitState() error {
+	r, err := git.PlainOpen(getRepoRoot())
+	if err != nil {
+		return err
+	}
 
-	_, err = wt.Commit(commitMessage, &commitOptions)
+	wt, err := r.Worktree()
 	if err != nil {
 		return err
 	}
@@ -367,8 +861,14 @@ func commitChanges(updatedList PackageList, iconOverride bool) error {
 		return err
 	}
 
-	if !gitStatus.IsClean() {
-		logrus.Fatal("Git status is not clean")
+	if gitStatus.IsUntracked(state.StateFile) || gitStatus.File(state.StateFile).Worktree == git.Modified {
+		logrus.Info("Committing state changes")
+		if _, err := wt.Add(state.StateFile); err != nil {
+			return fmt.Errorf("failed to add %q to working tree: %w", state.StateFile, err)
+		}
+		if _, err := wt.Commit("Charts CI state", &git.CommitOptions{}); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -393,8 +893,10 @@ func preparePackage(packagePath string, sourceMetadata *fetcher.ChartSourceMetad
 
 	if sourceMetadata.Source == "Git" {
 		chart, err = fetcher.LoadChartFromGit(chartVersion.URLs[0], sourceMetadata.SubDirectory, sourceMetadata.Commit)
+	} else if sourceMetadata.Source == fetcher.SourceLocal {
+		chart, err = fetcher.LoadChartFromPath(chartVersion.URLs[0])
 	} else {
-		chart, err = fetcher.LoadChartFromUrl(chartVersion.URLs[0])
+		chart, err = fetcher.LoadChartFromUrls(chartVersion.URLs)
 	}
 	if err != nil {
 		return err
@@ -414,164 +916,180 @@ func preparePackage(packagePath string, sourceMetadata *fetcher.ChartSourceMetad
 	return nil
 }
 
-func collectTrackedVersions(upstreamVersions repo.ChartVersions, tracked []string) map[string]repo.ChartVersions {
-	trackedVersions := make(map[string]repo.ChartVersions)
-
-	for _, trackedVersion := range tracked {
-		versionList := make(repo.ChartVersions, 0)
-		for _, version := range upstreamVersions {
-			semVer, err := semver.NewVersion(version.Version)
-			if err != nil {
-				logrus.Errorf("%s: %s", version.Version, err)
-				continue
-			}
-			trackedSemVer, err := semver.NewVersion(trackedVersion)
-			if err != nil {
-				logrus.Errorf("%s: %s", version.Version, err)
-				continue
-			}
-			logrus.Debugf("Comparing upstream version %s (%s) to tracked version %s\n", version.Name, version.Version, trackedVersion)
-			if semVer.Major() == trackedSemVer.Major() && semVer.Minor() == trackedSemVer.Minor() {
-				logrus.Debugf("Appending version %s tracking %s\n", version.Version, trackedVersion)
-				versionList = append(versionList, version)
-			} else if semVer.Major() < trackedSemVer.Major() || (semVer.Major() == trackedSemVer.Major() && semVer.Minor() < trackedSemVer.Minor()) {
-				break
-			}
+func stripPreRelease(versions repo.ChartVersions) repo.ChartVersions {
+	strippedVersions := make(repo.ChartVersions, 0)
+	for _, version := range versions {
+		semVer, err := semver.NewVersion(version.Version)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if semVer.Prerelease() == "" {
+			strippedVersions = append(strippedVersions, version)
 		}
-		trackedVersions[trackedVersion] = versionList
 	}
 
-	return trackedVersions
+	return strippedVersions
 }
 
-func collectNonStoredVersions(versions repo.ChartVersions, storedVersions repo.ChartVersions, fetch string) repo.ChartVersions {
-	nonStoredVersions := make(repo.ChartVersions, 0)
-	for i, version := range versions {
-		parsedVersion, err := semver.NewVersion(version.Version)
+func checkNewerUntracked(tracked []string, upstreamVersions repo.ChartVersions) []string {
+	newerUntracked := make([]string, 0)
+	latestTracked := getLatestTracked(tracked)
+	logrus.Debugf("Tracked Versions: %s\n", tracked)
+	logrus.Debugf("Checking for versions newer than latest tracked %s\n", latestTracked)
+	if len(tracked) == 0 {
+		return newerUntracked
+	}
+	for _, upstreamVersion := range upstreamVersions {
+		semVer, err := semver.NewVersion(upstreamVersion.Version)
 		if err != nil {
 			logrus.Error(err)
 		}
-		stored := false
-		logrus.Debugf("Checking if version %s is stored\n", version.Version)
-		for _, storedVersion := range storedVersions {
-			strippedStoredVersion := conform.StripPackageVersion(storedVersion.Version)
-			if storedVersion.Version == parsedVersion.String() {
-				logrus.Debugf("Found version %s\n", storedVersion.Version)
-				stored = true
-				break
-			} else if strippedStoredVersion == parsedVersion.String() {
-				logrus.Debugf("Found modified version %s\n", storedVersion.Version)
-				stored = true
-				break
-			}
-		}
-		if stored && i == 0 && (strings.ToLower(fetch) == "" || strings.ToLower(fetch) == "latest") {
-			logrus.Debugf("Latest version already stored")
+		if semVer.Major() > latestTracked.Major() || (semVer.Major() == latestTracked.Major() && semVer.Minor() > latestTracked.Minor()) {
+			logrus.Debugf("Found version %s newer than latest tracked %s", semVer.String(), latestTracked.String())
+			newerUntracked = append(newerUntracked, semVer.String())
+		} else if semVer.Major() == latestTracked.Major() && semVer.Minor() == latestTracked.Minor() {
 			break
 		}
-		if !stored {
-			if fetch == strings.ToLower("newer") {
-				var semVer *semver.Version
-				semVer, err := semver.NewVersion(version.Version)
-				if err != nil {
-					logrus.Error(err)
-					continue
-				}
-				if len(storedVersions) > 0 {
-					strippedStoredLatest := conform.StripPackageVersion(storedVersions[0].Version)
-					storedLatestSemVer, err := semver.NewVersion(strippedStoredLatest)
-					if err != nil {
-						logrus.Error(err)
-						continue
-					}
-					if semVer.GreaterThan(storedLatestSemVer) {
-						logrus.Debugf("Version: %s > %s\n", semVer.String(), storedVersions[0].Version)
-						nonStoredVersions = append(nonStoredVersions, version)
-					}
-				} else {
-					nonStoredVersions = append(nonStoredVersions, version)
-				}
-			} else if fetch == strings.ToLower("all") {
-				nonStoredVersions = append(nonStoredVersions, version)
-			} else {
-				nonStoredVersions = append(nonStoredVersions, version)
-				break
-			}
-		}
 	}
 
-	return nonStoredVersions
+	return newerUntracked
+
 }
 
-func stripPreRelease(versions repo.ChartVersions) repo.ChartVersions {
-	strippedVersions := make(repo.ChartVersions, 0)
-	for _, version := range versions {
-		semVer, err := semver.NewVersion(version.Version)
-		if err != nil {
-			logrus.Error(err)
-			continue
-		}
-		if semVer.Prerelease() == "" {
-			strippedVersions = append(strippedVersions, version)
-		}
-	}
+// versionResolution is the trace of how filterVersions selected the
+// versions to fetch, printed by resolve
+type versionResolution struct {
+	Package           string          `json:"package"`
+	Source            string          `json:"source,omitempty"`
+	Fetch             string          `json:"fetch"`
+	TrackVersions     []string        `json:"trackVersions,omitempty"`
+	VersionConstraint string          `json:"versionConstraint,omitempty"`
+	ExcludeVersions   []string        `json:"excludeVersions,omitempty"`
+	Upstream          []string        `json:"upstreamVersions"`
+	Stored            []string        `json:"storedVersions"`
+	NewerUntracked    []string        `json:"newerUntrackedVersions,omitempty"`
+	Filters           []versionFilter `json:"filters"`
+	FetchVersions     []string        `json:"fetchVersions"`
+}
 
-	return strippedVersions
+// Names of the versionFilters that leave out upstream versions before
+// selection. The filter of VersionConstraint is named after
+// filterConstraint followed by the constraint.
+const (
+	filterPreRelease = "pre-release"
+	filterConstraint = "constraint"
+	filterExcluded   = "excluded"
+)
+
+// versionFilter is one step of a versionResolution
+type versionFilter struct {
+	Name    string   `json:"name"`
+	Removed []string `json:"removed"`
+	Kept    []string `json:"kept"`
 }
 
-func checkNewerUntracked(tracked []string, upstreamVersions repo.ChartVersions) []string {
-	newerUntracked := make([]string, 0)
-	latestTracked := getLatestTracked(tracked)
-	logrus.Debugf("Tracked Versions: %s\n", tracked)
-	logrus.Debugf("Checking for versions newer than latest tracked %s\n", latestTracked)
-	if len(tracked) == 0 {
-		return newerUntracked
+// Records a filter that reduced before to after. Does nothing on a nil
+// resolution.
+func (r *versionResolution) addFilter(name string, before, after repo.ChartVersions) {
+	if r == nil {
+		return
 	}
-	for _, upstreamVersion := range upstreamVersions {
-		semVer, err := semver.NewVersion(upstreamVersion.Version)
-		if err != nil {
-			logrus.Error(err)
-		}
-		if semVer.Major() > latestTracked.Major() || (semVer.Major() == latestTracked.Major() && semVer.Minor() > latestTracked.Minor()) {
-			logrus.Debugf("Found version %s newer than latest tracked %s", semVer.String(), latestTracked.String())
-			newerUntracked = append(newerUntracked, semVer.String())
-		} else if semVer.Major() == latestTracked.Major() && semVer.Minor() == latestTracked.Minor() {
-			break
+	kept := make(map[string]struct{}, len(after))
+	for _, version := range after {
+		kept[version.Version] = struct{}{}
+	}
+	removed := make([]string, 0)
+	for _, version := range before {
+		if _, ok := kept[version.Version]; !ok {
+			removed = append(removed, version.Version)
 		}
 	}
+	r.Filters = append(r.Filters, versionFilter{Name: name, Removed: removed, Kept: chartVersionStrings(after)})
+}
 
-	return newerUntracked
+func chartVersionStrings(versions repo.ChartVersions) []string {
+	versionStrings := make([]string, 0, len(versions))
+	for _, version := range versions {
+		versionStrings = append(versionStrings, version.Version)
+	}
 
+	return versionStrings
 }
 
-func filterVersions(upstreamVersions repo.ChartVersions, fetch string, tracked []string) (repo.ChartVersions, error) {
-	logrus.Debugf("Filtering versions for %s\n", upstreamVersions[0].Name)
-	upstreamVersions = stripPreRelease(upstreamVersions)
+func filterVersions(upstreamVersions repo.ChartVersions, upstreamYaml parse.UpstreamYaml, resolution *versionResolution) (repo.ChartVersions, error) {
+	chartName := upstreamVersions[0].Name
+	logrus.Debugf("Filtering versions for %s\n", chartName)
+	tracked := upstreamYaml.TrackVersions
+	selector := selection.New(upstreamYaml.Fetch)
+	if selector.Name() == selection.FetchRange && upstreamYaml.VersionConstraint == "" {
+		return repo.ChartVersions{}, fmt.Errorf("Fetch %s requires VersionConstraint", selection.FetchRange)
+	}
+	allStoredVersions, err := getStoredVersions(chartName)
+	if resolution != nil {
+		resolution.Fetch = selector.Name()
+		resolution.TrackVersions = tracked
+		resolution.VersionConstraint = upstreamYaml.VersionConstraint
+		resolution.ExcludeVersions = upstreamYaml.ExcludeVersions
+		resolution.Upstream = chartVersionStrings(upstreamVersions)
+		resolution.Stored = chartVersionStrings(allStoredVersions)
+	}
+	releaseVersions := stripPreRelease(upstreamVersions)
+	resolution.addFilter(filterPreRelease, upstreamVersions, releaseVersions)
+	upstreamVersions = releaseVersions
+	if len(upstreamVersions) == 0 {
+		err := fmt.Errorf("No versions available in upstream or all versions are marked pre-release")
+		return repo.ChartVersions{}, err
+	}
+	if upstreamYaml.VersionConstraint != "" {
+		constrainedVersions, err := selection.Constrain(upstreamVersions, upstreamYaml.VersionConstraint)
+		if err != nil {
+			return repo.ChartVersions{}, fmt.Errorf("invalid VersionConstraint %q: %w", upstreamYaml.VersionConstraint, err)
+		}
+		resolution.addFilter(fmt.Sprintf("%s %s", filterConstraint, upstreamYaml.VersionConstraint), upstreamVersions, constrainedVersions)
+		upstreamVersions = constrainedVersions
+	}
+	if len(upstreamYaml.ExcludeVersions) > 0 {
+		includedVersions := selection.Exclude(upstreamVersions, upstreamYaml.ExcludeVersions)
+		resolution.addFilter(filterExcluded, upstreamVersions, includedVersions)
+		upstreamVersions = includedVersions
+	}
+	if len(upstreamVersions) == 0 {
+		logrus.Warnf("No upstream versions of %s satisfy VersionConstraint and ExcludeVersions", chartName)
+		if resolution != nil {
+			resolution.FetchVersions = []string{}
+		}
+		return repo.ChartVersions{}, nil
+	}
 	if len(tracked) > 0 {
 		if newerUntracked := checkNewerUntracked(tracked, upstreamVersions); len(newerUntracked) > 0 {
-			logrus.Warnf("Newer untracked version available: %s (%s)", upstreamVersions[0].Name, strings.Join(newerUntracked, ", "))
+			logrus.Warnf("Newer untracked version available: %s (%s)", chartName, strings.Join(newerUntracked, ", "))
+			if resolution != nil {
+				resolution.NewerUntracked = newerUntracked
+			}
 		} else {
 			logrus.Debug("No newer untracked versions found")
 		}
 	}
-	if len(upstreamVersions) == 0 {
-		err := fmt.Errorf("No versions available in upstream or all versions are marked pre-release")
-		return repo.ChartVersions{}, err
-	}
 	filteredVersions := make(repo.ChartVersions, 0)
-	allStoredVersions, err := getStoredVersions(upstreamVersions[0].Name)
 	if len(tracked) > 0 {
-		allTrackedVersions := collectTrackedVersions(upstreamVersions, tracked)
-		storedTrackedVersions := collectTrackedVersions(allStoredVersions, tracked)
+		allTrackedVersions := selection.Track(upstreamVersions, tracked)
+		storedTrackedVersions := selection.Track(allStoredVersions, tracked)
 		if err != nil {
 			return filteredVersions, err
 		}
 		for _, trackedVersion := range tracked {
-			nonStoredVersions := collectNonStoredVersions(allTrackedVersions[trackedVersion], storedTrackedVersions[trackedVersion], fetch)
+			resolution.addFilter(fmt.Sprintf("track %s", trackedVersion), upstreamVersions, allTrackedVersions[trackedVersion])
+			nonStoredVersions := selector.Select(allTrackedVersions[trackedVersion], storedTrackedVersions[trackedVersion])
+			resolution.addFilter(fmt.Sprintf("stored %s (fetch %s)", trackedVersion, selector.Name()), allTrackedVersions[trackedVersion], nonStoredVersions)
 			filteredVersions = append(filteredVersions, nonStoredVersions...)
 		}
 	} else {
-		filteredVersions = collectNonStoredVersions(upstreamVersions, allStoredVersions, fetch)
+		filteredVersions = selector.Select(upstreamVersions, allStoredVersions)
+		resolution.addFilter(fmt.Sprintf("stored (fetch %s)", selector.Name()), upstreamVersions, filteredVersions)
+	}
+	if resolution != nil {
+		resolution.FetchVersions = chartVersionStrings(filteredVersions)
 	}
 
 	return filteredVersions, nil
@@ -611,110 +1129,343 @@ func parseVendor(upstreamYamlVendor, chartName, packagePath string) (string, str
 }
 
 // Prepares and standardizes chart, then returns loaded chart object
-func initializeChart(packagePath string, sourceMetadata fetcher.ChartSourceMetadata, chartVersion repo.ChartVersion) (*chart.Chart, error) {
-	var err error
+// and the overlay files applied to it
+func initializeChart(packagePath string, sourceMetadata fetcher.ChartSourceMetadata, chartVersion repo.ChartVersion) (*chart.Chart, []string, error) {
 	if err := preparePackage(packagePath, &sourceMetadata, &chartVersion); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	chartDirectoryPath := path.Join(packagePath, repositoryChartsDir)
 	if err := conform.StandardizeChartDirectory(chartDirectoryPath, ""); err != nil {
-		return nil, fmt.Errorf("failed to standardize chart directory: %w", err)
+		return nil, nil, fmt.Errorf("failed to standardize chart directory: %w", err)
 	}
 
-	err = conform.ApplyOverlayFiles(packagePath)
+	overlays, err := conform.ApplyOverlayFiles(packagePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	helmChart, err := loader.Load(chartDirectoryPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	helmChart.Metadata.Version = chartVersion.Version
 
-	return helmChart, nil
+	return helmChart, overlays, nil
+}
+
+// Returns the annotations configured for packageWrapper that the
+// repository sets on every chart version. May also align
+// helmChart.Metadata.KubeVersion with upstream.yaml.
+func getAnnotations(packageWrapper PackageWrapper, helmChart *chart.Chart) (map[string]string, error) {
+	annotations := make(map[string]string)
+
+	configYaml, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the defaults of the catalog are overridden by upstream.yaml
+	if len(configYaml.DefaultAnnotations) > 0 {
+		if errs := validate.CheckAnnotations(configYaml.DefaultAnnotations, configYaml.AllowedAnnotationPrefixes); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid defaultAnnotations in %s: %w", configOptionsFile, errors.Join(errs...))
+		}
+		for annotation, value := range configYaml.DefaultAnnotations {
+			annotations[annotation] = value
+		}
+	}
+	if len(packageWrapper.UpstreamYaml.Annotations) > 0 {
+		if errs := validate.CheckAnnotations(packageWrapper.UpstreamYaml.Annotations, configYaml.AllowedAnnotationPrefixes); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid Annotations in upstream.yaml: %w", errors.Join(errs...))
+		}
+		for annotation, value := range packageWrapper.UpstreamYaml.Annotations {
+			annotations[annotation] = value
+		}
+	}
+
+	if len(packageWrapper.UpstreamYaml.Aliases) > 0 {
+		aliases := make([]string, 0, len(packageWrapper.UpstreamYaml.Aliases))
+		for _, alias := range packageWrapper.UpstreamYaml.Aliases {
+			aliases = append(aliases, path.Base(alias))
+		}
+		annotations[annotationAliases] = strings.Join(aliases, ",")
+	}
+
+	if autoInstall := packageWrapper.UpstreamYaml.AutoInstall; autoInstall != "" {
+		annotations[annotationAutoInstall] = autoInstall
+	}
+
+	if packageWrapper.UpstreamYaml.Experimental {
+		annotations[annotationExperimental] = "true"
+	}
+
+	if packageWrapper.UpstreamYaml.EULAUrl != "" {
+		annotations[annotationEULAURL] = packageWrapper.UpstreamYaml.EULAUrl
+	}
+	if packageWrapper.UpstreamYaml.EULARequired {
+		annotations[annotationEULARequired] = "true"
+	}
+
+	if packageWrapper.UpstreamYaml.Hidden {
+		annotations[annotationHidden] = "true"
+	}
+
+	annotations[annotationCertified] = "partner"
+	annotations[annotationDisplayName] = packageWrapper.DisplayName
+	if helmChart.Metadata.Deprecated {
+		annotations[annotationDeprecated] = "true"
+	}
+	if packageWrapper.UpstreamYaml.ReleaseName != "" {
+		annotations[annotationReleaseName] = packageWrapper.UpstreamYaml.ReleaseName
+	} else {
+		annotations[annotationReleaseName] = packageWrapper.Name
+	}
+
+	if packageWrapper.UpstreamYaml.Namespace != "" {
+		annotations[annotationNamespace] = packageWrapper.UpstreamYaml.Namespace
+	} else if _, ok := helmChart.Metadata.Annotations[annotationNamespace]; !ok {
+		if namespace := configYaml.Namespaces.DefaultNamespace(packageWrapper.ParsedVendor, packageWrapper.Name); namespace != "" {
+			annotations[annotationNamespace] = namespace
+			// the default namespace is specific to the chart, so it
+			// rarely exists before the chart is installed
+			if !validate.BuiltinNamespace(namespace) {
+				annotations[annotationCreateNamespace] = "true"
+			}
+		}
+	}
+	if packageWrapper.UpstreamYaml.CreateNamespace {
+		annotations[annotationCreateNamespace] = "true"
+	}
+	if helmChart.Metadata.KubeVersion != "" && packageWrapper.UpstreamYaml.ChartYaml.KubeVersion != "" {
+		annotations[annotationKubeVersion] = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
+		helmChart.Metadata.KubeVersion = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
+	} else if helmChart.Metadata.KubeVersion != "" {
+		annotations[annotationKubeVersion] = helmChart.Metadata.KubeVersion
+	} else if packageWrapper.UpstreamYaml.ChartYaml.KubeVersion != "" {
+		annotations[annotationKubeVersion] = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
+	}
+	if packageWrapper.UpstreamYaml.DisableKubeVersionAnnotation {
+		delete(annotations, annotationKubeVersion)
+	}
+
+	eolDate, err := getEOLDate(*packageWrapper.UpstreamYaml, helmChart.Metadata.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !eolDate.IsZero() {
+		annotations[annotationEOLDate] = eolDate.Format(eolDateLayout)
+	}
+
+	return annotations, nil
+}
+
+// Returns the vendor-declared EOL date of the major version of
+// chartVersion, or the zero time if none is declared
+func getEOLDate(upstreamYaml parse.UpstreamYaml, chartVersion string) (time.Time, error) {
+	if len(upstreamYaml.EOL) == 0 {
+		return time.Time{}, nil
+	}
+
+	semVer, err := semver.NewVersion(chartVersion)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	rawDate, ok := upstreamYaml.EOL[strconv.FormatUint(semVer.Major(), 10)]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	eolDate, err := time.Parse(eolDateLayout, rawDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid EOL date %q for major version %d: %w", rawDate, semVer.Major(), err)
+	}
+
+	return eolDate, nil
+}
+
+// Applies the annotations configured for packageWrapper to helmChart
+// without overriding annotations already present. Returns true if
+// helmChart was modified.
+func addAnnotations(packageWrapper PackageWrapper, helmChart *chart.Chart) (bool, error) {
+	kubeVersion := helmChart.Metadata.KubeVersion
+	annotations, err := getAnnotations(packageWrapper, helmChart)
+	if err != nil {
+		return false, err
+	}
+	modified := conform.ApplyChartAnnotations(helmChart, annotations, false)
+
+	return modified || kubeVersion != helmChart.Metadata.KubeVersion, nil
+}
+
+// Compares the appVersion of metadata, a new version of the package, to
+// that of the chart version before it among the stored versions and
+// the versions fetched alongside it. Returns a description of the
+// regression, or "" if there is none.
+func appVersionRegression(packageWrapper PackageWrapper, metadata *chart.Metadata) string {
+	currentVersion, err := semver.NewVersion(metadata.Version)
+	if err != nil {
+		return ""
+	}
+	// new repositories have no index to read stored versions from
+	candidates, _ := getStoredVersions(packageWrapper.Name)
+	candidates = append(candidates, packageWrapper.FetchVersions...)
+
+	var previous *repo.ChartVersion
+	var previousVersion *semver.Version
+	for _, candidate := range candidates {
+		candidateVersion, err := semver.NewVersion(conform.StripPackageVersion(candidate.Version))
+		if err != nil || !candidateVersion.LessThan(currentVersion) {
+			continue
+		}
+		if previousVersion == nil || candidateVersion.GreaterThan(previousVersion) {
+			previous, previousVersion = candidate, candidateVersion
+		}
+	}
+
+	return validate.AppVersionRegression(previous, &repo.ChartVersion{Metadata: metadata})
 }
 
 // Mutates chart with necessary alterations for repository. Only writes
-// the chart to disk if writeChart is true.
-func conformPackage(packageWrapper PackageWrapper, writeChart bool) error {
-	var err error
+// the chart to disk if writeChart is true, returning the paths written.
+// If packageWrapper.renderCheck is set, versions that fail the render
+// check are left out and returned with their failure, keyed by upstream
+// version; if every version fails, the package fails.
+func conformPackage(packageWrapper PackageWrapper, writeChart bool) (map[string]error, writtenPaths, error) {
+	written := writtenPaths{}
 	logrus.Debugf("Conforming package from %s\n", packageWrapper.Path)
+	configYaml, err := readConfig()
+	if err != nil {
+		return nil, written, fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+	}
+	rejected := make(map[string]error)
 	for _, chartVersion := range packageWrapper.FetchVersions {
 		logrus.Debugf("Conforming package %s (%s)\n", chartVersion.Name, chartVersion.Version)
-		helmChart, err := initializeChart(
+		started := time.Now()
+		helmChart, overlays, err := initializeChart(
 			packageWrapper.Path,
 			*packageWrapper.SourceMetadata,
 			*chartVersion,
 		)
 		if err != nil {
-			return err
+			return nil, written, err
+		}
+		// transformations are recorded in provenance attestations
+		transformations := make([]string, 0)
+		for _, overlay := range overlays {
+			transformations = append(transformations, "overlay "+overlay)
+		}
+		if packageWrapper.UpstreamYaml.NormalizeAPIVersion {
+			conform.ConvertToAPIVersionV2(helmChart)
+			transformations = append(transformations, "apiVersion normalized to v2")
+		}
+		if !packageWrapper.UpstreamYaml.RemoteDependencies {
+			for _, d := range helmChart.Metadata.Dependencies {
+				d.Repository = fmt.Sprintf("file://./charts/%s", d.Name)
+				transformations = append(transformations, fmt.Sprintf("dependency %s repository set to vendored chart", d.Name))
+			}
 		}
-		annotations := make(map[string]string)
 
-		if autoInstall := packageWrapper.UpstreamYaml.AutoInstall; autoInstall != "" {
-			annotations[annotationAutoInstall] = autoInstall
+		conform.OverlayChartMetadata(helmChart, packageWrapper.UpstreamYaml.ChartMetadata())
+		transformations = append(transformations, "ChartMetadata of upstream.yaml applied")
+
+		if regression := appVersionRegression(packageWrapper, helmChart.Metadata); regression != "" {
+			message := fmt.Sprintf("%s (%s): %s", helmChart.Name(), helmChart.Metadata.Version, regression)
+			logrus.Warn(message)
+			events.Warning(packageWrapper.packageName(), message)
 		}
 
-		if packageWrapper.UpstreamYaml.Experimental {
-			annotations[annotationExperimental] = "true"
+		if configYaml.EmbedIcons && !packageWrapper.UpstreamYaml.DisableIconOverride {
+			if embedded, err := icons.Embed(helmChart); err != nil {
+				message := fmt.Sprintf("%s (%s): not embedding icon: %s", helmChart.Name(), helmChart.Metadata.Version, err)
+				logrus.Warn(message)
+				events.Warning(packageWrapper.packageName(), message)
+			} else if embedded {
+				transformations = append(transformations, "icon embedded")
+			}
 		}
 
-		if packageWrapper.UpstreamYaml.Hidden {
-			annotations[annotationHidden] = "true"
+		annotations, err := getAnnotations(packageWrapper, helmChart)
+		if err != nil {
+			return nil, written, err
 		}
 
-		if !packageWrapper.UpstreamYaml.RemoteDependencies {
-			for _, d := range helmChart.Metadata.Dependencies {
-				d.Repository = fmt.Sprintf("file://./charts/%s", d.Name)
+		if packageVersion := packageWrapper.UpstreamYaml.PackageVersion; packageVersion != 0 {
+			helmChart.Metadata.Version, err = conform.GeneratePackageVersion(helmChart.Metadata.Version, &packageVersion, "")
+			if err != nil {
+				logrus.Error(err)
 			}
+			transformations = append(transformations, fmt.Sprintf("package version %d", packageVersion))
 		}
 
-		annotations[annotationCertified] = "partner"
-		annotations[annotationDisplayName] = packageWrapper.DisplayName
-		if packageWrapper.UpstreamYaml.ReleaseName != "" {
-			annotations[annotationReleaseName] = packageWrapper.UpstreamYaml.ReleaseName
-		} else {
-			annotations[annotationReleaseName] = packageWrapper.Name
+		var crdChart *chart.Chart
+		if packageWrapper.UpstreamYaml.SplitCRDs {
+			if packageWrapper.UpstreamYaml.AutoInstall != "" {
+				return nil, written, fmt.Errorf("SplitCRDs and AutoInstall are mutually exclusive")
+			}
+			crdChart = conform.SplitCRDChart(helmChart)
+			if crdChart != nil {
+				annotations[annotationAutoInstall] = fmt.Sprintf("%s=match", crdChart.Name())
+				crdAnnotations := map[string]string{
+					annotationCertified:   "partner",
+					annotationHidden:      "true",
+					annotationReleaseName: crdChart.Name(),
+				}
+				if namespace, ok := annotations[annotationNamespace]; ok {
+					crdAnnotations[annotationNamespace] = namespace
+				}
+				conform.ApplyChartAnnotations(crdChart, crdAnnotations, false)
+				transformations = append(transformations, "CRDs split into "+crdChart.Name())
+			}
 		}
 
-		conform.OverlayChartMetadata(helmChart, packageWrapper.UpstreamYaml.ChartYaml)
+		if packageWrapper.renderCheck {
+			if err := checkRender(helmChart, crdChart); err != nil {
+				message := fmt.Sprintf("%s (%s): version rejected: %s", helmChart.Name(), helmChart.Metadata.Version, err)
+				logrus.Warn(message)
+				events.Warning(packageWrapper.packageName(), message)
+				rejected[chartVersion.Version] = err
+				if cleanErr := cleanPackage(packageWrapper.Path); cleanErr != nil {
+					logrus.Debug(cleanErr)
+				}
+				continue
+			}
+		}
 
-		if val, ok := getByAnnotation(annotationFeatured, "")[packageWrapper.Name]; ok {
+		// the featured annotation only moves onto versions newer than the
+		// latest stored one, so that republishing an older version does
+		// not unfeature the latest
+		if val, ok := getByAnnotation(annotationFeatured, "")[packageWrapper.Name]; ok && isNewerThanLatestStored(packageWrapper, chartVersion.Version) {
 			logrus.Debugf("Migrating featured annotation to latest version %s\n", packageWrapper.Name)
 			featuredIndex := val[0].Annotations[annotationFeatured]
 			err := annotate(packageWrapper.ParsedVendor, packageWrapper.LatestStored.Name, annotationFeatured, "", true, false)
 			if err != nil {
-				return fmt.Errorf("failed to annotate package: %w", err)
+				return nil, written, fmt.Errorf("failed to annotate package: %w", err)
 			}
 			if err = writeIndex(); err != nil {
-				return fmt.Errorf("failed to write index: %w", err)
+				return nil, written, fmt.Errorf("failed to write index: %w", err)
 			}
 			annotations[annotationFeatured] = featuredIndex
 		}
 
-		if packageWrapper.UpstreamYaml.Namespace != "" {
-			annotations[annotationNamespace] = packageWrapper.UpstreamYaml.Namespace
+		upstreamAnnotations := make(map[string]string, len(helmChart.Metadata.Annotations))
+		for annotation, value := range helmChart.Metadata.Annotations {
+			upstreamAnnotations[annotation] = value
 		}
-		if helmChart.Metadata.KubeVersion != "" && packageWrapper.UpstreamYaml.ChartYaml.KubeVersion != "" {
-			annotations[annotationKubeVersion] = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
-			helmChart.Metadata.KubeVersion = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
-		} else if helmChart.Metadata.KubeVersion != "" {
-			annotations[annotationKubeVersion] = helmChart.Metadata.KubeVersion
-		} else if packageWrapper.UpstreamYaml.ChartYaml.KubeVersion != "" {
-			annotations[annotationKubeVersion] = packageWrapper.UpstreamYaml.ChartYaml.KubeVersion
-		}
-
-		if packageVersion := packageWrapper.UpstreamYaml.PackageVersion; packageVersion != 0 {
-			helmChart.Metadata.Version, err = conform.GeneratePackageVersion(helmChart.Metadata.Version, &packageVersion, "")
-			if err != nil {
-				logrus.Error(err)
+		conform.ApplyChartAnnotations(helmChart, annotations, packageWrapper.rebuild)
+		applied := appliedAnnotations(upstreamAnnotations, helmChart.Metadata.Annotations, annotations)
+		for _, annotation := range applied {
+			if annotation.Action != events.AnnotationKept {
+				transformations = append(transformations, fmt.Sprintf("annotation %s %s", annotation.Name, annotation.Action))
 			}
 		}
-
-		conform.ApplyChartAnnotations(helmChart, annotations, false)
+		events.Emit(events.Event{
+			Type:        events.TypeVersionConformed,
+			Package:     packageWrapper.packageName(),
+			Version:     helmChart.Metadata.Version,
+			Annotations: applied,
+			Overlays:    overlays,
+		})
 
 		if writeChart {
 			err = cleanPackage(packageWrapper.Path)
@@ -722,53 +1473,207 @@ func conformPackage(packageWrapper PackageWrapper, writeChart bool) error {
 				logrus.Debug(err)
 			}
 
-			assetsPath := filepath.Join(
-				getRepoRoot(),
-				repositoryAssetsDir,
-				packageWrapper.ParsedVendor)
-
 			chartsPath := filepath.Join(
 				getRepoRoot(),
 				repositoryChartsDir,
 				packageWrapper.ParsedVendor,
 				helmChart.Metadata.Name)
 
-			if _, err := os.Stat(chartsPath); !os.IsNotExist(err) {
-				os.RemoveAll(chartsPath)
+			archive, err := saveChart(helmChart, packageWrapper.ParsedVendor, chartsPath)
+			if err != nil {
+				return nil, written, err
+			}
+			written.add(archive, chartsPath)
+
+			if crdChart != nil {
+				crdChartsPath := filepath.Join(
+					getRepoRoot(),
+					repositoryChartsDir,
+					packageWrapper.ParsedVendor,
+					crdChart.Name())
+
+				archive, err := saveChart(crdChart, packageWrapper.ParsedVendor, crdChartsPath)
+				if err != nil {
+					return nil, written, err
+				}
+				written.add(archive, crdChartsPath)
 			}
 
-			err = saveChart(helmChart, assetsPath, chartsPath)
-			if err != nil {
-				return err
+			if configYaml.Provenance && archiveStorage().Local() {
+				for _, builtChart := range []*chart.Chart{helmChart, crdChart} {
+					if builtChart == nil {
+						continue
+					}
+					if err := writeProvenance(packageWrapper, chartVersion, builtChart, transformations, started); err != nil {
+						return nil, written, fmt.Errorf("failed to write provenance of %s (%s): %w", builtChart.Name(), builtChart.Metadata.Version, err)
+					}
+				}
 			}
 		}
 
 	}
+	if len(rejected) > 0 && len(rejected) == len(packageWrapper.FetchVersions) {
+		errs := make([]error, 0, len(rejected))
+		for _, chartVersion := range newestFirst(packageWrapper.FetchVersions) {
+			errs = append(errs, rejected[chartVersion.Version])
+		}
+		return rejected, written, errors.Join(errs...)
+	}
 
-	return err
+	return rejected, written, err
+}
+
+// The chart archives and directories written by conformPackage. Paths
+// are relative to the repository root; archives not kept in the assets
+// directory are given by URL.
+type writtenPaths struct {
+	archives []string
+	charts   []string
 }
 
-// Saves chart to disk as asset gzip and directory
-func saveChart(helmChart *chart.Chart, assetsPath, chartsPath string) error {
+// Records an archive and the chart directory at the absolute chartsPath
+func (w *writtenPaths) add(archive, chartsPath string) {
+	w.archives = append(w.archives, archive)
+	chartsPath = strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(chartsPath, getRepoRoot())), "/")
+	for _, written := range w.charts {
+		if written == chartsPath {
+			return
+		}
+	}
+	w.charts = append(w.charts, chartsPath)
+}
 
-	logrus.Debugf("Exporting chart assets to %s\n", assetsPath)
-	assetFile, err := chartutil.Save(helmChart, assetsPath)
+// Returns true if upstreamVersion is at least the upstream version of
+// the latest stored version of packageWrapper, or nothing is stored
+func isNewerThanLatestStored(packageWrapper PackageWrapper, upstreamVersion string) bool {
+	if packageWrapper.LatestStored.Version == "" {
+		return true
+	}
+	latest, err := semver.NewVersion(conform.StripPackageVersion(packageWrapper.LatestStored.Version))
 	if err != nil {
-		return fmt.Errorf("failed to save chart %q version %q: %w", helmChart.Name(), helmChart.Metadata.Version, err)
+		return true
 	}
+	semVer, err := semver.NewVersion(upstreamVersion)
+	if err != nil {
+		return true
+	}
+
+	return !semVer.LessThan(latest)
+}
 
-	err = conform.Gunzip(assetFile, chartsPath)
+// Writes the provenance attestation of the stored archive of
+// builtChart, which was conformed from chartVersion of the upstream of
+// packageWrapper by transformations
+func writeProvenance(packageWrapper PackageWrapper, chartVersion *repo.ChartVersion, builtChart *chart.Chart, transformations []string, started time.Time) error {
+	archivePath := filepath.Join(getRepoRoot(), repositoryAssetsDir, packageWrapper.ParsedVendor, fmt.Sprintf("%s-%s.tgz", builtChart.Name(), builtChart.Metadata.Version))
+	upstreamURL := ""
+	if len(chartVersion.URLs) > 0 {
+		upstreamURL = redact.URL(chartVersion.URLs[0])
+	}
+	invocationID := ""
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		invocationID = fmt.Sprintf("%s/%s/actions/runs/%s", os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), runID)
+	}
+
+	attestationPath, err := attest.Write(archivePath, attest.Provenance{
+		Package:         packageWrapper.packageName(),
+		Source:          packageWrapper.SourceMetadata.Source,
+		UpstreamURL:     upstreamURL,
+		UpstreamVersion: chartVersion.Version,
+		UpstreamCommit:  packageWrapper.SourceMetadata.Commit,
+		UpstreamDigest:  chartVersion.Digest,
+		Transformations: transformations,
+		ToolVersion:     fmt.Sprintf("%s (%s)", version, commit),
+		InvocationID:    invocationID,
+		StartedOn:       started,
+		FinishedOn:      time.Now(),
+	})
 	if err != nil {
-		logrus.Error(err)
+		return err
+	}
+	logrus.Debugf("Wrote provenance to %s\n", attestationPath)
+
+	return nil
+}
+
+// Lints and renders helmChart and its CRD chart, if any, before they
+// are written to the repository, so that versions that can not be
+// installed are rejected
+func checkRender(helmChart, crdChart *chart.Chart) error {
+	for _, c := range []*chart.Chart{helmChart, crdChart} {
+		if c == nil {
+			continue
+		}
+		if err := rendercheck.Check(c); err != nil {
+			return fmt.Errorf("%s (%s) failed the render check: %w", c.Name(), c.Metadata.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns how each of the configured annotations was applied to a chart
+// whose annotations were upstream before and applied after conforming,
+// sorted by name
+func appliedAnnotations(upstream, applied, configured map[string]string) []events.Annotation {
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]events.Annotation, 0, len(names))
+	for _, name := range names {
+		previous, ok := upstream[name]
+		value := applied[name]
+		action := events.AnnotationAdded
+		switch {
+		case ok && previous == value && value != configured[name]:
+			action = events.AnnotationKept
+		case ok && previous == value:
+			continue
+		case ok:
+			action = events.AnnotationOverridden
+		}
+		result = append(result, events.Annotation{Name: name, Action: action, Previous: previous, Value: value})
+	}
+
+	return result
+}
+
+// Saves the archive of helmChart with the storage backend and returns
+// its path relative to the repository root, or its URL if it is not
+// kept in the assets directory. Such archives are added to the index by
+// the next writeIndex.
+func saveChartArchive(helmChart *chart.Chart, vendor string) (string, error) {
+	chartVersion, err := archiveStorage().Save(helmChart, vendor)
+	if err != nil {
+		return "", fmt.Errorf("failed to save chart %q version %q: %w", helmChart.Name(), helmChart.Metadata.Version, err)
+	}
+	if !archiveStorage().Local() {
+		savedChartVersions = append(savedChartVersions, chartVersion)
+	}
+
+	return chartVersion.URLs[0], nil
+}
+
+// Saves chart with the storage backend and to disk as a directory, and
+// returns the path or URL of its archive
+func saveChart(helmChart *chart.Chart, vendor, chartsPath string) (string, error) {
+
+	logrus.Debugf("Exporting chart assets of %s\n", vendor)
+	archive, err := saveChartArchive(helmChart, vendor)
+	if err != nil {
+		return "", err
 	}
 
 	logrus.Debugf("Exporting chart to %s\n", chartsPath)
 	err = conform.ExportChartDirectory(helmChart, chartsPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return archive, nil
 }
 
 func getLatestTracked(tracked []string) *semver.Version {
@@ -817,44 +1722,65 @@ func getLatestStoredVersion(chartName string) (repo.ChartVersion, error) {
 // the specified annotation with the specified value. If value is "",
 // all repo.ChartVersions that have the specified annotation will be
 // returned, regardless of that annotation's value.
+//
+// The query is answered from the view of index.yaml cached for the
+// process, so the returned versions must not be modified.
 func getByAnnotation(annotation, value string) map[string]repo.ChartVersions {
-	indexYaml, err := readIndex()
+	indexView, err := indexcache.Load(filepath.Join(getRepoRoot(), indexFile))
 	if err != nil {
 		logrus.Fatalf("failed to read index.yaml: %s", err)
 	}
-	matchedVersions := make(map[string]repo.ChartVersions)
 
-	for chartName, entries := range indexYaml.Entries {
-		for _, version := range entries {
-			appendVersion := false
-			if _, ok := version.Annotations[annotation]; ok {
-				if value != "" {
-					if version.Annotations[annotation] == value {
-						appendVersion = true
-					}
-				} else {
-					appendVersion = true
-				}
-			}
-			if appendVersion {
-				if _, ok := matchedVersions[chartName]; !ok {
-					matchedVersions[chartName] = repo.ChartVersions{version}
-				} else {
-					matchedVersions[chartName] = append(matchedVersions[chartName], version)
-				}
-			}
-		}
+	return indexView.WithAnnotation(annotation, value)
+}
+
+// Replaces the entry of chartVersion in indexYaml, keeping its created
+// timestamp, and reports whether one existed. Archives re-saved to a
+// remote storage backend would otherwise keep a stale digest, as
+// merging does not update existing versions.
+func replaceIndexEntry(indexYaml *repo.IndexFile, chartVersion *repo.ChartVersion) bool {
+	for i, entry := range indexYaml.Entries[chartVersion.Name] {
+		if entry.Version == chartVersion.Version {
+			chartVersion.Created = entry.Created
+			indexYaml.Entries[chartVersion.Name][i] = chartVersion
+			return true
+		}
 	}
 
-	return matchedVersions
+	return false
 }
 
+// Removes version of chartName from the index. Within batchIndexWrites
+// the removal is deferred to the write that ends the batch, so that the
+// index stays complete for the packages processed in the meantime.
 func removeVersionFromIndex(chartName string, version repo.ChartVersion) error {
-	entryIndex := -1
 	indexYaml, err := readIndex()
 	if err != nil {
 		return err
 	}
+	if err := removeIndexEntry(indexYaml, chartName, version.Version); err != nil {
+		return err
+	}
+	if indexBatchDepth > 0 {
+		removal := [2]string{chartName, version.Version}
+		for _, pending := range pendingIndexRemovals {
+			if pending == removal {
+				return nil
+			}
+		}
+		pendingIndexRemovals = append(pendingIndexRemovals, removal)
+		return nil
+	}
+
+	indexFilePath := filepath.Join(getRepoRoot(), indexFile)
+	err = indexYaml.WriteFile(indexFilePath, 0644)
+	indexcache.Invalidate()
+
+	return err
+}
+
+func removeIndexEntry(indexYaml *repo.IndexFile, chartName, version string) error {
+	entryIndex := -1
 	if _, ok := indexYaml.Entries[chartName]; !ok {
 		return fmt.Errorf("%s not present in index entries", chartName)
 	}
@@ -862,7 +1788,7 @@ func removeVersionFromIndex(chartName string, version repo.ChartVersion) error {
 	indexEntries := indexYaml.Entries[chartName]
 
 	for i, entryVersion := range indexEntries {
-		if entryVersion.Version == version.Version {
+		if entryVersion.Version == version {
 			entryIndex = i
 			break
 		}
@@ -874,13 +1800,57 @@ func removeVersionFromIndex(chartName string, version repo.ChartVersion) error {
 		entries = append(entries, indexEntries[entryIndex+1:]...)
 		indexYaml.Entries[chartName] = entries
 	} else {
-		return fmt.Errorf("version %s not found for chart %s in index", version.Version, chartName)
+		return fmt.Errorf("version %s not found for chart %s in index", version, chartName)
 	}
 
-	indexFilePath := filepath.Join(getRepoRoot(), indexFile)
-	err = indexYaml.WriteFile(indexFilePath, 0644)
+	return nil
+}
 
-	return err
+// Reads configuration.yaml, returning an empty configuration if the
+// file does not exist
+func readConfig() (validate.ConfigurationYaml, error) {
+	configYaml, err := validate.ReadConfig(filepath.Join(getRepoRoot(), configOptionsFile))
+	if os.IsNotExist(err) {
+		return validate.ConfigurationYaml{}, nil
+	}
+
+	return configYaml, err
+}
+
+// Applies the upstream rate limits, dialer and read-through mirror of
+// configuration.yaml to all upstream requests, and the environment
+// variables and aws-sigv4 hosts that upstream.yaml may use
+func applyConfiguration(c *cli.Context) error {
+	configYaml, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+	}
+	ratelimit.Configure(configYaml.RateLimits)
+	parse.ConfigureEnv(configYaml.UpstreamEnvVariables)
+	fetcher.ConfigureSigV4Hosts(configYaml.AWSSigV4Hosts)
+	if err := dialer.Configure(configYaml.Dialer); err != nil {
+		return fmt.Errorf("failed to configure dialer: %w", err)
+	}
+	fetcher.ConfigureMirror(configYaml.ReadThroughMirror)
+
+	return nil
+}
+
+// Returns the storage backend for chart archives. It is configured
+// from configuration.yaml when first used, so that commands that do not
+// read or write archives do not depend on the storage configuration.
+func archiveStorage() storage.Backend {
+	storageConfigured.Do(func() {
+		configYaml, err := readConfig()
+		if err != nil {
+			logrus.Fatalf("failed to read %s: %s", configOptionsFile, err)
+		}
+		if err := storage.Configure(configYaml.Storage, filepath.Join(getRepoRoot(), repositoryAssetsDir), repositoryAssetsDir); err != nil {
+			logrus.Fatalf("failed to configure storage: %s", err)
+		}
+	})
+
+	return storage.Default()
 }
 
 // Reads in current index yaml
@@ -890,8 +1860,14 @@ func readIndex() (*repo.IndexFile, error) {
 	return helmIndexYaml, err
 }
 
-// Writes out modified index file
+// Writes out modified index file. Within batchIndexWrites the write is
+// deferred until the batch ends.
 func writeIndex() error {
+	if indexBatchDepth > 0 {
+		indexWritePending = true
+		return nil
+	}
+
 	indexFilePath := filepath.Join(getRepoRoot(), indexFile)
 	if _, err := os.Stat(indexFilePath); os.IsNotExist(err) {
 		err = repo.NewIndexFile().WriteFile(indexFilePath, 0644)
@@ -904,19 +1880,257 @@ func writeIndex() error {
 	if err != nil {
 		return err
 	}
+	for _, removal := range pendingIndexRemovals {
+		if err := removeIndexEntry(helmIndexYaml, removal[0], removal[1]); err != nil {
+			return err
+		}
+	}
+	pendingIndexRemovals = nil
 
-	assetsDirectoryPath := filepath.Join(getRepoRoot(), repositoryAssetsDir)
-	newHelmIndexYaml, err := repo.IndexDirectory(assetsDirectoryPath, repositoryAssetsDir)
-	if err != nil {
-		return err
+	newHelmIndexYaml := repo.NewIndexFile()
+	if archiveStorage().Local() {
+		newHelmIndexYaml, _, err = indexAssets()
+		if err != nil {
+			return err
+		}
+		configYaml, err := readConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+		}
+		if configYaml.BackfillCreated {
+			if err := backfillCreated(helmIndexYaml, newHelmIndexYaml); err != nil {
+				return fmt.Errorf("failed to backfill created timestamps: %w", err)
+			}
+		}
+	} else {
+		for _, chartVersion := range savedChartVersions {
+			if replaceIndexEntry(helmIndexYaml, chartVersion) {
+				continue
+			}
+			newHelmIndexYaml.Entries[chartVersion.Name] = append(newHelmIndexYaml.Entries[chartVersion.Name], chartVersion)
+		}
 	}
 	helmIndexYaml.Merge(newHelmIndexYaml)
 	helmIndexYaml.SortEntries()
 
 	err = helmIndexYaml.WriteFile(indexFilePath, 0644)
+	indexcache.Invalidate()
+	if err != nil {
+		return err
+	}
+	savedChartVersions = nil
+
+	return writeChecksums(helmIndexYaml)
+}
+
+// Indexes the chart archives of the assets directory. Archives that can
+// not be indexed, such as corrupted ones, are logged and left out of
+// the returned index, so that one bad asset does not block every
+// command, unless --strict-index is set.
+func indexAssets() (*repo.IndexFile, []assetindex.Skipped, error) {
+	assetsDirectoryPath := filepath.Join(getRepoRoot(), repositoryAssetsDir)
+	index, skipped, err := assetindex.Directory(assetsDirectoryPath, repositoryAssetsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(skipped) == 0 {
+		return index, skipped, nil
+	}
+	if strictIndex {
+		errs := make([]error, 0, len(skipped))
+		for _, s := range skipped {
+			errs = append(errs, s)
+		}
+		return nil, nil, fmt.Errorf("failed to index %d assets: %w", len(skipped), errors.Join(errs...))
+	}
+	for _, s := range skipped {
+		logrus.Errorf("Leaving unreadable asset out of the index: %s", s)
+	}
+
+	return index, skipped, nil
+}
+
+// Writes the SHA256SUMS manifests of the archives in indexYaml if
+// checksums is set in configuration.yaml. Archives kept by a remote
+// storage backend are not in the assets directory, so have none.
+func writeChecksums(indexYaml *repo.IndexFile) error {
+	configYaml, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+	}
+	if configYaml.Checksums == "" || !archiveStorage().Local() {
+		return nil
+	}
+	if err := checksums.Write(getRepoRoot(), repositoryAssetsDir, indexYaml, configYaml.Checksums); err != nil {
+		return fmt.Errorf("failed to write %s: %w", checksums.File, err)
+	}
+
+	return nil
+}
+
+// Runs fn with index writes deferred, so that operations over several
+// packages regenerate index.yaml once, when the outermost batch ends.
+// The index is written even if fn fails, so that the packages changed
+// before the failure are indexed. If that write fails, the changes
+// that updateAnnotations made during the batch are rolled back.
+func batchIndexWrites(fn func() error) error {
+	if indexBatchDepth == 0 {
+		indexBatchTx = transaction.New()
+		if err := indexBatchTx.Track(filepath.Join(getRepoRoot(), indexFile)); err != nil {
+			indexBatchTx = nil
+			return err
+		}
+		defer func() {
+			indexBatchTx = nil
+		}()
+	}
+	indexBatchDepth++
+	err := fn()
+	indexBatchDepth--
+	if indexBatchDepth > 0 {
+		return err
+	}
+	if !indexWritePending {
+		indexBatchTx.Commit()
+		return err
+	}
+
+	indexWritePending = false
+	if writeErr := writeIndex(); writeErr != nil {
+		writeErr = fmt.Errorf("failed to write index: %w", writeErr)
+		if rollbackErr := indexBatchTx.Rollback(); rollbackErr != nil {
+			writeErr = errors.Join(writeErr, rollbackErr)
+		}
+		return errors.Join(err, writeErr)
+	}
+	indexBatchTx.Commit()
+
+	return err
+}
+
+// Regenerates index.yaml from the archives in the assets directory,
+// unlike writeIndex, which only adds versions to the index. Entries
+// without an archive are dropped and the digests of the others are
+// refreshed, while versions already indexed keep their created
+// timestamp. Returns the added, removed and refreshed versions.
+func rebuildIndex() ([]string, []string, []string, error) {
+	newHelmIndexYaml, added, removed, refreshed, err := regenerateIndex()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	indexFilePath := filepath.Join(getRepoRoot(), indexFile)
+	err = newHelmIndexYaml.WriteFile(indexFilePath, 0644)
+	indexcache.Invalidate()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeChecksums(newHelmIndexYaml); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return added, removed, refreshed, nil
+}
+
+// Builds the index that rebuildIndex writes, without writing it.
+// Returns the index with the versions it adds to, removes from and
+// refreshes the digest of in the current index.yaml.
+func regenerateIndex() (*repo.IndexFile, []string, []string, []string, error) {
+	if !archiveStorage().Local() {
+		return nil, nil, nil, nil, errors.New("the index can only be rebuilt from the filesystem storage backend")
+	}
+	indexFilePath := filepath.Join(getRepoRoot(), indexFile)
+	helmIndexYaml := repo.NewIndexFile()
+	if _, err := os.Stat(indexFilePath); err == nil {
+		helmIndexYaml, err = repo.LoadIndexFile(indexFilePath)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	newHelmIndexYaml, skipped, err := indexAssets()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	// versions whose archive can not be indexed keep their entry
+	skippedURLs := assetindex.URLs(skipped)
+	for chartName, chartVersions := range helmIndexYaml.Entries {
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) == 0 {
+				continue
+			}
+			if _, ok := skippedURLs[chartVersion.URLs[0]]; ok && !newHelmIndexYaml.Has(chartName, chartVersion.Version) {
+				newHelmIndexYaml.Entries[chartName] = append(newHelmIndexYaml.Entries[chartName], chartVersion)
+			}
+		}
+	}
+	configYaml, err := readConfig()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+	}
+	if configYaml.BackfillCreated {
+		if err := backfillCreated(helmIndexYaml, newHelmIndexYaml); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to backfill created timestamps: %w", err)
+		}
+	}
+
+	added := make([]string, 0)
+	refreshed := make([]string, 0)
+	for chartName, chartVersions := range newHelmIndexYaml.Entries {
+		for _, chartVersion := range chartVersions {
+			if indexed, err := helmIndexYaml.Get(chartName, chartVersion.Version); err == nil {
+				chartVersion.Created = indexed.Created
+				if chartVersion.Digest != indexed.Digest {
+					refreshed = append(refreshed, fmt.Sprintf("%s %s", chartName, chartVersion.Version))
+				}
+				continue
+			}
+			added = append(added, fmt.Sprintf("%s %s", chartName, chartVersion.Version))
+		}
+	}
+	removed := make([]string, 0)
+	for chartName, chartVersions := range helmIndexYaml.Entries {
+		for _, chartVersion := range chartVersions {
+			if !newHelmIndexYaml.Has(chartName, chartVersion.Version) {
+				removed = append(removed, fmt.Sprintf("%s %s", chartName, chartVersion.Version))
+			}
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(refreshed)
+	newHelmIndexYaml.SortEntries()
+
+	return newHelmIndexYaml, added, removed, refreshed, nil
+}
+
+// Sets the created timestamp of each version in newIndex that is not
+// yet in index to the time of the commit that introduced its archive,
+// so that regenerating the index does not reset the timestamps of
+// released versions. Archives that were never committed keep the
+// current time.
+func backfillCreated(index, newIndex *repo.IndexFile) error {
+	missing := make(repo.ChartVersions, 0)
+	for chartName, chartVersions := range newIndex.Entries {
+		for _, chartVersion := range chartVersions {
+			if !index.Has(chartName, chartVersion.Version) && len(chartVersion.URLs) > 0 {
+				missing = append(missing, chartVersion)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	introduced, err := validate.AssetIntroductionTimes(getRepoRoot(), repositoryAssetsDir)
 	if err != nil {
 		return err
 	}
+	for _, chartVersion := range missing {
+		if created, ok := introduced[chartVersion.URLs[0]]; ok {
+			logrus.Debugf("Backfilled created timestamp of %s (%s) from git history\n", chartVersion.Name, chartVersion.Version)
+			chartVersion.Created = created
+		}
+	}
 
 	return nil
 }
@@ -951,35 +2165,146 @@ func generatePackageList(currentPackage string) PackageList {
 // Populates list of package wrappers, handles manual and automatic variation
 // If print, function will print information during processing
 func populatePackages(currentPackage string, onlyUpdates bool, onlyLatest bool, print bool) (PackageList, error) {
+	packageList, _, err := populatePackagesWithFailures(currentPackage, onlyUpdates, onlyLatest, print, progress.Discard{})
+	return packageList, err
+}
+
+// Same as populatePackages, but also returns the packages that could not
+// be populated, keyed by their <vendor>/<chart> path. Packages that fail
+// or have no updates are reported done to reporter.
+func populatePackagesWithFailures(currentPackage string, onlyUpdates bool, onlyLatest bool, print bool, reporter progress.Reporter) (PackageList, map[string]error, error) {
 	packageList := make(PackageList, 0)
-	for _, packageWrapper := range generatePackageList(currentPackage) {
+	failures := make(map[string]error)
+	populatedList := generatePackageList(currentPackage)
+	updatedList := make([]bool, len(populatedList))
+	errs := make([]error, len(populatedList))
+	// upstreams are fetched concurrently, and the results handled in
+	// order
+	forEachConcurrently(len(populatedList), func(i int) {
+		packageWrapper := &populatedList[i]
 		logrus.Debugf("Populating package from %s\n", packageWrapper.Path)
-		updated, err := packageWrapper.populate(onlyLatest)
+		reporter.Phase(packageWrapper.packageName(), "fetching upstream")
+		events.Emit(events.Event{Type: events.TypePackageStarted, Package: packageWrapper.packageName()})
+		// the resolution lists the skipped versions in the update report
+		packageWrapper.resolution = &versionResolution{Package: packageWrapper.packageName()}
+		checkStarted := time.Now()
+		updatedList[i], errs[i] = packageWrapper.populate(onlyLatest)
+		packageWrapper.checkDuration = time.Since(checkStarted)
+	})
+	for i, packageWrapper := range populatedList {
+		updated, err := updatedList[i], errs[i]
 		if err != nil {
 			logrus.Error(err)
+			failures[packageWrapper.packageName()] = err
+			events.Failed(packageWrapper.packageName(), err)
+			reporter.Done(packageWrapper.packageName(), err)
 			continue
 		}
+		for _, version := range packageWrapper.FetchVersions {
+			events.Emit(events.Event{
+				Type:       events.TypeVersionFetched,
+				Package:    packageWrapper.packageName(),
+				Version:    version.Version,
+				Source:     packageWrapper.SourceMetadata.Source,
+				Repository: packageWrapper.SourceMetadata.Mirror,
+			})
+		}
 		if print {
 			logrus.Infof("Parsed %s/%s\n", packageWrapper.ParsedVendor, packageWrapper.Name)
 			if len(packageWrapper.FetchVersions) == 0 {
 				logrus.Infof("%s (%s) is up-to-date\n",
 					packageWrapper.Vendor, packageWrapper.Name)
 			}
+			if packageWrapper.SourceMetadata.Mirror != "" {
+				logrus.Infof("%s/%s served by %s\n", packageWrapper.ParsedVendor, packageWrapper.Name, redact.URL(packageWrapper.SourceMetadata.Mirror))
+			}
 			for _, version := range packageWrapper.FetchVersions {
 				logrus.Infof("\n  Source: %s\n  Vendor: %s\n  Chart: %s\n  Version: %s\n  URL: %s  \n",
 					packageWrapper.SourceMetadata.Source, packageWrapper.Vendor, packageWrapper.Name,
-					version.Version, version.URLs[0])
+					version.Version, redact.URL(version.URLs[0]))
 			}
 		}
 
-		if onlyUpdates && !updated {
-			continue
+		if !updated {
+			reporter.Done(packageWrapper.packageName(), nil)
+			if onlyUpdates {
+				continue
+			}
 		}
 
 		packageList = append(packageList, packageWrapper)
 	}
 
-	return packageList, nil
+	return packageList, failures, nil
+}
+
+// Calls fn with every index below n, in up to concurrency goroutines at
+// once, and returns once all calls have returned
+func forEachConcurrently(n int, fn func(i int)) {
+	if concurrency <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency && worker < n; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// Downloads the new versions of the packages of packageList, in order
+// and up to concurrency packages at once, so that integrating them,
+// which writes to the repository one package at a time, reuses the
+// downloads. Returns a function that waits until the versions of the
+// package at an index are downloaded, and one that skips the downloads
+// of the packages not started yet. Failed downloads are left to the
+// integration of their package to retry and report.
+func prefetchCharts(packageList PackageList) (wait func(i int), stop func()) {
+	if concurrency <= 1 {
+		return func(int) {}, func() {}
+	}
+
+	done := make([]chan struct{}, len(packageList))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	var stopped atomic.Bool
+	go forEachConcurrently(len(packageList), func(i int) {
+		defer close(done[i])
+		if stopped.Load() {
+			return
+		}
+		packageWrapper := packageList[i]
+		for _, chartVersion := range packageWrapper.FetchVersions {
+			if err := fetcher.Prefetch(*packageWrapper.SourceMetadata, chartVersion); err != nil {
+				logrus.Debugf("Failed to download %s (%s) ahead of integrating it: %s\n", packageWrapper.Name, chartVersion.Version, err)
+			}
+		}
+	})
+
+	return func(i int) { <-done[i] }, func() { stopped.Store(true) }
+}
+
+// Applies --concurrency
+func setConcurrency(c *cli.Context) {
+	concurrency = c.Int("concurrency")
+	if concurrency < 1 {
+		logrus.Fatal("--concurrency must be at least 1")
+	}
 }
 
 // downloadIcons should only be used in a local machine by manual execution.
@@ -1007,6 +2332,8 @@ func downloadIcons(c *cli.Context) {
 	// Download all icons or retrieve the ones already downloaded
 	downloadedIcons := icons.DownloadFiles(entriesPathsAndIconsMap)
 
+	evictCache()
+
 	logrus.Infof("Finished downloading and saving icon files")
 	logrus.Infof("Downloaded %d icons", len(downloadedIcons))
 }
@@ -1047,6 +2374,10 @@ func overrideIcons() {
 func parsePackageListToPackageIconList(packageList PackageList) icons.PackageIconList {
 	var packageIconList icons.PackageIconList
 	for _, pkg := range packageList {
+		if pkg.UpstreamYaml != nil && pkg.UpstreamYaml.DisableIconOverride {
+			logrus.Infof("Icon override disabled for %s\n", pkg.packageName())
+			continue
+		}
 
 		// check conditions for icon override and avoid panics
 		iconURL := icons.CheckForDownloadedIcon(pkg.Name)
@@ -1072,17 +2403,26 @@ func overwriteIndexIconsAndTestChanges(packageIconList icons.PackageIconList) er
 	if err != nil {
 		return err
 	}
-	assetsDirectoryPath := filepath.Join(getRepoRoot(), repositoryAssetsDir)
-	newHelmIndexYaml, err := repo.IndexDirectory(assetsDirectoryPath, repositoryAssetsDir)
+	newHelmIndexYaml, _, err := indexAssets()
 	if err != nil {
 		return err
 	}
+	configYaml, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+	}
+	if configYaml.BackfillCreated {
+		if err := backfillCreated(helmIndexYaml, newHelmIndexYaml); err != nil {
+			return fmt.Errorf("failed to backfill created timestamps: %w", err)
+		}
+	}
 	helmIndexYaml.Merge(newHelmIndexYaml)
 	helmIndexYaml.SortEntries()
 
 	icons.OverrideIconValues(helmIndexYaml, packageIconList)
 
 	err = helmIndexYaml.WriteFile(indexFilePath, 0644)
+	indexcache.Invalidate()
 	if err != nil {
 		return err
 	}
@@ -1097,29 +2437,169 @@ func overwriteIndexIconsAndTestChanges(packageIconList icons.PackageIconList) er
 // the charts to be modified depends on the populatePackages function and their update status
 // the changes will be applied on fetchUpstreams function
 func generateChanges(auto bool, stage bool) {
+	defer evictCache()
 	currentPackage := os.Getenv(packageEnvVariable)
-	var packageList PackageList
+	var packageList, populatedList PackageList
+	var failures map[string]error
 	var err error
+	started := time.Now()
+	checked := len(generatePackageList(currentPackage))
+	reporter := progress.New("update")
+	reporter.Start(checked)
 	if auto || stage {
-		packageList, err = populatePackages(currentPackage, true, false, true)
+		// packages without updates are kept for the update report
+		populatedList, failures, err = populatePackagesWithFailures(currentPackage, false, false, true, reporter)
+		for _, packageWrapper := range populatedList {
+			if len(packageWrapper.FetchVersions) > 0 {
+				packageList = append(packageList, packageWrapper)
+			}
+		}
 	} else {
-		packageList, err = populatePackages(currentPackage, false, true, true)
+		packageList, failures, err = populatePackagesWithFailures(currentPackage, false, true, true, reporter)
 	}
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	if len(packageList) == 0 {
-		return
+	runCommand := "stage"
+	if auto {
+		runCommand = "auto"
+	}
+	updateReport := newUpdateReport(runCommand, started, populatedList)
+	deferredList := make([]string, 0)
+	rejectedVersions := make(map[string]map[string]error)
+	integrationDurations := make(map[string]time.Duration)
+	if updateReportPath != "" && (auto || stage) {
+		var reportOnce sync.Once
+		writeReport := func() {
+			reportOnce.Do(func() {
+				completeUpdateReport(&updateReport, failures, deferredList, rejectedVersions, integrationDurations)
+				if err := report.Write(updateReportPath, updateReport); err != nil {
+					logrus.Error(err)
+				} else {
+					logrus.Infof("Wrote update report to %s\n", updateReportPath)
+				}
+			})
+		}
+		// logrus.Fatal exits without running deferred functions
+		logrus.RegisterExitHandler(writeReport)
+		defer writeReport()
+	}
+
+	configYaml, err := readConfig()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	hookOptions := configYaml.Hooks
+	if !auto && !stage {
+		hookOptions = hooks.Options{}
+	}
+	var dryRunSandbox *sandbox.Sandbox
+	if dryRun {
+		hookOptions = hooks.Options{}
+		dryRunSandbox, err = enterSandbox(packageList, configYaml)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 	}
 
 	skippedList := make([]string, 0)
-	for _, packageWrapper := range packageList {
-		if err := conformPackage(packageWrapper, auto || stage); err != nil {
+	integratedList := make(PackageList, 0, len(packageList))
+	capExceeded := ""
+	runSummary := summary.Summary{Command: runCommand, Checked: checked, Failed: failures}
+	if dryRun {
+		defer func() {
+			runSummary.Deferred = deferredList
+			if err := leaveSandbox(dryRunSandbox, configYaml, runSummary); err != nil {
+				logrus.Error(err)
+			}
+		}()
+	} else if auto || stage {
+		defer func() {
+			runSummary.Deferred = deferredList
+			runSummary.DeferReason = capExceeded
+			runSummary.Duration = time.Since(started)
+			if err := summary.Write(runSummary); err != nil {
+				logrus.Error(err)
+			}
+		}()
+	}
+	// new versions are downloaded ahead of the integration, which
+	// writes to the repository one package at a time
+	waitForDownloads, stopDownloads := prefetchCharts(packageList)
+	defer stopDownloads()
+	for i, packageWrapper := range packageList {
+		if len(packageWrapper.FetchVersions) == 0 {
+			continue
+		}
+		if capExceeded == "" {
+			capExceeded = resourceCapExceeded()
+		}
+		if capExceeded != "" {
+			stopDownloads()
+			deferredList = append(deferredList, packageWrapper.packageName())
+			events.Warning(packageWrapper.packageName(), "deferred to the next run: "+capExceeded)
+			reporter.Done(packageWrapper.packageName(), nil)
+			continue
+		}
+		integrationStarted := time.Now()
+		waitForDownloads(i)
+		err := checkMaxVersions(packageWrapper, configYaml)
+		if err == nil {
+			var rejected map[string]error
+			rejected, err = integratePackage(packageWrapper, auto || stage, hookOptions, reporter)
+			// versions that failed the render check are left out of the
+			// commit and the summaries
+			if err == nil && len(rejected) > 0 {
+				rejectedVersions[packageWrapper.packageName()] = rejected
+				packageWrapper.FetchVersions = withoutRejected(packageWrapper.FetchVersions, rejected)
+				packageList[i] = packageWrapper
+				for version, rejectedErr := range rejected {
+					runSummary.Rejected = append(runSummary.Rejected, summary.Rejected{
+						Package: packageWrapper.packageName(),
+						Version: version,
+						Err:     rejectedErr,
+					})
+				}
+			}
+		}
+		integratedList = append(integratedList, packageWrapper)
+		integrationDurations[packageWrapper.packageName()] = time.Since(integrationStarted)
+		if err == nil {
+			runSummary.Updated = append(runSummary.Updated, summaryPackage(packageWrapper, time.Since(integrationStarted)))
+		}
+		if isHookError(err) && !errors.Is(err, hooks.ErrSkipPackage) {
+			logrus.Fatal(err)
+		}
+		if err != nil {
 			logrus.Error(err)
 			skippedList = append(skippedList, packageWrapper.Name)
+			failures[packageWrapper.packageName()] = err
+			events.Failed(packageWrapper.packageName(), err)
+		}
+		reporter.Done(packageWrapper.packageName(), err)
+	}
+	reporter.Finish()
+	if len(deferredList) > 0 {
+		logrus.Warnf("Resource cap exceeded (%s); deferred to the next run: %v", capExceeded, deferredList)
+		packageList = integratedList
+	}
+
+	if (auto || stage) && !dryRun {
+		if err := recordPackageStates(currentPackage, failures, auto); err != nil {
+			logrus.Errorf("failed to record package state: %s", err)
+		}
+	}
+
+	if len(packageList) == 0 {
+		if auto && !dryRun {
+			if err := commitState(); err != nil {
+				logrus.Fatal(err)
+			}
 		}
+		return
 	}
+
 	if len(skippedList) > 0 {
 		logrus.Errorf("Skipped due to error: %v", skippedList)
 	}
@@ -1127,308 +2607,2929 @@ func generateChanges(auto bool, stage bool) {
 		logrus.Fatalf("All packages skipped. Exiting...")
 	}
 
+	// the files of failed packages were rolled back, so they are left
+	// out of the index and the commit
+	updatedList := make(PackageList, 0, len(packageList))
+	for _, packageWrapper := range packageList {
+		if _, failed := failures[packageWrapper.packageName()]; !failed {
+			updatedList = append(updatedList, packageWrapper)
+		}
+	}
+
 	if auto || stage {
 		err = writeIndex()
 		if err != nil {
 			logrus.Error(err)
+		} else {
+			events.Emit(events.Event{Type: events.TypeIndexWritten})
+		}
+
+		updatedPackages := make([]string, 0, len(updatedList))
+		for _, packageWrapper := range updatedList {
+			updatedPackages = append(updatedPackages, packageWrapper.packageName())
+		}
+		err = hookOptions.Run(hooks.Payload{Stage: hooks.StagePostIndex, Packages: updatedPackages})
+		if err != nil {
+			logrus.Fatal(err)
 		}
 	}
-	if auto {
-		err = commitChanges(packageList, false)
+	if auto && !dryRun {
+		runSummary.Base = headCommit()
+		err = commitChanges(updatedList, false)
 		if err != nil {
 			logrus.Fatal(err)
 		}
+		runSummary.Head = headCommit()
 	}
 }
 
-// CLI function call - Prints list of available packages to STDout
-func listPackages(c *cli.Context) {
-	packageList := generatePackageList(os.Getenv(packageEnvVariable))
-	vendorSorted := make([]string, 0)
-	for _, packageWrapper := range packageList {
-		packagesPath := filepath.Join(getRepoRoot(), repositoryPackagesDir)
-		packageParentPath := filepath.Dir(packageWrapper.Path)
-		packageRelativePath := filepath.Base(packageWrapper.Path)
-		if packagesPath != packageParentPath {
-			packageRelativePath = filepath.Join(filepath.Base(packageParentPath), packageRelativePath)
+// Starts the update report of a run with the packages it populated.
+// Must be called before entering a dry run sandbox, which changes the
+// package names of populatedList.
+func newUpdateReport(command string, started time.Time, populatedList PackageList) report.Report {
+	updateReport := report.Report{Command: command, DryRun: dryRun, Started: started}
+	for _, packageWrapper := range populatedList {
+		reportPackage := report.Package{
+			Name:         packageWrapper.packageName(),
+			Status:       report.StatusUpToDate,
+			Skipped:      skippedVersions(packageWrapper),
+			CheckSeconds: packageWrapper.checkDuration.Seconds(),
 		}
-		vendorSorted = append(vendorSorted, packageRelativePath)
+		for _, version := range newestFirst(packageWrapper.FetchVersions) {
+			reportPackage.Fetched = append(reportPackage.Fetched, version.Version)
+		}
+		if len(reportPackage.Fetched) > 0 {
+			reportPackage.Status = report.StatusUpdated
+		}
+		updateReport.Packages = append(updateReport.Packages, reportPackage)
 	}
 
-	sort.Strings(vendorSorted)
-	for _, pkg := range vendorSorted {
-		fmt.Println(pkg)
-	}
+	return updateReport
 }
 
-// CLI function call - Appends annotaion to feature chart in Rancher UI
-func addFeaturedChart(c *cli.Context) {
-	if len(c.Args()) != 2 {
-		logrus.Fatalf("Please provide the chart name and featured number (1 - %d) as arguments\n", featuredMax)
+// Completes updateReport with the packages that failed or were
+// deferred, the versions that failed the render check, and the time
+// spent integrating each package
+func completeUpdateReport(updateReport *report.Report, failures map[string]error, deferred []string, rejectedVersions map[string]map[string]error, integrationDurations map[string]time.Duration) {
+	updateReport.DurationSeconds = time.Since(updateReport.Started).Seconds()
+	deferredPackages := make(map[string]struct{}, len(deferred))
+	for _, packageName := range deferred {
+		deferredPackages[packageName] = struct{}{}
+	}
+
+	populated := make(map[string]struct{}, len(updateReport.Packages))
+	for i := range updateReport.Packages {
+		reportPackage := &updateReport.Packages[i]
+		populated[reportPackage.Name] = struct{}{}
+		reportPackage.IntegrationSeconds = integrationDurations[reportPackage.Name].Seconds()
+		if rejected := rejectedVersions[reportPackage.Name]; len(rejected) > 0 {
+			fetched := make([]string, 0, len(reportPackage.Fetched))
+			for _, version := range reportPackage.Fetched {
+				if err, ok := rejected[version]; ok {
+					reportPackage.Skipped = append(reportPackage.Skipped, report.Skipped{
+						Version: version,
+						Reason:  "failed the render check: " + redact.String(err.Error()),
+					})
+					continue
+				}
+				fetched = append(fetched, version)
+			}
+			reportPackage.Fetched = fetched
+		}
+		if err, failed := failures[reportPackage.Name]; failed {
+			reportPackage.Status = report.StatusFailed
+			reportPackage.Error = redact.String(err.Error())
+		} else if _, ok := deferredPackages[reportPackage.Name]; ok {
+			reportPackage.Status = report.StatusDeferred
+		}
 	}
-	featuredChart := c.Args().Get(0)
+	// packages that failed to populate
+	for packageName, err := range failures {
+		if _, ok := populated[packageName]; ok {
+			continue
+		}
+		updateReport.Packages = append(updateReport.Packages, report.Package{
+			Name:   packageName,
+			Status: report.StatusFailed,
+			Error:  redact.String(err.Error()),
+		})
+	}
+}
+
+// Returns the upstream versions of packageWrapper newer than its latest
+// stored version that were left out as pre-releases, by
+// VersionConstraint or ExcludeVersions, or for being newer than its
+// TrackVersions, with the reason for each
+func skippedVersions(packageWrapper PackageWrapper) []report.Skipped {
+	resolution := packageWrapper.resolution
+	if resolution == nil {
+		return nil
+	}
+	var latestStored *semver.Version
+	if packageWrapper.LatestStored.Version != "" {
+		latestStored, _ = semver.NewVersion(conform.StripPackageVersion(packageWrapper.LatestStored.Version))
+	}
+
+	skipped := make([]report.Skipped, 0)
+	skip := func(version, reason string) {
+		if latestStored != nil {
+			semVer, err := semver.NewVersion(version)
+			if err != nil || !semVer.GreaterThan(latestStored) {
+				return
+			}
+		}
+		skipped = append(skipped, report.Skipped{Version: version, Reason: reason})
+	}
+	for _, filter := range resolution.Filters {
+		var reason string
+		switch {
+		case filter.Name == filterPreRelease:
+			reason = "pre-release"
+		case strings.HasPrefix(filter.Name, filterConstraint+" "):
+			reason = fmt.Sprintf("outside VersionConstraint %s", resolution.VersionConstraint)
+		case filter.Name == filterExcluded:
+			reason = "listed in ExcludeVersions"
+		default:
+			continue
+		}
+		for _, version := range filter.Removed {
+			skip(version, reason)
+		}
+	}
+	for _, version := range resolution.NewerUntracked {
+		skip(version, "newer than TrackVersions")
+	}
+
+	return skipped
+}
+
+// Returns the entry of the job summary for a package integrated in
+// duration
+func summaryPackage(packageWrapper PackageWrapper, duration time.Duration) summary.Package {
+	summaryPackage := summary.Package{Name: packageWrapper.packageName(), Duration: duration}
+	for _, chartVersion := range newestFirst(packageWrapper.FetchVersions) {
+		version := summary.Version{Version: chartVersion.Version}
+		if packageWrapper.UpstreamYaml != nil && packageWrapper.SourceMetadata != nil {
+			version.ReleaseURL = fetcher.ReleaseURL(*packageWrapper.UpstreamYaml, *packageWrapper.SourceMetadata, chartVersion.Version)
+		}
+		summaryPackage.Versions = append(summaryPackage.Versions, version)
+	}
+
+	return summaryPackage
+}
+
+// Moves the run into a sandbox of the repository, in which the index,
+// the checksum manifests, and the archives, chart directories and
+// package of each package in packageList with versions to fetch are
+// copies that the run can change without changing the repository
+func enterSandbox(packageList PackageList, configYaml validate.ConfigurationYaml) (*sandbox.Sandbox, error) {
+	if !archiveStorage().Local() {
+		return nil, errors.New("--dry-run requires the filesystem storage backend")
+	}
+	repoRoot := getRepoRoot()
+
+	copied := []string{indexFile, path.Join(repositoryAssetsDir, checksums.File)}
+	assetsEntries, err := os.ReadDir(filepath.Join(repoRoot, repositoryAssetsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range assetsEntries {
+		if entry.IsDir() {
+			copied = append(copied, path.Join(repositoryAssetsDir, entry.Name(), checksums.File))
+		}
+	}
+	relativePaths := make([]string, len(packageList))
+	for i, packageWrapper := range packageList {
+		if len(packageWrapper.FetchVersions) == 0 {
+			continue
+		}
+		relativePath, err := filepath.Rel(repoRoot, packageWrapper.Path)
+		if err != nil {
+			return nil, err
+		}
+		relativePaths[i] = relativePath
+		copied = append(copied,
+			filepath.ToSlash(relativePath),
+			path.Join(repositoryAssetsDir, packageWrapper.ParsedVendor),
+			path.Join(repositoryChartsDir, packageWrapper.ParsedVendor))
+	}
+
+	s, err := sandbox.New(repoRoot, copied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	for i, relativePath := range relativePaths {
+		if relativePath != "" {
+			packageList[i].Path = filepath.Join(s.Root, relativePath)
+		}
+	}
+	if err := os.Chdir(s.Root); err != nil {
+		s.Remove()
+		return nil, err
+	}
+	if err := storage.Configure(configYaml.Storage, filepath.Join(s.Root, repositoryAssetsDir), repositoryAssetsDir); err != nil {
+		return nil, fmt.Errorf("failed to configure storage: %w", err)
+	}
+	logrus.Infof("Dry run in %s\n", s.Root)
+
+	return s, nil
+}
+
+// Prints the changes that the dry run described by runSummary made in
+// s, then returns to the repository and removes s
+func leaveSandbox(s *sandbox.Sandbox, configYaml validate.ConfigurationYaml, runSummary summary.Summary) error {
+	changes, changesErr := s.Changes()
+	if err := os.Chdir(s.Origin); err != nil {
+		return err
+	}
+	if err := storage.Configure(configYaml.Storage, filepath.Join(s.Origin, repositoryAssetsDir), repositoryAssetsDir); err != nil {
+		return fmt.Errorf("failed to configure storage: %w", err)
+	}
+	if err := s.Remove(); err != nil {
+		logrus.Warnf("failed to remove sandbox %s: %s", s.Root, err)
+	}
+	if changesErr != nil {
+		return fmt.Errorf("failed to compare sandbox: %w", changesErr)
+	}
+	fmt.Print(dryRunReport(runSummary, changes))
+
+	return nil
+}
+
+// Renders the packages and versions that a run would add and the files
+// it would change
+func dryRunReport(runSummary summary.Summary, changes sandbox.Changes) string {
+	runSummary = runSummary.Sorted()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run of %s: %d updated, %d failed, %d deferred\n",
+		runSummary.Command, len(runSummary.Updated), len(runSummary.Failed), len(runSummary.Deferred))
+
+	for _, updated := range runSummary.Updated {
+		versions := make([]string, 0, len(updated.Versions))
+		for _, version := range updated.Versions {
+			versions = append(versions, version.Version)
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", updated.Name, strings.Join(versions, ", "))
+	}
+	failed := make([]string, 0, len(runSummary.Failed))
+	for name := range runSummary.Failed {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		fmt.Fprintf(&b, "  %s: failed: %s\n", name, runSummary.Failed[name])
+	}
+	for _, name := range runSummary.Deferred {
+		fmt.Fprintf(&b, "  %s: deferred\n", name)
+	}
+
+	if len(changes.Added)+len(changes.Modified)+len(changes.Removed) == 0 {
+		b.WriteString("No files would change\n")
+		return b.String()
+	}
+	b.WriteString("Files that would change:\n")
+	for _, list := range []struct {
+		status string
+		paths  []string
+	}{{"A", changes.Added}, {"M", changes.Modified}, {"D", changes.Removed}} {
+		for _, filePath := range list.paths {
+			fmt.Fprintf(&b, "  %s %s\n", list.status, filePath)
+		}
+	}
+
+	return b.String()
+}
+
+// Returns the hash of the commit checked out in the repository, or ""
+// if it can not be read
+func headCommit() string {
+	r, err := git.PlainOpen(getRepoRoot())
+	if err != nil {
+		logrus.Debug(err)
+		return ""
+	}
+	head, err := r.Head()
+	if err != nil {
+		logrus.Debug(err)
+		return ""
+	}
+
+	return head.Hash().String()
+}
+
+// hookError marks errors returned by hooks with PolicyFail, which abort
+// the run instead of skipping the package
+type hookError struct {
+	error
+}
+
+func (e hookError) Unwrap() error {
+	return e.error
+}
+
+func isHookError(err error) bool {
+	var target hookError
+	return errors.As(err, &target)
+}
+
+// Fails a package whose stored versions, together with the versions to
+// be added, would exceed maxVersions of configuration.yaml, unless it
+// is exempted from the max-versions validation rule
+func checkMaxVersions(packageWrapper PackageWrapper, configYaml validate.ConfigurationYaml) error {
+	if configYaml.MaxVersions <= 0 || validate.IsExempted(configYaml.ValidationRules, "max-versions", packageWrapper.packageName()) {
+		return nil
+	}
+	storedVersions, err := getStoredVersions(packageWrapper.Name)
+	if err != nil {
+		return err
+	}
+	versions := len(storedVersions) + len(packageWrapper.FetchVersions)
+	if versions > configYaml.MaxVersions {
+		return validate.MaxVersionsError{
+			Chart:       packageWrapper.Name,
+			Versions:    versions,
+			Added:       len(packageWrapper.FetchVersions),
+			MaxVersions: configYaml.MaxVersions,
+		}
+	}
+
+	return nil
+}
+
+// Conforms and writes a package, running the preIntegrate and
+// postIntegrate hooks around it. Versions written to the repository
+// are render checked unless --skip-render-check is set; those that fail
+// are returned with their failure, keyed by upstream version. If the
+// package fails to conform or a postIntegrate hook fails, the files it
+// wrote are rolled back.
+func integratePackage(packageWrapper PackageWrapper, writeChart bool, hookOptions hooks.Options, reporter progress.Reporter) (map[string]error, error) {
+	payload := hooks.Payload{
+		Package: packageWrapper.packageName(),
+		Vendor:  packageWrapper.ParsedVendor,
+		Chart:   packageWrapper.Name,
+		Source:  packageWrapper.SourceMetadata.Source,
+	}
+	for _, chartVersion := range packageWrapper.FetchVersions {
+		payload.Versions = append(payload.Versions, chartVersion.Version)
+	}
+
+	reporter.Phase(packageWrapper.packageName(), "running preIntegrate hooks")
+	payload.Stage = hooks.StagePreIntegrate
+	if err := hookOptions.Run(payload); err != nil {
+		return nil, hookError{err}
+	}
+
+	tx := transaction.New()
+	if writeChart {
+		if err := trackPackage(tx, packageWrapper); err != nil {
+			return nil, err
+		}
+	}
+	saved := len(savedChartVersions)
+
+	var rejected map[string]error
+	err := tx.Run(func() error {
+		reporter.Phase(packageWrapper.packageName(), "conforming")
+		packageWrapper.renderCheck = writeChart && !skipRenderCheck
+		var written writtenPaths
+		var err error
+		rejected, written, err = conformPackage(packageWrapper, writeChart)
+		if err != nil {
+			return err
+		}
+
+		reporter.Phase(packageWrapper.packageName(), "running postIntegrate hooks")
+		payload.Stage = hooks.StagePostIntegrate
+		payload.Archives = written.archives
+		payload.Charts = written.charts
+		if err := hookOptions.Run(payload); err != nil {
+			return hookError{err}
+		}
+		return nil
+	})
+	if err != nil {
+		// archives already uploaded to remote storage are left out of
+		// the index
+		savedChartVersions = savedChartVersions[:saved]
+	}
+
+	return rejected, err
+}
+
+// Tracks in tx the index and every path of the repository that
+// conformPackage may write for packageWrapper
+func trackPackage(tx *transaction.Transaction, packageWrapper PackageWrapper) error {
+	chartsPath := filepath.Join(getRepoRoot(), repositoryChartsDir, packageWrapper.ParsedVendor, packageWrapper.Name)
+	trackedPaths := []string{
+		filepath.Join(getRepoRoot(), indexFile),
+		filepath.Join(getRepoRoot(), repositoryAssetsDir, packageWrapper.ParsedVendor),
+		chartsPath,
+		chartsPath + conform.CRDChartSuffix,
+		packageWrapper.Path,
+	}
+	for _, trackedPath := range trackedPaths {
+		if err := tx.Track(trackedPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns versions without those in rejected
+func withoutRejected(versions repo.ChartVersions, rejected map[string]error) repo.ChartVersions {
+	if len(rejected) == 0 {
+		return versions
+	}
+	kept := make(repo.ChartVersions, 0, len(versions))
+	for _, version := range versions {
+		if _, ok := rejected[version.Version]; !ok {
+			kept = append(kept, version)
+		}
+	}
+
+	return kept
+}
+
+// Records consecutive failures of every checked package in the state
+// file. If escalate is true, packages that keep failing get a GitHub
+// issue opened or updated in the configured repository.
+func recordPackageStates(currentPackage string, failures map[string]error, escalate bool) error {
+	ciState, err := state.Load(filepath.Join(getRepoRoot(), state.StateFile))
+	if err != nil {
+		return err
+	}
+
+	for _, packageWrapper := range generatePackageList(currentPackage) {
+		packageName := packageWrapper.packageName()
+		if err, ok := failures[packageName]; ok && fetcher.IsUnreachable(err) {
+			ciState.RecordUnreachable(packageName, err)
+		} else if ok {
+			ciState.RecordFailure(packageName, err)
+			ciState.RecordReachable(packageName)
+		} else {
+			ciState.RecordSuccess(packageName)
+		}
+	}
+
+	if escalate {
+		configYaml, err := readConfig()
+		if err != nil {
+			return err
+		}
+		if err := ciState.Escalate(configYaml.Escalation); err != nil {
+			logrus.Error(err)
+		}
+	}
+
+	return ciState.Write()
+}
+
+// Trims the upstream cache to its size cap, if caching is enabled
+func evictCache() {
+	if c := cache.Default(); c != nil {
+		if err := c.Evict(); err != nil {
+			logrus.Errorf("failed to evict cache entries: %s", err)
+		}
+	}
+}
+
+// generatePullRequests is the per-package variation of generateChanges.
+// Each updated package is conformed on its own branch, starting from the
+// current branch, which is committed, pushed to origin, and opened as a
+// pull request.
+func generatePullRequests() {
+	defer evictCache()
+	currentPackage := os.Getenv(packageEnvVariable)
+
+	configYaml, err := readConfig()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if configYaml.PullRequests.Repository == "" || configYaml.PullRequests.Base == "" {
+		logrus.Fatalf("pullRequests.repository and pullRequests.base must be set in %s", configOptionsFile)
+	}
+
+	r, err := git.PlainOpen(getRepoRoot())
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	gitStatus, err := wt.Status()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if !gitStatus.IsClean() {
+		logrus.Fatal("Git status must be clean to open per-package pull requests")
+	}
+
+	packageList, _, err := populatePackagesWithFailures(currentPackage, true, false, true, progress.Discard{})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	skippedList := make([]string, 0)
+	for _, packageWrapper := range packageList {
+		if err := openPackagePullRequest(packageWrapper, configYaml.PullRequests); err != nil {
+			logrus.Errorf("%s: %s", packageWrapper.packageName(), err)
+			skippedList = append(skippedList, packageWrapper.Name)
+		}
+	}
+	if len(skippedList) > 0 {
+		logrus.Errorf("Skipped due to error: %v", skippedList)
+	}
+	if len(packageList) > 0 && len(skippedList) >= len(packageList) {
+		logrus.Fatalf("All packages skipped. Exiting...")
+	}
+}
+
+// Conforms a single package on a new branch, commits and pushes it, and
+// opens a pull request. The original branch is checked out afterwards.
+func openPackagePullRequest(packageWrapper PackageWrapper, options pullrequest.Options) error {
+	token, err := pullrequest.Token()
+	if err != nil {
+		return err
+	}
+
+	r, err := git.PlainOpen(getRepoRoot())
+	if err != nil {
+		return err
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	branchName := fmt.Sprintf("partner-charts-ci/%s/%s", packageWrapper.ParsedVendor, packageWrapper.Name)
+	branch := plumbing.NewBranchReferenceName(branchName)
+	if err := r.Storer.RemoveReference(branch); err != nil {
+		return err
+	}
+	err = wt.Checkout(&git.CheckoutOptions{
+		Branch: branch,
+		Hash:   head.Hash(),
+		Create: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branchName, err)
+	}
+	defer func() {
+		if err := wt.Checkout(&git.CheckoutOptions{Branch: head.Name(), Force: true}); err != nil {
+			logrus.Errorf("failed to check out %s: %s", head.Name().Short(), err)
+		}
+		if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+			logrus.Errorf("failed to clean working tree: %s", err)
+		}
+	}()
+
+	packageWrapper.renderCheck = !skipRenderCheck
+	rejected, _, err := conformPackage(packageWrapper, true)
+	if err != nil {
+		return err
+	}
+	packageWrapper.FetchVersions = withoutRejected(packageWrapper.FetchVersions, rejected)
+	if err := writeIndex(); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := commitChanges(PackageList{packageWrapper}, false); err != nil {
+		return err
+	}
+
+	refSpec := gitconfig.RefSpec(fmt.Sprintf("+%s:%s", branch, branch))
+	err = r.Push(&git.PushOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+		Auth:       &githttp.BasicAuth{Username: "x-access-token", Password: token},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push %s: %w", branchName, err)
+	}
+
+	action := "Update"
+	if packageWrapper.LatestStored.Digest == "" {
+		action = "Add"
+	}
+	versions := make([]string, 0, len(packageWrapper.FetchVersions))
+	for _, version := range newestFirst(packageWrapper.FetchVersions) {
+		versions = append(versions, version.Version)
+	}
+	title := fmt.Sprintf("%s %s/%s %s", action, packageWrapper.ParsedVendor, packageWrapper.Name, strings.Join(versions, ", "))
+
+	body := generateCommitMessage(PackageList{packageWrapper}, false)
+	if valuesReport, err := generateValuesDiff(packageWrapper); err != nil {
+		logrus.Warnf("%s: not reporting values changes: %s", packageWrapper.packageName(), err)
+	} else if valuesReport != "" {
+		body += "\n\n" + valuesReport
+	}
+
+	_, err = pullrequest.Open(options, packageWrapper.ParsedVendor, branchName, title, body)
+
+	return err
+}
+
+// Reports the changes to the default values of a package between the
+// version stored before the update and the newly stored latest version,
+// as Markdown. Returns an empty report for new packages.
+func generateValuesDiff(packageWrapper PackageWrapper) (string, error) {
+	if packageWrapper.LatestStored.Digest == "" {
+		return "", nil
+	}
+	latestStored, err := getLatestStoredVersion(packageWrapper.Name)
+	if err != nil {
+		return "", err
+	}
+	if latestStored.Version == packageWrapper.LatestStored.Version {
+		return "", nil
+	}
+
+	previousChart, err := archiveStorage().Load(&packageWrapper.LatestStored)
+	if err != nil {
+		return "", err
+	}
+	latestChart, err := archiveStorage().Load(&latestStored)
+	if err != nil {
+		return "", err
+	}
+	changes := valuesdiff.Diff(previousChart.Values, latestChart.Values)
+
+	return valuesdiff.Markdown(packageWrapper.LatestStored.Version, latestStored.Version, changes), nil
+}
+
+// CLI function call - Prints list of available packages to STDout
+// listedPackage is a package printed by list with --output json or
+// yaml, with its stored versions
+type listedPackage struct {
+	Package  string   `json:"package"`
+	Vendor   string   `json:"vendor,omitempty"`
+	Chart    string   `json:"chart,omitempty"`
+	Versions []string `json:"versions"`
+}
+
+func listPackages(c *cli.Context) {
+	packageList := generatePackageList(os.Getenv(packageEnvVariable))
+	vendorSorted := make([]string, 0)
+	for _, packageWrapper := range packageList {
+		packagesPath := filepath.Join(getRepoRoot(), repositoryPackagesDir)
+		packageParentPath := filepath.Dir(packageWrapper.Path)
+		packageRelativePath := filepath.Base(packageWrapper.Path)
+		if packagesPath != packageParentPath {
+			packageRelativePath = filepath.Join(filepath.Base(packageParentPath), packageRelativePath)
+		}
+		vendorSorted = append(vendorSorted, packageRelativePath)
+	}
+
+	sort.Strings(vendorSorted)
+
+	format := outputFormat(c)
+	listed := make([]listedPackage, 0, len(packageList))
+	if format != output.FormatTable {
+		var err error
+		listed, err = listedPackages(packageList)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	err := output.Print(format, listed, func() {
+		for _, pkg := range vendorSorted {
+			fmt.Println(pkg)
+		}
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// Returns the vendor, chart and stored versions of each package in
+// packageList, sorted by package name
+func listedPackages(packageList PackageList) ([]listedPackage, error) {
+	indexYaml := repo.NewIndexFile()
+	if _, err := os.Stat(filepath.Join(getRepoRoot(), indexFile)); err == nil {
+		indexYaml, err = readIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index: %w", err)
+		}
+	}
+
+	listed := make([]listedPackage, 0, len(packageList))
+	for _, packageWrapper := range packageList {
+		entry := listedPackage{Package: packageWrapper.packageName(), Versions: make([]string, 0)}
+		upstreamYaml, err := parse.ParseUpstreamYaml(packageWrapper.Path)
+		if err != nil {
+			logrus.Warnf("%s: failed to parse upstream.yaml: %s", entry.Package, err)
+			listed = append(listed, entry)
+			continue
+		}
+		entry.Chart = upstreamYaml.ChartName(packageWrapper.Path)
+		entry.Vendor, _ = parseVendor(upstreamYaml.Vendor, entry.Chart, packageWrapper.Path)
+		for _, chartVersion := range indexYaml.Entries[entry.Chart] {
+			entry.Versions = append(entry.Versions, chartVersion.Version)
+		}
+		listed = append(listed, entry)
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].Package < listed[j].Package
+	})
+
+	return listed, nil
+}
+
+// Returns the path of the vendor directory of the package, or the
+// empty string for packages directly under the packages directory
+func (packageWrapper PackageWrapper) vendorPath() string {
+	vendorPath := filepath.Dir(packageWrapper.Path)
+	if vendorPath == filepath.Join(getRepoRoot(), repositoryPackagesDir) {
+		return ""
+	}
+
+	return vendorPath
+}
+
+// CLI function call - Prints, as JSON, how the versions to fetch for a
+// package are selected from its upstream versions
+func resolvePackage(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the package name as argument")
+	}
+	currentPackage := c.Args().Get(0)
+
+	packageList := generatePackageList(currentPackage)
+	if len(packageList) != 1 {
+		return fmt.Errorf("package %q not available", currentPackage)
+	}
+	setIndexOverride(c, currentPackage)
+	packageWrapper := packageList[0]
+	packageWrapper.resolution = &versionResolution{Package: packageWrapper.packageName()}
+
+	if _, err := packageWrapper.populate(false); err != nil {
+		return err
+	}
+	packageWrapper.resolution.Source = packageWrapper.SourceMetadata.Source
+
+	resolution, err := json.MarshalIndent(packageWrapper.resolution, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(resolution))
+
+	return nil
+}
+
+// CLI function call - Prints the source, stored versions and vendor
+// contacts of a package
+// Prints the changes to the annotations of the stored chart versions
+// of a package, from the git history of its Chart.yaml in the charts
+// directory, optionally only those of a single version
+func auditHistory(c *cli.Context) error {
+	if len(c.Args()) < 1 || len(c.Args()) > 2 {
+		return fmt.Errorf("please provide the package name, and optionally a chart version, as arguments")
+	}
+	currentPackage := c.Args().Get(0)
+	chartVersion := c.Args().Get(1)
+
+	packageList := generatePackageList(currentPackage)
+	if len(packageList) != 1 {
+		return fmt.Errorf("package %q not available", currentPackage)
+	}
+	packageWrapper := packageList[0]
+	if err := packageWrapper.populateFromStored(); err != nil {
+		if packageWrapper.UpstreamYaml == nil {
+			return err
+		}
+		logrus.Debug(err)
+	}
+
+	chartYamlPath := path.Join(repositoryChartsDir, packageWrapper.ParsedVendor, packageWrapper.Name, "Chart.yaml")
+	changes, err := audit.AnnotationHistory(getRepoRoot(), chartYamlPath)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, change := range changes {
+		if chartVersion != "" && change.Version != chartVersion {
+			continue
+		}
+		found = true
+		fmt.Printf("%s %.8s %s <%s> %s\n", change.When.UTC().Format(time.RFC3339), change.Commit, change.Author, change.Email, change)
+	}
+	if !found {
+		logrus.Infof("No annotation history for %s in %s\n", packageWrapper.packageName(), chartYamlPath)
+	}
+
+	return nil
+}
+
+// Prints the stored chart versions in the index that have an
+// annotation, optionally only those where it has a given value
+func auditAnnotation(c *cli.Context) error {
+	if len(c.Args()) < 1 || len(c.Args()) > 2 {
+		return fmt.Errorf("please provide the annotation, and optionally its value, as arguments")
+	}
+	annotation := c.Args().Get(0)
+	value := c.Args().Get(1)
+
+	matchedVersions := getByAnnotation(annotation, value)
+	chartNames := make([]string, 0, len(matchedVersions))
+	for chartName := range matchedVersions {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+	for _, chartName := range chartNames {
+		for _, chartVersion := range matchedVersions[chartName] {
+			fmt.Printf("%s %s %s=%s\n", chartName, chartVersion.Version, annotation, chartVersion.Annotations[annotation])
+		}
+	}
+	if len(chartNames) == 0 {
+		logrus.Infof("No stored chart versions have %s\n", annotation)
+	}
+
+	return nil
+}
+
+func printPackageInfo(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the package name as argument")
+	}
+	currentPackage := c.Args().Get(0)
+
+	packageList := generatePackageList(currentPackage)
+	if len(packageList) != 1 {
+		return fmt.Errorf("package %q not available", currentPackage)
+	}
+	packageWrapper := packageList[0]
+
+	latestStored := "none"
+	if err := packageWrapper.populateFromStored(); err == nil {
+		latestStored = packageWrapper.LatestStored.Version
+	} else if packageWrapper.UpstreamYaml == nil {
+		return err
+	} else {
+		logrus.Debug(err)
+		packageWrapper.setDisplayName()
+	}
+	upstreamYaml := packageWrapper.UpstreamYaml
+
+	source := ""
+	switch {
+	case upstreamYaml.AHRepoName != "" && upstreamYaml.AHPackageName != "":
+		source = fmt.Sprintf("Artifact Hub %s/%s", upstreamYaml.AHRepoName, upstreamYaml.AHPackageName)
+	case fetcher.IsOCI(upstreamYaml.HelmRepoUrl) && upstreamYaml.HelmChart != "":
+		source = fmt.Sprintf("OCI registry %s, chart %s", redact.URL(upstreamYaml.HelmRepoUrl), upstreamYaml.HelmChart)
+	case upstreamYaml.HelmRepoUrl != "" && upstreamYaml.HelmChart != "":
+		source = fmt.Sprintf("Helm repo %s, chart %s", redact.URL(upstreamYaml.HelmRepoUrl), upstreamYaml.HelmChart)
+	case upstreamYaml.GitRepoUrl != "":
+		source = fmt.Sprintf("Git repo %s", redact.URL(upstreamYaml.GitRepoUrl))
+		if upstreamYaml.GitSubDirectory != "" {
+			source += fmt.Sprintf(", subdirectory %s", upstreamYaml.GitSubDirectory)
+		}
+	}
+
+	fmt.Printf("Package:       %s\n", packageWrapper.packageName())
+	fmt.Printf("Display name:  %s\n", packageWrapper.DisplayName)
+	fmt.Printf("Source:        %s\n", source)
+	fmt.Printf("Latest stored: %s\n", latestStored)
+
+	if packageWrapper.vendorPath() == "" {
+		return nil
+	}
+	vendorYaml, err := parse.ParseVendorYaml(packageWrapper.vendorPath())
+	if os.IsNotExist(err) {
+		fmt.Printf("Vendor:        no %s\n", parse.VendorOptionsFile)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", parse.VendorOptionsFile, err)
+	}
+	if vendorYaml.SupportUrl != "" {
+		fmt.Printf("Support:       %s\n", vendorYaml.SupportUrl)
+	}
+	for _, contact := range vendorYaml.Contacts {
+		if contact.Email != "" {
+			fmt.Printf("Contact:       %s <%s>\n", contact.Name, contact.Email)
+		} else {
+			fmt.Printf("Contact:       %s\n", contact.Name)
+		}
+	}
+	if len(vendorYaml.GitHubHandles) > 0 {
+		handles := make([]string, 0, len(vendorYaml.GitHubHandles))
+		for _, handle := range vendorYaml.GitHubHandles {
+			handles = append(handles, "@"+strings.TrimPrefix(handle, "@"))
+		}
+		fmt.Printf("Owners:        %s\n", strings.Join(handles, " "))
+	}
+
+	return nil
+}
+
+// CLI function call - Updates CODEOWNERS so that each vendor's
+// packages are owned by the GitHub handles in its vendor.yaml
+func generateCodeowners(c *cli.Context) error {
+	packagesPath := filepath.Join(getRepoRoot(), repositoryPackagesDir)
+	vendors, err := parse.ListVendors(packagesPath)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string][]string, len(vendors))
+	for _, vendor := range vendors {
+		vendorYaml, err := parse.ParseVendorYaml(filepath.Join(packagesPath, vendor))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s of %s: %w", parse.VendorOptionsFile, vendor, err)
+		}
+		owners[vendor] = vendorYaml.GitHubHandles
+	}
+
+	codeownersPath := codeowners.Find(getRepoRoot())
+	existing, err := os.ReadFile(codeownersPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated := codeowners.Update(existing, repositoryPackagesDir, owners)
+	if bytes.Equal(existing, updated) {
+		logrus.Infof("%s is up to date\n", codeownersPath)
+		return nil
+	}
+	if c.Bool("check") {
+		return fmt.Errorf("%s is out of date; run generate codeowners", codeownersPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(codeownersPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(codeownersPath, updated, 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote %s with owners for %d vendors\n", codeownersPath, len(vendors))
+
+	return nil
+}
+
+// CLI function call - Writes the supported Kubernetes and Rancher
+// versions of each stored chart version as Markdown or JSON
+func generateCompatMatrix(c *cli.Context) error {
+	format := c.String("format")
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("invalid format %q: must be markdown or json", format)
+	}
+
+	entries := make([]compat.Entry, 0)
+	for _, packageWrapper := range generatePackageList(os.Getenv(packageEnvVariable)) {
+		if err := packageWrapper.populateFromStored(); err != nil {
+			logrus.Debugf("%s: %s", packageWrapper.packageName(), err)
+			continue
+		}
+		storedVersions, err := getStoredVersions(packageWrapper.Name)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, compat.Entries(packageWrapper.packageName(), storedVersions)...)
+	}
+
+	var output []byte
+	if format == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		output = append(data, '\n')
+	} else {
+		output = []byte(compat.Markdown(entries))
+	}
+
+	outputPath := c.String("output")
+	if outputPath == "" {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	if err := os.WriteFile(outputPath, output, 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote compatibility matrix of %d chart versions to %s\n", len(entries), outputPath)
+
+	return nil
+}
+
+// CLI function call - Prints the stored state of each package, including
+// deprecation and approaching EOL dates. Only contacts upstreams with
+// --upstream, to probe for newer versions, reading only their chart
+// metadata.
+func printStatus(c *cli.Context) {
+	warningDays := c.Int("eol-warning-days")
+	now := time.Now()
+
+	configYaml, err := readConfig()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	ciState, err := state.Load(filepath.Join(getRepoRoot(), state.StateFile))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	unreachableDays := configYaml.Escalation.GetUnreachableDays()
+
+	for _, packageWrapper := range generatePackageList(os.Getenv(packageEnvVariable)) {
+		if err := packageWrapper.populateFromStored(); err != nil {
+			logrus.Errorf("%s: %s", packageWrapper.packageName(), err)
+			continue
+		}
+
+		latest := packageWrapper.LatestStored
+		line := fmt.Sprintf("%s/%s: %s", packageWrapper.ParsedVendor, packageWrapper.Name, latest.Version)
+		if latest.Deprecated {
+			line += " (deprecated)"
+		}
+
+		eolDate, err := getEOLDate(*packageWrapper.UpstreamYaml, latest.Version)
+		if err != nil {
+			logrus.Errorf("%s: %s", packageWrapper.packageName(), err)
+		} else if !eolDate.IsZero() {
+			daysLeft := int(eolDate.Sub(now).Hours() / 24)
+			switch {
+			case daysLeft < 0:
+				line += fmt.Sprintf(" (EOL since %s)", eolDate.Format(eolDateLayout))
+				logrus.Warnf("%s/%s %s reached EOL on %s", packageWrapper.ParsedVendor, packageWrapper.Name, latest.Version, eolDate.Format(eolDateLayout))
+			case daysLeft <= warningDays:
+				line += fmt.Sprintf(" (EOL in %d days)", daysLeft)
+				logrus.Warnf("%s/%s %s reaches EOL on %s", packageWrapper.ParsedVendor, packageWrapper.Name, latest.Version, eolDate.Format(eolDateLayout))
+			default:
+				line += fmt.Sprintf(" (EOL %s)", eolDate.Format(eolDateLayout))
+			}
+		}
+
+		if c.Bool("upstream") {
+			upstreamWrapper := packageWrapper
+			if _, err := upstreamWrapper.populate(true); err != nil {
+				logrus.Errorf("%s: failed to probe upstream: %s", packageWrapper.packageName(), err)
+			} else if len(upstreamWrapper.FetchVersions) > 0 {
+				line += fmt.Sprintf(" (%s available upstream)", upstreamWrapper.FetchVersions[0].Version)
+			}
+		}
+
+		if packageState, ok := ciState.Packages[packageWrapper.packageName()]; ok && packageState.UnreachableSince != nil {
+			unreachableSince := packageState.UnreachableSince.Format(eolDateLayout)
+			line += fmt.Sprintf(" (upstream unreachable since %s)", unreachableSince)
+			if now.Sub(*packageState.UnreachableSince) >= time.Duration(unreachableDays)*24*time.Hour {
+				logrus.Warnf("%s upstream unreachable since %s; consider deprecating it", packageWrapper.packageName(), unreachableSince)
+			}
+		}
+
+		fmt.Println(line)
+	}
+}
+
+// CLI function call - Appends annotaion to feature chart in Rancher UI
+func addFeaturedChart(c *cli.Context) {
+	if len(c.Args()) != 2 {
+		logrus.Fatalf("Please provide the chart name and featured number (1 - %d) as arguments\n", featuredMax)
+	}
+	featuredChart := c.Args().Get(0)
 	featuredNumber, err := strconv.Atoi(c.Args().Get(1))
 	if err != nil {
 		logrus.Fatal(err)
 	}
-	if featuredNumber < 1 || featuredNumber > featuredMax {
-		logrus.Fatalf("Featured number must be between %d and %d\n", 1, featuredMax)
+	if featuredNumber < 1 || featuredNumber > featuredMax {
+		logrus.Fatalf("Featured number must be between %d and %d\n", 1, featuredMax)
+	}
+
+	packageList := generatePackageList(featuredChart)
+	if len(packageList) == 0 {
+		logrus.Fatalf("Package '%s' not available\n", featuredChart)
+	}
+
+	packageList, err = populatePackages(featuredChart, false, false, false)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	featuredVersions := getByAnnotation(annotationFeatured, c.Args().Get(1))
+
+	if len(featuredVersions) > 0 {
+		for chartName := range featuredVersions {
+			logrus.Errorf("%s already featured at index %d\n", chartName, featuredNumber)
+		}
+	} else {
+		vendor := packageList[0].ParsedVendor
+		chartName := packageList[0].LatestStored.Name
+		err = updateAnnotations(func(tx *transaction.Transaction) error {
+			return annotateTracked(tx, vendor, chartName, annotationFeatured, c.Args().Get(1), false, true)
+		})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+}
+
+// CLI function call - Appends annotaion to feature chart in Rancher UI
+func removeFeaturedChart(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		logrus.Fatal("Please provide the chart name as argument")
+	}
+	featuredChart := c.Args().Get(0)
+	packageMap, err := parse.ListPackages(repositoryPackagesDir, "")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if _, ok := packageMap[featuredChart]; !ok {
+		logrus.Fatalf("Package '%s' not available\n", featuredChart)
+	}
+
+	packageList, err := populatePackages(featuredChart, false, false, false)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	vendor := packageList[0].ParsedVendor
+	chartName := packageList[0].LatestStored.Name
+	plan := []string{fmt.Sprintf("%s: remove %s from every stored version", featuredChart, annotationFeatured)}
+	if err := prompt.Confirm("Removing featured chart", plan, c.GlobalBool("assume-yes")); err != nil {
+		logrus.Fatal(err)
+	}
+	err = updateAnnotations(func(tx *transaction.Transaction) error {
+		return annotateTracked(tx, vendor, chartName, annotationFeatured, "", true, false)
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// CLI function call - Reconciles the featured annotations of the
+// stored charts with the featured schedule file
+func applyFeaturedSchedule(c *cli.Context) error {
+	date := time.Now()
+	if rawDate := c.String("date"); rawDate != "" {
+		var err error
+		date, err = time.Parse(schedule.DateLayout, rawDate)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", rawDate, err)
+		}
+	}
+
+	featuredSchedule, err := schedule.Load(filepath.Join(getRepoRoot(), schedule.ScheduleFile))
+	if err != nil {
+		return err
+	}
+	active, err := featuredSchedule.Active(date, featuredMax)
+	if err != nil {
+		return err
+	}
+
+	packagesByName := make(map[string]PackageWrapper)
+	packagesByChart := make(map[string]PackageWrapper)
+	for _, packageWrapper := range generatePackageList("") {
+		if err := packageWrapper.populateFromStored(); err != nil {
+			logrus.Debug(err)
+			continue
+		}
+		packagesByName[packageWrapper.packageName()] = packageWrapper
+		packagesByChart[packageWrapper.Name] = packageWrapper
+	}
+
+	desired := make(map[string]string)
+	for _, slot := range schedule.Slots(active) {
+		packageWrapper, ok := packagesByName[active[slot]]
+		if !ok {
+			return fmt.Errorf("scheduled package %s has no stored versions", active[slot])
+		}
+		desired[packageWrapper.Name] = strconv.Itoa(slot)
+	}
+
+	changes := make([]string, 0)
+	err = updateAnnotations(func(tx *transaction.Transaction) error {
+		for chartName, chartVersions := range getByAnnotation(annotationFeatured, "") {
+			if _, ok := desired[chartName]; ok {
+				continue
+			}
+			packageWrapper, ok := packagesByChart[chartName]
+			if !ok {
+				logrus.Warnf("%s is featured but has no package; skipping", chartName)
+				continue
+			}
+			if err := annotateTracked(tx, packageWrapper.ParsedVendor, chartName, annotationFeatured, "", true, false); err != nil {
+				return fmt.Errorf("failed to unfeature %s: %w", chartName, err)
+			}
+			changes = append(changes, fmt.Sprintf("Unfeatured %s (was %s)", chartName, chartVersions[0].Annotations[annotationFeatured]))
+		}
+
+		for _, slot := range schedule.Slots(active) {
+			packageWrapper := packagesByName[active[slot]]
+			chartName := packageWrapper.Name
+			if packageWrapper.LatestStored.Annotations[annotationFeatured] == desired[chartName] {
+				continue
+			}
+			if err := annotateTracked(tx, packageWrapper.ParsedVendor, chartName, annotationFeatured, desired[chartName], false, true); err != nil {
+				return fmt.Errorf("failed to feature %s: %w", chartName, err)
+			}
+			changes = append(changes, fmt.Sprintf("Featured %s at %d", chartName, slot))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s, no changes were made: %w", schedule.ScheduleFile, err)
+	}
+
+	if len(changes) == 0 {
+		logrus.Infof("Featured charts already match %s\n", schedule.ScheduleFile)
+		return nil
+	}
+	logrus.Infof("Applied %s:\n  %s", schedule.ScheduleFile, strings.Join(changes, "\n  "))
+
+	return nil
+}
+
+// featuredChart is a chart printed by feature list with --output json
+// or yaml
+type featuredChart struct {
+	Index   int    `json:"index"`
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+}
+
+func listFeaturedCharts(c *cli.Context) {
+	indexConflict := false
+	featuredSorted := make([]string, featuredMax)
+	featuredVersions := getByAnnotation(annotationFeatured, "")
+	featured := make([]featuredChart, 0, len(featuredVersions))
+
+	for chartName, chartVersion := range featuredVersions {
+		featuredIndex, err := strconv.Atoi(chartVersion[0].Annotations[annotationFeatured])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		featured = append(featured, featuredChart{Index: featuredIndex, Chart: chartName, Version: chartVersion[0].Version})
+		featuredIndex--
+		if featuredSorted[featuredIndex] != "" {
+			indexConflict = true
+			featuredSorted[featuredIndex] += fmt.Sprintf(", %s", chartName)
+		} else {
+			featuredSorted[featuredIndex] = chartName
+		}
+	}
+	if indexConflict {
+		logrus.Errorf("Multiple charts given same featured index")
+	}
+
+	sort.Slice(featured, func(i, j int) bool {
+		if featured[i].Index != featured[j].Index {
+			return featured[i].Index < featured[j].Index
+		}
+		return featured[i].Chart < featured[j].Chart
+	})
+	err := output.Print(outputFormat(c), featured, func() {
+		for i, chartName := range featuredSorted {
+			if featuredSorted[i] != "" {
+				fmt.Printf("%d: %s\n", i+1, chartName)
+			}
+		}
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// CLI function call - Appends annotation to hide chart in Rancher UI
+func hideChart(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		logrus.Fatal("Provide package name(s) as argument")
+	}
+	hiddenList := make(PackageList, 0, len(c.Args()))
+	plan := make([]string, 0, len(c.Args()))
+	for _, currentPackage := range c.Args() {
+		packageList, err := populatePackages(currentPackage, false, false, false)
+		if err != nil {
+			logrus.Error(err)
+		}
+		if len(packageList) != 1 {
+			continue
+		}
+		hiddenList = append(hiddenList, packageList[0])
+		change := fmt.Sprintf("%s: annotate every stored version with %s: \"true\"", packageList[0].packageName(), annotationHidden)
+		if !packageList[0].UpstreamYaml.Hidden {
+			change += ", set Hidden: true in " + parse.UpstreamOptionsFile
+		}
+		plan = append(plan, change)
+	}
+	if len(hiddenList) == 0 {
+		logrus.Fatal("No packages to hide")
+	}
+	if err := prompt.Confirm("Hiding charts", plan, c.GlobalBool("assume-yes")); err != nil {
+		logrus.Fatal(err)
+	}
+
+	err := batchIndexWrites(func() error {
+		for _, packageWrapper := range hiddenList {
+			vendor := packageWrapper.ParsedVendor
+			chartName := packageWrapper.LatestStored.Name
+			err := updateAnnotations(func(tx *transaction.Transaction) error {
+				if err := annotateTracked(tx, vendor, chartName, annotationHidden, "true", false, false); err != nil {
+					return err
+				}
+				if packageWrapper.UpstreamYaml.Hidden {
+					return nil
+				}
+				if err := tx.Track(filepath.Join(packageWrapper.Path, parse.UpstreamOptionsFile)); err != nil {
+					return err
+				}
+				return parse.SetUpstreamYamlField(packageWrapper.Path, "Hidden", "true")
+			})
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// CLI function call - Reconciles the hidden and deprecated state of the
+// stored charts of the packages selected with the PACKAGE environment
+// variable with their upstream.yaml. Hidden is applied to every stored
+// version, like hide, and ChartMetadata.deprecated to the latest one.
+func reconcileFlags(c *cli.Context) error {
+	packageList := generatePackageList(os.Getenv(packageEnvVariable))
+	ctx := &validate.Context{
+		RepoRoot: getRepoRoot(),
+		Packages: make(map[string]parse.UpstreamYaml),
+	}
+	packages := make(map[string]PackageWrapper)
+	for _, packageWrapper := range packageList {
+		if err := packageWrapper.populateFromStored(); err != nil {
+			logrus.Debugf("Skipping %s: %s\n", packageWrapper.packageName(), err)
+			continue
+		}
+		ctx.Packages[packageWrapper.packageName()] = *packageWrapper.UpstreamYaml
+		packages[packageWrapper.packageName()] = packageWrapper
+	}
+	var err error
+	ctx.Index, err = readIndex()
+	if err != nil {
+		return err
+	}
+
+	drift, err := validate.CheckFlagConsistency(ctx)
+	if err != nil {
+		return err
+	}
+	if len(drift) == 0 {
+		logrus.Info("Hidden and deprecated state of stored charts matches upstream.yaml")
+		return nil
+	}
+	plan := make([]string, 0, len(drift))
+	driftedPackages := make([]string, 0)
+	for _, d := range drift {
+		plan = append(plan, d.String())
+		if len(driftedPackages) == 0 || driftedPackages[len(driftedPackages)-1] != d.Package {
+			driftedPackages = append(driftedPackages, d.Package)
+		}
+	}
+	if err := prompt.Confirm("Reconciling stored charts with upstream.yaml", plan, c.GlobalBool("assume-yes")); err != nil {
+		return err
+	}
+
+	return batchIndexWrites(func() error {
+		for _, packageName := range driftedPackages {
+			packageWrapper := packages[packageName]
+			vendor, chartName := packageWrapper.ParsedVendor, packageWrapper.Name
+			err := updateAnnotations(func(tx *transaction.Transaction) error {
+				var err error
+				if packageWrapper.UpstreamYaml.Hidden {
+					err = annotateTracked(tx, vendor, chartName, annotationHidden, "true", false, false)
+				} else {
+					err = annotateTracked(tx, vendor, chartName, annotationHidden, "", true, false)
+				}
+				if err != nil {
+					return err
+				}
+
+				latestStored, err := getLatestStoredVersion(chartName)
+				if err != nil {
+					return err
+				}
+				helmChart, err := archiveStorage().Load(&latestStored)
+				if err != nil {
+					return err
+				}
+				helmChart.Metadata.Deprecated = packageWrapper.UpstreamYaml.ChartYaml.Deprecated
+				if err := saveStoredChart(helmChart, vendor, true); err != nil {
+					return err
+				}
+				return removeVersionFromIndex(chartName, latestStored)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to reconcile %s: %w", packageName, err)
+			}
+			logrus.Infof("Reconciled %s with upstream.yaml\n", packageName)
+		}
+		return nil
+	})
+}
+
+// CLI function call - Cleans package object(s)
+func cleanCharts(c *cli.Context) {
+	packageList := generatePackageList(os.Getenv(packageEnvVariable))
+	for _, packageWrapper := range packageList {
+		err := cleanPackage(packageWrapper.Path)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+// CLI function call - Removes leftovers of removed charts from the
+// repository. Passes are selected with flags; without any, every pass
+// runs.
+func collectGarbage(c *cli.Context) error {
+	all := !c.Bool("empty-dirs")
+	if all || c.Bool("empty-dirs") {
+		repoRoot := getRepoRoot()
+		for _, dir := range []string{repositoryAssetsDir, repositoryChartsDir, repositoryPackagesDir} {
+			removed, err := tidy.RemoveEmptyDirs(filepath.Join(repoRoot, dir))
+			for _, removedPath := range removed {
+				relativePath, _ := filepath.Rel(repoRoot, removedPath)
+				logrus.Infof("Removed empty directory %s\n", relativePath)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to remove empty directories from %s: %w", dir, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CLI function call - Prints the differences between the files of two
+// chart archives
+func diffArchives(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("usage: tgz-diff <old.tgz> <new.tgz>")
+	}
+	format := c.String("format")
+	if format != "text" && format != "markdown" {
+		return fmt.Errorf("invalid format %q: must be text or markdown", format)
+	}
+
+	archiveDiff, err := tgzdiff.Compare(c.Args().Get(0), c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	output := archiveDiff.Text()
+	if format == "markdown" {
+		output = archiveDiff.Markdown()
+	}
+
+	outputPath := c.String("output")
+	if outputPath == "" {
+		_, err := os.Stdout.WriteString(output)
+		return err
+	}
+
+	return os.WriteFile(outputPath, []byte(output), 0644)
+}
+
+// CLI function call - Prepares package(s) for modification via patch
+func prepareCharts(c *cli.Context) {
+	setLocalSourceOverride(c)
+	setIndexOverride(c, os.Getenv(packageEnvVariable))
+	generateChanges(false, false)
+}
+
+// CLI function call - Generates all changes for available packages,
+// Checking against upstream version, prepare, patch, clean, and index update
+// Does not commit
+func stageChanges(c *cli.Context) {
+	setLocalSourceOverride(c)
+	setIndexOverride(c, os.Getenv(packageEnvVariable))
+	openEvents(c)
+	defer closeEvents()
+	defer setResourceCaps(c)()
+	dryRun = c.Bool("dry-run")
+	skipRenderCheck = c.Bool("skip-render-check")
+	setUpdateReportPath(c)
+	setConcurrency(c)
+	generateChanges(false, true)
+}
+
+// CLI function call - Lists the upstream versions that auto would add,
+// without modifying the repository. Exits with code 1 when updates are
+// available and 2 when the upstream of a package can not be checked.
+func checkUpdates(c *cli.Context) error {
+	defer evictCache()
+	currentPackage := os.Getenv(packageEnvVariable)
+	setIndexOverride(c, currentPackage)
+	reporter := progress.New("check")
+	reporter.Start(len(generatePackageList(currentPackage)))
+	packageList, failures, err := populatePackagesWithFailures(currentPackage, true, false, false, reporter)
+	if err != nil {
+		return err
+	}
+
+	updates := 0
+	for _, packageWrapper := range packageList {
+		reporter.Done(packageWrapper.packageName(), nil)
+		if len(packageWrapper.FetchVersions) == 0 {
+			continue
+		}
+		versions := make([]string, 0, len(packageWrapper.FetchVersions))
+		for _, version := range packageWrapper.FetchVersions {
+			versions = append(versions, version.Version)
+		}
+		stored := "new package"
+		if packageWrapper.LatestStored.Metadata != nil {
+			stored = packageWrapper.LatestStored.Version
+		}
+		fmt.Printf("%s: %s -> %s\n", packageWrapper.packageName(), stored, strings.Join(versions, ", "))
+		updates++
+	}
+	reporter.Finish()
+
+	if len(failures) > 0 {
+		failed := make([]string, 0, len(failures))
+		for packageName := range failures {
+			failed = append(failed, packageName)
+		}
+		sort.Strings(failed)
+		return cli.NewExitError(fmt.Sprintf("failed to check %d packages: %s", len(failed), strings.Join(failed, ", ")), 2)
+	}
+	if updates > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d packages have pending updates", updates), 1)
+	}
+	logrus.Info("All packages are up to date")
+
+	return nil
+}
+
+// Applies --index, which replaces the upstream index.yaml of
+// packageName with a snapshot URL or file
+func setIndexOverride(c *cli.Context, packageName string) {
+	index := c.String("index")
+	if index == "" {
+		return
+	}
+	if len(generatePackageList(packageName)) != 1 {
+		logrus.Fatalf("--index requires a single package, selected with the %s environment variable or as argument", packageEnvVariable)
+	}
+	if strings.HasPrefix(index, "http://") || strings.HasPrefix(index, "https://") {
+		indexOverride = index
+		return
+	}
+	absolutePath, err := filepath.Abs(index)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	indexOverride = absolutePath
+}
+
+// Returns the output format set by the global --output, or by the
+// --format of the command, exiting if it is unknown
+func outputFormat(c *cli.Context) string {
+	format := c.GlobalString("output")
+	if c.IsSet("format") {
+		format = c.String("format")
+	}
+	if err := output.Validate(format); err != nil {
+		logrus.Fatal(err)
+	}
+
+	return format
+}
+
+// Returns the default path of the update report, in the temporary
+// directory of the GitHub Actions runner if set, so that the report is
+// not left in the repository, whose status must be clean to commit
+func defaultUpdateReportPath() string {
+	tempDir := os.Getenv("RUNNER_TEMP")
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+
+	return filepath.Join(tempDir, "update-report.json")
+}
+
+// Applies --report. The path is made absolute, as dry runs change the
+// working directory.
+func setUpdateReportPath(c *cli.Context) {
+	reportPath := c.String("report")
+	if reportPath == "" {
+		return
+	}
+	absolutePath, err := filepath.Abs(reportPath)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	updateReportPath = absolutePath
+}
+
+// Applies --local-source, which replaces the upstream of the single
+// package selected with the PACKAGE environment variable
+func setLocalSourceOverride(c *cli.Context) {
+	localSource := c.String("local-source")
+	if localSource == "" {
+		return
+	}
+	if len(generatePackageList(os.Getenv(packageEnvVariable))) != 1 {
+		logrus.Fatalf("--local-source requires the %s environment variable to select a single package", packageEnvVariable)
+	}
+	absolutePath, err := filepath.Abs(localSource)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	localSourceOverride = absolutePath
+}
+
+// Applies --max-download-bytes and --max-temp-bytes. With a temporary
+// disk cap, temporary files of the run are created in a directory of
+// their own, so that their usage can be measured. Returns a function
+// removing it.
+func setResourceCaps(c *cli.Context) func() {
+	maxDownloadBytes = c.Int64("max-download-bytes")
+	maxTempBytes = c.Int64("max-temp-bytes")
+	if maxDownloadBytes < 0 || maxTempBytes < 0 {
+		logrus.Fatal("--max-download-bytes and --max-temp-bytes can not be negative")
+	}
+	if maxTempBytes == 0 {
+		return func() {}
+	}
+
+	var err error
+	runTempDir, err = os.MkdirTemp("", "partner-charts-ci-run")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := os.Setenv("TMPDIR", runTempDir); err != nil {
+		logrus.Fatal(err)
+	}
+
+	return func() {
+		fetcher.Cleanup()
+		if err := os.RemoveAll(runTempDir); err != nil {
+			logrus.Debug(err)
+		}
+	}
+}
+
+// Returns why the resource caps of the run are exceeded, or "" if they
+// are not
+func resourceCapExceeded() string {
+	if maxDownloadBytes > 0 {
+		if downloaded := ratelimit.Downloaded(); downloaded > maxDownloadBytes {
+			return fmt.Sprintf("downloaded %d bytes, more than --max-download-bytes %d", downloaded, maxDownloadBytes)
+		}
+	}
+	if maxTempBytes > 0 && runTempDir != "" {
+		var used int64
+		err := filepath.WalkDir(runTempDir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// files may be removed while walking
+				return nil
+			}
+			if info, err := d.Info(); err == nil && !d.IsDir() {
+				used += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.Debug(err)
+		}
+		if used > maxTempBytes {
+			return fmt.Sprintf("temporary files use %d bytes, more than --max-temp-bytes %d", used, maxTempBytes)
+		}
+	}
+
+	return ""
+}
+
+// Applies --commit-strategy
+func setCommitStrategy(c *cli.Context) {
+	switch strategy := c.String("commit-strategy"); strategy {
+	case "":
+	case commitStrategySingle, commitStrategyPerPackage, commitStrategyByType:
+		commitStrategy = strategy
+	default:
+		logrus.Fatalf("unknown commit strategy %q: must be one of %s, %s or %s", strategy, commitStrategySingle, commitStrategyPerPackage, commitStrategyByType)
+	}
+}
+
+// Starts the events stream requested with --events
+func openEvents(c *cli.Context) {
+	if target := c.String("events"); target != "" {
+		if err := events.Open(target); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+}
+
+func closeEvents() {
+	if err := events.Close(); err != nil {
+		logrus.Error(err)
+	}
+}
+
+func unstageChanges(c *cli.Context) {
+	plan, err := gitCleanupPlan()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if len(plan) == 0 {
+		logrus.Info("No changes to discard")
+		return
+	}
+	if err := prompt.Confirm("Discarding changes", plan, c.GlobalBool("assume-yes")); err != nil {
+		logrus.Fatal(err)
+	}
+
+	err = gitCleanup()
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// CLI function call - Generates automated commit
+func autoUpdate(c *cli.Context) {
+	icons := c.Bool("icons")
+	setCommitStrategy(c)
+	openEvents(c)
+	defer closeEvents()
+	skipRenderCheck = c.Bool("skip-render-check")
+	setUpdateReportPath(c)
+	setConcurrency(c)
+	if c.Bool("per-package-prs") {
+		if c.Bool("dry-run") {
+			logrus.Fatal("--dry-run can not be used with --per-package-prs")
+		}
+		if c.IsSet("report") {
+			logrus.Fatal("--report can not be used with --per-package-prs")
+		}
+		generatePullRequests()
+		return
+	}
+	defer setResourceCaps(c)()
+	dryRun = c.Bool("dry-run")
+	generateChanges(true, false)
+	if icons && !dryRun {
+		overrideIcons()
+	}
+}
+
+// validationReport is printed by validate with --output json or yaml
+type validationReport struct {
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+	Findings []validate.Finding `json:"findings"`
+}
+
+// CLI function call - Validates repo against released
+func validateRepo(c *cli.Context) {
+	if c.Bool("list-rules") {
+		for _, rule := range validate.Rules {
+			fmt.Printf("%s (%s): %s\n", rule.ID, rule.Severity, rule.Description)
+		}
+		return
+	}
+
+	configYamlPath := path.Join(getRepoRoot(), configOptionsFile)
+	if _, err := os.Stat(configYamlPath); os.IsNotExist(err) {
+		logrus.Fatalf("Unable to read %s\n", configOptionsFile)
+	}
+	configYaml, err := validate.ReadConfig(configYamlPath)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	rules, err := validate.SelectRules(c.StringSlice("enable"), c.StringSlice("disable"), configYaml.ValidationRules)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	ctx := &validate.Context{
+		RepoRoot:      getRepoRoot(),
+		Config:        configYaml,
+		Packages:      make(map[string]parse.UpstreamYaml),
+		PackageErrors: make(map[string]error),
+		Reporter:      progress.New("validate"),
+		FailFast:      c.Bool("fail-fast"),
+	}
+	for _, packageWrapper := range generatePackageList("") {
+		upstreamYaml, err := parse.ParseUpstreamYaml(packageWrapper.Path)
+		if err != nil {
+			ctx.PackageErrors[packageWrapper.packageName()] = err
+			continue
+		}
+		ctx.Packages[packageWrapper.packageName()] = upstreamYaml
+	}
+	ctx.Index, err = readIndex()
+	if err != nil {
+		logrus.Fatalf("failed to read index.yaml: %s", err)
+	}
+	ctx.State, err = state.Load(filepath.Join(getRepoRoot(), state.StateFile))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	errorCount := validate.Run(rules, ctx, configYaml.ValidationRules)
+	if format := outputFormat(c); format != output.FormatTable {
+		report := validationReport{Errors: errorCount, Findings: make([]validate.Finding, 0, len(ctx.Findings))}
+		for _, finding := range ctx.Findings {
+			if finding.Severity == validate.SeverityWarning {
+				report.Warnings++
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+		if err := output.Print(format, report, nil); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if errorCount > 0 {
+		logrus.Fatalf("Validation failed with %d errors", errorCount)
+	}
+
+	if c.Bool("install") {
+		// the selected rules may not have needed the comparison
+		if err := ctx.CompareReleased(); err != nil {
+			logrus.Fatal(err)
+		}
+		if err := installAddedCharts(c, ctx.AddedAssets); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if len(configYaml.Validate) > 0 {
+		logrus.Infof("Successfully validated\n  Upstream: %s\n  Branch: %s\n",
+			configYaml.Validate[0].Url, configYaml.Validate[0].Branch)
+	} else {
+		logrus.Info("Successfully validated")
+	}
+}
+
+// CLI function call - Reapplies conform logic to stored chart versions
+func reconformCharts(c *cli.Context) error {
+	packageNames := c.StringSlice("package")
+	if len(packageNames) == 0 {
+		packageNames = []string{os.Getenv(packageEnvVariable)}
+	}
+	annotationOnly := c.Bool("annotation-only")
+
+	modifiedList := make([]string, 0)
+	for _, currentPackage := range packageNames {
+		for _, packageWrapper := range generatePackageList(currentPackage) {
+			if err := packageWrapper.populateFromStored(); err != nil {
+				logrus.Errorf("%s: %s", packageWrapper.packageName(), err)
+				continue
+			}
+			modifiedVersions, err := reconformPackage(packageWrapper, annotationOnly)
+			if err != nil {
+				return fmt.Errorf("failed to reconform %s: %w", packageWrapper.packageName(), err)
+			}
+			for _, modifiedVersion := range modifiedVersions {
+				modifiedList = append(modifiedList, fmt.Sprintf("%s/%s %s", packageWrapper.ParsedVendor, packageWrapper.Name, modifiedVersion))
+			}
+		}
+	}
+
+	if len(modifiedList) == 0 {
+		logrus.Info("No stored chart versions modified")
+		return nil
+	}
+
+	if err := writeIndex(); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	logrus.Infof("Modified chart versions:\n  %s", strings.Join(modifiedList, "\n  "))
+
+	return nil
+}
+
+// Applies OverlayChartMetadata, unless annotationOnly is true, and
+// addAnnotations to every stored version of a package. Rewrites and
+// returns the versions whose metadata changed.
+func reconformPackage(packageWrapper PackageWrapper, annotationOnly bool) ([]string, error) {
+	storedVersions, err := getStoredVersions(packageWrapper.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedVersions := make([]string, 0)
+	storedCharts := charts.New(storedVersions, archiveStorage().Load)
+	for storedCharts.Next() {
+		i, storedVersion := storedCharts.Index(), storedCharts.Version()
+		helmChart, err := storedCharts.Chart()
+		if err != nil {
+			return modifiedVersions, err
+		}
+		originalMetadata, err := yaml.Marshal(helmChart.Metadata)
+		if err != nil {
+			return modifiedVersions, err
+		}
+
+		if !annotationOnly {
+			name, version := helmChart.Metadata.Name, helmChart.Metadata.Version
+			conform.OverlayChartMetadata(helmChart, packageWrapper.UpstreamYaml.ChartMetadata())
+			helmChart.Metadata.Name, helmChart.Metadata.Version = name, version
+		}
+		if _, err := addAnnotations(packageWrapper, helmChart); err != nil {
+			return modifiedVersions, err
+		}
+
+		metadata, err := yaml.Marshal(helmChart.Metadata)
+		if err != nil {
+			return modifiedVersions, err
+		}
+		if bytes.Equal(originalMetadata, metadata) {
+			logrus.Debugf("%s (%s) already conforms\n", packageWrapper.Name, storedVersion.Version)
+			continue
+		}
+
+		logrus.Infof("Reconforming %s (%s)\n", packageWrapper.Name, storedVersion.Version)
+		if err := saveStoredChart(helmChart, packageWrapper.ParsedVendor, i == 0); err != nil {
+			return modifiedVersions, err
+		}
+		if err := removeVersionFromIndex(packageWrapper.Name, *storedVersion); err != nil {
+			return modifiedVersions, err
+		}
+		modifiedVersions = append(modifiedVersions, storedVersion.Version)
+	}
+
+	return modifiedVersions, nil
+}
+
+// Overwrites the asset of a modified stored chart version. If latest is
+// true, the unpacked chart in the charts directory is replaced as well.
+func saveStoredChart(helmChart *chart.Chart, vendor string, latest bool) error {
+	if _, err := saveChartArchive(helmChart, vendor); err != nil {
+		return err
+	}
+
+	if latest {
+		chartsPath := filepath.Join(getRepoRoot(), repositoryChartsDir, vendor, helmChart.Name())
+		if err := conform.ExportChartDirectory(helmChart, chartsPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Replaces the stored asset of version with helmChart, and the chart
+// directory too if it is the latest version, after tracking them in
+// tx. The version is removed from the index so that writing the index
+// adds it back from the new asset.
+func rewriteStoredChart(tx *transaction.Transaction, helmChart *chart.Chart, vendor string, version repo.ChartVersion, latest bool) error {
+	name := helmChart.Name()
+	trackedPaths := []string{
+		filepath.Join(getRepoRoot(), repositoryAssetsDir, vendor, fmt.Sprintf("%s-%s.tgz", name, helmChart.Metadata.Version)),
+	}
+	if latest {
+		trackedPaths = append(trackedPaths, filepath.Join(getRepoRoot(), repositoryChartsDir, vendor, name))
+	}
+	for _, trackedPath := range trackedPaths {
+		if err := tx.Track(trackedPath); err != nil {
+			return err
+		}
+	}
+
+	if err := saveStoredChart(helmChart, vendor, latest); err != nil {
+		return err
+	}
+
+	return removeVersionFromIndex(name, version)
+}
+
+// CLI function call - Renames and rewrites annotations of stored chart
+// versions according to a mapping file
+func migrateAnnotations(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the mapping file as argument")
+	}
+	mapping, err := migrate.Load(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	packageNames := c.StringSlice("package")
+	if len(packageNames) == 0 {
+		packageNames = []string{os.Getenv(packageEnvVariable)}
+	}
+	dryRun := c.Bool("dry-run")
+
+	// stored chart versions are only rewritten once every change has
+	// been planned, so a conflict leaves the repository untouched
+	type migratedVersion struct {
+		helmChart *chart.Chart
+		vendor    string
+		version   repo.ChartVersion
+		latest    bool
+	}
+	migratedVersions := make([]migratedVersion, 0)
+	changeList := make([]string, 0)
+
+	for _, currentPackage := range packageNames {
+		for _, packageWrapper := range generatePackageList(currentPackage) {
+			if err := packageWrapper.populateFromStored(); err != nil {
+				logrus.Debugf("Skipping %s: %s\n", packageWrapper.packageName(), err)
+				continue
+			}
+			for _, migration := range mapping {
+				if _, ok := packageWrapper.UpstreamYaml.Annotations[migration.From]; ok {
+					logrus.Warnf("%s: upstream.yaml still sets %s, which new chart versions will keep", packageWrapper.packageName(), migration.From)
+				}
+			}
+
+			for _, chartName := range []string{packageWrapper.Name, packageWrapper.Name + conform.CRDChartSuffix} {
+				storedVersions, err := getStoredVersions(chartName)
+				if err != nil {
+					return err
+				}
+				storedCharts := charts.New(storedVersions, archiveStorage().Load)
+				for storedCharts.Next() {
+					i, storedVersion := storedCharts.Index(), storedCharts.Version()
+					// only versions whose index metadata the mapping
+					// would change are loaded
+					indexAnnotations := make(map[string]string, len(storedVersion.Annotations))
+					for annotation, value := range storedVersion.Annotations {
+						indexAnnotations[annotation] = value
+					}
+					if indexChanges, err := mapping.Apply(indexAnnotations); err == nil && len(indexChanges) == 0 {
+						continue
+					}
+					helmChart, err := storedCharts.Chart()
+					if err != nil {
+						return err
+					}
+					if helmChart.Metadata.Annotations == nil {
+						continue
+					}
+					changes, err := mapping.Apply(helmChart.Metadata.Annotations)
+					if err != nil {
+						return fmt.Errorf("%s (%s): %w", chartName, storedVersion.Version, err)
+					}
+					if len(changes) == 0 {
+						continue
+					}
+
+					for _, change := range changes {
+						changeList = append(changeList, fmt.Sprintf("%s/%s %s: %s", packageWrapper.ParsedVendor, chartName, storedVersion.Version, change))
+					}
+					migratedVersions = append(migratedVersions, migratedVersion{
+						helmChart: helmChart,
+						vendor:    packageWrapper.ParsedVendor,
+						version:   *storedVersion,
+						latest:    i == 0,
+					})
+				}
+			}
+		}
+	}
+
+	if len(changeList) == 0 {
+		logrus.Info("No stored chart versions to migrate")
+		return nil
+	}
+	logrus.Infof("Annotation changes:\n  %s", strings.Join(changeList, "\n  "))
+	if dryRun {
+		logrus.Infof("Dry run: %d chart versions would be rewritten", len(migratedVersions))
+		return nil
+	}
+
+	err = updateAnnotations(func(tx *transaction.Transaction) error {
+		for _, migrated := range migratedVersions {
+			logrus.Debugf("Migrating annotations of %s (%s)\n", migrated.helmChart.Name(), migrated.helmChart.Metadata.Version)
+			if err := rewriteStoredChart(tx, migrated.helmChart, migrated.vendor, migrated.version, migrated.latest); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Migrated annotations of %d chart versions", len(migratedVersions))
+
+	return nil
+}
+
+// CLI function call - Writes the catalog annotations of every stored
+// chart version to a YAML file
+func exportAnnotations(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the export file as argument")
+	}
+	helmIndexYaml, err := readIndex()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	export := catalog.FromIndex(helmIndexYaml)
+	if err := export.Write(c.Args().Get(0)); err != nil {
+		return err
+	}
+	logrus.Infof("Exported annotations of %d chart versions to %s", export.Count(), c.Args().Get(0))
+
+	return nil
+}
+
+// CLI function call - Reapplies the catalog annotations of an export
+// file to the stored chart versions they were exported from
+func importAnnotations(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the export file as argument")
+	}
+	export, err := catalog.Load(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	dryRun := c.Bool("dry-run")
+
+	// as with migrate-annotations, stored chart versions are only
+	// rewritten once every change has been planned
+	type importedVersion struct {
+		helmChart *chart.Chart
+		vendor    string
+		version   repo.ChartVersion
+		latest    bool
+	}
+	importedVersions := make([]importedVersion, 0)
+	changeList := make([]string, 0)
+
+	chartNames := make([]string, 0, len(export.Charts))
+	for chartName := range export.Charts {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+	for _, chartName := range chartNames {
+		wantedVersions := export.Charts[chartName]
+		storedVersions, err := getStoredVersions(chartName)
+		if err != nil {
+			return err
+		}
+		found := make(map[string]struct{}, len(storedVersions))
+		storedCharts := charts.New(storedVersions, archiveStorage().Load)
+		for storedCharts.Next() {
+			i, storedVersion := storedCharts.Index(), storedCharts.Version()
+			wanted, ok := wantedVersions[storedVersion.Version]
+			if !ok {
+				continue
+			}
+			found[storedVersion.Version] = struct{}{}
+			// only versions whose index metadata would change are loaded
+			indexAnnotations := make(map[string]string, len(storedVersion.Annotations))
+			for annotation, value := range storedVersion.Annotations {
+				indexAnnotations[annotation] = value
+			}
+			if len(catalog.Apply(indexAnnotations, wanted)) == 0 {
+				continue
+			}
+			if len(storedVersion.URLs) == 0 {
+				return fmt.Errorf("version %s of %s has no asset", storedVersion.Version, chartName)
+			}
+			helmChart, err := storedCharts.Chart()
+			if err != nil {
+				return err
+			}
+			if helmChart.Metadata.Annotations == nil {
+				helmChart.Metadata.Annotations = make(map[string]string)
+			}
+			changes := catalog.Apply(helmChart.Metadata.Annotations, wanted)
+			if len(changes) == 0 {
+				continue
+			}
+
+			vendor := path.Base(path.Dir(storedVersion.URLs[0]))
+			for _, change := range changes {
+				changeList = append(changeList, fmt.Sprintf("%s/%s %s: %s", vendor, chartName, storedVersion.Version, change))
+			}
+			importedVersions = append(importedVersions, importedVersion{
+				helmChart: helmChart,
+				vendor:    vendor,
+				version:   *storedVersion,
+				latest:    i == 0,
+			})
+		}
+		for version := range wantedVersions {
+			if _, ok := found[version]; !ok {
+				logrus.Warnf("%s (%s) is not stored, skipping", chartName, version)
+			}
+		}
 	}
 
-	packageList := generatePackageList(featuredChart)
-	if len(packageList) == 0 {
-		logrus.Fatalf("Package '%s' not available\n", featuredChart)
+	if len(changeList) == 0 {
+		logrus.Info("Annotations of stored chart versions already match the export")
+		return nil
+	}
+	logrus.Infof("Annotation changes:\n  %s", strings.Join(changeList, "\n  "))
+	if dryRun {
+		logrus.Infof("Dry run: %d chart versions would be rewritten", len(importedVersions))
+		return nil
 	}
 
-	packageList, err = populatePackages(featuredChart, false, false, false)
+	err = updateAnnotations(func(tx *transaction.Transaction) error {
+		for _, imported := range importedVersions {
+			logrus.Infof("Modified annotations of %s/%s (%s)", imported.vendor, imported.helmChart.Name(), imported.helmChart.Metadata.Version)
+			if err := rewriteStoredChart(tx, imported.helmChart, imported.vendor, imported.version, imported.latest); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
+	logrus.Infof("Imported annotations of %d chart versions", len(importedVersions))
 
-	featuredVersions := getByAnnotation(annotationFeatured, c.Args().Get(1))
+	return nil
+}
 
-	if len(featuredVersions) > 0 {
-		for chartName := range featuredVersions {
-			logrus.Errorf("%s already featured at index %d\n", chartName, featuredNumber)
-		}
-	} else {
-		vendor := packageList[0].ParsedVendor
-		chartName := packageList[0].LatestStored.Name
-		err = annotate(vendor, chartName, annotationFeatured, c.Args().Get(1), false, true)
-		if err != nil {
-			logrus.Fatal(err)
-		}
-		if err = writeIndex(); err != nil {
-			logrus.Fatalf("failed to write index: %s", err)
-		}
-	}
+// packageNamePattern matches the <vendor>/<chart> names of new packages
+var packageNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?/[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// scaffoldYaml is the upstream.yaml written by add-package
+type scaffoldYaml struct {
+	DisplayName string `json:"DisplayName,omitempty"`
+	Fetch       string `json:"Fetch,omitempty"`
+	HelmChart   string `json:"HelmChart"`
+	HelmRepo    string `json:"HelmRepo"`
+	Vendor      string `json:"Vendor"`
 }
 
-// CLI function call - Appends annotaion to feature chart in Rancher UI
-func removeFeaturedChart(c *cli.Context) {
+// CLI function call - Creates a package with an upstream.yaml pointing
+// at a chart of a Helm repository, optionally checking that the chart
+// can be fetched
+func addPackage(c *cli.Context) error {
 	if len(c.Args()) != 1 {
-		logrus.Fatal("Please provide the chart name as argument")
+		return fmt.Errorf("please provide the package name, <vendor>/<chart>, as argument")
 	}
-	featuredChart := c.Args().Get(0)
-	packageMap, err := parse.ListPackages(repositoryPackagesDir, "")
+	packageName := c.Args().Get(0)
+	if !packageNamePattern.MatchString(packageName) {
+		return fmt.Errorf("invalid package name %q: must be <vendor>/<chart> in lowercase letters, digits and dashes", packageName)
+	}
+	vendorDir, chartDir, _ := strings.Cut(packageName, "/")
+
+	upstreamYaml := scaffoldYaml{
+		DisplayName: c.String("display-name"),
+		Fetch:       c.String("fetch"),
+		HelmChart:   c.String("chart"),
+		HelmRepo:    strings.TrimSuffix(c.String("helm-repo"), "/"),
+		Vendor:      c.String("vendor"),
+	}
+	if upstreamYaml.HelmChart == "" {
+		upstreamYaml.HelmChart = chartDir
+	}
+	if upstreamYaml.Vendor == "" {
+		upstreamYaml.Vendor = vendorDir
+	}
+	repoURL, err := url.Parse(upstreamYaml.HelmRepo)
+	if err != nil || repoURL.Host == "" || (repoURL.Scheme != "http" && repoURL.Scheme != "https" && repoURL.Scheme != "oci") {
+		return fmt.Errorf("invalid --helm-repo %q: must be an http(s) or oci:// URL", upstreamYaml.HelmRepo)
+	}
+	switch upstreamYaml.Fetch {
+	case "", selection.FetchLatest, selection.FetchNewer, selection.FetchAll:
+	default:
+		return fmt.Errorf("invalid --fetch %q: must be %s, %s or %s", upstreamYaml.Fetch, selection.FetchLatest, selection.FetchNewer, selection.FetchAll)
+	}
+	vendorPath := filepath.Join(getRepoRoot(), repositoryPackagesDir, vendorDir)
+	packagePath := filepath.Join(vendorPath, chartDir)
+	if _, err := os.Stat(packagePath); err == nil {
+		return fmt.Errorf("package %s already exists", packageName)
+	}
+	_, err = os.Stat(vendorPath)
+	newVendor := os.IsNotExist(err)
+	removePackage := func() {
+		if err := os.RemoveAll(packagePath); err != nil {
+			logrus.Error(err)
+		}
+		if newVendor {
+			if err := os.Remove(vendorPath); err != nil {
+				logrus.Error(err)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(upstreamYaml)
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
-	if _, ok := packageMap[featuredChart]; !ok {
-		logrus.Fatalf("Package '%s' not available\n", featuredChart)
+	if err := os.MkdirAll(packagePath, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(packagePath, parse.UpstreamOptionsFile), data, 0644); err != nil {
+		removePackage()
+		return err
+	}
+	if _, err := parse.ParseUpstreamYaml(packagePath); err != nil {
+		removePackage()
+		return fmt.Errorf("failed to parse generated %s: %w", parse.UpstreamOptionsFile, err)
 	}
 
-	packageList, err := populatePackages(featuredChart, false, false, false)
+	if c.Bool("probe") {
+		if err := probePackage(packagePath); err != nil {
+			removePackage()
+			return fmt.Errorf("failed to fetch %s: %w", packageName, err)
+		}
+	}
+	logrus.Infof("Created %s\n", path.Join(repositoryPackagesDir, packageName, parse.UpstreamOptionsFile))
+
+	return nil
+}
+
+// Fetches the latest upstream version of the package at packagePath
+// and loads it as a chart, without storing it
+func probePackage(packagePath string) error {
+	packageWrapper := PackageWrapper{Path: packagePath}
+	if _, err := packageWrapper.populate(true); err != nil {
+		return err
+	}
+	latest := packageWrapper.SourceMetadata.Versions[0]
+
+	defer func() {
+		if err := cleanPackage(packagePath); err != nil {
+			logrus.Error(err)
+		}
+	}()
+	helmChart, _, err := initializeChart(packagePath, *packageWrapper.SourceMetadata, *latest)
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
+	logrus.Infof("Fetched %s %s from %s\n", helmChart.Name(), latest.Version, packageWrapper.UpstreamYaml.HelmRepoUrl)
 
-	vendor := packageList[0].ParsedVendor
-	chartName := packageList[0].LatestStored.Name
-	err = annotate(vendor, chartName, annotationFeatured, "", true, false)
+	return nil
+}
+
+// CLI function call - Builds the chart archives declared by a fixture
+// spec, for the tests of validation rules
+func generateTestdata(c *cli.Context) error {
+	if len(c.Args()) != 2 {
+		return fmt.Errorf("please provide the spec file and output directory as arguments")
+	}
+	spec, err := fixture.Load(c.Args().Get(0))
 	if err != nil {
-		logrus.Fatal(err)
+		return err
+	}
+	archivePaths, err := fixture.Generate(spec, c.Args().Get(1))
+	for _, archivePath := range archivePaths {
+		logrus.Infof("Wrote %s", archivePath)
 	}
-	if err = writeIndex(); err != nil {
-		logrus.Fatalf("failed to write index: %s", err)
+	if err != nil {
+		return fmt.Errorf("failed to generate fixtures: %w", err)
 	}
+
+	return nil
 }
 
-func listFeaturedCharts(c *cli.Context) {
-	indexConflict := false
-	featuredSorted := make([]string, featuredMax)
-	featuredVersions := getByAnnotation(annotationFeatured, "")
+// CLI function call - Writes a starter questions.yaml, generated from
+// the values.yaml of the latest chart version, to the package overlay
+func generateQuestions(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the package name as argument")
+	}
+	currentPackage := c.Args().Get(0)
 
-	for chartName, chartVersion := range featuredVersions {
-		featuredIndex, err := strconv.Atoi(chartVersion[0].Annotations[annotationFeatured])
+	packageList := generatePackageList(currentPackage)
+	if len(packageList) != 1 {
+		return fmt.Errorf("package %q not available", currentPackage)
+	}
+	packageWrapper := packageList[0]
+
+	questionsPath := filepath.Join(packageWrapper.Path, "overlay", questions.QuestionsFile)
+	if _, err := os.Stat(questionsPath); err == nil && !c.Bool("force") {
+		return fmt.Errorf("%s already exists; use --force to overwrite it", questionsPath)
+	}
+
+	var helmChart *chart.Chart
+	if err := packageWrapper.populateFromStored(); err == nil {
+		helmChart, err = archiveStorage().Load(&packageWrapper.LatestStored)
 		if err != nil {
-			logrus.Fatal(err)
+			return err
 		}
-		featuredIndex--
-		if featuredSorted[featuredIndex] != "" {
-			indexConflict = true
-			featuredSorted[featuredIndex] += fmt.Sprintf(", %s", chartName)
+	} else {
+		logrus.Debugf("Loading %s from upstream: %s\n", currentPackage, err)
+		if _, err := packageWrapper.populate(true); err != nil {
+			return err
+		}
+		latestVersion := packageWrapper.SourceMetadata.Versions[0]
+		if packageWrapper.SourceMetadata.Source == "Git" {
+			helmChart, err = fetcher.LoadChartFromGit(latestVersion.URLs[0], packageWrapper.SourceMetadata.SubDirectory, packageWrapper.SourceMetadata.Commit)
+		} else if packageWrapper.SourceMetadata.Source == fetcher.SourceLocal {
+			helmChart, err = fetcher.LoadChartFromPath(latestVersion.URLs[0])
 		} else {
-			featuredSorted[featuredIndex] = chartName
+			helmChart, err = fetcher.LoadChartFromUrls(latestVersion.URLs)
+		}
+		if err != nil {
+			return err
 		}
-	}
-	if indexConflict {
-		logrus.Errorf("Multiple charts given same featured index")
 	}
 
-	for i, chartName := range featuredSorted {
-		if featuredSorted[i] != "" {
-			fmt.Printf("%d: %s\n", i+1, chartName)
+	var valuesYaml []byte
+	for _, file := range helmChart.Raw {
+		if file.Name == chartutil.ValuesfileName {
+			valuesYaml = file.Data
 		}
 	}
+	if valuesYaml == nil {
+		return fmt.Errorf("%s (%s) has no %s", helmChart.Name(), helmChart.Metadata.Version, chartutil.ValuesfileName)
+	}
 
+	questionsYaml, err := questions.Generate(valuesYaml)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(questionsPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(questionsPath, questionsYaml, 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote %s from %s (%s)\n", questionsPath, helmChart.Name(), helmChart.Metadata.Version)
+
+	return nil
 }
 
-// CLI function call - Appends annotation to hide chart in Rancher UI
-func hideChart(c *cli.Context) {
-	if len(c.Args()) < 1 {
-		logrus.Fatal("Provide package name(s) as argument")
+// CLI function call - Writes the selected chart versions, their icons
+// and a pruned index.yaml to a tarball for air-gapped installations
+func exportBundle(c *cli.Context) error {
+	var versionConstraint *semver.Constraints
+	if rawConstraint := c.String("version"); rawConstraint != "" {
+		var err error
+		versionConstraint, err = semver.NewConstraint(rawConstraint)
+		if err != nil {
+			return fmt.Errorf("invalid version constraint %q: %w", rawConstraint, err)
+		}
 	}
-	for _, currentPackage := range c.Args() {
-		packageList, err := populatePackages(currentPackage, false, false, false)
+	var since time.Time
+	if rawSince := c.String("since"); rawSince != "" {
+		var err error
+		since, err = time.Parse(time.DateOnly, rawSince)
 		if err != nil {
-			logrus.Error(err)
+			return fmt.Errorf("invalid date %q: %w", rawSince, err)
 		}
+	}
 
-		if len(packageList) == 1 {
-			vendor := packageList[0].ParsedVendor
-			chartName := packageList[0].LatestStored.Name
-			err = annotate(vendor, chartName, annotationHidden, "true", false, false)
-			if err != nil {
-				logrus.Error(err)
+	packageNames := c.StringSlice("package")
+	if len(packageNames) == 0 {
+		packageNames = []string{os.Getenv(packageEnvVariable)}
+	}
+	chartNames := make(map[string]struct{})
+	for _, currentPackage := range packageNames {
+		for _, packageWrapper := range generatePackageList(currentPackage) {
+			if err := packageWrapper.populateFromStored(); err != nil {
+				logrus.Debugf("%s: %s", packageWrapper.packageName(), err)
+				continue
 			}
-			if err = writeIndex(); err != nil {
-				logrus.Fatalf("failed to write index: %s", err)
+			chartNames[packageWrapper.Name] = struct{}{}
+			chartNames[packageWrapper.Name+conform.CRDChartSuffix] = struct{}{}
+		}
+	}
+
+	index, err := readIndex()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	bundleIndex := repo.NewIndexFile()
+	for chartName, chartVersions := range index.Entries {
+		if _, ok := chartNames[chartName]; !ok {
+			continue
+		}
+		for _, chartVersion := range chartVersions {
+			if !since.IsZero() && chartVersion.Created.Before(since) {
+				continue
+			}
+			if versionConstraint != nil {
+				parsedVersion, err := semver.NewVersion(chartVersion.Version)
+				if err != nil || !versionConstraint.Check(parsedVersion) {
+					continue
+				}
 			}
+			bundleIndex.Entries[chartName] = append(bundleIndex.Entries[chartName], chartVersion)
 		}
 	}
+	if len(bundleIndex.Entries) == 0 {
+		return fmt.Errorf("no chart versions match the given filters")
+	}
+	bundleIndex.SortEntries()
+
+	manifest, err := bundle.Write(c.String("output"), getRepoRoot(), bundleIndex)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	versionCount := 0
+	for _, count := range manifest.Charts {
+		versionCount += count
+	}
+	logrus.Infof("Exported %d versions of %d charts to %s\n", versionCount, len(manifest.Charts), c.String("output"))
+
+	return nil
 }
 
-// CLI function call - Cleans package object(s)
-func cleanCharts(c *cli.Context) {
-	packageList := generatePackageList(os.Getenv(packageEnvVariable))
-	for _, packageWrapper := range packageList {
-		err := cleanPackage(packageWrapper.Path)
+// CLI function call - Walks the git history of the assets directory
+// and fails if any released chart was rewritten
+func verifyAssetHistory(c *cli.Context) error {
+	rewritten, err := validate.CheckAssetHistory(getRepoRoot(), repositoryAssetsDir)
+	if err != nil {
+		return fmt.Errorf("failed to check history of %s: %w", repositoryAssetsDir, err)
+	}
+
+	if len(rewritten) > 0 {
+		for _, asset := range rewritten {
+			logrus.Error(asset)
+		}
+		return fmt.Errorf("%d released assets were modified after being added", len(rewritten))
+	}
+
+	logrus.Infof("No released assets were modified\n")
+
+	return nil
+}
+
+// CLI function call - Compares index.yaml and a sample of assets to
+// the published copy of the repository and fails on any drift
+func verifyPublished(c *cli.Context) error {
+	publishedURL := c.String("url")
+	if publishedURL == "" {
+		configYaml, err := readConfig()
 		if err != nil {
-			logrus.Error(err)
+			return fmt.Errorf("failed to read %s: %w", configOptionsFile, err)
+		}
+		publishedURL = configYaml.PublishedURL
+	}
+	if publishedURL == "" {
+		return fmt.Errorf("please provide the published repository URL with --url or publishedURL in %s", configOptionsFile)
+	}
+
+	helmIndexYaml, err := readIndex()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", indexFile, err)
+	}
+
+	drift, err := validate.CheckPublished(helmIndexYaml, publishedURL, c.Int("sample"))
+	if err != nil {
+		return err
+	}
+
+	if len(drift) > 0 {
+		for _, d := range drift {
+			logrus.Error(d)
 		}
+		return fmt.Errorf("%d differences between %s and %s", len(drift), indexFile, publishedURL)
 	}
+
+	logrus.Infof("%s matches %s\n", indexFile, publishedURL)
+
+	return nil
 }
 
-// CLI function call - Prepares package(s) for modification via patch
-func prepareCharts(c *cli.Context) {
-	generateChanges(false, false)
+// CLI function call - Regenerates index.yaml from the assets
+// directory, or with --check fails if it is out of date
+func rebuildIndexCommand(c *cli.Context) error {
+	if c.Bool("check") {
+		return checkIndex()
+	}
+	added, removed, refreshed, err := rebuildIndex()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	if len(added)+len(removed)+len(refreshed) == 0 {
+		logrus.Info("Rebuilt index; no versions added, removed or refreshed")
+		return nil
+	}
+	logIndexChanges(added, removed, refreshed)
+
+	return nil
 }
 
-// CLI function call - Generates all changes for available packages,
-// Checking against upstream version, prepare, patch, clean, and index update
-// Does not commit
-func stageChanges(c *cli.Context) {
-	generateChanges(false, true)
+// Compares index.yaml with the index rebuildIndex would write, listing
+// the versions it would change
+func checkIndex() error {
+	newHelmIndexYaml, added, removed, refreshed, err := regenerateIndex()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	current, err := os.ReadFile(filepath.Join(getRepoRoot(), indexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the generated timestamp changes on every write
+	if helmIndexYaml, err := readIndex(); err == nil {
+		newHelmIndexYaml.Generated = helmIndexYaml.Generated
+	}
+	generated, err := yaml.Marshal(newHelmIndexYaml)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, generated) {
+		logrus.Infof("%s is up to date with %s\n", indexFile, repositoryAssetsDir)
+		return nil
+	}
+
+	logIndexChanges(added, removed, refreshed)
+	return fmt.Errorf("%s is out of date with %s; run index rebuild to regenerate it", indexFile, repositoryAssetsDir)
 }
 
-func unstageChanges(c *cli.Context) {
-	err := gitCleanup()
+func logIndexChanges(added, removed, refreshed []string) {
+	if len(added) > 0 {
+		logrus.Infof("Added to index:\n  %s", strings.Join(added, "\n  "))
+	}
+	if len(removed) > 0 {
+		logrus.Infof("Removed from index:\n  %s", strings.Join(removed, "\n  "))
+	}
+	if len(refreshed) > 0 {
+		logrus.Infof("Refreshed digests:\n  %s", strings.Join(refreshed, "\n  "))
+	}
+}
+
+// CLI function call - Tags HEAD as a snapshot of index.yaml and the
+// assets directory
+func createSnapshot(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the snapshot name as argument")
+	}
+	name := c.Args().Get(0)
+
+	manifest, err := snapshot.Create(getRepoRoot(), name, []string{indexFile, repositoryAssetsDir})
 	if err != nil {
-		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("Created snapshot %s of %d files at %s as tag %s%s\n", name, len(manifest.Files), manifest.Commit, snapshot.TagPrefix, name)
+
+	return nil
+}
+
+// CLI function call - Restores index.yaml and the assets directory to a
+// snapshot, leaving the changes to be committed
+func rollbackSnapshot(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("please provide the snapshot name as argument")
+	}
+	name := c.Args().Get(0)
+	catalogPaths := []string{indexFile, repositoryAssetsDir}
+
+	manifest, changes, err := snapshot.Plan(getRepoRoot(), name, catalogPaths)
+	if err != nil {
+		return err
 	}
+	if len(changes) == 0 {
+		logrus.Infof("Catalog already matches snapshot %s\n", name)
+		return nil
+	}
+	plan := make([]string, 0, len(changes))
+	for _, change := range changes {
+		plan = append(plan, change.String())
+	}
+	action := fmt.Sprintf("Rolling back to snapshot %s (%s, created %s)", name, manifest.Commit, manifest.Created.Format(time.DateOnly))
+	if err := prompt.Confirm(action, plan, c.GlobalBool("assume-yes")); err != nil {
+		return err
+	}
+
+	if _, err := snapshot.Rollback(getRepoRoot(), name, catalogPaths); err != nil {
+		return err
+	}
+	logrus.Infof("Rolled back %d files to snapshot %s; review and commit the changes\n", len(changes), name)
+
+	return nil
 }
 
-// CLI function call - Generates automated commit
-func autoUpdate(c *cli.Context) {
-	icons := c.Bool("icons")
-	generateChanges(true, false)
-	if icons {
-		overrideIcons()
+// CLI function call - Republishes a stored chart version with its
+// package version incremented, from upstream or, with --offline, from
+// the stored asset
+func bumpVersion(c *cli.Context) error {
+	if len(c.Args()) != 2 {
+		return fmt.Errorf("please provide the package name and stored chart version as arguments")
+	}
+	currentPackage := c.Args().Get(0)
+	storedVersion := c.Args().Get(1)
+	offline := c.Bool("offline")
+
+	var packageWrapper PackageWrapper
+	if offline {
+		packageList := generatePackageList(currentPackage)
+		if len(packageList) != 1 {
+			return fmt.Errorf("package %q not available", currentPackage)
+		}
+		packageWrapper = packageList[0]
+		if err := packageWrapper.populateFromStored(); err != nil {
+			return err
+		}
+	} else {
+		packageList, err := populatePackages(currentPackage, false, false, false)
+		if err != nil {
+			return err
+		}
+		if len(packageList) != 1 {
+			return fmt.Errorf("package %q not available", currentPackage)
+		}
+		packageWrapper = packageList[0]
 	}
-}
 
-// CLI function call - Validates repo against released
-func validateRepo(c *cli.Context) {
-	validatePaths := map[string]validate.DirectoryComparison{
-		"assets": {},
+	storedVersions, err := getStoredVersions(packageWrapper.Name)
+	if err != nil {
+		return err
 	}
-
-	excludeFiles := make(map[string]struct{})
-	var exclude = struct{}{}
-	excludeFiles["README.md"] = exclude
-
-	directoryComparison := validate.DirectoryComparison{}
-
-	configYamlPath := path.Join(getRepoRoot(), configOptionsFile)
-	if _, err := os.Stat(configYamlPath); os.IsNotExist(err) {
-		logrus.Fatalf("Unable to read %s\n", configOptionsFile)
+	var storedChartVersion *repo.ChartVersion
+	for _, chartVersion := range storedVersions {
+		if chartVersion.Version == storedVersion {
+			storedChartVersion = chartVersion
+			break
+		}
 	}
-	configYaml, err := validate.ReadConfig(configYamlPath)
-	if err != nil {
-		logrus.Fatal(err)
+	if storedChartVersion == nil {
+		return fmt.Errorf("version %s of %s not found in %s", storedVersion, packageWrapper.Name, indexFile)
 	}
 
-	if len(configYaml.Validate) == 0 || configYaml.Validate[0].Branch == "" || configYaml.Validate[0].Url == "" {
-		logrus.Fatal("Invalid validation configuration")
+	upstreamVersion := conform.StripPackageVersion(storedVersion)
+	var upstreamChartVersion *repo.ChartVersion
+	if offline {
+		var cleanup func()
+		upstreamChartVersion, cleanup, err = storedSourceVersion(&packageWrapper, storedChartVersion, upstreamVersion)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	} else {
+		for _, chartVersion := range packageWrapper.SourceMetadata.Versions {
+			if chartVersion.Version == upstreamVersion {
+				upstreamChartVersion = chartVersion
+				break
+			}
+		}
+		if upstreamChartVersion == nil {
+			return fmt.Errorf("version %s of %s not available in upstream", upstreamVersion, packageWrapper.Name)
+		}
 	}
 
-	cloneDir, err := os.MkdirTemp("", "gitRepo")
+	storedSemVer, err := semver.NewVersion(storedVersion)
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
+	packageVersion := 0
+	if storedSemVer.Patch() >= conform.PatchNumMultiplier {
+		packageVersion = int(storedSemVer.Patch() % conform.PatchNumMultiplier)
+	}
+	packageVersion++
 
-	err = validate.CloneRepo(configYaml.Validate[0].Url, configYaml.Validate[0].Branch, cloneDir)
+	newVersion, err := conform.GeneratePackageVersion(upstreamVersion, &packageVersion, "")
 	if err != nil {
-		logrus.Fatal(err)
+		return err
+	}
+	for _, chartVersion := range storedVersions {
+		if chartVersion.Version == newVersion {
+			return fmt.Errorf("version %s of %s already exists", newVersion, packageWrapper.Name)
+		}
+	}
+	// a patch below the package version multiplier carries no package
+	// version, so the bumped version would be read as an upstream one
+	// and that upstream version would never be fetched
+	newSemVer, err := semver.NewVersion(newVersion)
+	if err != nil {
+		return err
+	}
+	if newSemVer.Patch() < conform.PatchNumMultiplier {
+		return fmt.Errorf("can not bump %s %s: %s would be ambiguous with upstream version %s", packageWrapper.Name, storedVersion, newVersion, newVersion)
+	}
+	if packageWrapper.SourceMetadata != nil {
+		for _, chartVersion := range packageWrapper.SourceMetadata.Versions {
+			if chartVersion.Version == newVersion {
+				return fmt.Errorf("can not bump %s %s: %s is an upstream version", packageWrapper.Name, storedVersion, newVersion)
+			}
+		}
 	}
 
-	for dirPath := range validatePaths {
-		upstreamPath := path.Join(cloneDir, dirPath)
-		updatePath := path.Join(getRepoRoot(), dirPath)
-		if _, err := os.Stat(updatePath); os.IsNotExist(err) {
-			logrus.Infof("Directory '%s' not in source. Skipping...", dirPath)
-			continue
+	logrus.Infof("Republishing %s %s as %s\n", packageWrapper.Name, storedVersion, newVersion)
+	packageWrapper.UpstreamYaml.PackageVersion = packageVersion
+	packageWrapper.FetchVersions = repo.ChartVersions{upstreamChartVersion}
+	if _, _, err := conformPackage(packageWrapper, true); err != nil {
+		return fmt.Errorf("failed to conform %s: %w", packageWrapper.Name, err)
+	}
+	if offline {
+		if err := republishStoredCRDChart(packageWrapper, storedVersion, newVersion); err != nil {
+			return err
 		}
-		if _, err := os.Stat(upstreamPath); os.IsNotExist(err) {
-			logrus.Infof("Directory '%s' not in upstream. Skipping...", dirPath)
-			continue
+	}
+
+	return writeIndex()
+}
+
+// Points the source of packageWrapper at the stored asset of
+// storedChartVersion, so it is re-conformed without contacting the
+// upstream, and returns the version to conform. The annotations of the
+// stored asset are replaced by those configured for the package. Assets
+// of a remote storage backend are downloaded to a temporary archive,
+// which the returned function removes.
+func storedSourceVersion(packageWrapper *PackageWrapper, storedChartVersion *repo.ChartVersion, upstreamVersion string) (*repo.ChartVersion, func(), error) {
+	cleanup := func() {}
+	if len(storedChartVersion.URLs) == 0 {
+		return nil, cleanup, fmt.Errorf("version %s of %s has no asset", storedChartVersion.Version, packageWrapper.Name)
+	}
+	archivePath := storedChartVersion.URLs[0]
+	if !archiveStorage().Local() {
+		storedChart, err := archiveStorage().Load(storedChartVersion)
+		if err != nil {
+			return nil, cleanup, err
 		}
-		newComparison, err := validate.CompareDirectories(upstreamPath, updatePath, excludeFiles)
+		tempDir, err := os.MkdirTemp("", "storedChart")
 		if err != nil {
-			logrus.Error(err)
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(tempDir) }
+		archivePath, err = chartutil.Save(storedChart, tempDir)
+		if err != nil {
+			cleanup()
+			return nil, func() {}, err
 		}
-		directoryComparison.Merge(newComparison)
-		validatePaths[dirPath] = newComparison
+	} else if !filepath.IsAbs(archivePath) {
+		archivePath = filepath.Join(getRepoRoot(), archivePath)
 	}
 
-	err = os.RemoveAll(cloneDir)
-	if err != nil {
-		logrus.Error(err)
+	metadata := *storedChartVersion.Metadata
+	metadata.Version = upstreamVersion
+	sourceVersion := &repo.ChartVersion{
+		Metadata: &metadata,
+		URLs:     []string{archivePath},
 	}
+	packageWrapper.SourceMetadata = &fetcher.ChartSourceMetadata{
+		Source:   fetcher.SourceLocal,
+		Versions: repo.ChartVersions{sourceVersion},
+	}
+	packageWrapper.rebuild = true
 
-	if len(directoryComparison.Added) > 0 {
-		outString := ""
-		for dirPath := range validatePaths {
-			if len(validatePaths[dirPath].Added) > 0 {
-				outString += fmt.Sprintf("\n - %s", dirPath)
-				stringJoiner := fmt.Sprintf("\n - %s", dirPath)
-				fileList := strings.Join(validatePaths[dirPath].Added[:], stringJoiner)
-				outString += fileList
-			}
+	return sourceVersion, cleanup, nil
+}
+
+// Republishes the stored CRD chart matching storedVersion, if any, as
+// newVersion. CRDs were already split out of the stored chart, so
+// conformPackage does not create a CRD chart when rebuilding offline.
+func republishStoredCRDChart(packageWrapper PackageWrapper, storedVersion, newVersion string) error {
+	crdChartName := packageWrapper.Name + conform.CRDChartSuffix
+	crdVersions, err := getStoredVersions(crdChartName)
+	if err != nil {
+		return err
+	}
+	for _, crdVersion := range crdVersions {
+		if crdVersion.Version != storedVersion || len(crdVersion.URLs) == 0 {
+			continue
+		}
+		crdChart, err := archiveStorage().Load(crdVersion)
+		if err != nil {
+			return err
 		}
-		logrus.Infof("Files Added:%s", outString)
+		crdChart.Metadata.Version = newVersion
+		logrus.Infof("Republishing %s %s as %s\n", crdChartName, storedVersion, newVersion)
+		_, err = saveChart(
+			crdChart,
+			packageWrapper.ParsedVendor,
+			filepath.Join(getRepoRoot(), repositoryChartsDir, packageWrapper.ParsedVendor, crdChartName),
+		)
+		return err
 	}
 
-	if len(directoryComparison.Removed) > 0 {
-		outString := ""
-		for dirPath := range validatePaths {
-			if len(validatePaths[dirPath].Removed) > 0 {
-				outString += fmt.Sprintf("\n - %s", dirPath)
-				stringJoiner := fmt.Sprintf("\n - %s", dirPath)
-				fileList := strings.Join(validatePaths[dirPath].Removed[:], stringJoiner)
-				outString += fileList
-			}
-		}
-		logrus.Warnf("Files Removed:%s", outString)
+	return nil
+}
+
+// Installs every chart archive added relative to the released repo into
+// a cluster, creating an ephemeral one if a cluster provider is given
+func installAddedCharts(c *cli.Context, addedAssets []string) error {
+	options := install.Options{
+		Mode:        c.String("install-mode"),
+		KubeContext: c.String("kube-context"),
 	}
 
-	if len(directoryComparison.Modified) > 0 {
-		outString := ""
-		for dirPath := range validatePaths {
-			if len(validatePaths[dirPath].Modified) > 0 {
-				outString += fmt.Sprintf("\n - %s", dirPath)
-				stringJoiner := fmt.Sprintf("\n - %s", dirPath)
-				fileList := strings.Join(validatePaths[dirPath].Modified[:], stringJoiner)
-				outString += fileList
+	if provider := c.String("cluster-provider"); provider != "" {
+		cluster, err := install.StartCluster(provider)
+		if err != nil {
+			return fmt.Errorf("failed to start cluster: %w", err)
+		}
+		defer func() {
+			if err := cluster.Delete(); err != nil {
+				logrus.Error(err)
 			}
+		}()
+		options.Kubeconfig = cluster.Kubeconfig
+	}
+
+	failedList := make([]string, 0)
+	for _, asset := range addedAssets {
+		if !strings.HasSuffix(asset, ".tgz") {
+			continue
+		}
+		chartPath := filepath.Join(getRepoRoot(), repositoryAssetsDir, asset)
+		logrus.Infof("Installing %s\n", asset)
+		if err := install.InstallChart(chartPath, options); err != nil {
+			logrus.Errorf("Failed to install %s: %s", asset, err)
+			failedList = append(failedList, asset)
 		}
-		logrus.Fatalf("Files Modified:%s", outString)
 	}
 
-	logrus.Infof("Successfully validated\n  Upstream: %s\n  Branch: %s\n",
-		configYaml.Validate[0].Url, configYaml.Validate[0].Branch)
+	if len(failedList) > 0 {
+		return fmt.Errorf("failed to install: %s", strings.Join(failedList, ", "))
+	}
 
+	return nil
 }
 
 func cullCharts(c *cli.Context) error {
@@ -1458,28 +5559,43 @@ func cullCharts(c *cli.Context) error {
 	// get charts that are newer and older than cutoff
 	now := time.Now()
 	cutoff := now.AddDate(0, 0, -days)
-	olderPackageVersions := make(repo.ChartVersions, 0, len(packageVersions))
-	newerPackageVersions := make(repo.ChartVersions, 0, len(packageVersions))
-	for _, packageVersion := range packageVersions {
-		if packageVersion.Created.After(cutoff) {
-			newerPackageVersions = append(newerPackageVersions, packageVersion)
-		} else {
-			olderPackageVersions = append(olderPackageVersions, packageVersion)
-		}
+	newerPackageVersions, olderPackageVersions := charts.Partition(packageVersions, func(packageVersion *repo.ChartVersion) bool {
+		return packageVersion.Created.After(cutoff)
+	})
+
+	if len(olderPackageVersions) == 0 {
+		logrus.Infof("No versions of %s older than %d days\n", chartName, days)
+		return nil
+	}
+	plan := make([]string, 0, len(olderPackageVersions))
+	for _, olderPackageVersion := range olderPackageVersions {
+		plan = append(plan, fmt.Sprintf("%s %s (created %s): remove %s and its %s entry",
+			chartName, olderPackageVersion.Version, olderPackageVersion.Created.Format(time.DateOnly),
+			strings.Join(olderPackageVersion.URLs, ", "), indexFile))
+	}
+	if err := prompt.Confirm(fmt.Sprintf("Removing %d versions of %s", len(olderPackageVersions), chartName), plan, c.GlobalBool("assume-yes")); err != nil {
+		return err
 	}
 
 	// remove old charts from assets directory
+	reporter := progress.New("cull")
+	reporter.Start(len(olderPackageVersions))
 	for _, olderPackageVersion := range olderPackageVersions {
-		for _, url := range olderPackageVersion.URLs {
-			if err := os.Remove(url); err != nil {
-				return fmt.Errorf("failed to remove %q: %w", url, err)
-			}
+		reporter.Phase(olderPackageVersion.Version, "removing")
+		if err := archiveStorage().Delete(olderPackageVersion); err != nil {
+			reporter.Done(olderPackageVersion.Version, err)
+			reporter.Finish()
+			return fmt.Errorf("failed to remove %q: %w", strings.Join(olderPackageVersion.URLs, ", "), err)
 		}
+		reporter.Done(olderPackageVersion.Version, nil)
 	}
+	reporter.Finish()
 
 	// modify index.yaml
 	index.Entries[chartName] = newerPackageVersions
-	if err := index.WriteFile(indexFile, 0o644); err != nil {
+	err = index.WriteFile(indexFile, 0o644)
+	indexcache.Invalidate()
+	if err != nil {
 		return fmt.Errorf("failed to write index file: %w", err)
 	}
 
@@ -1490,22 +5606,140 @@ func main() {
 	if len(os.Getenv("DEBUG")) > 0 {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
+	logrus.SetFormatter(&redact.Formatter{Formatter: &logrus.TextFormatter{}})
 
 	app := cli.NewApp()
 	app.Name = "partner-charts-ci"
 	app.Version = fmt.Sprintf("%s (%s)", version, commit)
 	app.Usage = "Assists in submission and maintenance of partner Helm charts"
+	app.Before = func(c *cli.Context) error {
+		if err := output.Validate(c.GlobalString("output")); err != nil {
+			return err
+		}
+		strictIndex = c.GlobalBool("strict-index")
+		return applyConfiguration(c)
+	}
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "assume-yes, y",
+			Usage: "skip the confirmation prompts of destructive commands, for use in CI",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "print the results of list, feature list and validate as \"table\", \"json\" or \"yaml\"",
+			Value: output.FormatTable,
+		},
+		cli.BoolFlag{
+			Name:  "strict-index",
+			Usage: "fail when an asset can not be added to index.yaml, instead of leaving it out",
+		},
+	}
+	app.After = func(c *cli.Context) error {
+		fetcher.Cleanup()
+		return nil
+	}
+
+	eventsFlag := cli.StringFlag{
+		Name:  "events",
+		Usage: "stream update events as newline-delimited JSON to this file, or to stdout if \"-\"",
+	}
+
+	localSourceFlag := cli.StringFlag{
+		Name:  "local-source",
+		Usage: "use this chart directory or archive as the upstream of the package selected with the PACKAGE environment variable",
+	}
+
+	indexFlag := cli.StringFlag{
+		Name:  "index",
+		Usage: "discover versions of the selected package from this index.yaml URL or file instead of its live Helm repository",
+	}
+
+	dryRunFlag := cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "fetch, overlay and annotate in a temporary copy of the repository and report the changes, without modifying it",
+	}
+
+	skipRenderCheckFlag := cli.BoolFlag{
+		Name:  "skip-render-check",
+		Usage: "write new chart versions without checking that they pass helm lint and render with their default values",
+	}
+
+	reportFlag := cli.StringFlag{
+		Name:  "report",
+		Usage: "write a JSON report of each package, its fetched and skipped versions, errors and timings to this file, or nowhere if empty",
+		Value: defaultUpdateReportPath(),
+	}
+
+	formatFlag := cli.StringFlag{
+		Name:  "format",
+		Usage: "print the results as \"table\", \"json\" or \"yaml\", same as the global --output",
+		Value: output.FormatTable,
+	}
+
+	concurrencyFlag := cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "fetch upstreams and download new chart versions of this many packages at once; packages are still written to the repository one at a time",
+		Value: 1,
+	}
+
+	resourceCapFlags := []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "max-download-bytes",
+			Usage: "defer the remaining packages to the next run once more than this many bytes have been downloaded (0 for no cap)",
+		},
+		&cli.Int64Flag{
+			Name:  "max-temp-bytes",
+			Usage: "defer the remaining packages to the next run once temporary files use more than this many bytes (0 for no cap)",
+		},
+	}
 
 	app.Commands = []cli.Command{
 		{
 			Name:   "list",
 			Usage:  "Print a list of all tracked upstreams in current repository",
 			Action: listPackages,
+			Flags:  []cli.Flag{formatFlag},
+		},
+		{
+			Name:      "info",
+			Usage:     "Print the source, latest stored version and vendor contacts of a package",
+			Action:    printPackageInfo,
+			ArgsUsage: "<vendor>/<chart>",
+		},
+		{
+			Name:      "resolve",
+			Usage:     "Print how the versions to fetch for a package are selected, as JSON",
+			ArgsUsage: "<vendor>/<chart>",
+			Action:    resolvePackage,
+			Flags:     []cli.Flag{indexFlag},
+		},
+		{
+			Name:   "check",
+			Usage:  "List pending upstream versions without modifying the repository, exiting non-zero if there are any",
+			Action: checkUpdates,
+			Flags:  []cli.Flag{indexFlag},
+		},
+		{
+			Name:   "status",
+			Usage:  "Print the latest stored version of each package with its deprecation and EOL status",
+			Action: printStatus,
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "eol-warning-days",
+					Usage: "warn about packages reaching EOL within this many days",
+					Value: 90,
+				},
+				&cli.BoolFlag{
+					Name:  "upstream",
+					Usage: "also print the latest upstream version of packages that have one newer than stored, reading only its chart metadata",
+				},
+			},
 		},
 		{
 			Name:   "prepare",
 			Usage:  "Pull chart from upstream and prepare for alteration via patch",
 			Action: prepareCharts,
+			Flags:  []cli.Flag{localSourceFlag, indexFlag},
 			Hidden: true, // Hidden because this subcommand does not execute overrideIcons
 			// that is necessary in the current release process,
 			// this should not be executed and pushed to production
@@ -1521,17 +5755,32 @@ func main() {
 			Name:   "auto",
 			Usage:  "Generate and commit changes",
 			Action: autoUpdate,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.BoolFlag{
 					Name:  "icons",
 					Usage: "override icons in index.yaml if true",
 				},
-			},
+				&cli.BoolFlag{
+					Name:  "per-package-prs",
+					Usage: "commit each updated package to its own branch and open a pull request for it",
+				},
+				&cli.StringFlag{
+					Name:  "commit-strategy",
+					Usage: "group changes into commits: \"single\", \"per-package\" (one commit per package, then the index) or \"by-type\" (icons, charts, then the index)",
+					Value: commitStrategySingle,
+				},
+				eventsFlag,
+				dryRunFlag,
+				skipRenderCheckFlag,
+				reportFlag,
+				concurrencyFlag,
+			}, resourceCapFlags...),
 		},
 		{
 			Name:   "stage",
 			Usage:  "Stage all changes. Does not commit",
 			Action: stageChanges,
+			Flags:  append([]cli.Flag{eventsFlag, localSourceFlag, indexFlag, dryRunFlag, skipRenderCheckFlag, reportFlag, concurrencyFlag}, resourceCapFlags...),
 			Hidden: true, // Hidden because this subcommand does not execute overrideIcons
 			// that is necessary in the current release process,
 			// this should not be executed and pushed to production
@@ -1548,6 +5797,11 @@ func main() {
 			Usage:  "Apply 'catalog.cattle.io/hidden' annotation to all stored versions of chart",
 			Action: hideChart,
 		},
+		{
+			Name:   "reconcile-flags",
+			Usage:  "Update the hidden and deprecated state of stored charts to match upstream.yaml",
+			Action: reconcileFlags,
+		},
 		{
 			Name:  "feature",
 			Usage: "Manipulate charts featured in Rancher UI",
@@ -1556,6 +5810,7 @@ func main() {
 					Name:   "list",
 					Usage:  "List currently featured charts",
 					Action: listFeaturedCharts,
+					Flags:  []cli.Flag{formatFlag},
 				},
 				{
 					Name:   "add",
@@ -1567,18 +5822,360 @@ func main() {
 					Usage:  "Remove featured annotation from chart",
 					Action: removeFeaturedChart,
 				},
+				{
+					Name:   "apply-schedule",
+					Usage:  "Feature and unfeature charts to match " + schedule.ScheduleFile,
+					Action: applyFeaturedSchedule,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "date",
+							Usage: "apply the schedule as of this date (YYYY-MM-DD) instead of today",
+						},
+					},
+				},
 			},
 		},
 		{
 			Name:   "validate",
 			Usage:  "Check repo against released charts",
 			Action: validateRepo,
+			Flags: []cli.Flag{
+				formatFlag,
+				&cli.StringSliceFlag{
+					Name:  "enable",
+					Usage: "only run this validation rule. May be repeated",
+				},
+				&cli.StringSliceFlag{
+					Name:  "disable",
+					Usage: "skip this validation rule. May be repeated",
+				},
+				cli.BoolFlag{
+					Name:  "list-rules",
+					Usage: "print the available validation rules and exit",
+				},
+				&cli.BoolFlag{
+					Name:  "fail-fast",
+					Usage: "stop at the first finding of a rule with severity error",
+				},
+				&cli.BoolFlag{
+					Name:  "install",
+					Usage: "install chart versions added relative to the released charts into a cluster",
+				},
+				&cli.StringFlag{
+					Name:  "install-mode",
+					Usage: "'dry-run' to render against the cluster with helm install --dry-run=server, or 'install' to install and uninstall",
+					Value: install.ModeDryRun,
+				},
+				&cli.StringFlag{
+					Name:  "cluster-provider",
+					Usage: "create an ephemeral cluster to install into with 'kind' or 'k3d'. Uses the current kubeconfig if unset",
+				},
+				&cli.StringFlag{
+					Name:  "kube-context",
+					Usage: "kubeconfig context to install into",
+				},
+			},
 		},
 		{
 			Name:   "download-icons",
 			Usage:  "Download icons from charts in index.yaml",
 			Action: downloadIcons,
 		},
+		{
+			Name:   "reconform",
+			Usage:  "Reapply conform logic to stored chart versions",
+			Action: reconformCharts,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "package",
+					Usage: "package to reconform, in the format printed by list. May be repeated. Defaults to the PACKAGE environment variable or all packages",
+				},
+				&cli.BoolFlag{
+					Name:  "annotation-only",
+					Usage: "only apply annotations, not the ChartMetadata of upstream.yaml",
+				},
+			},
+		},
+		{
+			Name:      "migrate-annotations",
+			Usage:     "Rename or rewrite annotations of stored chart versions according to a mapping file",
+			ArgsUsage: "<mapping file>",
+			Action:    migrateAnnotations,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "package",
+					Usage: "package to migrate, in the format printed by list. May be repeated. Defaults to the PACKAGE environment variable or all packages",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the annotation changes without rewriting any chart",
+				},
+			},
+		},
+		{
+			Name:  "annotations",
+			Usage: "Back up and restore the catalog annotations of stored chart versions",
+			Subcommands: []cli.Command{
+				{
+					Name:      "export",
+					Usage:     "Write the catalog annotations of every stored chart version to a YAML file",
+					ArgsUsage: "<export file>",
+					Action:    exportAnnotations,
+				},
+				{
+					Name:      "import",
+					Usage:     "Reapply the catalog annotations of an export file to the stored chart versions",
+					ArgsUsage: "<export file>",
+					Action:    importAnnotations,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "print the annotation changes without rewriting any chart",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "version",
+			Usage: "Manipulate stored chart versions",
+			Subcommands: []cli.Command{
+				{
+					Name:      "bump",
+					Usage:     "Re-fetch a stored version from upstream and add it again with its package version incremented",
+					Action:    bumpVersion,
+					ArgsUsage: "<vendor>/<chart> <version>",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "offline",
+							Usage: "re-conform the stored asset of the version instead of fetching it from upstream",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:      "add-package",
+			Usage:     "Create a package with an upstream.yaml for a chart of a Helm repository",
+			Action:    addPackage,
+			ArgsUsage: "<vendor>/<chart>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "helm-repo",
+					Usage: "the http(s) URL of the Helm repository, or the oci:// registry path, serving the chart",
+				},
+				cli.StringFlag{
+					Name:  "chart",
+					Usage: "the name of the chart in the Helm repository (default: the chart of the package name)",
+				},
+				cli.StringFlag{
+					Name:  "vendor",
+					Usage: "the vendor name shown in the Rancher UI (default: the vendor of the package name)",
+				},
+				cli.StringFlag{
+					Name:  "display-name",
+					Usage: "the name the chart is listed under in the Rancher UI",
+				},
+				cli.StringFlag{
+					Name:  "fetch",
+					Usage: "the versions to fetch: latest, newer or all",
+				},
+				cli.BoolFlag{
+					Name:  "probe",
+					Usage: "fetch the latest upstream version to check that the chart exists, removing the package if it can not be fetched",
+				},
+			},
+		},
+		{
+			Name:   "testdata",
+			Usage:  "Generate test fixtures",
+			Hidden: true, // Hidden because these subcommands are only useful for developing partner-charts-ci
+			Subcommands: []cli.Command{
+				{
+					Name:      "generate",
+					Usage:     "Build the chart archives declared by a fixture spec",
+					Action:    generateTestdata,
+					ArgsUsage: "<spec file> <output directory>",
+				},
+			},
+		},
+		{
+			Name:  "generate",
+			Usage: "Generate files for a package",
+			Subcommands: []cli.Command{
+				{
+					Name:      "questions",
+					Usage:     "Write a starter questions.yaml, generated from values.yaml, to the package overlay",
+					Action:    generateQuestions,
+					ArgsUsage: "<vendor>/<chart>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "overwrite an existing questions.yaml in the overlay",
+						},
+					},
+				},
+				{
+					Name:   "codeowners",
+					Usage:  "Update CODEOWNERS to assign each vendor's packages to the GitHub handles in its vendor.yaml",
+					Action: generateCodeowners,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "check",
+							Usage: "fail instead of writing if CODEOWNERS is out of date",
+						},
+					},
+				},
+				{
+					Name:   "compat-matrix",
+					Usage:  "Write the supported Kubernetes and Rancher versions of each stored chart version",
+					Action: generateCompatMatrix,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "output format, markdown or json",
+							Value: "markdown",
+						},
+						&cli.StringFlag{
+							Name:  "output",
+							Usage: "file to write the matrix to, by default standard output",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "export-bundle",
+			Usage:  "Write selected charts, their icons and a pruned index.yaml to a tarball for air-gapped installations",
+			Action: exportBundle,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "package",
+					Usage: "vendor or package to export, in the format printed by list. May be repeated. Defaults to the PACKAGE environment variable or all packages",
+				},
+				cli.StringFlag{
+					Name:  "version",
+					Usage: "only export chart versions matching this semver constraint, e.g. \">=1.2.0\"",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only export chart versions created on or after this date (YYYY-MM-DD)",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "path of the bundle to write",
+					Value: "partner-charts-bundle.tgz",
+				},
+			},
+		},
+		{
+			Name:  "assets",
+			Usage: "Inspect the released chart assets",
+			Subcommands: []cli.Command{
+				{
+					Name:   "verify-history",
+					Usage:  "Report assets whose content changed in git history after they were first added",
+					Action: verifyAssetHistory,
+				},
+				{
+					Name:   "verify-published",
+					Usage:  "Report drift between index.yaml and the published copy of the repository",
+					Action: verifyPublished,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "url",
+							Usage: "published repository URL, by default publishedURL of configuration.yaml",
+						},
+						&cli.IntFlag{
+							Name:  "sample",
+							Usage: "number of the most recently created assets to download and verify",
+							Value: 10,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "Inspect the history of stored charts",
+			Subcommands: []cli.Command{
+				{
+					Name:      "history",
+					Usage:     "Print when the annotations of each stored version of a package changed, by whom, and their previous values",
+					Action:    auditHistory,
+					ArgsUsage: "<vendor>/<chart> [version]",
+				},
+				{
+					Name:      "annotation",
+					Usage:     "Print the stored chart versions that have an annotation, optionally set to a value",
+					Action:    auditAnnotation,
+					ArgsUsage: "<annotation> [value]",
+				},
+			},
+		},
+		{
+			Name:  "index",
+			Usage: "Maintain index.yaml",
+			Subcommands: []cli.Command{
+				{
+					Name:   "rebuild",
+					Usage:  "Regenerate index.yaml from the assets directory",
+					Action: rebuildIndexCommand,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "check",
+							Usage: "fail instead of writing if index.yaml is out of date",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "snapshot",
+			Usage: "Record and restore the state of index.yaml and the assets",
+			Subcommands: []cli.Command{
+				{
+					Name:      "create",
+					Usage:     "Tag HEAD as a snapshot with a manifest of index.yaml and the assets",
+					Action:    createSnapshot,
+					ArgsUsage: "<name>",
+				},
+				{
+					Name:      "rollback",
+					Usage:     "Restore index.yaml and the assets to a snapshot",
+					Action:    rollbackSnapshot,
+					ArgsUsage: "<name>",
+				},
+			},
+		},
+		{
+			Name:      "tgz-diff",
+			Usage:     "Print the file and content differences between two chart archives",
+			Action:    diffArchives,
+			ArgsUsage: "<old.tgz> <new.tgz>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "output format, text or markdown",
+					Value: "text",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "file to write the diff to, by default standard output",
+				},
+			},
+		},
+		{
+			Name:   "gc",
+			Usage:  "Remove leftovers of removed charts, such as empty vendor directories",
+			Action: collectGarbage,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "empty-dirs",
+					Usage: "Remove empty directories from assets, charts and packages",
+				},
+			},
+		},
 		{
 			Name:      "cull",
 			Usage:     "Remove versions of chart older than a number of days",
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rancher/partner-charts-ci/internal/testutil"
+	"github.com/rancher/partner-charts-ci/pkg/fetcher"
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/transaction"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Returns a fixed set of updated packages, in an order that is neither
+// by vendor nor by chart name
+func testUpdatedPackages() PackageList {
+	packagePath := func(vendor, chartName string) string {
+		return filepath.Join(getRepoRoot(), repositoryPackagesDir, vendor, chartName)
+	}
+
+	return PackageList{
+		{
+			Name:           "tool",
+			ParsedVendor:   "beta",
+			Path:           packagePath("beta", "tool"),
+			LatestStored:   repo.ChartVersion{Digest: "stored"},
+			FetchVersions:  testutil.ChartVersions("0.9.0", "1.0.0"),
+			UpstreamYaml:   &parse.UpstreamYaml{GitRepoUrl: "https://github.com/beta/tool", GitSubDirectory: "charts/tool"},
+			SourceMetadata: &fetcher.ChartSourceMetadata{Source: "Git", Commit: "0123456789abcdef"},
+		},
+		{
+			Name:           "widget",
+			ParsedVendor:   "acme",
+			Path:           packagePath("acme", "widget"),
+			FetchVersions:  testutil.ChartVersions("1.0.0", "1.2.0", "1.1.0"),
+			UpstreamYaml:   &parse.UpstreamYaml{AHRepoName: "acme", AHPackageName: "widget"},
+			SourceMetadata: &fetcher.ChartSourceMetadata{Source: "ArtifactHub"},
+		},
+		{
+			Name:           "gadget",
+			ParsedVendor:   "acme",
+			Path:           packagePath("acme", "gadget"),
+			LatestStored:   repo.ChartVersion{Digest: "stored"},
+			FetchVersions:  testutil.ChartVersions("2.0.0"),
+			UpstreamYaml:   &parse.UpstreamYaml{},
+			SourceMetadata: &fetcher.ChartSourceMetadata{Source: "HelmRepo"},
+		},
+		{
+			Name:           "anvil",
+			ParsedVendor:   "acme",
+			Path:           packagePath("acme", "anvil"),
+			LatestStored:   repo.ChartVersion{Digest: "stored"},
+			FetchVersions:  testutil.ChartVersions("3.1.0", "3.0.1"),
+			UpstreamYaml:   &parse.UpstreamYaml{},
+			SourceMetadata: &fetcher.ChartSourceMetadata{Source: "HelmRepo"},
+		},
+	}
+}
+
+// Returns packageList in reverse order
+func reversed(packageList PackageList) PackageList {
+	reversedList := make(PackageList, 0, len(packageList))
+	for i := len(packageList) - 1; i >= 0; i-- {
+		reversedList = append(reversedList, packageList[i])
+	}
+
+	return reversedList
+}
+
+func TestGenerateCommitMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		iconOverride bool
+		golden       string
+	}{
+		{"charts", false, "commit-message.golden"},
+		{"icon override", true, "commit-message-icon-override.golden"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updatedList := testUpdatedPackages()
+			message := generateCommitMessage(updatedList, test.iconOverride)
+			testutil.AssertGolden(t, test.golden, []byte(message))
+
+			if reversedMessage := generateCommitMessage(reversed(updatedList), test.iconOverride); reversedMessage != message {
+				t.Errorf("message depends on the order of packages:\n%s", reversedMessage)
+			}
+			if updatedList[0].Name != "tool" {
+				t.Errorf("generateCommitMessage reordered the packages of its caller")
+			}
+		})
+	}
+}
+
+func TestGroupByVendor(t *testing.T) {
+	packageList := sortedPackages(testUpdatedPackages())
+	testutil.AssertGolden(t, "group-by-vendor.golden", []byte(groupByVendor(packageList)))
+}
+
+func TestSortedPackages(t *testing.T) {
+	packageList := testUpdatedPackages()
+	sorted := sortedPackages(packageList)
+	expected := []string{"acme/anvil", "acme/gadget", "acme/widget", "beta/tool"}
+	for i, packageWrapper := range sorted {
+		if actual := packageWrapper.ParsedVendor + "/" + packageWrapper.Name; actual != expected[i] {
+			t.Errorf("expected %s at %d, got %s", expected[i], i, actual)
+		}
+	}
+	if packageList[0].Name != "tool" {
+		t.Errorf("sortedPackages reordered its argument")
+	}
+}
+
+// Changes the working directory, which is the repository root, to a new
+// repository holding an archive of chartName 1.0.0 of vendor with
+// annotations, indexed in index.yaml. Returns the path of the archive.
+func setUpTestRepository(t *testing.T, vendor, chartName string, annotations map[string]string) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRoot := t.TempDir()
+	if err := os.Chdir(repoRoot); err != nil {
+		t.Fatal(err)
+	}
+	// the storage backend is configured for the repository root
+	storageConfigured = sync.Once{}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+		storageConfigured = sync.Once{}
+	})
+
+	helmChart := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:  chart.APIVersionV2,
+			Name:        chartName,
+			Version:     "1.0.0",
+			Annotations: annotations,
+		},
+	}
+	assetsPath := filepath.Join(repoRoot, repositoryAssetsDir, vendor)
+	if err := os.MkdirAll(assetsPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archivePath, err := chartutil.Save(helmChart, assetsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+// Returns the digest of version 1.0.0 of chartName in index.yaml
+func indexedDigest(t *testing.T, chartName string) string {
+	t.Helper()
+	storedVersions, err := getStoredVersions(chartName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, storedVersion := range storedVersions {
+		if storedVersion.Version == "1.0.0" {
+			return storedVersion.Digest
+		}
+	}
+	t.Fatalf("%s 1.0.0 is not indexed", chartName)
+
+	return ""
+}
+
+func TestAnnotateDigests(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		value       string
+		remove      bool
+		changed     bool
+	}{
+		{"same value", map[string]string{annotationHidden: "true"}, "true", false, false},
+		{"remove absent annotation", map[string]string{}, "", true, false},
+		{"new value", map[string]string{annotationHidden: "true"}, "false", false, true},
+		{"remove present annotation", map[string]string{annotationHidden: "true"}, "", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archivePath := setUpTestRepository(t, "acme", "widget", test.annotations)
+			archive, err := os.ReadFile(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := indexedDigest(t, "widget")
+
+			if err := annotate("acme", "widget", annotationHidden, test.value, test.remove, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeIndex(); err != nil {
+				t.Fatal(err)
+			}
+
+			annotatedArchive, err := os.ReadFile(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			annotatedDigest := indexedDigest(t, "widget")
+			if changed := !bytes.Equal(annotatedArchive, archive); changed != test.changed {
+				t.Errorf("expected archive changed to be %t, got %t", test.changed, changed)
+			}
+			if changed := annotatedDigest != digest; changed != test.changed {
+				t.Errorf("expected index digest changed to be %t, got %t (%s, was %s)", test.changed, changed, annotatedDigest, digest)
+			}
+		})
+	}
+}
+
+func TestTrackPackageRollback(t *testing.T) {
+	archivePath := setUpTestRepository(t, "acme", "widget", nil)
+	indexPath := filepath.Join(getRepoRoot(), indexFile)
+	index, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packageWrapper := PackageWrapper{
+		Name:         "widget",
+		ParsedVendor: "acme",
+		Path:         filepath.Join(getRepoRoot(), repositoryPackagesDir, "acme", "widget"),
+	}
+
+	tx := transaction.New()
+	if err := trackPackage(tx, packageWrapper); err != nil {
+		t.Fatal(err)
+	}
+	helmChart := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "widget", Version: "2.0.0"},
+	}
+	chartsPath := filepath.Join(getRepoRoot(), repositoryChartsDir, "acme", "widget")
+	written, err := saveChart(helmChart, "acme", chartsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(getRepoRoot(), written)); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be rolled back, got %v", written, err)
+	}
+	if _, err := os.Stat(chartsPath); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be rolled back, got %v", chartsPath, err)
+	}
+	if _, err := os.Stat(archivePath); err != nil {
+		t.Errorf("expected stored archive to be kept: %s", err)
+	}
+	if rolledBack, err := os.ReadFile(indexPath); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(rolledBack, index) {
+		t.Errorf("expected %s to be restored", indexFile)
+	}
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	defer func(previous int) { concurrency = previous }(concurrency)
+	for _, c := range []int{1, 4} {
+		concurrency = c
+		calls := make([]int32, 10)
+		forEachConcurrently(len(calls), func(i int) {
+			atomic.AddInt32(&calls[i], 1)
+		})
+		for i, n := range calls {
+			if n != 1 {
+				t.Errorf("concurrency %d: expected index %d to be visited once, got %d", c, i, n)
+			}
+		}
+	}
+}
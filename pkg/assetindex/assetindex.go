@@ -0,0 +1,79 @@
+package assetindex
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Skipped is a chart archive left out of an index because it could not
+// be indexed
+type Skipped struct {
+	// URL is the URL the archive would have in the index
+	URL string
+	Err error
+}
+
+func (s Skipped) Error() string {
+	return fmt.Sprintf("%s: %s", s.URL, s.Err)
+}
+
+// Directory indexes the chart archives in dir and its subdirectories,
+// like repo.IndexDirectory, with URLs relative to baseURL. Archives that
+// can not be read, loaded or added to the index are left out and
+// returned, rather than failing the whole index, or being dropped
+// silently as repo.IndexDirectory does with archives that fail to load.
+func Directory(dir, baseURL string) (*repo.IndexFile, []Skipped, error) {
+	archives, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, nil, err
+	}
+	moreArchives, err := filepath.Glob(filepath.Join(dir, "**/*.tgz"))
+	if err != nil {
+		return nil, nil, err
+	}
+	archives = append(archives, moreArchives...)
+
+	index := repo.NewIndexFile()
+	skipped := make([]Skipped, 0)
+	for _, archive := range archives {
+		relativePath, err := filepath.Rel(dir, archive)
+		if err != nil {
+			return nil, nil, err
+		}
+		parentDir, filename := path.Split(filepath.ToSlash(relativePath))
+		parentURL := path.Join(baseURL, strings.TrimSuffix(parentDir, "/"))
+		url := path.Join(parentURL, filename)
+
+		helmChart, err := loader.Load(archive)
+		if err != nil {
+			skipped = append(skipped, Skipped{URL: url, Err: fmt.Errorf("failed to load chart: %w", err)})
+			continue
+		}
+		digest, err := provenance.DigestFile(archive)
+		if err != nil {
+			skipped = append(skipped, Skipped{URL: url, Err: err})
+			continue
+		}
+		if err := index.MustAdd(helmChart.Metadata, filename, parentURL, digest); err != nil {
+			skipped = append(skipped, Skipped{URL: url, Err: err})
+		}
+	}
+
+	return index, skipped, nil
+}
+
+// URLs returns the URLs of the skipped archives, for lookups
+func URLs(skipped []Skipped) map[string]struct{} {
+	urls := make(map[string]struct{}, len(skipped))
+	for _, s := range skipped {
+		urls[s.URL] = struct{}{}
+	}
+
+	return urls
+}
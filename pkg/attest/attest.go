@@ -0,0 +1,261 @@
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Suffix is appended to the path of a chart archive to name its
+	// attestation
+	Suffix = ".intoto.jsonl"
+	// SigningKeyEnvVariable holds a PEM encoded PKCS #8 Ed25519 or
+	// ECDSA private key that attestations are signed with
+	SigningKeyEnvVariable = "PROVENANCE_SIGNING_KEY"
+
+	statementType     = "https://in-toto.io/Statement/v1"
+	predicateType     = "https://slsa.dev/provenance/v1"
+	payloadType       = "application/vnd.in-toto+json"
+	buildType         = "https://github.com/rancher/partner-charts-ci/conform@v1"
+	builderID         = "https://github.com/rancher/partner-charts-ci"
+	envelopeSignature = "DSSEv1"
+)
+
+// Provenance describes how a chart archive was built
+type Provenance struct {
+	// Package is the package the chart was built for, as printed by
+	// list
+	Package string
+	// Source is the kind of upstream, such as HelmRepo or Git
+	Source string
+	// UpstreamURL and UpstreamVersion identify the upstream chart
+	UpstreamURL     string
+	UpstreamVersion string
+	// UpstreamCommit is the commit of Git upstreams
+	UpstreamCommit string
+	// UpstreamDigest is the sha256 digest of the upstream archive, if
+	// the upstream publishes it
+	UpstreamDigest string
+	// Transformations lists the changes made to the upstream chart
+	Transformations []string
+	// ToolVersion is the version of partner-charts-ci
+	ToolVersion string
+	// InvocationID identifies the run, such as a GitHub Actions run URL
+	InvocationID string
+	StartedOn    time.Time
+	FinishedOn   time.Time
+}
+
+type statement struct {
+	Type          string    `json:"_type"`
+	Subject       []subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     predicate `json:"predicate"`
+}
+
+type subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type predicate struct {
+	BuildDefinition buildDefinition `json:"buildDefinition"`
+	RunDetails      runDetails      `json:"runDetails"`
+}
+
+type buildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]string    `json:"externalParameters"`
+	InternalParameters   map[string][]string  `json:"internalParameters,omitempty"`
+	ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type resourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type runDetails struct {
+	Builder  builder  `json:"builder"`
+	Metadata metadata `json:"metadata"`
+}
+
+type builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type metadata struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	StartedOn    string `json:"startedOn,omitempty"`
+	FinishedOn   string `json:"finishedOn,omitempty"`
+}
+
+type envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []signature `json:"signatures"`
+}
+
+type signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Write writes an in-toto statement with the SLSA provenance p of the
+// chart archive at archivePath next to it, in a DSSE envelope signed
+// with the key of SigningKeyEnvVariable, or unsigned if it is not set.
+// Returns the path of the attestation.
+func Write(archivePath string, p Provenance) (string, error) {
+	digest, err := digestFile(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	externalParameters := map[string]string{
+		"package": p.Package,
+		"source":  p.Source,
+		"version": p.UpstreamVersion,
+	}
+	dependency := resourceDescriptor{URI: p.UpstreamURL, Digest: make(map[string]string)}
+	if p.UpstreamCommit != "" {
+		dependency.Digest["gitCommit"] = p.UpstreamCommit
+	}
+	if p.UpstreamDigest != "" {
+		dependency.Digest["sha256"] = p.UpstreamDigest
+	}
+	definition := buildDefinition{
+		BuildType:          buildType,
+		ExternalParameters: externalParameters,
+	}
+	if len(p.Transformations) > 0 {
+		definition.InternalParameters = map[string][]string{"transformations": p.Transformations}
+	}
+	if p.UpstreamURL != "" {
+		definition.ResolvedDependencies = []resourceDescriptor{dependency}
+	}
+
+	s := statement{
+		Type:          statementType,
+		Subject:       []subject{{Name: filepath.Base(archivePath), Digest: map[string]string{"sha256": digest}}},
+		PredicateType: predicateType,
+		Predicate: predicate{
+			BuildDefinition: definition,
+			RunDetails: runDetails{
+				Builder: builder{ID: builderID, Version: map[string]string{"partner-charts-ci": p.ToolVersion}},
+				Metadata: metadata{
+					InvocationID: p.InvocationID,
+					StartedOn:    timestamp(p.StartedOn),
+					FinishedOn:   timestamp(p.FinishedOn),
+				},
+			},
+		},
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	e := envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []signature{},
+	}
+	if pemKey := os.Getenv(SigningKeyEnvVariable); pemKey != "" {
+		sig, err := sign([]byte(pemKey), pae(payloadType, payload))
+		if err != nil {
+			return "", fmt.Errorf("failed to sign attestation: %w", err)
+		}
+		e.Signatures = append(e.Signatures, sig)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	attestationPath := archivePath + Suffix
+	if err := os.WriteFile(attestationPath, append(line, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	return attestationPath, nil
+}
+
+// Returns the DSSE pre-authentication encoding of payload, which is
+// what gets signed
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("%s %d %s %d %s", envelopeSignature, len(payloadType), payloadType, len(payload), payload))
+}
+
+// Signs message with the PEM encoded private key pemKey. The key ID is
+// the sha256 digest of the public key.
+func sign(pemKey, message []byte) (signature, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return signature{}, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signature{}, err
+	}
+
+	var sig []byte
+	var public crypto.PublicKey
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, message)
+		public = k.Public()
+	case *ecdsa.PrivateKey:
+		hash := sha256.Sum256(message)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, hash[:])
+		if err != nil {
+			return signature{}, err
+		}
+		public = k.Public()
+	default:
+		return signature{}, fmt.Errorf("unsupported key type %T: must be Ed25519 or ECDSA", key)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return signature{}, err
+	}
+	keyID := sha256.Sum256(publicDER)
+
+	return signature{KeyID: hex.EncodeToString(keyID[:]), Sig: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+func digestFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ActionAdded is an annotation set for the first time on a version
+	ActionAdded = "added"
+	// ActionChanged is an annotation whose value changed
+	ActionChanged = "changed"
+	// ActionRemoved is an annotation removed from a version
+	ActionRemoved = "removed"
+)
+
+// AnnotationChange is a change to an annotation of a chart version,
+// with the commit that made it
+type AnnotationChange struct {
+	Version    string    `json:"version"`
+	Annotation string    `json:"annotation"`
+	Action     string    `json:"action"`
+	Previous   string    `json:"previous,omitempty"`
+	Value      string    `json:"value,omitempty"`
+	Commit     string    `json:"commit"`
+	Author     string    `json:"author"`
+	Email      string    `json:"email"`
+	When       time.Time `json:"when"`
+}
+
+func (a AnnotationChange) String() string {
+	switch a.Action {
+	case ActionAdded:
+		return fmt.Sprintf("%s %s: %s = %q", a.Version, a.Action, a.Annotation, a.Value)
+	case ActionRemoved:
+		return fmt.Sprintf("%s %s: %s (was %q)", a.Version, a.Action, a.Annotation, a.Previous)
+	}
+
+	return fmt.Sprintf("%s %s: %s = %q (was %q)", a.Version, a.Action, a.Annotation, a.Value, a.Previous)
+}
+
+// AnnotationHistory walks the history of the Chart.yaml at
+// chartYamlPath, relative to the root of the repository at repoPath,
+// oldest commit first, and returns every change to the annotations of
+// each chart version it held. Annotations of a version that appears
+// for the first time are reported as added.
+func AnnotationHistory(repoPath, chartYamlPath string) ([]AnnotationChange, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commitIter, err := r.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderCommitterTime, FileName: &chartYamlPath})
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*object.Commit, 0)
+	err = commitIter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// last known annotations of each version
+	annotations := make(map[string]map[string]string)
+	changes := make([]AnnotationChange, 0)
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		metadata, err := readMetadata(c, chartYamlPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s at %s: %w", chartYamlPath, c.Hash, err)
+		} else if metadata == nil {
+			continue
+		}
+		logrus.Debugf("Comparing %s %s at %s\n", chartYamlPath, metadata.Version, c.Hash)
+
+		record := func(annotation, action, previous, value string) {
+			changes = append(changes, AnnotationChange{
+				Version:    metadata.Version,
+				Annotation: annotation,
+				Action:     action,
+				Previous:   previous,
+				Value:      value,
+				Commit:     c.Hash.String(),
+				Author:     c.Author.Name,
+				Email:      c.Author.Email,
+				When:       c.Author.When,
+			})
+		}
+		previous := annotations[metadata.Version]
+		for _, annotation := range sortedKeys(metadata.Annotations) {
+			value := metadata.Annotations[annotation]
+			previousValue, ok := previous[annotation]
+			switch {
+			case !ok:
+				record(annotation, ActionAdded, "", value)
+			case previousValue != value:
+				record(annotation, ActionChanged, previousValue, value)
+			}
+		}
+		for _, annotation := range sortedKeys(previous) {
+			if _, ok := metadata.Annotations[annotation]; !ok {
+				record(annotation, ActionRemoved, previous[annotation], "")
+			}
+		}
+		annotations[metadata.Version] = metadata.Annotations
+	}
+
+	return changes, nil
+}
+
+// Reads the chart metadata at filePath in commit c, or nil if the file
+// does not exist there
+func readMetadata(c *object.Commit, filePath string) (*chart.Metadata, error) {
+	file, err := c.File(filePath)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &chart.Metadata{}
+	if err := yaml.Unmarshal([]byte(contents), metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Annotations == nil {
+		metadata.Annotations = make(map[string]string)
+	}
+
+	return metadata, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,218 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/icons"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	indexFile    = "index.yaml"
+	manifestFile = "manifest.yaml"
+	//iconsDir is where remote icons are downloaded to in the bundle
+	iconsDir   = "assets/icons"
+	fileScheme = "file://"
+)
+
+// Manifest lists the contents of a bundle with their digests
+type Manifest struct {
+	Created time.Time      `json:"created"`
+	Charts  map[string]int `json:"charts"`
+	Files   []File         `json:"files"`
+}
+
+// File is a single file of a bundle
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Write packages the chart archives and icons referenced by index,
+// index itself, and a manifest of all of them, into a gzipped tarball
+// at outputPath. Chart and icon paths in index are relative to
+// repoRoot and keep the same paths within the bundle. Remote icons are
+// downloaded into iconsDir of the bundle, and the bundled index points
+// at them instead. Nothing is left at outputPath if writing fails.
+func Write(outputPath, repoRoot string, index *repo.IndexFile) (Manifest, error) {
+	manifest := Manifest{
+		Created: time.Now().UTC(),
+		Charts:  make(map[string]int),
+		Files:   make([]File, 0),
+	}
+
+	chartNames := make([]string, 0, len(index.Entries))
+	filePaths := make(map[string]struct{})
+	for chartName, chartVersions := range index.Entries {
+		chartNames = append(chartNames, chartName)
+		manifest.Charts[chartName] = len(chartVersions)
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) == 0 {
+				return manifest, fmt.Errorf("%s (%s) has no URL", chartName, chartVersion.Version)
+			}
+			filePaths[chartVersion.URLs[0]] = struct{}{}
+			if strings.HasPrefix(chartVersion.Icon, fileScheme) && !icons.IsEmbedded(chartVersion.Icon) {
+				filePaths[strings.TrimPrefix(chartVersion.Icon, fileScheme)] = struct{}{}
+			}
+		}
+	}
+	sort.Strings(chartNames)
+
+	// remote icons are downloaded before the bundle is created, so that
+	// an unreachable icon does not leave a partial bundle behind
+	bundleIndex := repo.NewIndexFile()
+	bundleIndex.Generated = index.Generated
+	iconPaths := make(map[string]string)
+	downloadedIcons := make(map[string][]byte)
+	for _, chartName := range chartNames {
+		for _, chartVersion := range index.Entries[chartName] {
+			bundledVersion := *chartVersion
+			if isRemote(chartVersion.Icon) {
+				iconPath, ok := iconPaths[chartVersion.Icon]
+				if !ok {
+					data, ext, err := icons.Download(chartVersion.Icon)
+					if err != nil {
+						return manifest, fmt.Errorf("failed to bundle the icon of %s (%s): %w", chartName, chartVersion.Version, err)
+					}
+					iconPath = freeIconPath(chartName, ext, filePaths, downloadedIcons)
+					iconPaths[chartVersion.Icon] = iconPath
+					downloadedIcons[iconPath] = data
+				}
+				metadata := *chartVersion.Metadata
+				metadata.Icon = fileScheme + iconPath
+				bundledVersion.Metadata = &metadata
+			}
+			bundleIndex.Entries[chartName] = append(bundleIndex.Entries[chartName], &bundledVersion)
+		}
+	}
+
+	for iconPath := range downloadedIcons {
+		filePaths[iconPath] = struct{}{}
+	}
+	sortedPaths := make([]string, 0, len(filePaths))
+	for filePath := range filePaths {
+		sortedPaths = append(sortedPaths, filePath)
+	}
+	sort.Strings(sortedPaths)
+
+	bundleFile, err := os.Create(outputPath)
+	if err != nil {
+		return manifest, err
+	}
+	if err := writeBundle(bundleFile, &manifest, repoRoot, sortedPaths, downloadedIcons, bundleIndex); err != nil {
+		bundleFile.Close()
+		if removeErr := os.Remove(outputPath); removeErr != nil {
+			logrus.Errorf("Failed to remove incomplete bundle %s: %s", outputPath, removeErr)
+		}
+		return manifest, err
+	}
+
+	return manifest, nil
+}
+
+// Writes the files at filePaths, read from downloadedIcons or else from
+// repoRoot, index and manifest to bundleFile, and closes it
+func writeBundle(bundleFile *os.File, manifest *Manifest, repoRoot string, filePaths []string, downloadedIcons map[string][]byte, index *repo.IndexFile) error {
+	gzipWriter := gzip.NewWriter(bundleFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, filePath := range filePaths {
+		data, ok := downloadedIcons[filePath]
+		if !ok {
+			var err error
+			data, err = os.ReadFile(filepath.Join(repoRoot, filePath))
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeFile(tarWriter, manifest, filePath, data); err != nil {
+			return err
+		}
+	}
+
+	indexData, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tarWriter, manifest, indexFile, indexData); err != nil {
+		return err
+	}
+
+	manifestData, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeToTar(tarWriter, manifestFile, manifestData); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	return bundleFile.Close()
+}
+
+// Returns whether icon is a URL to download rather than a file of the
+// repository or of its chart
+func isRemote(icon string) bool {
+	return strings.HasPrefix(icon, "http://") || strings.HasPrefix(icon, "https://")
+}
+
+// Returns the path within the bundle for a downloaded icon of chartName,
+// <chart><ext> in iconsDir unless it is already taken by another file
+func freeIconPath(chartName, ext string, filePaths map[string]struct{}, downloadedIcons map[string][]byte) string {
+	taken := func(iconPath string) bool {
+		_, isFile := filePaths[iconPath]
+		_, isDownloaded := downloadedIcons[iconPath]
+		return isFile || isDownloaded
+	}
+	iconPath := path.Join(iconsDir, chartName+ext)
+	for i := 2; taken(iconPath); i++ {
+		iconPath = path.Join(iconsDir, fmt.Sprintf("%s-%d%s", chartName, i, ext))
+	}
+
+	return iconPath
+}
+
+func writeFile(tarWriter *tar.Writer, manifest *Manifest, filePath string, data []byte) error {
+	logrus.Debugf("Adding %s to bundle\n", filePath)
+	manifest.Files = append(manifest.Files, File{
+		Path:   filePath,
+		SHA256: fmt.Sprintf("%x", sha256.Sum256(data)),
+		Size:   len(data),
+	})
+
+	return writeToTar(tarWriter, filePath, data)
+}
+
+func writeToTar(tarWriter *tar.Writer, filePath string, data []byte) error {
+	header := &tar.Header{
+		Name:    filepath.ToSlash(filePath),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tarWriter.Write(data)
+
+	return err
+}
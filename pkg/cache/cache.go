@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	//DirEnvVariable sets the environment variable to check for the cache root
+	DirEnvVariable = "PARTNER_CHARTS_CACHE_DIR"
+	//MaxSizeEnvVariable sets the environment variable to check for the cache size cap in megabytes
+	MaxSizeEnvVariable = "PARTNER_CHARTS_CACHE_MAX_SIZE"
+	defaultMaxSizeMB   = 2048
+
+	KindCharts = "charts"
+	KindGit    = "git"
+	KindIcons  = "icons"
+	KindIndex  = "index"
+	KindOCI    = "oci"
+)
+
+// Kinds lists every subdirectory of the cache root, in the order they
+// are considered for eviction
+var Kinds = []string{KindCharts, KindOCI, KindIcons, KindIndex, KindGit}
+
+var (
+	defaultCache *Cache
+	defaultOnce  sync.Once
+	// entryLocks holds the lock of each entry locked with Lock
+	entryLocks = struct {
+		mu    sync.Mutex
+		locks map[string]*sync.Mutex
+	}{locks: make(map[string]*sync.Mutex)}
+)
+
+// Cache is an on-disk cache of upstream artifacts laid out so that the
+// whole root directory can be persisted between CI runs (for example
+// with actions/cache). Each kind of artifact lives in its own
+// subdirectory and entries are named by the sha256 of their key.
+type Cache struct {
+	Root    string
+	MaxSize int64
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Default returns the cache configured through the environment, or nil
+// if caching is disabled
+func Default() *Cache {
+	defaultOnce.Do(func() {
+		root := os.Getenv(DirEnvVariable)
+		if root == "" {
+			return
+		}
+
+		maxSizeMB := int64(defaultMaxSizeMB)
+		if rawMaxSize := os.Getenv(MaxSizeEnvVariable); rawMaxSize != "" {
+			parsed, err := strconv.ParseInt(rawMaxSize, 10, 64)
+			if err != nil {
+				logrus.Errorf("invalid %s %q: %s", MaxSizeEnvVariable, rawMaxSize, err)
+			} else {
+				maxSizeMB = parsed
+			}
+		}
+
+		c, err := New(root, maxSizeMB*1024*1024)
+		if err != nil {
+			logrus.Errorf("failed to initialize cache: %s", err)
+			return
+		}
+		defaultCache = c
+	})
+
+	return defaultCache
+}
+
+// New creates the cache directory layout under root
+func New(root string, maxSize int64) (*Cache, error) {
+	for _, kind := range Kinds {
+		if err := os.MkdirAll(filepath.Join(root, kind), 0755); err != nil {
+			return nil, fmt.Errorf("failed to mkdir %q: %w", kind, err)
+		}
+	}
+	logrus.Debugf("Using cache directory %s\n", root)
+
+	return &Cache{Root: root, MaxSize: maxSize}, nil
+}
+
+// Path returns the location of the entry for key within kind. Accessing
+// an entry through Path does not update its eviction order; use Touch.
+func (c *Cache) Path(kind, key string) string {
+	return filepath.Join(c.Root, kind, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+}
+
+// Read returns the cached content for key, marking it as recently used
+func (c *Cache) Read(kind, key string) ([]byte, error) {
+	entryPath := c.Path(kind, key)
+	data, err := os.ReadFile(entryPath)
+	if err != nil {
+		return nil, err
+	}
+	c.Touch(entryPath)
+
+	return data, nil
+}
+
+// Write stores data as the content for key
+func (c *Cache) Write(kind, key string, data []byte) error {
+	entryPath := c.Path(kind, key)
+	// concurrent writes of the same entry each use their own file
+	f, err := os.CreateTemp(filepath.Dir(entryPath), filepath.Base(entryPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, entryPath)
+}
+
+// Lock locks the entry for key within kind against updates by other
+// goroutines, such as a git clone being fetched, and returns the
+// function that unlocks it
+func (c *Cache) Lock(kind, key string) func() {
+	entryPath := c.Path(kind, key)
+	entryLocks.mu.Lock()
+	l, ok := entryLocks.locks[entryPath]
+	if !ok {
+		l = &sync.Mutex{}
+		entryLocks.locks[entryPath] = l
+	}
+	entryLocks.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// Touch marks the entry at entryPath as recently used
+func (c *Cache) Touch(entryPath string) {
+	now := time.Now()
+	if err := os.Chtimes(entryPath, now, now); err != nil {
+		logrus.Debug(err)
+	}
+}
+
+// Evict removes least recently used entries until the cache fits
+// within MaxSize. An entry is a top-level file or directory of a kind
+// subdirectory; git clones are evicted as a whole.
+func (c *Cache) Evict() error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	var entries []entry
+	var total int64
+	for _, kind := range Kinds {
+		kindPath := filepath.Join(c.Root, kind)
+		dirEntries, err := os.ReadDir(kindPath)
+		if err != nil {
+			return err
+		}
+		for _, dirEntry := range dirEntries {
+			info, err := dirEntry.Info()
+			if err != nil {
+				return err
+			}
+			entryPath := filepath.Join(kindPath, dirEntry.Name())
+			size := info.Size()
+			if info.IsDir() {
+				size, err = dirSize(entryPath)
+				if err != nil {
+					return err
+				}
+			}
+			entries = append(entries, entry{path: entryPath, size: size, modTime: info.ModTime()})
+			total += size
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	for _, e := range entries {
+		if total <= c.MaxSize {
+			break
+		}
+		logrus.Debugf("Evicting %s from cache\n", e.path)
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("failed to evict %q: %w", e.path, err)
+		}
+		total -= e.size
+	}
+
+	return nil
+}
+
+func dirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
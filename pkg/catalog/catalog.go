@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// AnnotationPrefix is the prefix of the annotations that Rancher reads
+// from charts in its catalog
+const AnnotationPrefix = "catalog.cattle.io/"
+
+// Export holds the catalog annotations of every stored chart version,
+// by chart name and version
+type Export struct {
+	Charts map[string]map[string]map[string]string `json:"charts"`
+}
+
+// FromIndex returns the catalog annotations of every chart version in
+// index
+func FromIndex(index *repo.IndexFile) Export {
+	export := Export{Charts: make(map[string]map[string]map[string]string)}
+	for chartName, chartVersions := range index.Entries {
+		versions := make(map[string]map[string]string, len(chartVersions))
+		for _, chartVersion := range chartVersions {
+			versions[chartVersion.Version] = Annotations(chartVersion.Annotations)
+		}
+		export.Charts[chartName] = versions
+	}
+
+	return export
+}
+
+// Annotations returns the catalog annotations among annotations
+func Annotations(annotations map[string]string) map[string]string {
+	catalogAnnotations := make(map[string]string)
+	for annotation, value := range annotations {
+		if strings.HasPrefix(annotation, AnnotationPrefix) {
+			catalogAnnotations[annotation] = value
+		}
+	}
+
+	return catalogAnnotations
+}
+
+// Load reads the export file at exportPath
+func Load(exportPath string) (Export, error) {
+	export := Export{}
+	exportFile, err := os.ReadFile(exportPath)
+	if err != nil {
+		return export, err
+	}
+	if err := yaml.Unmarshal(exportFile, &export); err != nil {
+		return export, fmt.Errorf("failed to parse %s: %w", exportPath, err)
+	}
+
+	return export, nil
+}
+
+// Write writes e to the file at exportPath
+func (e Export) Write(exportPath string) error {
+	exportFile, err := yaml.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(exportPath, exportFile, 0644)
+}
+
+// Count returns the number of chart versions in e
+func (e Export) Count() int {
+	count := 0
+	for _, versions := range e.Charts {
+		count += len(versions)
+	}
+
+	return count
+}
+
+// Apply replaces the catalog annotations of annotations with wanted,
+// leaving other annotations alone, and returns a description of each
+// change made
+func Apply(annotations map[string]string, wanted map[string]string) []string {
+	wanted = Annotations(wanted)
+	changes := make([]string, 0)
+	for annotation, value := range annotations {
+		if _, ok := wanted[annotation]; !ok && strings.HasPrefix(annotation, AnnotationPrefix) {
+			changes = append(changes, fmt.Sprintf("removed %s=%q", annotation, value))
+			delete(annotations, annotation)
+		}
+	}
+	for annotation, value := range wanted {
+		if current, ok := annotations[annotation]; !ok {
+			changes = append(changes, fmt.Sprintf("added %s=%q", annotation, value))
+		} else if current != value {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", annotation, current, value))
+		} else {
+			continue
+		}
+		annotations[annotation] = value
+	}
+	sort.Strings(changes)
+
+	return changes
+}
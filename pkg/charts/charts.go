@@ -0,0 +1,92 @@
+package charts
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// LoadFunc loads the full chart of a stored chart version, such as
+// the Load method of a storage backend
+type LoadFunc func(chartVersion *repo.ChartVersion) (*chart.Chart, error)
+
+// Iterator walks stored chart versions in order using only their index
+// metadata, and loads the full chart of a version only when Chart is
+// called for it. Commands that touch vendors with hundreds of versions
+// can skip the versions they do not need to change without reading
+// their archives.
+//
+//	it := charts.New(storedVersions, storage.Default().Load)
+//	for it.Next() {
+//		if skip(it.Version()) {
+//			continue
+//		}
+//		helmChart, err := it.Chart()
+//		...
+//	}
+type Iterator struct {
+	versions repo.ChartVersions
+	load     LoadFunc
+	index    int
+	loaded   *chart.Chart
+}
+
+// New returns an Iterator over versions that loads charts with load
+func New(versions repo.ChartVersions, load LoadFunc) *Iterator {
+	return &Iterator{versions: versions, load: load, index: -1}
+}
+
+// Next advances to the next version, returning false when there are
+// no more versions
+func (it *Iterator) Next() bool {
+	if it.index < len(it.versions) {
+		it.index++
+	}
+	it.loaded = nil
+
+	return it.index < len(it.versions)
+}
+
+// Index returns the position of the current version
+func (it *Iterator) Index() int {
+	return it.index
+}
+
+// Version returns the index metadata of the current version
+func (it *Iterator) Version() *repo.ChartVersion {
+	return it.versions[it.index]
+}
+
+// Chart loads the full chart of the current version on the first call
+// and returns the same chart on later calls
+func (it *Iterator) Chart() (*chart.Chart, error) {
+	if it.loaded != nil {
+		return it.loaded, nil
+	}
+	chartVersion := it.Version()
+	helmChart, err := it.load(chartVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s (%s): %w", chartVersion.Name, chartVersion.Version, err)
+	}
+	it.loaded = helmChart
+
+	return helmChart, nil
+}
+
+// Partition splits versions by keep without loading any chart,
+// preserving their order
+func Partition(versions repo.ChartVersions, keep func(chartVersion *repo.ChartVersion) bool) (repo.ChartVersions, repo.ChartVersions) {
+	kept := make(repo.ChartVersions, 0, len(versions))
+	rest := make(repo.ChartVersions, 0, len(versions))
+	it := New(versions, nil)
+	for it.Next() {
+		if keep(it.Version()) {
+			kept = append(kept, it.Version())
+		} else {
+			rest = append(rest, it.Version())
+		}
+	}
+
+	return kept, rest
+}
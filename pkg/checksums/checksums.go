@@ -0,0 +1,102 @@
+package checksums
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	// File is the name of the checksum manifests, in the format of
+	// sha256sum
+	File = "SHA256SUMS"
+
+	// ModeGlobal writes a single manifest for all archives
+	ModeGlobal = "global"
+	// ModeVendor writes a manifest to the directory of each vendor
+	ModeVendor = "vendor"
+)
+
+// Write writes the digests of the chart archives in index that lie in
+// the assets directory assetsDir of the repository at repoRoot to
+// SHA256SUMS manifests, either one in assetsDir or one per vendor
+// directory, depending on mode. Manifests that are no longer needed,
+// for example after the mode changes, are removed. Paths in each
+// manifest are relative to its directory, so that it can be checked
+// with sha256sum -c from there.
+func Write(repoRoot, assetsDir string, index *repo.IndexFile, mode string) error {
+	if mode != ModeGlobal && mode != ModeVendor {
+		return fmt.Errorf("invalid checksums mode %q: must be %s or %s", mode, ModeGlobal, ModeVendor)
+	}
+
+	// digests of the archives of each manifest directory, by path
+	manifests := make(map[string]map[string]string)
+	for _, chartVersions := range index.Entries {
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) == 0 || !strings.HasPrefix(chartVersion.URLs[0], assetsDir+"/") {
+				continue
+			}
+			relativePath := strings.TrimPrefix(chartVersion.URLs[0], assetsDir+"/")
+			dir := ""
+			if mode == ModeVendor {
+				dir = path.Dir(relativePath)
+				if dir == "." {
+					dir = ""
+				}
+				relativePath = path.Base(relativePath)
+			}
+			if manifests[dir] == nil {
+				manifests[dir] = make(map[string]string)
+			}
+			manifests[dir][relativePath] = chartVersion.Digest
+		}
+	}
+
+	assetsPath := filepath.Join(repoRoot, assetsDir)
+	for dir, digests := range manifests {
+		paths := make([]string, 0, len(digests))
+		for archivePath := range digests {
+			paths = append(paths, archivePath)
+		}
+		sort.Strings(paths)
+		var b strings.Builder
+		for _, archivePath := range paths {
+			fmt.Fprintf(&b, "%s  %s\n", digests[archivePath], archivePath)
+		}
+		manifestPath := filepath.Join(assetsPath, filepath.FromSlash(dir), File)
+		if err := os.WriteFile(manifestPath, []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", manifestPath, err)
+		}
+	}
+
+	existing, err := filepath.Glob(filepath.Join(assetsPath, "*", File))
+	if err != nil {
+		return err
+	}
+	existing = append(existing, filepath.Join(assetsPath, File))
+	for _, manifestPath := range existing {
+		dir, err := filepath.Rel(assetsPath, filepath.Dir(manifestPath))
+		if err != nil {
+			return err
+		}
+		if dir == "." {
+			dir = ""
+		}
+		if _, ok := manifests[filepath.ToSlash(dir)]; ok {
+			continue
+		}
+		if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return err
+		} else if err == nil {
+			logrus.Debugf("Removed stale %s\n", manifestPath)
+		}
+	}
+
+	return nil
+}
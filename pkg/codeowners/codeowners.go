@@ -0,0 +1,90 @@
+package codeowners
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	beginMarker = "# BEGIN partner-charts-ci vendor owners"
+	endMarker   = "# END partner-charts-ci vendor owners"
+)
+
+// Locations are the paths, relative to the repository root, that
+// GitHub reads CODEOWNERS from, in order of precedence
+var Locations = []string{
+	filepath.Join(".github", "CODEOWNERS"),
+	"CODEOWNERS",
+	filepath.Join("docs", "CODEOWNERS"),
+}
+
+// Find returns the path of the CODEOWNERS file in repoRoot that GitHub
+// uses, or .github/CODEOWNERS if there is none
+func Find(repoRoot string) string {
+	for _, location := range Locations {
+		if _, err := os.Stat(filepath.Join(repoRoot, location)); err == nil {
+			return filepath.Join(repoRoot, location)
+		}
+	}
+
+	return filepath.Join(repoRoot, Locations[0])
+}
+
+// Update returns existing with its managed block replaced by a rule
+// per vendor, assigning packagesDir/<vendor>/** to the vendor's GitHub
+// handles. Lines outside the block are kept as they are, and the block
+// is appended if existing has none. Since later rules take precedence,
+// appending lets vendor owners override broader rules above.
+func Update(existing []byte, packagesDir string, owners map[string][]string) []byte {
+	vendors := make([]string, 0, len(owners))
+	for vendor, handles := range owners {
+		if len(handles) > 0 {
+			vendors = append(vendors, vendor)
+		}
+	}
+	sort.Strings(vendors)
+
+	block := []string{beginMarker}
+	for _, vendor := range vendors {
+		handles := make([]string, 0, len(owners[vendor]))
+		for _, handle := range owners[vendor] {
+			handles = append(handles, "@"+strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+		}
+		block = append(block, fmt.Sprintf("/%s/%s/** %s", packagesDir, vendor, strings.Join(handles, " ")))
+	}
+	block = append(block, endMarker)
+
+	lines := strings.Split(strings.TrimRight(string(existing), "\n"), "\n")
+	if len(existing) == 0 {
+		lines = nil
+	}
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case beginMarker:
+			begin = i
+		case endMarker:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+
+	var updated []string
+	if begin >= 0 && end > begin {
+		updated = append(updated, lines[:begin]...)
+		updated = append(updated, block...)
+		updated = append(updated, lines[end+1:]...)
+	} else {
+		updated = append(updated, lines...)
+		if len(updated) > 0 {
+			updated = append(updated, "")
+		}
+		updated = append(updated, block...)
+	}
+
+	return []byte(strings.Join(updated, "\n") + "\n")
+}
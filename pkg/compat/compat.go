@@ -0,0 +1,92 @@
+package compat
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	//KubeVersionAnnotation is the supported Kubernetes versions of
+	//charts that do not set kubeVersion
+	KubeVersionAnnotation = "catalog.cattle.io/kube-version"
+	//RancherVersionAnnotation is the supported Rancher versions of a
+	//chart
+	RancherVersionAnnotation = "catalog.cattle.io/rancher-version"
+
+	//anyVersion is rendered for versions without a constraint
+	anyVersion = "any"
+)
+
+// Entry is the supported Kubernetes and Rancher versions of a stored
+// chart version. Empty constraints mean any version.
+type Entry struct {
+	Package        string `json:"package"`
+	Chart          string `json:"chart"`
+	Version        string `json:"version"`
+	AppVersion     string `json:"appVersion,omitempty"`
+	KubeVersion    string `json:"kubeVersion,omitempty"`
+	RancherVersion string `json:"rancherVersion,omitempty"`
+	Deprecated     bool   `json:"deprecated,omitempty"`
+}
+
+// Entries returns an entry for each of chartVersions, the stored
+// versions of package packageName, in the same order. The Kubernetes
+// constraint is taken from kubeVersion, or from the kube-version
+// annotation if it is not set.
+func Entries(packageName string, chartVersions repo.ChartVersions) []Entry {
+	entries := make([]Entry, 0, len(chartVersions))
+	for _, chartVersion := range chartVersions {
+		kubeVersion := chartVersion.KubeVersion
+		if kubeVersion == "" {
+			kubeVersion = chartVersion.Annotations[KubeVersionAnnotation]
+		}
+		entries = append(entries, Entry{
+			Package:        packageName,
+			Chart:          chartVersion.Name,
+			Version:        chartVersion.Version,
+			AppVersion:     chartVersion.AppVersion,
+			KubeVersion:    kubeVersion,
+			RancherVersion: chartVersion.Annotations[RancherVersionAnnotation],
+			Deprecated:     chartVersion.Deprecated,
+		})
+	}
+
+	return entries
+}
+
+// Markdown renders entries as one table per package, in the order the
+// packages first appear in entries
+func Markdown(entries []Entry) string {
+	var b strings.Builder
+	b.WriteString("# Chart compatibility matrix\n")
+	if len(entries) == 0 {
+		b.WriteString("\nNo stored chart versions.\n")
+		return b.String()
+	}
+
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].Package != entry.Package {
+			fmt.Fprintf(&b, "\n## %s\n\n", entry.Package)
+			b.WriteString("| Chart version | App version | Kubernetes | Rancher |\n")
+			b.WriteString("| --- | --- | --- | --- |\n")
+		}
+		version := entry.Version
+		if entry.Deprecated {
+			version += " (deprecated)"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", version, cell(entry.AppVersion, ""), cell(entry.KubeVersion, anyVersion), cell(entry.RancherVersion, anyVersion))
+	}
+
+	return b.String()
+}
+
+// Renders value as a table cell, or fallback if it is empty
+func cell(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return "`" + strings.ReplaceAll(value, "|", "\\|") + "`"
+}
@@ -0,0 +1,48 @@
+package conform
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const (
+	requirementsFile     = "requirements.yaml"
+	requirementsLockFile = "requirements.lock"
+)
+
+// ConvertToAPIVersionV2 converts an apiVersion v1 chart, and any v1
+// subcharts, to apiVersion v2. The loader has already read the
+// dependencies from requirements.yaml into the chart metadata and the
+// lock from requirements.lock, so both files are dropped and are
+// written as part of Chart.yaml and Chart.lock instead. Returns true
+// if any chart was converted.
+func ConvertToAPIVersionV2(helmChart *chart.Chart) bool {
+	converted := false
+	for _, subchart := range helmChart.Dependencies() {
+		if ConvertToAPIVersionV2(subchart) {
+			converted = true
+		}
+	}
+
+	if helmChart.Metadata.APIVersion != chart.APIVersionV1 {
+		return converted
+	}
+
+	logrus.Debugf("Converting %s to apiVersion %s\n", helmChart.Name(), chart.APIVersionV2)
+	helmChart.Metadata.APIVersion = chart.APIVersionV2
+	if helmChart.Metadata.Type == "" {
+		helmChart.Metadata.Type = "application"
+	}
+
+	remainingFiles := make([]*chart.File, 0, len(helmChart.Files))
+	for _, file := range helmChart.Files {
+		if file.Name == requirementsFile || file.Name == requirementsLockFile {
+			continue
+		}
+		remainingFiles = append(remainingFiles, file)
+	}
+	helmChart.Files = remainingFiles
+
+	return true
+}
@@ -24,7 +24,7 @@ func OverlayChartMetadata(helmChart *chart.Chart, overlay chart.Metadata) {
 		helmChart.Metadata.Home = overlay.Home
 	}
 	if overlay.Sources != nil {
-		helmChart.Metadata.Sources = append(helmChart.Metadata.Sources, overlay.Sources...)
+		helmChart.Metadata.Sources = appendMissing(helmChart.Metadata.Sources, overlay.Sources)
 	}
 	if overlay.Version != "" {
 		helmChart.Metadata.Version = overlay.Version
@@ -33,10 +33,14 @@ func OverlayChartMetadata(helmChart *chart.Chart, overlay chart.Metadata) {
 		helmChart.Metadata.Description = overlay.Description
 	}
 	if overlay.Keywords != nil {
-		helmChart.Metadata.Keywords = append(helmChart.Metadata.Keywords, overlay.Keywords...)
+		helmChart.Metadata.Keywords = appendMissing(helmChart.Metadata.Keywords, overlay.Keywords)
 	}
 	if overlay.Maintainers != nil {
-		helmChart.Metadata.Maintainers = append(helmChart.Metadata.Maintainers, overlay.Maintainers...)
+		for _, maintainer := range overlay.Maintainers {
+			if !hasMaintainer(helmChart.Metadata.Maintainers, maintainer) {
+				helmChart.Metadata.Maintainers = append(helmChart.Metadata.Maintainers, maintainer)
+			}
+		}
 	}
 	if overlay.Icon != "" {
 		helmChart.Metadata.Icon = overlay.Icon
@@ -68,7 +72,11 @@ func OverlayChartMetadata(helmChart *chart.Chart, overlay chart.Metadata) {
 	}
 	*/
 	if overlay.Dependencies != nil {
-		helmChart.Metadata.Dependencies = append(helmChart.Metadata.Dependencies, overlay.Dependencies...)
+		for _, dependency := range overlay.Dependencies {
+			if !hasDependency(helmChart.Metadata.Dependencies, dependency) {
+				helmChart.Metadata.Dependencies = append(helmChart.Metadata.Dependencies, dependency)
+			}
+		}
 	}
 	if overlay.Type != "" {
 		helmChart.Metadata.Type = overlay.Type
@@ -76,12 +84,55 @@ func OverlayChartMetadata(helmChart *chart.Chart, overlay chart.Metadata) {
 
 }
 
+// appendMissing appends the values of overlay not already in values, so
+// that overlaying the same metadata twice has no further effect
+func appendMissing(values, overlay []string) []string {
+	for _, value := range overlay {
+		found := false
+		for _, existing := range values {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func hasMaintainer(maintainers []*chart.Maintainer, maintainer *chart.Maintainer) bool {
+	for _, existing := range maintainers {
+		if existing.Name == maintainer.Name && existing.Email == maintainer.Email {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasDependency(dependencies []*chart.Dependency, dependency *chart.Dependency) bool {
+	for _, existing := range dependencies {
+		if existing.Name == dependency.Name && existing.Alias == dependency.Alias {
+			return true
+		}
+	}
+
+	return false
+}
+
 func annotateChart(helmChart *chart.Chart, annotation, value string, override bool) bool {
 	modified := false
 	if helmChart.Metadata.Annotations == nil {
 		helmChart.Metadata.Annotations = make(map[string]string)
 	}
-	if _, ok := helmChart.Metadata.Annotations[annotation]; !ok || override {
+	currentValue, ok := helmChart.Metadata.Annotations[annotation]
+	if ok && currentValue == value {
+		return false
+	}
+	if !ok || override {
 		logrus.Debugf("Adding annotation '%s: %s' to %s (%s)\n", annotation, value, helmChart.Name(), helmChart.Metadata.Version)
 		helmChart.Metadata.Annotations[annotation] = value
 		modified = true
@@ -194,3 +245,16 @@ func GeneratePackageVersion(upstreamChartVersion string, packageVersion *int, ve
 
 	return chartVersion.String(), nil
 }
+
+// DeriveDisplayName generates a display name from a package name, for
+// example "kubewarden-controller" becomes "Kubewarden Controller"
+func DeriveDisplayName(packageName string) string {
+	words := strings.FieldsFunc(packageName, func(r rune) bool {
+		return r == '-' || r == '_' || r == ' '
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,56 @@
+package conform
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const (
+	crdsDir      = "crds"
+	templatesDir = "templates"
+	//CRDChartSuffix is appended to a chart name to form its CRD chart name
+	CRDChartSuffix = "-crd"
+)
+
+// SplitCRDChart moves the contents of the crds directory of helmChart
+// into a new companion chart, placing them in its templates directory
+// so that they are upgraded along with the chart. Returns nil if
+// helmChart has no CRDs.
+func SplitCRDChart(helmChart *chart.Chart) *chart.Chart {
+	crdChart := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:  chart.APIVersionV2,
+			Name:        helmChart.Metadata.Name + CRDChartSuffix,
+			Version:     helmChart.Metadata.Version,
+			AppVersion:  helmChart.Metadata.AppVersion,
+			Description: fmt.Sprintf("Installs the CRDs for %s.", helmChart.Metadata.Name),
+			KubeVersion: helmChart.Metadata.KubeVersion,
+			Type:        "application",
+		},
+	}
+
+	remainingFiles := make([]*chart.File, 0, len(helmChart.Files))
+	for _, file := range helmChart.Files {
+		if strings.HasPrefix(file.Name, crdsDir+"/") {
+			logrus.Debugf("Moving %s to %s\n", file.Name, crdChart.Metadata.Name)
+			crdChart.Templates = append(crdChart.Templates, &chart.File{
+				Name: path.Join(templatesDir, strings.TrimPrefix(file.Name, crdsDir+"/")),
+				Data: file.Data,
+			})
+		} else {
+			remainingFiles = append(remainingFiles, file)
+		}
+	}
+
+	if len(crdChart.Templates) == 0 {
+		return nil
+	}
+	helmChart.Files = remainingFiles
+
+	return crdChart
+}
@@ -2,11 +2,14 @@ package conform
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -51,12 +54,14 @@ func GetFileList(searchPath string, relative bool) ([]string, []string, error) {
 	return dirList, fileList, nil
 }
 
-func ApplyOverlayFiles(packagePath string) error {
+func ApplyOverlayFiles(packagePath string) ([]string, error) {
 	overlayPath := filepath.Join(packagePath, overlayDir)
+	var fileList []string
 	if _, err := os.Stat(overlayPath); !os.IsNotExist(err) {
-		dirList, fileList, err := GetFileList(overlayPath, true)
+		var dirList []string
+		dirList, fileList, err = GetFileList(overlayPath, true)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if len(dirList) == 0 {
 			dirList = append(dirList, "")
@@ -65,7 +70,7 @@ func ApplyOverlayFiles(packagePath string) error {
 			generatedPath := filepath.Join(packagePath, "charts", dir)
 			if _, err := os.Stat(generatedPath); os.IsNotExist(err) {
 				if err := os.MkdirAll(generatedPath, 0755); err != nil {
-					return fmt.Errorf("failed to mkdir %q: %w", generatedPath, err)
+					return nil, fmt.Errorf("failed to mkdir %q: %w", generatedPath, err)
 				}
 			}
 		}
@@ -73,12 +78,12 @@ func ApplyOverlayFiles(packagePath string) error {
 		for _, filePath := range fileList {
 			srcPath := filepath.Join(overlayPath, filePath)
 			if _, err := os.Stat(srcPath); os.IsNotExist(err) {
-				return err
+				return nil, err
 			}
 
 			srcFile, err := os.Open(srcPath)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			defer srcFile.Close()
 
@@ -87,23 +92,24 @@ func ApplyOverlayFiles(packagePath string) error {
 				logrus.Warnf("Replacing %s with overlay file", filePath)
 				err = os.Remove(generatedPath)
 				if err != nil {
-					return err
+					return nil, err
 				}
 			}
 			dstFile, err := os.Create(generatedPath)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			defer dstFile.Close()
 
 			if _, err = io.Copy(dstFile, srcFile); err != nil {
-				return err
+				return nil, err
 			}
 		}
 
 	}
+	sort.Strings(fileList)
 
-	return nil
+	return fileList, nil
 
 }
 
@@ -212,23 +218,171 @@ func ExportChartDirectory(chart *chart.Chart, targetPath string) error {
 		return err
 	}
 
-	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
-		os.RemoveAll(targetPath)
+	if err = syncDirectory(chartOutputPath, targetPath); err != nil {
+		return err
 	}
 
-	if err = os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+	err = os.RemoveAll(tempDir)
+	if err != nil {
 		return err
 	}
 
-	err = os.Rename(chartOutputPath, targetPath)
+	return nil
+}
+
+// SaveChartArchive saves chart as a tgz archive in outDir, like
+// chartutil.Save, but leaves an existing archive untouched if its
+// files are identical to the new archive. Archives embed modification
+// times, so only the names, modes and contents of their files are
+// compared. Returns the archive path and whether it was written.
+func SaveChartArchive(chart *chart.Chart, outDir string) (string, bool, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", false, err
+	}
+	tempDir, err := os.MkdirTemp(outDir, ".chartArchive")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempFile, err := chartutil.Save(chart, tempDir)
+	if err != nil {
+		return "", false, err
+	}
+	archivePath := filepath.Join(outDir, filepath.Base(tempFile))
+
+	if _, err := os.Stat(archivePath); err == nil {
+		existingDigest, err := archiveDigest(archivePath)
+		if err != nil {
+			logrus.Debugf("Unable to read %s, overwriting: %s\n", archivePath, err)
+		} else {
+			newDigest, err := archiveDigest(tempFile)
+			if err != nil {
+				return "", false, err
+			}
+			if existingDigest == newDigest {
+				logrus.Debugf("%s is unchanged\n", archivePath)
+				return archivePath, false, nil
+			}
+		}
+	}
+
+	if err := os.Rename(tempFile, archivePath); err != nil {
+		return "", false, err
+	}
+
+	return archivePath, true, nil
+}
+
+// Hashes the names, modes and contents of the files in a tgz archive
+func archiveDigest(archivePath string) (string, error) {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer archiveFile.Close()
+
+	gzipReader, err := gzip.NewReader(archiveFile)
+	if err != nil {
+		return "", err
+	}
+	defer gzipReader.Close()
+
+	hash := sha256.New()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%o\x00%d\x00", h.Name, h.Mode, h.Size)
+		if _, err := io.Copy(hash, tarReader); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Makes targetPath identical to sourcePath, writing only files whose
+// content or mode differs and removing files not in sourcePath
+func syncDirectory(sourcePath, targetPath string) error {
+	_, sourceFiles, err := GetFileList(sourcePath, true)
 	if err != nil {
 		return err
 	}
+	wanted := make(map[string]struct{}, len(sourceFiles))
 
-	err = os.RemoveAll(tempDir)
+	for _, file := range sourceFiles {
+		wanted[file] = struct{}{}
+		sourceFile := filepath.Join(sourcePath, file)
+		targetFile := filepath.Join(targetPath, file)
+
+		sourceInfo, err := os.Stat(sourceFile)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(sourceFile)
+		if err != nil {
+			return err
+		}
+		if targetInfo, err := os.Stat(targetFile); err == nil && targetInfo.Mode() == sourceInfo.Mode() {
+			existing, err := os.ReadFile(targetFile)
+			if err == nil && bytes.Equal(existing, data) {
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(targetFile), 0755); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(targetFile); err != nil {
+			return err
+		}
+		if err := os.WriteFile(targetFile, data, sourceInfo.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+		return os.MkdirAll(targetPath, 0755)
+	}
+	_, targetFiles, err := GetFileList(targetPath, true)
+	if err != nil {
+		return err
+	}
+	for _, file := range targetFiles {
+		if _, ok := wanted[file]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(targetPath, file)); err != nil {
+			return err
+		}
+	}
+
+	return removeEmptyDirectories(targetPath)
+}
+
+// Removes the empty directories below rootPath, deepest first
+func removeEmptyDirectories(rootPath string) error {
+	dirList, _, err := GetFileList(rootPath, false)
 	if err != nil {
 		return err
 	}
+	for i := len(dirList) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirList[i])
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dirList[i]); err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,156 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FamilyIPv4 prefers IPv4 addresses
+	FamilyIPv4 = "ipv4"
+	// FamilyIPv6 prefers IPv6 addresses
+	FamilyIPv6 = "ipv6"
+)
+
+// Options configures how connections to upstream hosts are dialed
+type Options struct {
+	// PreferIPFamily is ipv4 or ipv6 to try the addresses of that
+	// family first, falling back to the other. Empty uses the system
+	// order.
+	PreferIPFamily string
+	// OnlyPreferred skips the addresses of the other family, for
+	// environments where it is unreachable
+	OnlyPreferred bool
+	// Hosts maps hostnames to the addresses to connect to instead of
+	// resolving them with DNS
+	Hosts map[string][]string
+}
+
+var (
+	mu      sync.Mutex
+	options = Options{}
+	base    = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	once    sync.Once
+)
+
+// Configure validates newOptions and applies them to every connection
+// made through http.DefaultTransport, which all upstream HTTP requests
+// and git clones use
+func Configure(newOptions Options) error {
+	switch newOptions.PreferIPFamily {
+	case "", FamilyIPv4, FamilyIPv6:
+	default:
+		return fmt.Errorf("invalid preferIPFamily %q: must be %s or %s", newOptions.PreferIPFamily, FamilyIPv4, FamilyIPv6)
+	}
+	if newOptions.OnlyPreferred && newOptions.PreferIPFamily == "" {
+		return errors.New("onlyPreferred requires preferIPFamily")
+	}
+	hosts := make(map[string][]string, len(newOptions.Hosts))
+	for host, addresses := range newOptions.Hosts {
+		if len(addresses) == 0 {
+			return fmt.Errorf("host %s has no addresses", host)
+		}
+		for _, address := range addresses {
+			if net.ParseIP(address) == nil {
+				return fmt.Errorf("host %s: %q is not an IP address", host, address)
+			}
+		}
+		hosts[strings.ToLower(host)] = addresses
+	}
+	newOptions.Hosts = hosts
+
+	mu.Lock()
+	options = newOptions
+	mu.Unlock()
+
+	once.Do(func() {
+		if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+			transport.DialContext = DialContext
+		}
+	})
+
+	return nil
+}
+
+// DialContext connects to address, resolving its host with the
+// configured overrides and dialing its addresses in the order of the
+// preferred family, until one of them answers
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	mu.Lock()
+	current := options
+	mu.Unlock()
+
+	if current.PreferIPFamily == "" && len(current.Hosts) == 0 {
+		return base.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addresses, ok := current.Hosts[strings.ToLower(host)]
+	if ok {
+		logrus.Debugf("Dialing %s at %s\n", host, strings.Join(addresses, ", "))
+	} else if net.ParseIP(host) != nil {
+		addresses = []string{host}
+	} else {
+		ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ipAddr := range ipAddrs {
+			addresses = append(addresses, ipAddr.IP.String())
+		}
+	}
+	addresses = order(addresses, current.PreferIPFamily, current.OnlyPreferred)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s has no %s address", host, current.PreferIPFamily)
+	}
+
+	var errs []error
+	for _, ip := range addresses {
+		conn, err := base.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// Returns addresses with those of family first, keeping their relative
+// order, or only those of family if only is set
+func order(addresses []string, family string, only bool) []string {
+	if family == "" {
+		return addresses
+	}
+	preferred := func(address string) bool {
+		isIPv4 := net.ParseIP(address).To4() != nil
+		return isIPv4 == (family == FamilyIPv4)
+	}
+
+	ordered := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if !only || preferred(address) {
+			ordered = append(ordered, address)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return preferred(ordered[i]) && !preferred(ordered[j])
+	})
+
+	return ordered
+}
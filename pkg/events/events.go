@@ -0,0 +1,135 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/sirupsen/logrus"
+)
+
+// Event types emitted during an update
+const (
+	TypePackageStarted   = "package_started"
+	TypeVersionFetched   = "version_fetched"
+	TypeVersionConformed = "version_conformed"
+	TypePackageFailed    = "package_failed"
+	TypePackageWarning   = "package_warning"
+	TypeIndexWritten     = "index_written"
+	TypeCommitCreated    = "commit_created"
+)
+
+// Event is a single line of the events stream
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Package    string    `json:"package,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Repository string    `json:"repository,omitempty"`
+	Commit     string    `json:"commit,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	// Annotations and Overlays are set on version_conformed events
+	Annotations []Annotation `json:"annotations,omitempty"`
+	Overlays    []string     `json:"overlays,omitempty"`
+}
+
+// Actions of an Annotation applied while conforming a chart version
+const (
+	// AnnotationAdded is an annotation the upstream chart did not set
+	AnnotationAdded = "added"
+	// AnnotationOverridden is an upstream annotation replaced with a
+	// different value
+	AnnotationOverridden = "overridden"
+	// AnnotationKept is an upstream annotation left in place instead of
+	// the configured value
+	AnnotationKept = "kept"
+)
+
+// Annotation is an annotation applied to a chart version while
+// conforming it
+type Annotation struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Previous string `json:"previous,omitempty"`
+	Value    string `json:"value"`
+}
+
+var (
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+)
+
+// Open starts streaming events as newline-delimited JSON to the file
+// at target, or to stdout if target is "-". Until Open is called,
+// events are discarded.
+func Open(target string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var w io.Writer = os.Stdout
+	if target != "-" {
+		f, err := os.Create(target)
+		if err != nil {
+			return fmt.Errorf("failed to open events stream: %w", err)
+		}
+		w = f
+		closer = f
+	}
+	encoder = json.NewEncoder(w)
+
+	return nil
+}
+
+// Close stops streaming events
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	encoder = nil
+	if closer == nil {
+		return nil
+	}
+	err := closer.Close()
+	closer = nil
+
+	return err
+}
+
+// Emit writes e to the stream, setting its time and redacting its
+// error. Failures to write are logged, not returned, so that the
+// stream can not fail an update.
+func Emit(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if encoder == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Error = redact.String(e.Error)
+	e.Message = redact.String(e.Message)
+	e.Repository = redact.URL(e.Repository)
+	if err := encoder.Encode(e); err != nil {
+		logrus.Debugf("failed to emit %s event: %s", e.Type, err)
+	}
+}
+
+// Failed emits a package_failed event for packageName
+func Failed(packageName string, err error) {
+	Emit(Event{Type: TypePackageFailed, Package: packageName, Error: err.Error()})
+}
+
+// Warning emits a package_warning event for packageName, for problems
+// that do not fail the package
+func Warning(packageName, message string) {
+	Emit(Event{Type: TypePackageWarning, Package: packageName, Message: message})
+}
@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/objectstorage"
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+)
+
+const (
+	// AuthAWSSigV4 signs requests to the upstream with AWS Signature
+	// Version 4, for charts served behind an AWS API Gateway
+	AuthAWSSigV4 = "aws-sigv4"
+	// AuthBasic authenticates requests to the upstream with HTTP basic
+	// authentication, with the username and password in the environment
+	// variables named by AuthUsernameEnv and AuthSecretEnv
+	AuthBasic = "basic"
+	// AuthBearer authenticates requests to the upstream with the bearer
+	// token in the environment variable named by AuthSecretEnv
+	AuthBearer = "bearer"
+	//defaultAWSService is the service that requests are signed for
+	//when AWSService is not set
+	defaultAWSService = "execute-api"
+)
+
+// reservedAuthHosts are the hosts that partner-charts-ci sends its own
+// credentials to, which upstream.yaml can not configure Auth for
+var reservedAuthHosts = []string{
+	"github.com",
+	"api.github.com",
+	"uploads.github.com",
+	"raw.githubusercontent.com",
+	"objects.githubusercontent.com",
+	"artifacthub.io",
+}
+
+// sigV4Hosts are the hosts that upstream.yaml may sign requests to with
+// aws-sigv4, set by ConfigureSigV4Hosts
+var sigV4Hosts []string
+
+// ConfigureSigV4Hosts sets the hosts that upstream.yaml may sign
+// requests to with aws-sigv4. The requests carry the AWS credentials of
+// the CI job, so a partner can not choose the hosts in upstream.yaml
+// alone.
+func ConfigureSigV4Hosts(hosts []string) {
+	sigV4Hosts = hosts
+}
+
+func init() {
+	for _, host := range reservedAuthHosts {
+		objectstorage.ReserveHost(host)
+	}
+}
+
+// Sets up the Auth mode of upstreamYaml for the hosts of its Helm
+// repository, mirrors, index snapshot and manifest. Credentials are only
+// referenced by the names of the environment variables holding them,
+// which are read for each request, so they are never written to disk.
+// upstream.yaml is contributed by partners, so it may only name the
+// environment variables allowed by parse.ConfigureEnv.
+func configureAuth(upstreamYaml parse.UpstreamYaml) error {
+	var register func(host string) error
+	switch upstreamYaml.Auth {
+	case "":
+		return nil
+	case AuthAWSSigV4:
+		region, service, err := sigV4Scope(upstreamYaml)
+		if err != nil {
+			return err
+		}
+		register = func(host string) error {
+			if !sigV4HostAllowed(host) {
+				return fmt.Errorf("%s is not listed in awsSigV4Hosts", host)
+			}
+			return objectstorage.RegisterSigV4Host(host, region, service)
+		}
+	case AuthBasic:
+		if upstreamYaml.AuthUsernameEnv == "" || upstreamYaml.AuthSecretEnv == "" {
+			return fmt.Errorf("Auth %s requires AuthUsernameEnv and AuthSecretEnv", AuthBasic)
+		}
+		if err := requireEnv(upstreamYaml.AuthUsernameEnv, upstreamYaml.AuthSecretEnv); err != nil {
+			return err
+		}
+		register = func(host string) error {
+			return objectstorage.RegisterBasicAuthHost(host, upstreamYaml.AuthUsernameEnv, upstreamYaml.AuthSecretEnv)
+		}
+	case AuthBearer:
+		if upstreamYaml.AuthSecretEnv == "" {
+			return fmt.Errorf("Auth %s requires AuthSecretEnv", AuthBearer)
+		}
+		if err := requireEnv(upstreamYaml.AuthSecretEnv); err != nil {
+			return err
+		}
+		register = func(host string) error {
+			return objectstorage.RegisterBearerTokenHost(host, upstreamYaml.AuthSecretEnv)
+		}
+	default:
+		return fmt.Errorf("invalid Auth %q: must be %s, %s or %s", upstreamYaml.Auth, AuthAWSSigV4, AuthBasic, AuthBearer)
+	}
+
+	upstreamURLs := append([]string{upstreamYaml.HelmRepoUrl, upstreamYaml.HelmRepoIndex, upstreamYaml.Manifest}, upstreamYaml.HelmRepoMirrors...)
+	for _, upstreamURL := range upstreamURLs {
+		u, err := url.Parse(upstreamURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if err := register(u.Hostname()); err != nil {
+			return fmt.Errorf("invalid Auth: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the region and service that aws-sigv4 requests to the
+// upstream of upstreamYaml are signed for
+func sigV4Scope(upstreamYaml parse.UpstreamYaml) (string, string, error) {
+
+	region := upstreamYaml.AWSRegion
+	if region == "" {
+		region = objectstorage.AWSRegionFromEnv()
+	}
+	if region == "" {
+		return "", "", fmt.Errorf("Auth %s requires AWSRegion or the AWS_REGION environment variable", AuthAWSSigV4)
+	}
+	service := upstreamYaml.AWSService
+	if service == "" {
+		service = defaultAWSService
+	}
+
+	return region, service, nil
+}
+
+func sigV4HostAllowed(host string) bool {
+	for _, allowed := range sigV4Hosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns an error naming the first of envVariables that upstream.yaml
+// may not reference or that is not set
+func requireEnv(envVariables ...string) error {
+	for _, envVariable := range envVariables {
+		if !parse.EnvAllowed(envVariable) {
+			return fmt.Errorf("environment variable %s is not listed in upstreamEnvVariables", envVariable)
+		}
+		if os.Getenv(envVariable) == "" {
+			return fmt.Errorf("environment variable %s is not set", envVariable)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+// Fetches an upstream index.yaml, revalidating any cached copy with
+// its ETag so unchanged indices are not downloaded again
+func fetchIndex(url string) ([]byte, error) {
+	c := cache.Default()
+	if c == nil {
+		return httpGetBody(url)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	etagKey := url + "#etag"
+	cached, cachedErr := c.Read(cache.KindIndex, url)
+	if cachedErr == nil {
+		if etag, err := c.Read(cache.KindIndex, etagKey); err == nil {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		if cachedErr == nil {
+			logrus.Warnf("Using cached index for %s: %s", url, err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cachedErr == nil {
+		logrus.Debugf("Using cached index for %s\n", url)
+		return cached, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Write(cache.KindIndex, url, body); err != nil {
+		logrus.Debug(err)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if err := c.Write(cache.KindIndex, etagKey, []byte(etag)); err != nil {
+			logrus.Debug(err)
+		}
+	}
+
+	return body, nil
+}
+
+// Fetches a chart archive. Published chart archives are immutable, so
+// a cached copy is used without revalidation.
+func fetchChartArchive(url string) ([]byte, error) {
+	getArchive, kind := httpGetBody, cache.KindCharts
+	if IsOCI(url) {
+		getArchive, kind = pullOCIChart, cache.KindOCI
+	}
+	c := cache.Default()
+	if c == nil {
+		return getArchive(url)
+	}
+
+	if body, err := c.Read(kind, url); err == nil {
+		logrus.Debugf("Using cached chart archive for %s\n", url)
+		return body, nil
+	}
+
+	body, err := getArchive(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Write(kind, url, body); err != nil {
+		logrus.Debug(err)
+	}
+
+	return body, nil
+}
+
+func httpGetBody(url string) ([]byte, error) {
+	resp, err := ratelimit.Client().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Maintains a full clone of url in the cache, updating it in place,
+// and copies it to a new temporary directory for the caller to consume
+func gitCloneFromCache(c *cache.Cache, url, branch string) (string, error) {
+	clonePath := c.Path(cache.KindGit, url+"#"+branch)
+	unlock := c.Lock(cache.KindGit, url+"#"+branch)
+	defer unlock()
+
+	if err := updateCachedClone(clonePath, branch); err != nil {
+		logrus.Debugf("Recloning %s into cache: %s\n", url, err)
+		if err := os.RemoveAll(clonePath); err != nil {
+			return "", err
+		}
+		cloneOptions := git.CloneOptions{
+			URL: url,
+		}
+		if branch != "" {
+			cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		}
+		if _, err := git.PlainClone(clonePath, false, &cloneOptions); err != nil {
+			return "", err
+		}
+	}
+	c.Touch(clonePath)
+
+	tempDir, err := os.MkdirTemp("", "gitRepo")
+	if err != nil {
+		return "", err
+	}
+
+	if err := copyDirectory(clonePath, tempDir); err != nil {
+		return "", fmt.Errorf("failed to copy cached clone of %s: %w", url, err)
+	}
+
+	return tempDir, nil
+}
+
+func updateCachedClone(clonePath, branch string) error {
+	r, err := git.PlainOpen(clonePath)
+	if err != nil {
+		return err
+	}
+
+	err = r.Fetch(&git.FetchOptions{Force: true, Tags: git.AllTags})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	if branch == "" {
+		head, err := r.Head()
+		if err != nil {
+			return err
+		}
+		branch = head.Name().Short()
+	}
+
+	remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
+	if err != nil {
+		return err
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Reset(&git.ResetOptions{Commit: remoteRef.Hash(), Mode: git.HardReset})
+}
+
+func copyDirectory(sourcePath, targetPath string) error {
+	return filepath.WalkDir(sourcePath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourcePath, filePath)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(targetPath, relativePath)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(destPath, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			linkTarget, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkTarget, destPath)
+		default:
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(destPath, data, info.Mode().Perm())
+		}
+	})
+}
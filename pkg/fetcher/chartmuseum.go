@@ -0,0 +1,51 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const chartMuseumApiPath = "api/charts"
+
+// Constructs Chart Metadata from the ChartMuseum API of a Helm
+// Repository, which lists the versions of a single chart instead of
+// requiring the whole index.yaml
+func fetchUpstreamChartMuseum(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
+	repoUrl := strings.TrimSuffix(upstreamYaml.HelmRepoUrl, "/")
+	url := fmt.Sprintf("%s/%s/%s", repoUrl, chartMuseumApiPath, upstreamYaml.HelmChart)
+
+	body, err := fetchIndex(url)
+	if err != nil {
+		return ChartSourceMetadata{}, err
+	}
+
+	upstreamVersions := repo.ChartVersions{}
+	if err := json.Unmarshal(body, &upstreamVersions); err != nil {
+		return ChartSourceMetadata{}, fmt.Errorf("failed to parse ChartMuseum response from %s: %w", url, err)
+	}
+	if len(upstreamVersions) == 0 {
+		return ChartSourceMetadata{}, fmt.Errorf("Helm chart: %s/%s %w", repoUrl, upstreamYaml.HelmChart, ErrNotFound)
+	}
+
+	sort.Sort(sort.Reverse(upstreamVersions))
+
+	for _, upstreamVersion := range upstreamVersions {
+		if len(upstreamVersion.URLs) == 0 {
+			return ChartSourceMetadata{}, fmt.Errorf("ChartMuseum version %s of %s has no URLs", upstreamVersion.Version, upstreamYaml.HelmChart)
+		}
+		if !strings.HasPrefix(upstreamVersion.URLs[0], "http") {
+			upstreamVersion.URLs[0] = repoUrl + "/" + strings.TrimPrefix(upstreamVersion.URLs[0], "/")
+		}
+	}
+
+	return ChartSourceMetadata{
+		Source:   "ChartMuseum",
+		Versions: upstreamVersions,
+	}, nil
+}
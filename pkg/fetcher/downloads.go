@@ -0,0 +1,178 @@
+package fetcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// downloads holds the artifacts fetched during a single run, so each
+// chart archive is downloaded, and each git repository cloned, at most
+// once per run. Unlike the persistent cache, it is always in use.
+// Archives are kept on disk, in archiveDir, rather than in memory, as a
+// run can fetch every version of every chart.
+var downloads = struct {
+	mu         sync.Mutex
+	archiveDir string
+	archives   map[string]*download
+	clones     map[string]*clone
+}{
+	archives: make(map[string]*download),
+	clones:   make(map[string]*clone),
+}
+
+type download struct {
+	mu   sync.Mutex
+	path string
+}
+
+type clone struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Returns the archive stored under key, calling fetch to obtain it on
+// first use. Failed fetches are not stored, so a later call retries.
+func downloadOnce(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	downloads.mu.Lock()
+	d, ok := downloads.archives[key]
+	if !ok {
+		d = &download{}
+		downloads.archives[key] = d
+	}
+	downloads.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.path != "" {
+		archive, err := os.ReadFile(d.path)
+		if err == nil {
+			logrus.Debugf("Reusing %s downloaded earlier in this run\n", redact.URL(key))
+			return archive, nil
+		}
+		logrus.Debug(err)
+		d.path = ""
+	}
+
+	archive, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	// the archive is still returned if it can not be kept for reuse
+	if path, err := writeDownload(archive); err != nil {
+		logrus.Debugf("Unable to keep %s for reuse: %s\n", redact.URL(key), err)
+	} else {
+		d.path = path
+	}
+
+	return archive, nil
+}
+
+// Writes archive to a new file in the archive directory of this run,
+// creating it on first use, and returns its path
+func writeDownload(archive []byte) (string, error) {
+	downloads.mu.Lock()
+	if downloads.archiveDir == "" {
+		archiveDir, err := os.MkdirTemp("", "chartDownloads")
+		if err != nil {
+			downloads.mu.Unlock()
+			return "", err
+		}
+		downloads.archiveDir = archiveDir
+	}
+	archiveDir := downloads.archiveDir
+	downloads.mu.Unlock()
+
+	f, err := os.CreateTemp(archiveDir, "*.tgz")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(archive); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Calls use with a full clone of url, cloning it on first use. The
+// clone's worktree is shared, so calls for the same url are serialized.
+func withRetainedClone(url string, use func(clonePath string) error) error {
+	downloads.mu.Lock()
+	c, ok := downloads.clones[url]
+	if !ok {
+		c = &clone{}
+		downloads.clones[url] = c
+	}
+	downloads.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		clonePath, err := gitCloneToDirectory(url, "", false)
+		if err != nil {
+			return err
+		}
+		c.path = clonePath
+	} else {
+		logrus.Debugf("Reusing clone of %s from earlier in this run\n", redact.URL(url))
+	}
+
+	return use(c.path)
+}
+
+// Packages helmChart into an archive in memory
+func archiveChart(helmChart *chart.Chart) ([]byte, error) {
+	tempDir, err := os.MkdirTemp("", "chartArchive")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath, err := chartutil.Save(helmChart, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(filepath.Clean(archivePath))
+}
+
+// Cleanup removes the chart archives and git clones retained for reuse
+// during this run
+func Cleanup() {
+	downloads.mu.Lock()
+	defer downloads.mu.Unlock()
+
+	if downloads.archiveDir != "" {
+		if err := os.RemoveAll(downloads.archiveDir); err != nil {
+			logrus.Debug(err)
+		}
+		downloads.archiveDir = ""
+	}
+	for key := range downloads.archives {
+		delete(downloads.archives, key)
+	}
+
+	for url, c := range downloads.clones {
+		c.mu.Lock()
+		if c.path != "" {
+			if err := os.RemoveAll(c.path); err != nil {
+				logrus.Debug(err)
+			}
+		}
+		c.mu.Unlock()
+		delete(downloads.clones, url)
+	}
+}
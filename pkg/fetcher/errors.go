@@ -0,0 +1,50 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+)
+
+// ErrNotFound is wrapped by errors for charts or packages missing from
+// an upstream that could otherwise be reached
+var ErrNotFound = errors.New("not found")
+
+// StatusError is returned for HTTP responses with an unexpected status
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s returned status %d", redact.URL(e.URL), e.StatusCode)
+}
+
+// IsUnreachable returns true if err indicates that an upstream no longer
+// exists, rather than a failure in processing it: the host does not
+// resolve or refuses connections, the repository or chart is gone, or
+// the server responds with 404 Not Found or 410 Gone.
+func IsUnreachable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	return errors.Is(err, ErrNotFound) ||
+		errors.Is(err, transport.ErrRepositoryNotFound) ||
+		errors.Is(err, transport.ErrAuthenticationRequired)
+}
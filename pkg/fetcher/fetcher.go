@@ -1,12 +1,14 @@
 package fetcher
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -15,7 +17,11 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/google/go-github/v53/github"
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/objectstorage"
 	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/rancher/partner-charts-ci/pkg/redact"
 	"github.com/sirupsen/logrus"
 
 	"helm.sh/helm/v3/pkg/chart"
@@ -27,6 +33,9 @@ import (
 
 const (
 	artifactHubApi = "https://artifacthub.io/api/v1/packages/helm"
+	//chartTypeLibrary is the Chart.yaml type of charts that can not be
+	//installed on their own
+	chartTypeLibrary = "library"
 )
 
 type ArtifactHubApiHelmRepo struct {
@@ -42,14 +51,107 @@ type ArtifactHubApiHelm struct {
 }
 
 type ChartSourceMetadata struct {
-	Commit       string
+	Commit string
+	// Mirror is the Helm repository URL that served the index, when
+	// the package lists HelmRepoMirrors
+	Mirror       string
 	Source       string
 	SubDirectory string
 	Versions     repo.ChartVersions
 }
 
-// Constructs Chart Metadata for latest version published to Helm Repository
+// readThroughMirror is the base URL of a read-through mirror of all
+// Helm repositories, set by ConfigureMirror
+var readThroughMirror string
+
+// ConfigureMirror sets the base URL of a read-through mirror, such as
+// an Artifactory remote repository, that serves each Helm repository
+// under <baseURL>/<host>/<path>. Helm repositories are fetched from
+// the mirror first and from their origin if that fails. An empty
+// baseURL disables the mirror.
+func ConfigureMirror(baseURL string) {
+	readThroughMirror = strings.TrimSuffix(baseURL, "/")
+	// the mirror serves every package, so no package may authenticate
+	// requests to it
+	if parsed, err := url.Parse(readThroughMirror); err == nil && parsed.Host != "" {
+		objectstorage.ReserveHost(parsed.Hostname())
+	}
+}
+
+// Returns the URL of repoUrl under the read-through mirror, or "" if
+// no mirror is configured or repoUrl can not be mirrored
+func mirrorURL(repoUrl string) string {
+	if readThroughMirror == "" {
+		return ""
+	}
+	parsed, err := url.Parse(repoUrl)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+
+	return readThroughMirror + "/" + parsed.Host + strings.TrimSuffix(parsed.EscapedPath(), "/")
+}
+
+// Constructs Chart Metadata from the read-through mirror of HelmRepo,
+// if configured, then from HelmRepo, or failing that from each of
+// HelmRepoMirrors in order. Chart URLs under the serving repository are
+// followed by the same URLs under the other repositories, so that
+// downloads fail over as well. HelmRepoIndex replaces all of them with
+// an index snapshot.
 func fetchUpstreamHelmrepo(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
+	if upstreamYaml.HelmRepoIndex != "" {
+		return fetchUpstreamHelmrepoIndex(upstreamYaml)
+	}
+	originUrl := strings.TrimSuffix(upstreamYaml.HelmRepoUrl, "/")
+	repoUrls := []string{originUrl}
+	if readThroughUrl := mirrorURL(originUrl); readThroughUrl != "" {
+		repoUrls = []string{readThroughUrl, originUrl}
+	}
+	for _, mirror := range upstreamYaml.HelmRepoMirrors {
+		repoUrls = append(repoUrls, strings.TrimSuffix(mirror, "/"))
+	}
+	if len(repoUrls) == 1 {
+		return fetchUpstreamHelmrepoUrl(upstreamYaml)
+	}
+
+	var firstErr error
+	for _, repoUrl := range repoUrls {
+		mirrorYaml := upstreamYaml
+		mirrorYaml.HelmRepoUrl = repoUrl
+		chartSourceMeta, err := fetchUpstreamHelmrepoUrl(mirrorYaml)
+		if err != nil {
+			logrus.Warnf("Failed to fetch %s from %s: %s", upstreamYaml.HelmChart, redact.URL(repoUrl), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if repoUrl != originUrl {
+			logrus.Infof("Fetched %s from mirror %s\n", upstreamYaml.HelmChart, redact.URL(repoUrl))
+		}
+		chartSourceMeta.Mirror = repoUrl
+
+		for _, version := range chartSourceMeta.Versions {
+			if len(version.URLs) == 0 || !strings.HasPrefix(version.URLs[0], repoUrl+"/") {
+				continue
+			}
+			chartPath := strings.TrimPrefix(version.URLs[0], repoUrl)
+			for _, otherUrl := range repoUrls {
+				if otherUrl != repoUrl {
+					version.URLs = append(version.URLs, otherUrl+chartPath)
+				}
+			}
+		}
+
+		return chartSourceMeta, nil
+	}
+
+	return ChartSourceMetadata{}, firstErr
+}
+
+// Constructs Chart Metadata for latest version published to a single
+// Helm Repository
+func fetchUpstreamHelmrepoUrl(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
 	upstreamYaml.HelmRepoUrl = strings.TrimSuffix(upstreamYaml.HelmRepoUrl, "/")
 	url := fmt.Sprintf("%s/index.yaml", upstreamYaml.HelmRepoUrl)
 
@@ -62,22 +164,24 @@ func fetchUpstreamHelmrepo(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata
 
 	chartSourceMeta.Source = "HelmRepo"
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return chartSourceMeta, err
+	if upstreamYaml.ChartMuseum {
+		return fetchUpstreamChartMuseum(upstreamYaml)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return chartSourceMeta, err
+	body, err := fetchIndex(url)
+	if err == nil {
+		err = yaml.Unmarshal([]byte(body), indexYaml)
 	}
-
-	err = yaml.Unmarshal([]byte(body), indexYaml)
 	if err != nil {
-		return chartSourceMeta, err
+		logrus.Debugf("Failed to load %s, trying ChartMuseum API: %s\n", url, err)
+		chartMuseumMeta, chartMuseumErr := fetchUpstreamChartMuseum(upstreamYaml)
+		if chartMuseumErr != nil {
+			return chartSourceMeta, err
+		}
+		return chartMuseumMeta, nil
 	}
 	if _, ok := indexYaml.Entries[upstreamYaml.HelmChart]; !ok {
-		return chartSourceMeta, fmt.Errorf("Helm chart: %s/%s not found", upstreamYaml.HelmRepoUrl, upstreamYaml.HelmChart)
+		return chartSourceMeta, fmt.Errorf("Helm chart: %s/%s %w", upstreamYaml.HelmRepoUrl, upstreamYaml.HelmChart, ErrNotFound)
 	}
 
 	indexYaml.SortEntries()
@@ -101,10 +205,14 @@ func fetchUpstreamArtifacthub(upstreamYaml parse.UpstreamYaml) (ChartSourceMetad
 
 	apiResp := ArtifactHubApiHelm{}
 
-	resp, err := http.Get(url)
+	resp, err := ratelimit.Client().Get(url)
 	if err != nil {
 		return ChartSourceMetadata{}, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ChartSourceMetadata{}, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -117,7 +225,7 @@ func fetchUpstreamArtifacthub(upstreamYaml parse.UpstreamYaml) (ChartSourceMetad
 	}
 
 	if apiResp.ContentUrl == "" {
-		return ChartSourceMetadata{}, fmt.Errorf("ArtifactHub package: %s/%s not found", upstreamYaml.AHRepoName, upstreamYaml.AHPackageName)
+		return ChartSourceMetadata{}, fmt.Errorf("ArtifactHub package: %s/%s %w", upstreamYaml.AHRepoName, upstreamYaml.AHPackageName, ErrNotFound)
 	}
 
 	upstreamYaml.HelmRepoUrl = apiResp.Repository.Url
@@ -150,7 +258,7 @@ func getGitHubUserAndRepo(gitUrl string) (string, string, error) {
 
 func fetchGitHubRelease(repoUrl string) (string, error) {
 	var releaseCommit string
-	client := github.NewClient(nil)
+	client := github.NewClient(ratelimit.Client())
 	gitHubUser, gitHubRepo, err := getGitHubUserAndRepo(repoUrl)
 	if err != nil {
 		return "", err
@@ -186,6 +294,10 @@ func fetchGitHubRelease(repoUrl string) (string, error) {
 }
 
 func gitCloneToDirectory(url, branch string, shallow bool) (string, error) {
+	if c := cache.Default(); c != nil {
+		return gitCloneFromCache(c, url, branch)
+	}
+
 	cloneOptions := git.CloneOptions{
 		URL: url,
 	}
@@ -234,10 +346,18 @@ func gitCheckoutCommit(path, commit string) error {
 	return nil
 }
 
-// Constructs Chart Metadata for latest version published to Git Repository
+// Constructs Chart Metadata for latest version published to Git
+// Repository. Only its Chart.yaml is read if the repository can be
+// probed, and the repository is cloned otherwise.
 func fetchUpstreamGit(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
 	var upstreamCommit string
 
+	probed, probedCommit, err := probeGitChartMetadata(upstreamYaml)
+	if err == nil {
+		return gitChartSourceMetadata(upstreamYaml, probed, probedCommit), nil
+	}
+	logrus.Debugf("Cloning %s, as its Chart.yaml can not be read alone: %s\n", upstreamYaml.GitRepoUrl, err)
+
 	clonePath, err := gitCloneToDirectory(upstreamYaml.GitRepoUrl, upstreamYaml.GitBranch, !upstreamYaml.GitHubRelease)
 	if err != nil {
 		return ChartSourceMetadata{}, err
@@ -278,39 +398,63 @@ func fetchUpstreamGit(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, err
 		}
 	}
 	logrus.Debugf("Git Temp Directory: %s\n", chartPath)
-	helmChart, err := loader.Load(chartPath)
-	if err != nil {
+	if _, err := smudgeLFS(upstreamYaml.GitRepoUrl, clonePath, chartPath); err != nil {
 		return ChartSourceMetadata{}, err
 	}
+	var metadata *chart.Metadata
+	if info, err := os.Stat(chartPath); err == nil && !info.IsDir() {
+		var helmChart *chart.Chart
+		helmChart, err = loader.LoadFile(chartPath)
+		if err != nil {
+			return ChartSourceMetadata{}, err
+		}
+		metadata = helmChart.Metadata
+	} else {
+		metadata, err = loadChartMetadataFromDirectory(chartPath)
+		if err != nil {
+			return ChartSourceMetadata{}, err
+		}
+	}
+
+	err = os.RemoveAll(clonePath)
+	if err != nil {
+		logrus.Debug(err)
+	}
 
+	return gitChartSourceMetadata(upstreamYaml, metadata, upstreamCommit), nil
+}
+
+// Returns the Chart Metadata of the chart with metadata at commit of
+// the Git upstream of upstreamYaml
+func gitChartSourceMetadata(upstreamYaml parse.UpstreamYaml, metadata *chart.Metadata, commit string) ChartSourceMetadata {
 	version := repo.ChartVersion{
-		Metadata: helmChart.Metadata,
+		Metadata: metadata,
 		URLs:     []string{upstreamYaml.GitRepoUrl},
 	}
 
-	versions := repo.ChartVersions{&version}
-
-	chartSourceMeta := ChartSourceMetadata{
-		Commit:       upstreamCommit,
+	return ChartSourceMetadata{
+		Commit:       commit,
 		Source:       "Git",
 		SubDirectory: upstreamYaml.GitSubDirectory,
-		Versions:     versions,
+		Versions:     repo.ChartVersions{&version},
 	}
-
-	err = os.RemoveAll(clonePath)
-	if err != nil {
-		logrus.Debug(err)
-	}
-
-	return chartSourceMeta, nil
 }
 
 func FetchUpstream(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
 	var err error
 	chartSourceMetadata := ChartSourceMetadata{}
-	if upstreamYaml.AHRepoName != "" && upstreamYaml.AHPackageName != "" {
+	if err := configureAuth(upstreamYaml); err != nil {
+		return chartSourceMetadata, err
+	}
+	if upstreamYaml.LocalPath != "" {
+		chartSourceMetadata, err = fetchUpstreamLocal(upstreamYaml.LocalPath)
+	} else if upstreamYaml.Manifest != "" {
+		chartSourceMetadata, err = fetchUpstreamManifest(upstreamYaml)
+	} else if upstreamYaml.AHRepoName != "" && upstreamYaml.AHPackageName != "" {
 		chartSourceMetadata, err = fetchUpstreamArtifacthub(upstreamYaml)
-	} else if upstreamYaml.HelmRepoUrl != "" && upstreamYaml.HelmChart != "" {
+	} else if IsOCI(upstreamYaml.HelmRepoUrl) && upstreamYaml.HelmRepoIndex == "" && upstreamYaml.HelmChart != "" {
+		chartSourceMetadata, err = fetchUpstreamOCI(upstreamYaml)
+	} else if (upstreamYaml.HelmRepoUrl != "" || upstreamYaml.HelmRepoIndex != "") && upstreamYaml.HelmChart != "" {
 		chartSourceMetadata, err = fetchUpstreamHelmrepo(upstreamYaml)
 	} else if upstreamYaml.GitRepoUrl != "" {
 		chartSourceMetadata, err = fetchUpstreamGit(upstreamYaml)
@@ -319,6 +463,10 @@ func FetchUpstream(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error)
 		return ChartSourceMetadata{}, err
 	}
 
+	if err == nil && !upstreamYaml.AllowLibrary {
+		chartSourceMetadata, err = dropLibraryCharts(chartSourceMetadata)
+	}
+
 	if upstreamYaml.ChartYaml.Name != "" {
 		for _, version := range chartSourceMetadata.Versions {
 			version.Name = upstreamYaml.ChartYaml.Name
@@ -328,17 +476,68 @@ func FetchUpstream(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error)
 	return chartSourceMetadata, err
 }
 
+// Removes library chart versions listed by upstreams that serve many
+// charts, such as Helm repositories, where they are rarely the chart
+// that was meant to be packaged. Git and local upstreams point at a
+// single chart and are kept as they are.
+func dropLibraryCharts(chartSourceMetadata ChartSourceMetadata) (ChartSourceMetadata, error) {
+	switch chartSourceMetadata.Source {
+	case "HelmRepo", "ArtifactHub", "ChartMuseum", SourceManifest, SourceOCI:
+	default:
+		return chartSourceMetadata, nil
+	}
+
+	versions := make(repo.ChartVersions, 0, len(chartSourceMetadata.Versions))
+	for _, version := range chartSourceMetadata.Versions {
+		if version.Metadata != nil && version.Type == chartTypeLibrary {
+			logrus.Debugf("Skipping library chart %s %s\n", version.Name, version.Version)
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 && len(chartSourceMetadata.Versions) > 0 {
+		return chartSourceMetadata, fmt.Errorf("%s is a library chart; set AllowLibrary to fetch it", chartSourceMetadata.Versions[0].Name)
+	}
+	chartSourceMetadata.Versions = versions
+
+	return chartSourceMetadata, nil
+}
+
+// LoadChartFromUrls loads the chart from the first of urls that can be
+// downloaded, such as the same chart on several mirrors
+func LoadChartFromUrls(urls []string) (*chart.Chart, error) {
+	var firstErr error
+	for i, url := range urls {
+		helmChart, err := LoadChartFromUrl(url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if i > 0 {
+			logrus.Infof("Downloaded %s (%s) from mirror %s\n", helmChart.Name(), helmChart.Metadata.Version, redact.URL(url))
+		}
+		return helmChart, nil
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no chart URLs")
+	}
+
+	return nil, firstErr
+}
+
 func LoadChartFromUrl(url string) (*chart.Chart, error) {
 	logrus.Debugf("Loading chart from %s\n", url)
-	resp, err := http.Get(url)
+	body, err := downloadOnce(url, func() ([]byte, error) {
+		return fetchChartArchive(url)
+	})
 	if err != nil {
-		logrus.Errorf("Unable to fetch url %s", url)
+		logrus.Errorf("Unable to fetch url %s", redact.URL(url))
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	chart, err := loader.LoadArchive(resp.Body)
+	chart, err := loader.LoadArchive(bytes.NewReader(body))
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
@@ -348,32 +547,78 @@ func LoadChartFromUrl(url string) (*chart.Chart, error) {
 }
 
 func LoadChartFromGit(url, subDirectory, commit string) (*chart.Chart, error) {
-	clonePath, err := gitCloneToDirectory(url, "", false)
+	body, err := downloadGitChart(url, subDirectory, commit)
 	if err != nil {
 		return nil, err
 	}
 
-	err = gitCheckoutCommit(clonePath, commit)
-	if err != nil {
-		return nil, err
+	return loader.LoadArchive(bytes.NewReader(body))
+}
+
+// Prefetch downloads the archive of version of the upstream described
+// by sourceMetadata, so that loading it later in this run reuses the
+// download. Local charts are not read.
+func Prefetch(sourceMetadata ChartSourceMetadata, version *repo.ChartVersion) error {
+	switch sourceMetadata.Source {
+	case SourceLocal:
+		return nil
+	case "Git":
+		_, err := downloadGitChart(version.URLs[0], sourceMetadata.SubDirectory, sourceMetadata.Commit)
+		return err
 	}
 
-	chartPath := clonePath
-	if subDirectory != "" {
-		chartPath = filepath.Join(clonePath, subDirectory)
-		if _, err := os.Stat(chartPath); os.IsNotExist(err) {
-			err = fmt.Errorf("git subdirectory '%s' does not exist", subDirectory)
-			return nil, err
+	var firstErr error
+	for _, url := range version.URLs {
+		_, err := downloadOnce(url, func() ([]byte, error) {
+			return fetchChartArchive(url)
+		})
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
 	}
 
-	helmChart, err := loader.Load(chartPath)
-	if err != nil {
-		return nil, err
-	}
+	return firstErr
+}
 
-	err = os.RemoveAll(clonePath)
+// Returns the archive of the chart in subDirectory of the Git
+// repository at url, at commit
+func downloadGitChart(url, subDirectory, commit string) ([]byte, error) {
+	key := fmt.Sprintf("%s@%s:%s", url, commit, subDirectory)
+	return downloadOnce(key, func() ([]byte, error) {
+		var archive []byte
+		err := withRetainedClone(url, func(clonePath string) error {
+			err := gitCheckoutCommit(clonePath, commit)
+			if err != nil {
+				return err
+			}
+
+			chartPath := clonePath
+			if subDirectory != "" {
+				chartPath = filepath.Join(clonePath, subDirectory)
+				if _, err := os.Stat(chartPath); os.IsNotExist(err) {
+					err = fmt.Errorf("git subdirectory '%s' does not exist", subDirectory)
+					return err
+				}
+			}
+
+			restore, err := smudgeLFS(url, clonePath, chartPath)
+			defer restore()
+			if err != nil {
+				return err
+			}
 
-	return helmChart, err
+			helmChart, err := loader.Load(chartPath)
+			if err != nil {
+				return err
+			}
+
+			archive, err = archiveChart(helmChart)
+			return err
+		})
 
+		return archive, err
+	})
 }
@@ -0,0 +1,305 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gitconfig "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	//lfsPointerVersion is the first line of every Git LFS pointer file
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	//lfsPointerMaxSize is the largest file inspected for a pointer
+	lfsPointerMaxSize = 1024
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+// lfsPointer is a Git LFS pointer file checked out in place of the
+// object it refers to
+type lfsPointer struct {
+	path string
+	data []byte
+	oid  string
+	size int64
+}
+
+// Parses data as a Git LFS pointer, returning false if it is not one
+func parseLFSPointer(data []byte) (oid string, size int64, ok bool) {
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return "", 0, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "oid":
+			oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			var err error
+			if size, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return "", 0, false
+			}
+		}
+	}
+
+	return oid, size, oid != "" && size >= 0
+}
+
+// Finds the Git LFS pointer files at or beneath chartPath
+func findLFSPointers(chartPath string) ([]lfsPointer, error) {
+	pointers := make([]lfsPointer, 0)
+	err := filepath.WalkDir(chartPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if oid, size, ok := parseLFSPointer(data); ok {
+			pointers = append(pointers, lfsPointer{path: filePath, data: data, oid: oid, size: size})
+		}
+		return nil
+	})
+
+	return pointers, err
+}
+
+// Replaces the Git LFS pointer files at or beneath chartPath, in the
+// clone of repoUrl at clonePath, with the objects they refer to. The
+// returned function writes the pointers back, so that the clone can be
+// checked out at other commits.
+func smudgeLFS(repoUrl, clonePath, chartPath string) (func(), error) {
+	pointers, err := findLFSPointers(chartPath)
+	if err != nil || len(pointers) == 0 {
+		return func() {}, err
+	}
+
+	restore := func() {
+		for _, pointer := range pointers {
+			if err := os.WriteFile(pointer.path, pointer.data, 0644); err != nil {
+				logrus.Debug(err)
+			}
+		}
+	}
+
+	endpoint := lfsEndpoint(repoUrl, clonePath)
+	logrus.Debugf("Downloading %d Git LFS objects from %s\n", len(pointers), redact.URL(endpoint))
+	objects, err := fetchLFSObjects(endpoint, pointers)
+	if err != nil {
+		return restore, fmt.Errorf("failed to download Git LFS objects: %w", err)
+	}
+
+	for _, pointer := range pointers {
+		if err := os.WriteFile(pointer.path, objects[pointer.oid], 0644); err != nil {
+			return restore, err
+		}
+	}
+
+	return restore, nil
+}
+
+// Returns the Git LFS server of repoUrl: the lfs.url of the .lfsconfig
+// file of the clone if set, and otherwise the default of
+// <repository>.git/info/lfs
+func lfsEndpoint(repoUrl, clonePath string) string {
+	if lfsConfig, err := os.Open(filepath.Join(clonePath, ".lfsconfig")); err == nil {
+		defer lfsConfig.Close()
+		config := gitconfig.New()
+		if err := gitconfig.NewDecoder(lfsConfig).Decode(config); err == nil {
+			if endpoint := config.Section("lfs").Option("url"); endpoint != "" {
+				return strings.TrimSuffix(endpoint, "/")
+			}
+		}
+	}
+
+	repoUrl = strings.TrimSuffix(repoUrl, "/")
+	if !strings.HasSuffix(repoUrl, ".git") {
+		repoUrl += ".git"
+	}
+
+	return repoUrl + "/info/lfs"
+}
+
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+}
+
+type lfsObject struct {
+	Oid     string `json:"oid"`
+	Size    int64  `json:"size"`
+	Actions *struct {
+		Download *struct {
+			Href   string            `json:"href"`
+			Header map[string]string `json:"header"`
+		} `json:"download"`
+	} `json:"actions,omitempty"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type lfsBatchResponse struct {
+	Objects []lfsObject `json:"objects"`
+}
+
+// Downloads the objects of pointers with the Git LFS batch API, keyed
+// by oid. Objects are content-addressed, so cached copies are used
+// without revalidation.
+func fetchLFSObjects(endpoint string, pointers []lfsPointer) (map[string][]byte, error) {
+	objects := make(map[string][]byte)
+	c := cache.Default()
+
+	request := lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}}
+	for _, pointer := range pointers {
+		if _, ok := objects[pointer.oid]; ok {
+			continue
+		}
+		if c != nil {
+			if data, err := c.Read(cache.KindCharts, "lfs:"+pointer.oid); err == nil {
+				objects[pointer.oid] = data
+				continue
+			}
+		}
+		objects[pointer.oid] = nil
+		request.Objects = append(request.Objects, lfsObject{Oid: pointer.oid, Size: pointer.size})
+	}
+	if len(request.Objects) == 0 {
+		return objects, nil
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	setLFSAuth(req, endpoint)
+
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
+
+	batch := lfsBatchResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("failed to parse Git LFS batch response: %w", err)
+	}
+
+	for _, object := range batch.Objects {
+		if object.Error != nil {
+			return nil, fmt.Errorf("object %s: %s (%d)", object.Oid, object.Error.Message, object.Error.Code)
+		}
+		if object.Actions == nil || object.Actions.Download == nil {
+			return nil, fmt.Errorf("object %s: no download action", object.Oid)
+		}
+		data, err := downloadLFSObject(object)
+		if err != nil {
+			return nil, err
+		}
+		objects[object.Oid] = data
+		if c != nil {
+			if err := c.Write(cache.KindCharts, "lfs:"+object.Oid, data); err != nil {
+				logrus.Debug(err)
+			}
+		}
+	}
+
+	for oid, data := range objects {
+		if data == nil {
+			return nil, fmt.Errorf("object %s: missing from Git LFS batch response", oid)
+		}
+	}
+
+	return objects, nil
+}
+
+// Downloads a single object and verifies its size and sha256 digest
+func downloadLFSObject(object lfsObject) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, object.Actions.Download.Href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range object.Actions.Download.Header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != object.Size {
+		return nil, fmt.Errorf("object %s: expected %d bytes, got %d", object.Oid, object.Size, len(data))
+	}
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != object.Oid {
+		return nil, fmt.Errorf("object %s: sha256 digest mismatch", object.Oid)
+	}
+
+	return data, nil
+}
+
+// Authenticates req with the credentials embedded in endpoint, if any
+func setLFSAuth(req *http.Request, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return
+	}
+	password, _ := u.User.Password()
+	req.SetBasicAuth(u.User.Username(), password)
+	req.URL.User = nil
+}
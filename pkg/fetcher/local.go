@@ -0,0 +1,58 @@
+package fetcher
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// SourceLocal is the Source of charts read from local disk
+const SourceLocal = "Local"
+
+// Constructs Chart Metadata for a chart directory or archive on local
+// disk, for testing a chart before it is published
+func fetchUpstreamLocal(localPath string) (ChartSourceMetadata, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return ChartSourceMetadata{}, fmt.Errorf("local source %s: %w", localPath, err)
+	}
+
+	var metadata *chart.Metadata
+	if info.IsDir() {
+		metadata, err = loadChartMetadataFromDirectory(localPath)
+	} else {
+		var archive *os.File
+		archive, err = os.Open(localPath)
+		if err != nil {
+			return ChartSourceMetadata{}, err
+		}
+		defer archive.Close()
+		metadata, err = readArchiveMetadata(archive)
+	}
+	if err != nil {
+		return ChartSourceMetadata{}, fmt.Errorf("failed to read chart metadata from %s: %w", localPath, err)
+	}
+	logrus.Debugf("Using local source %s\n", localPath)
+
+	version := repo.ChartVersion{
+		Metadata: metadata,
+		Created:  info.ModTime(),
+		URLs:     []string{localPath},
+	}
+
+	return ChartSourceMetadata{
+		Source:   SourceLocal,
+		Versions: repo.ChartVersions{&version},
+	}, nil
+}
+
+// LoadChartFromPath loads a chart directory or archive on local disk
+func LoadChartFromPath(localPath string) (*chart.Chart, error) {
+	logrus.Debugf("Loading chart from %s\n", localPath)
+	return loader.Load(localPath)
+}
@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/repo"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SourceManifest is the Source of charts listed in a catalog manifest
+const SourceManifest = "Manifest"
+
+// ManifestEntry is a chart reference in a catalog manifest, naming a
+// Helm repository, a chart in it, and one or more of its versions
+type ManifestEntry struct {
+	Repo     string   `json:"repo"`
+	Chart    string   `json:"chart"`
+	Version  string   `json:"version,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Constructs Chart Metadata for every chart version listed in a catalog
+// manifest, read from the Manifest URL, or from the Manifest path in
+// GitRepo if it is set. Only entries for HelmChart are used; without
+// HelmChart all entries must name the same chart.
+func fetchUpstreamManifest(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
+	chartSourceMeta := ChartSourceMetadata{Source: SourceManifest}
+
+	data, commit, err := readManifest(upstreamYaml)
+	if err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to read manifest %s: %w", upstreamYaml.Manifest, err)
+	}
+	chartSourceMeta.Commit = commit
+	entries := make([]ManifestEntry, 0)
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to parse manifest %s: %w", upstreamYaml.Manifest, err)
+	}
+
+	chartName := upstreamYaml.HelmChart
+	indices := make(map[string]*repo.IndexFile)
+	for _, entry := range entries {
+		if entry.Repo == "" || entry.Chart == "" {
+			return chartSourceMeta, fmt.Errorf("manifest %s: every entry needs repo and chart", upstreamYaml.Manifest)
+		}
+		if chartName == "" {
+			chartName = entry.Chart
+		} else if entry.Chart != chartName {
+			if upstreamYaml.HelmChart == "" {
+				return chartSourceMeta, fmt.Errorf("manifest %s lists charts %s and %s; set HelmChart to select one", upstreamYaml.Manifest, chartName, entry.Chart)
+			}
+			continue
+		}
+		versions := entry.Versions
+		if entry.Version != "" {
+			versions = append([]string{entry.Version}, versions...)
+		}
+		if len(versions) == 0 {
+			return chartSourceMeta, fmt.Errorf("manifest %s: %s has no version", upstreamYaml.Manifest, entry.Chart)
+		}
+
+		repoUrl := strings.TrimSuffix(entry.Repo, "/")
+		indexYaml, ok := indices[repoUrl]
+		if !ok {
+			indexYaml, err = loadRepoIndex(repoUrl)
+			if err != nil {
+				return chartSourceMeta, err
+			}
+			indices[repoUrl] = indexYaml
+		}
+		for _, version := range versions {
+			chartVersion, err := indexYaml.Get(entry.Chart, version)
+			if err != nil {
+				return chartSourceMeta, fmt.Errorf("Helm chart: %s/%s %s %w", repoUrl, entry.Chart, version, ErrNotFound)
+			}
+			if len(chartVersion.URLs) > 0 && !strings.HasPrefix(chartVersion.URLs[0], "http") {
+				chartVersion.URLs[0] = repoUrl + "/" + chartVersion.URLs[0]
+			}
+			chartSourceMeta.Versions = append(chartSourceMeta.Versions, chartVersion)
+		}
+	}
+	if len(chartSourceMeta.Versions) == 0 {
+		return chartSourceMeta, fmt.Errorf("manifest %s: chart %s %w", upstreamYaml.Manifest, upstreamYaml.HelmChart, ErrNotFound)
+	}
+	sort.Sort(sort.Reverse(chartSourceMeta.Versions))
+
+	return chartSourceMeta, nil
+}
+
+// Reads the manifest of upstreamYaml, returning the commit it was read
+// at when it comes from a git repository
+func readManifest(upstreamYaml parse.UpstreamYaml) ([]byte, string, error) {
+	if upstreamYaml.GitRepoUrl == "" {
+		if !regexp.MustCompile("^https?://").MatchString(upstreamYaml.Manifest) {
+			return nil, "", errors.New("manifest must be an http(s) URL, or a path in GitRepo")
+		}
+		data, err := fetchIndex(upstreamYaml.Manifest)
+		return data, "", err
+	}
+
+	clonePath, err := gitCloneToDirectory(upstreamYaml.GitRepoUrl, upstreamYaml.GitBranch, true)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := os.RemoveAll(clonePath); err != nil {
+			logrus.Debug(err)
+		}
+	}()
+
+	r, err := git.PlainOpen(clonePath)
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := r.Head()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(filepath.Join(clonePath, filepath.FromSlash(upstreamYaml.Manifest)))
+
+	return data, ref.Hash().String(), err
+}
+
+func loadRepoIndex(repoUrl string) (*repo.IndexFile, error) {
+	body, err := fetchIndex(repoUrl + "/index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	indexYaml := repo.NewIndexFile()
+	if err := yaml.Unmarshal(body, indexYaml); err != nil {
+		return nil, fmt.Errorf("failed to parse %s/index.yaml: %w", repoUrl, err)
+	}
+	indexYaml.SortEntries()
+
+	return indexYaml, nil
+}
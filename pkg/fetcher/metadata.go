@@ -0,0 +1,225 @@
+package fetcher
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartfileName = "Chart.yaml"
+	//metadataRangeSize is the number of leading bytes of a chart archive
+	//requested when probing for its Chart.yaml
+	metadataRangeSize = 64 * 1024
+	//gitHubRawContent serves the files of GitHub repositories at a commit
+	gitHubRawContent = "https://raw.githubusercontent.com"
+)
+
+var errChartfileNotFound = errors.New("Chart.yaml not found in archive")
+
+// LoadChartMetadataFromUrl reads only the Chart.yaml of the chart
+// archive at url. It first requests the leading bytes of the archive
+// with an HTTP range request, and otherwise streams the archive only
+// until Chart.yaml has been read.
+func LoadChartMetadataFromUrl(url string) (*chart.Metadata, error) {
+	logrus.Debugf("Loading chart metadata from %s\n", url)
+	if c := cache.Default(); c != nil {
+		if body, err := c.Read(cache.KindCharts, url); err == nil {
+			return readArchiveMetadata(bytes.NewReader(body))
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", metadataRangeSize-1))
+
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		metadata, err := readArchiveMetadata(resp.Body)
+		if err == nil {
+			return metadata, nil
+		}
+		logrus.Debugf("Chart.yaml not within first %d bytes of %s: %s\n", metadataRangeSize, url, err)
+	case http.StatusOK:
+		return readArchiveMetadata(resp.Body)
+	default:
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	fullResp, err := ratelimit.Client().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer fullResp.Body.Close()
+	if fullResp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: url, StatusCode: fullResp.StatusCode}
+	}
+
+	return readArchiveMetadata(fullResp.Body)
+}
+
+// Reads the Chart.yaml of the Git upstream of upstreamYaml, like git
+// show, without cloning the repository, and returns it with the commit
+// it was read at. The commit is resolved with git ls-remote, or from
+// the latest GitHub release, and the file is read from the raw content
+// of GitHub, so only GitHub repositories can be probed. A chart archive
+// in GitSubDirectory is read with LoadChartMetadataFromUrl.
+func probeGitChartMetadata(upstreamYaml parse.UpstreamYaml) (*chart.Metadata, string, error) {
+	user, repository, err := getGitHubUserAndRepo(upstreamYaml.GitRepoUrl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var commit string
+	if upstreamYaml.GitHubRelease {
+		commit, err = fetchGitHubRelease(upstreamYaml.GitRepoUrl)
+	} else {
+		commit, err = lsRemote(upstreamYaml.GitRepoUrl, upstreamYaml.GitBranch)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileUrl := gitHubRawContent + "/" + path.Join(user, repository, commit, upstreamYaml.GitSubDirectory)
+	if strings.HasSuffix(upstreamYaml.GitSubDirectory, ".tgz") {
+		metadata, err := LoadChartMetadataFromUrl(fileUrl)
+		return metadata, commit, err
+	}
+
+	resp, err := ratelimit.Client().Get(fileUrl + "/" + chartfileName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &StatusError{URL: fileUrl + "/" + chartfileName, StatusCode: resp.StatusCode}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	// a Git LFS pointer fails to parse, and is left to the clone
+	metadata, err := parseChartfile(data)
+
+	return metadata, commit, err
+}
+
+// Returns the commit of branch in the repository at url, or that of
+// HEAD if branch is empty, without fetching any objects
+func lsRemote(url, branch string) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	name := plumbing.HEAD
+	if branch != "" {
+		name = plumbing.NewBranchReferenceName(branch)
+	}
+	resolved := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		resolved[ref.Name()] = ref
+	}
+	for i := 0; i < 10; i++ {
+		ref, ok := resolved[name]
+		if !ok {
+			return "", fmt.Errorf("%s not found in %s", name, url)
+		}
+		if ref.Type() == plumbing.HashReference {
+			return ref.Hash().String(), nil
+		}
+		name = ref.Target()
+	}
+
+	return "", fmt.Errorf("too many symbolic references from %s in %s", name, url)
+}
+
+// Reads archive entries until the top-level Chart.yaml is found
+func readArchiveMetadata(r io.Reader) (*chart.Metadata, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, errChartfileNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(h.Name, "/"), "/")
+		if len(parts) != 2 || parts[1] != chartfileName {
+			continue
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseChartfile(data)
+	}
+}
+
+// Reads only the Chart.yaml of a chart directory
+func loadChartMetadataFromDirectory(chartPath string) (*chart.Metadata, error) {
+	metadata, err := chartutil.LoadChartfile(filepath.Join(chartPath, chartfileName))
+	if err != nil {
+		return nil, err
+	}
+	if metadata.APIVersion == "" {
+		metadata.APIVersion = chart.APIVersionV1
+	}
+
+	return metadata, metadata.Validate()
+}
+
+func parseChartfile(data []byte) (*chart.Metadata, error) {
+	metadata := &chart.Metadata{}
+	if err := yaml.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+	if metadata.APIVersion == "" {
+		metadata.APIVersion = chart.APIVersionV1
+	}
+
+	return metadata, metadata.Validate()
+}
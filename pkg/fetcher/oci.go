@@ -0,0 +1,95 @@
+package fetcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// SourceOCI is the Source of charts pulled from an OCI registry
+const SourceOCI = "OCI"
+
+// IsOCI returns true if url is an oci:// reference
+func IsOCI(url string) bool {
+	return registry.IsOCI(url)
+}
+
+// Returns a client for OCI registries. It authenticates with the
+// credentials stored by helm registry login, or failing that docker
+// login, and sends its requests through the rate-limited client.
+func ociClient() (*registry.Client, error) {
+	return registry.NewClient(
+		registry.ClientOptHTTPClient(ratelimit.Client()),
+		registry.ClientOptEnableCache(true),
+	)
+}
+
+// Constructs Chart Metadata for the versions of HelmChart in the OCI
+// registry HelmRepo, one for each tag that is a semantic version. Tags
+// only carry versions, so only the metadata of the latest version is
+// read from the registry; that of the others is read from their
+// archives once downloaded.
+func fetchUpstreamOCI(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
+	chartSourceMeta := ChartSourceMetadata{Source: SourceOCI}
+	if len(upstreamYaml.HelmRepoMirrors) > 0 {
+		logrus.Warnf("%s: HelmRepoMirrors are not used with OCI registries", upstreamYaml.HelmChart)
+	}
+	repository := strings.TrimSuffix(strings.TrimPrefix(upstreamYaml.HelmRepoUrl, registry.OCIScheme+"://"), "/") + "/" + upstreamYaml.HelmChart
+
+	client, err := ociClient()
+	if err != nil {
+		return chartSourceMeta, err
+	}
+	tags, err := client.Tags(repository)
+	if err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to list tags of %s: %w", repository, err)
+	}
+	if len(tags) == 0 {
+		return chartSourceMeta, fmt.Errorf("OCI chart: %s %w", repository, ErrNotFound)
+	}
+
+	// tags are sorted newest first, like the entries of an index
+	for _, tag := range tags {
+		chartSourceMeta.Versions = append(chartSourceMeta.Versions, &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: upstreamYaml.HelmChart, Version: tag},
+			URLs:     []string{fmt.Sprintf("%s://%s:%s", registry.OCIScheme, repository, tag)},
+		})
+	}
+
+	latest := chartSourceMeta.Versions[0]
+	result, err := client.Pull(
+		strings.TrimPrefix(latest.URLs[0], registry.OCIScheme+"://"),
+		registry.PullOptWithChart(false),
+		registry.PullOptWithProv(true),
+		registry.PullOptIgnoreMissingProv(true),
+	)
+	if err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to read metadata of %s: %w", latest.URLs[0], err)
+	}
+	if result.Chart.Meta != nil {
+		latest.Metadata = result.Chart.Meta
+	}
+
+	return chartSourceMeta, nil
+}
+
+// Pulls the chart archive of the oci:// reference ref
+func pullOCIChart(ref string) ([]byte, error) {
+	client, err := ociClient()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Pull(strings.TrimPrefix(ref, registry.OCIScheme+"://"))
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Chart.Data, nil
+}
@@ -0,0 +1,33 @@
+package fetcher
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+)
+
+// artifactHubPackages is the Artifact Hub page of a Helm chart version
+const artifactHubPackages = "https://artifacthub.io/packages/helm/%s/%s/%s"
+
+// ReleaseURL returns a page describing version of the upstream of
+// upstreamYaml, as fetched into sourceMetadata, or "" if none is known:
+// the Artifact Hub page of the version, or the fetched commit of a
+// GitHub repository
+func ReleaseURL(upstreamYaml parse.UpstreamYaml, sourceMetadata ChartSourceMetadata, version string) string {
+	switch sourceMetadata.Source {
+	case "ArtifactHub":
+		return fmt.Sprintf(artifactHubPackages, upstreamYaml.AHRepoName, upstreamYaml.AHPackageName, version)
+	case "Git":
+		if sourceMetadata.Commit == "" {
+			return ""
+		}
+		user, repo, err := getGitHubUserAndRepo(upstreamYaml.GitRepoUrl)
+		if err != nil {
+			return ""
+		}
+		return "https://" + path.Join("github.com", user, repo, "tree", sourceMetadata.Commit, upstreamYaml.GitSubDirectory)
+	}
+
+	return ""
+}
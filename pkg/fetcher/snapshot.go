@@ -0,0 +1,68 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/repo"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Constructs Chart Metadata from HelmRepoIndex, a URL or file of an
+// index.yaml snapshot, instead of the live index of HelmRepo, to fetch
+// exactly the versions an old index advertised. Relative chart URLs are
+// resolved against HelmRepo, or against the snapshot URL if HelmRepo is
+// not set.
+func fetchUpstreamHelmrepoIndex(upstreamYaml parse.UpstreamYaml) (ChartSourceMetadata, error) {
+	chartSourceMeta := ChartSourceMetadata{Source: "HelmRepo"}
+	snapshot := upstreamYaml.HelmRepoIndex
+	isUrl := regexp.MustCompile("^https?://").MatchString(snapshot)
+
+	var body []byte
+	var err error
+	if isUrl {
+		body, err = fetchIndex(snapshot)
+	} else {
+		body, err = os.ReadFile(snapshot)
+	}
+	if err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to read index snapshot %s: %w", redact.URL(snapshot), err)
+	}
+	indexYaml := repo.NewIndexFile()
+	if err := yaml.Unmarshal(body, indexYaml); err != nil {
+		return chartSourceMeta, fmt.Errorf("failed to parse index snapshot %s: %w", redact.URL(snapshot), err)
+	}
+	logrus.Infof("Using index snapshot %s for %s\n", redact.URL(snapshot), upstreamYaml.HelmChart)
+
+	upstreamVersions, ok := indexYaml.Entries[upstreamYaml.HelmChart]
+	if !ok {
+		return chartSourceMeta, fmt.Errorf("Helm chart: %s in %s %w", upstreamYaml.HelmChart, redact.URL(snapshot), ErrNotFound)
+	}
+	indexYaml.SortEntries()
+
+	baseUrl := strings.TrimSuffix(upstreamYaml.HelmRepoUrl, "/")
+	if baseUrl == "" && isUrl {
+		baseUrl = strings.TrimSuffix(snapshot, "/"+path.Base(snapshot))
+	}
+	for _, version := range upstreamVersions {
+		if len(version.URLs) == 0 || strings.HasPrefix(version.URLs[0], "http") {
+			continue
+		}
+		if baseUrl == "" {
+			return chartSourceMeta, errors.New("index snapshot file has relative chart URLs; set HelmRepo to resolve them")
+		}
+		version.URLs[0] = baseUrl + "/" + version.URLs[0]
+	}
+	chartSourceMeta.Versions = upstreamVersions
+
+	return chartSourceMeta, nil
+}
@@ -0,0 +1,147 @@
+package fixture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Spec declares the chart archives of a fixture
+type Spec struct {
+	Charts []ChartSpec
+	// Index also writes an index.yaml of the archives, with URLs
+	// relative to the output directory
+	Index bool
+}
+
+// ChartSpec declares a chart archive. Only Name and Version are
+// required.
+type ChartSpec struct {
+	Name       string
+	Version    string
+	AppVersion string
+	// APIVersion defaults to v2
+	APIVersion  string
+	Type        string
+	Description string
+	Icon        string
+	KubeVersion string
+	Deprecated  bool
+	Annotations map[string]string
+	// Files maps paths in the chart, such as templates/deployment.yaml,
+	// to their contents. A values.yaml is parsed into the chart values.
+	Files map[string]string
+	// Vendor is the subdirectory of the output directory the archive is
+	// written to, as under assets. Empty writes it to the output
+	// directory itself.
+	Vendor string
+}
+
+// Load reads the spec at specPath
+func Load(specPath string) (Spec, error) {
+	spec := Spec{}
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return spec, err
+	}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("failed to parse %s: %w", specPath, err)
+	}
+
+	return spec, nil
+}
+
+// Build returns the chart declared by chartSpec
+func Build(chartSpec ChartSpec) (*chart.Chart, error) {
+	if chartSpec.Name == "" || chartSpec.Version == "" {
+		return nil, fmt.Errorf("chart %q %q: name and version are required", chartSpec.Name, chartSpec.Version)
+	}
+	apiVersion := chartSpec.APIVersion
+	if apiVersion == "" {
+		apiVersion = chart.APIVersionV2
+	}
+
+	helmChart := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:  apiVersion,
+			Name:        chartSpec.Name,
+			Version:     chartSpec.Version,
+			AppVersion:  chartSpec.AppVersion,
+			Type:        chartSpec.Type,
+			Description: chartSpec.Description,
+			Icon:        chartSpec.Icon,
+			KubeVersion: chartSpec.KubeVersion,
+			Deprecated:  chartSpec.Deprecated,
+			Annotations: chartSpec.Annotations,
+		},
+		Values: make(map[string]interface{}),
+	}
+
+	filePaths := make([]string, 0, len(chartSpec.Files))
+	for filePath := range chartSpec.Files {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	for _, filePath := range filePaths {
+		data := []byte(chartSpec.Files[filePath])
+		file := &chart.File{Name: filepath.ToSlash(filePath), Data: data}
+		switch {
+		case filePath == chartutil.ValuesfileName:
+			if err := yaml.Unmarshal(data, &helmChart.Values); err != nil {
+				return nil, fmt.Errorf("chart %s %s: failed to parse %s: %w", chartSpec.Name, chartSpec.Version, filePath, err)
+			}
+			// chartutil.Save writes values.yaml from the raw file
+			helmChart.Raw = append(helmChart.Raw, file)
+		case filepath.Dir(filePath) == "templates":
+			helmChart.Templates = append(helmChart.Templates, file)
+		default:
+			helmChart.Files = append(helmChart.Files, file)
+		}
+	}
+	if err := helmChart.Validate(); err != nil {
+		return nil, fmt.Errorf("chart %s %s: %w", chartSpec.Name, chartSpec.Version, err)
+	}
+
+	return helmChart, nil
+}
+
+// Generate writes the chart archives declared by spec to outputDir,
+// returning their paths, and their index.yaml if spec.Index is set
+func Generate(spec Spec, outputDir string) ([]string, error) {
+	archivePaths := make([]string, 0, len(spec.Charts))
+	for _, chartSpec := range spec.Charts {
+		helmChart, err := Build(chartSpec)
+		if err != nil {
+			return archivePaths, err
+		}
+		chartDir := filepath.Join(outputDir, chartSpec.Vendor)
+		if err := os.MkdirAll(chartDir, 0755); err != nil {
+			return archivePaths, err
+		}
+		archivePath, err := chartutil.Save(helmChart, chartDir)
+		if err != nil {
+			return archivePaths, fmt.Errorf("failed to save chart %s %s: %w", chartSpec.Name, chartSpec.Version, err)
+		}
+		archivePaths = append(archivePaths, archivePath)
+	}
+
+	if spec.Index {
+		index, err := repo.IndexDirectory(outputDir, "")
+		if err != nil {
+			return archivePaths, fmt.Errorf("failed to index %s: %w", outputDir, err)
+		}
+		index.SortEntries()
+		if err := index.WriteFile(filepath.Join(outputDir, "index.yaml"), 0644); err != nil {
+			return archivePaths, err
+		}
+	}
+
+	return archivePaths, nil
+}
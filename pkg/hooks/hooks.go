@@ -0,0 +1,166 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StagePreIntegrate  = "preIntegrate"
+	StagePostIntegrate = "postIntegrate"
+	StagePostIndex     = "postIndex"
+
+	// PolicyFail aborts the run when the hook fails
+	PolicyFail = "fail"
+	// PolicySkip skips the package the hook ran for. At the postIndex
+	// stage, which runs once for all packages, it behaves like PolicyWarn.
+	PolicySkip = "skip"
+	// PolicyWarn logs the failure and continues
+	PolicyWarn = "warn"
+
+	defaultTimeout = 10 * time.Minute
+)
+
+// ErrSkipPackage is wrapped by the error of a hook with PolicySkip
+var ErrSkipPackage = errors.New("skipping package")
+
+// Hook is an external command run at a pipeline stage. It receives a
+// JSON Payload on stdin.
+type Hook struct {
+	Name          string
+	Command       []string
+	FailurePolicy string
+	// Timeout is a duration such as "30s". Defaults to 10m.
+	Timeout string
+}
+
+// Options configures the hooks of each stage
+type Options struct {
+	PreIntegrate  []Hook
+	PostIntegrate []Hook
+	PostIndex     []Hook
+}
+
+// Payload is written to the stdin of hooks
+type Payload struct {
+	Stage string `json:"stage"`
+	// Package is the <vendor>/<chart> package name, for the
+	// preIntegrate and postIntegrate stages
+	Package  string   `json:"package,omitempty"`
+	Vendor   string   `json:"vendor,omitempty"`
+	Chart    string   `json:"chart,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+	// Archives and Charts are the chart archives and directories
+	// written for the package, for the postIntegrate stage. They are
+	// relative to the repository root; archives kept in remote storage
+	// are given by URL.
+	Archives []string `json:"archives,omitempty"`
+	Charts   []string `json:"charts,omitempty"`
+	// Packages lists every updated package at the postIndex stage
+	Packages []string `json:"packages,omitempty"`
+}
+
+// ForStage returns the hooks configured for stage
+func (o Options) ForStage(stage string) []Hook {
+	switch stage {
+	case StagePreIntegrate:
+		return o.PreIntegrate
+	case StagePostIntegrate:
+		return o.PostIntegrate
+	case StagePostIndex:
+		return o.PostIndex
+	}
+
+	return nil
+}
+
+// Run runs the hooks of payload.Stage in order. A failing hook with
+// PolicyWarn is logged; any other failure stops the remaining hooks and
+// is returned, wrapping ErrSkipPackage for PolicySkip.
+func (o Options) Run(payload Payload) error {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range o.ForStage(payload.Stage) {
+		err := hook.run(input)
+		if err == nil {
+			continue
+		}
+		switch hook.policy(payload.Stage) {
+		case PolicyWarn:
+			logrus.Warnf("%s hook %s failed: %s", payload.Stage, hook.name(), err)
+		case PolicySkip:
+			return fmt.Errorf("%s hook %s failed: %w: %s", payload.Stage, hook.name(), ErrSkipPackage, err)
+		default:
+			return fmt.Errorf("%s hook %s failed: %w", payload.Stage, hook.name(), err)
+		}
+	}
+
+	return nil
+}
+
+func (h Hook) name() string {
+	if h.Name != "" {
+		return h.Name
+	}
+
+	return strings.Join(h.Command, " ")
+}
+
+func (h Hook) policy(stage string) string {
+	switch h.FailurePolicy {
+	case PolicySkip:
+		if stage == StagePostIndex {
+			return PolicyWarn
+		}
+		return PolicySkip
+	case PolicyWarn:
+		return PolicyWarn
+	}
+
+	return PolicyFail
+}
+
+func (h Hook) run(input []byte) error {
+	if len(h.Command) == 0 {
+		return fmt.Errorf("no command configured")
+	}
+	timeout := defaultTimeout
+	if h.Timeout != "" {
+		parsed, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", h.Timeout, err)
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logrus.Debugf("Running hook %s\n", h.name())
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stderr
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -1,15 +1,34 @@
 package icons
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/rancher/partner-charts-ci/pkg/cache"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	//maxRedirects bounds the redirects followed to download an icon
+	maxRedirects = 5
+)
+
+var (
+	// ErrNotImage is returned when an icon URL does not serve an image,
+	// typically because it redirects to a login page
+	ErrNotImage = errors.New("not an image")
+
+	loginPathPattern = regexp.MustCompile(`(?i)/(login|log-in|signin|sign-in|sign_in|sso|oauth2?|auth)(/|\.|$)`)
+)
+
 // DownloadFiles will download all available icons from chart in index.yaml at assets/icons and return the successfully downloaded files.
 // If the file is already downloaded, it will skip the download process but still save the PackageIcon to the map so it can be overridden later
 func DownloadFiles(entriesPathsAndIconsMap PackageIconMap) PackageIconMap {
@@ -22,17 +41,16 @@ func DownloadFiles(entriesPathsAndIconsMap PackageIconMap) PackageIconMap {
 		ext := filepath.Ext(url) // file extension from the URL
 
 		// GET Request for downloading the icon file
-		resp, err := http.Get(url)
+		body, err := fetchIcon(url)
 		if err != nil {
 			failedURLs[filename] = url
-			logrus.Errorf("Failed to GET Request for url: %s", url)
+			logrus.Errorf("Failed to download icon of %s from %s: %s", filename, url, err)
 			continue
 		}
-		defer resp.Body.Close()
 
 		// Advanced file type checking in case we could not detect the file type from the URL
 		if ext == "" {
-			ext = detectMIMEType(resp.Body) // Update the file path with the detected extension
+			ext = detectMIMEType(io.NopCloser(bytes.NewReader(body))) // Update the file path with the detected extension
 			if ext == "" {
 				// could not detect the file type
 				failedURLs[filename] = url
@@ -50,7 +68,7 @@ func DownloadFiles(entriesPathsAndIconsMap PackageIconMap) PackageIconMap {
 		}
 
 		// Create and save the icon file locally
-		err = saveIconFile(filePath, resp.Body)
+		err = saveIconFile(filePath, io.NopCloser(bytes.NewReader(body)))
 		if err != nil {
 			failedURLs[filename] = url
 			logrus.Errorf("Failed to create/write file: %s", filePath)
@@ -63,6 +81,85 @@ func DownloadFiles(entriesPathsAndIconsMap PackageIconMap) PackageIconMap {
 	return downloadedIcons
 }
 
+// fetchIcon downloads the icon at url, reusing a cached copy if caching
+// is enabled. Redirects are followed as long as checkRedirect allows
+// them, and responses that are not images, such as the HTML of a login
+// page, are rejected instead of being saved as icons.
+func fetchIcon(url string) ([]byte, error) {
+	c := cache.Default()
+	if c != nil {
+		if body, err := c.Read(cache.KindIcons, url); err == nil && checkImage(body) == nil {
+			return body, nil
+		}
+	}
+
+	client := *ratelimit.Client()
+	client.CheckRedirect = checkRedirect
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	finalURL := resp.Request.URL.String()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", finalURL, resp.StatusCode)
+	}
+	if err := checkImage(body); err != nil {
+		if finalURL != url {
+			return nil, fmt.Errorf("redirected to %s: %w", finalURL, err)
+		}
+		return nil, err
+	}
+
+	if c != nil {
+		if err := c.Write(cache.KindIcons, url, body); err != nil {
+			logrus.Debug(err)
+		}
+	}
+
+	return body, nil
+}
+
+// Allows up to maxRedirects redirects that neither downgrade https to
+// http nor lead to a login page
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from https to %s", req.URL)
+	}
+	if loginPathPattern.MatchString(req.URL.Path) {
+		return fmt.Errorf("redirected to login page %s: %w", req.URL, ErrNotImage)
+	}
+
+	return nil
+}
+
+// Returns ErrNotImage, with the detected content type, unless data is
+// an image
+func checkImage(data []byte) error {
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "image/") {
+		return nil
+	}
+	// DetectContentType reports SVG images as XML or plain text
+	head := bytes.ToLower(data)
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if bytes.Contains(head, []byte("<svg")) && !bytes.Contains(head, []byte("<html")) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: content is %s", ErrNotImage, contentType)
+}
+
 // Exists checks if the file already exists
 func Exists(filePath string) bool {
 	_, err := os.Stat(filePath)
@@ -0,0 +1,112 @@
+package icons
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const (
+	//embeddedIconName is the path of an embedded icon in the chart,
+	//without its extension
+	embeddedIconName = "files/icon"
+	fileScheme       = "file://"
+)
+
+// Embed adds the icon of helmChart to the chart itself, at
+// files/icon.<ext>, and points Metadata.Icon at it, so the chart does
+// not depend on the icon being reachable. An icon previously downloaded
+// to assets/icons is used if present; otherwise it is fetched from
+// Metadata.Icon. Returns false if the chart has no icon or it is
+// already embedded.
+func Embed(helmChart *chart.Chart) (bool, error) {
+	iconUrl := helmChart.Metadata.Icon
+	if iconUrl == "" || IsEmbedded(iconUrl) {
+		return false, nil
+	}
+
+	if downloaded := CheckForDownloadedIcon(helmChart.Name()); downloaded != "" {
+		iconUrl = downloaded
+	}
+
+	var body []byte
+	var err error
+	if strings.HasPrefix(iconUrl, fileScheme) {
+		body, err = os.ReadFile(filepath.FromSlash(strings.TrimPrefix(iconUrl, fileScheme)))
+	} else {
+		body, err = fetchIcon(iconUrl)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read icon %s: %w", iconUrl, err)
+	}
+
+	ext, err := extension(iconUrl, body)
+	if err != nil {
+		return false, err
+	}
+
+	iconPath := embeddedIconName + ext
+	files := make([]*chart.File, 0, len(helmChart.Files)+1)
+	for _, file := range helmChart.Files {
+		if !strings.HasPrefix(file.Name, embeddedIconName+".") {
+			files = append(files, file)
+		}
+	}
+	helmChart.Files = append(files, &chart.File{Name: iconPath, Data: body})
+	helmChart.Metadata.Icon = fileScheme + iconPath
+	logrus.Debugf("Embedded icon %s in %s (%s)\n", iconUrl, helmChart.Name(), helmChart.Metadata.Version)
+
+	return true, nil
+}
+
+// IsEmbedded reports whether iconUrl points at an icon embedded in its
+// chart by Embed
+func IsEmbedded(iconUrl string) bool {
+	return strings.HasPrefix(iconUrl, fileScheme+embeddedIconName)
+}
+
+// Download fetches the remote icon at iconUrl, reusing a cached copy if
+// caching is enabled, and returns it along with its file extension
+func Download(iconUrl string) ([]byte, string, error) {
+	body, err := fetchIcon(iconUrl)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download icon %s: %w", iconUrl, err)
+	}
+	ext, err := extension(iconUrl, body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, ext, nil
+}
+
+// Returns the file extension of the icon at iconUrl, from the URL if it
+// is a known one or else from the content of body
+func extension(iconUrl string, body []byte) (string, error) {
+	ext := strings.ToLower(path.Ext(iconUrl))
+	if !isKnownExtension(ext) {
+		ext = detectMIMEType(io.NopCloser(bytes.NewReader(body)))
+		if ext == "" {
+			return "", fmt.Errorf("failed to detect file type of icon %s", iconUrl)
+		}
+	}
+
+	return ext, nil
+}
+
+func isKnownExtension(ext string) bool {
+	for _, extension := range extensions {
+		if ext == extension {
+			return true
+		}
+	}
+
+	return false
+}
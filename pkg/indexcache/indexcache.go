@@ -0,0 +1,94 @@
+package indexcache
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// View is a typed view over an index.yaml, built once and shared by the
+// queries of a process until the index changes. The chart versions it
+// returns belong to the view and must not be modified.
+type View struct {
+	Index *repo.IndexFile
+	// annotated maps each annotation to the versions of each chart that
+	// have it, in index order
+	annotated map[string]map[string]repo.ChartVersions
+}
+
+var (
+	mu      sync.Mutex
+	cached  *View
+	path    string
+	modTime time.Time
+	size    int64
+)
+
+// Build indexes the annotations of the versions in index
+func Build(index *repo.IndexFile) *View {
+	v := &View{Index: index, annotated: make(map[string]map[string]repo.ChartVersions)}
+	for chartName, chartVersions := range index.Entries {
+		for _, chartVersion := range chartVersions {
+			for annotation := range chartVersion.Annotations {
+				if v.annotated[annotation] == nil {
+					v.annotated[annotation] = make(map[string]repo.ChartVersions)
+				}
+				v.annotated[annotation][chartName] = append(v.annotated[annotation][chartName], chartVersion)
+			}
+		}
+	}
+
+	return v
+}
+
+// Load returns the view of the index.yaml at indexPath. It is only
+// built the first time, or again if the file changed or Invalidate was
+// called since.
+func Load(indexPath string) (*View, error) {
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cached != nil && path == indexPath && modTime.Equal(info.ModTime()) && size == info.Size() {
+		return cached, nil
+	}
+	index, err := repo.LoadIndexFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	cached = Build(index)
+	path, modTime, size = indexPath, info.ModTime(), info.Size()
+
+	return cached, nil
+}
+
+// Invalidate drops the cached view, so that the next Load reads the
+// index again. It must be called after writing the index, as a rewrite
+// within the resolution of the file's modification time may keep its
+// size.
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	cached = nil
+}
+
+// WithAnnotation returns the versions that have annotation set to
+// value, by chart name. If value is "", the versions that have
+// annotation are returned regardless of its value.
+func (v *View) WithAnnotation(annotation, value string) map[string]repo.ChartVersions {
+	matchedVersions := make(map[string]repo.ChartVersions)
+	for chartName, chartVersions := range v.annotated[annotation] {
+		for _, chartVersion := range chartVersions {
+			if value == "" || chartVersion.Annotations[annotation] == value {
+				matchedVersions[chartName] = append(matchedVersions[chartName], chartVersion)
+			}
+		}
+	}
+
+	return matchedVersions
+}
@@ -0,0 +1,201 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+const (
+	annotationNamespace   = "catalog.cattle.io/namespace"
+	annotationReleaseName = "catalog.cattle.io/release-name"
+	defaultNamespace      = "partner-charts-ci-smoke"
+	clusterName           = "partner-charts-ci"
+
+	ModeDryRun  = "dry-run"
+	ModeInstall = "install"
+
+	ProviderKind = "kind"
+	ProviderK3d  = "k3d"
+)
+
+// Options configures how chart versions are installed
+type Options struct {
+	// Mode is ModeDryRun to render against the API server without
+	// persisting anything, or ModeInstall to install and uninstall
+	Mode string
+	// Kubeconfig points helm at a specific cluster. Empty uses the
+	// default kubeconfig.
+	Kubeconfig  string
+	KubeContext string
+	Timeout     time.Duration
+}
+
+// Cluster is an ephemeral cluster created for smoke testing
+type Cluster struct {
+	Provider   string
+	Kubeconfig string
+	tempDir    string
+}
+
+// StartCluster creates an ephemeral cluster with kind or k3d
+func StartCluster(provider string) (*Cluster, error) {
+	tempDir, err := os.MkdirTemp("", "smokeCluster")
+	if err != nil {
+		return nil, err
+	}
+	cluster := &Cluster{
+		Provider:   provider,
+		Kubeconfig: filepath.Join(tempDir, "kubeconfig"),
+		tempDir:    tempDir,
+	}
+
+	logrus.Infof("Creating %s cluster %s\n", provider, clusterName)
+	switch provider {
+	case ProviderKind:
+		err = run("kind", "create", "cluster", "--name", clusterName, "--kubeconfig", cluster.Kubeconfig, "--wait", "5m")
+	case ProviderK3d:
+		err = run("k3d", "cluster", "create", clusterName, "--kubeconfig-update-default=false", "--wait")
+		if err == nil {
+			err = run("k3d", "kubeconfig", "write", clusterName, "--output", cluster.Kubeconfig)
+		}
+	default:
+		err = fmt.Errorf("unknown cluster provider %q", provider)
+	}
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return cluster, nil
+}
+
+// Delete removes the ephemeral cluster
+func (c *Cluster) Delete() error {
+	defer os.RemoveAll(c.tempDir)
+	logrus.Infof("Deleting %s cluster %s\n", c.Provider, clusterName)
+	switch c.Provider {
+	case ProviderKind:
+		return run("kind", "delete", "cluster", "--name", clusterName)
+	case ProviderK3d:
+		return run("k3d", "cluster", "delete", clusterName)
+	}
+
+	return nil
+}
+
+// InstallChart installs the chart archive at chartPath into the cluster
+// using the release name and namespace Rancher would use. In
+// ModeInstall the release is uninstalled again afterwards.
+func InstallChart(chartPath string, options Options) error {
+	helmChart, err := loader.LoadFile(chartPath)
+	if err != nil {
+		return err
+	}
+
+	releaseName := helmChart.Metadata.Annotations[annotationReleaseName]
+	if releaseName == "" {
+		releaseName = helmChart.Name()
+	}
+	namespace := helmChart.Metadata.Annotations[annotationNamespace]
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+
+	args := []string{"install", releaseName, chartPath, "--namespace", namespace, "--timeout", timeout.String()}
+	args = append(args, options.helmArgs()...)
+	switch options.Mode {
+	case "", ModeDryRun:
+		// a server side dry run does not create the namespace, and
+		// fails without it
+		created, err := createNamespace(namespace, options)
+		if err != nil {
+			return err
+		}
+		if created {
+			defer func() {
+				if err := run("kubectl", append([]string{"delete", "namespace", namespace, "--wait=false"}, options.kubectlArgs()...)...); err != nil {
+					logrus.Error(err)
+				}
+			}()
+		}
+		args = append(args, "--dry-run=server")
+	case ModeInstall:
+		args = append(args, "--create-namespace", "--wait")
+	default:
+		return fmt.Errorf("unknown install mode %q", options.Mode)
+	}
+
+	logrus.Debugf("Installing %s into namespace %s as %s\n", chartPath, namespace, releaseName)
+	installErr := run("helm", args...)
+
+	if options.Mode == ModeInstall {
+		uninstallArgs := append([]string{"uninstall", releaseName, "--namespace", namespace, "--wait"}, options.helmArgs()...)
+		if err := run("helm", uninstallArgs...); err != nil && installErr == nil {
+			return fmt.Errorf("failed to uninstall: %w", err)
+		}
+	}
+
+	return installErr
+}
+
+// Creates namespace unless it exists. Returns whether it was created.
+func createNamespace(namespace string, options Options) (bool, error) {
+	if err := run("kubectl", append([]string{"get", "namespace", namespace}, options.kubectlArgs()...)...); err == nil {
+		return false, nil
+	}
+	if err := run("kubectl", append([]string{"create", "namespace", namespace}, options.kubectlArgs()...)...); err != nil {
+		return false, fmt.Errorf("failed to create namespace %s: %w", namespace, err)
+	}
+
+	return true, nil
+}
+
+func (o Options) kubectlArgs() []string {
+	args := make([]string, 0)
+	if o.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", o.Kubeconfig)
+	}
+	if o.KubeContext != "" {
+		args = append(args, "--context", o.KubeContext)
+	}
+
+	return args
+}
+
+func (o Options) helmArgs() []string {
+	args := make([]string, 0)
+	if o.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", o.Kubeconfig)
+	}
+	if o.KubeContext != "" {
+		args = append(args, "--kube-context", o.KubeContext)
+	}
+
+	return args
+}
+
+func run(name string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package interpolate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Env replaces references to environment variables in data. See Expand.
+func Env(data []byte) ([]byte, error) {
+	return Expand(data, os.LookupEnv)
+}
+
+// AllowedEnv replaces references to the environment variables in
+// allowed in data, like Env. A reference to any other variable is an
+// error, even if it has a default, so that files from untrusted
+// contributors can not read secrets from the environment.
+func AllowedEnv(data []byte, allowed []string) ([]byte, error) {
+	return expand(data, os.LookupEnv, func(name string) bool {
+		for _, allowedName := range allowed {
+			if name == allowedName {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Expand replaces references to variables in data with their value
+// from lookup:
+//   - ${NAME} is required, and an error if NAME is not set
+//   - ${NAME:?message} is required, with message added to the error
+//   - ${NAME:-default} is optional, and default if NAME is unset or empty
+//
+// $${ is written as a literal ${. Lines that are YAML comments are left
+// untouched. Every unset required variable is reported, with its line.
+func Expand(data []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	return expand(data, lookup, nil)
+}
+
+// Expands data like Expand, rejecting the names that allow does not
+// accept. A nil allow accepts every name.
+func expand(data []byte, lookup func(string) (string, bool), allow func(string) bool) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	var errs []error
+	var out strings.Builder
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") || !strings.Contains(line, "${") {
+			out.WriteString(line)
+			continue
+		}
+		expanded, err := expandLine(line, lookup, allow)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+			continue
+		}
+		out.WriteString(expanded)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return []byte(out.String()), nil
+}
+
+func expandLine(line string, lookup func(string) (string, bool), allow func(string) bool) (string, error) {
+	var out strings.Builder
+	var errs []error
+	for {
+		start := strings.Index(line, "${")
+		if start < 0 {
+			out.WriteString(line)
+			break
+		}
+		if start > 0 && line[start-1] == '$' {
+			out.WriteString(line[:start-1] + "${")
+			line = line[start+2:]
+			continue
+		}
+		end := strings.Index(line[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", strings.TrimSpace(line))
+		}
+		out.WriteString(line[:start])
+		value, err := resolve(line[start+2:start+end], lookup, allow)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		out.WriteString(value)
+		line = line[start+end+1:]
+	}
+
+	return out.String(), errors.Join(errs...)
+}
+
+// Resolves the expression between ${ and }
+func resolve(expression string, lookup func(string) (string, bool), allow func(string) bool) (string, error) {
+	name, modifier, operand := expression, "", ""
+	if i := strings.Index(expression, ":"); i >= 0 {
+		name, modifier = expression[:i], expression[i:]
+		if len(modifier) < 2 || (modifier[1] != '-' && modifier[1] != '?') {
+			return "", fmt.Errorf("invalid reference ${%s}: use ${%s:-default} or ${%s:?message}", expression, name, name)
+		}
+		modifier, operand = modifier[:2], modifier[2:]
+	}
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	if allow != nil && !allow(name) {
+		return "", fmt.Errorf("environment variable %s may not be referenced: it is not listed in upstreamEnvVariables", name)
+	}
+
+	value, ok := lookup(name)
+	switch modifier {
+	case ":-":
+		if !ok || value == "" {
+			return operand, nil
+		}
+	case ":?":
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set: %s", name, operand)
+		}
+	default:
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set; use ${%s:-default} to make it optional", name, name)
+		}
+	}
+
+	return value, nil
+}
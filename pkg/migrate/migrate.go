@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Migration renames the annotation From to To, translating its value
+// through Values. Values not listed in Values are kept. An empty To
+// keeps the annotation name and only translates its value. Remove
+// drops the annotation instead.
+type Migration struct {
+	From   string            `json:"from"`
+	To     string            `json:"to,omitempty"`
+	Values map[string]string `json:"values,omitempty"`
+	Remove bool              `json:"remove,omitempty"`
+}
+
+// Mapping is an ordered list of migrations. Each migration sees the
+// annotations as left by the previous one.
+type Mapping []Migration
+
+// Change is a single annotation rewritten by a Mapping. An empty To
+// means the annotation was removed.
+type Change struct {
+	From     string
+	To       string
+	OldValue string
+	NewValue string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.To == "":
+		return fmt.Sprintf("removed %s=%q", c.From, c.OldValue)
+	case c.To == c.From:
+		return fmt.Sprintf("%s: %q -> %q", c.From, c.OldValue, c.NewValue)
+	default:
+		return fmt.Sprintf("%s=%q -> %s=%q", c.From, c.OldValue, c.To, c.NewValue)
+	}
+}
+
+// Load reads and validates the mapping file at mappingPath
+func Load(mappingPath string) (Mapping, error) {
+	mappingFile, err := os.ReadFile(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := Mapping{}
+	if err := yaml.Unmarshal(mappingFile, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", mappingPath, err)
+	}
+
+	for i, migration := range mapping {
+		switch {
+		case migration.From == "":
+			return nil, fmt.Errorf("migration %d has no from annotation", i+1)
+		case migration.Remove && (migration.To != "" || len(migration.Values) > 0):
+			return nil, fmt.Errorf("%s: remove cannot be combined with to or values", migration.From)
+		case !migration.Remove && migration.To == "" && len(migration.Values) == 0:
+			return nil, fmt.Errorf("%s: migration needs to, values or remove", migration.From)
+		}
+	}
+
+	return mapping, nil
+}
+
+// Apply rewrites annotations in place and returns the changes made. If
+// a renamed annotation would overwrite an existing annotation with a
+// different value, an error is returned and annotations are left
+// unmodified.
+func (m Mapping) Apply(annotations map[string]string) ([]Change, error) {
+	migrated := make(map[string]string, len(annotations))
+	for annotation, value := range annotations {
+		migrated[annotation] = value
+	}
+
+	changes := make([]Change, 0)
+	for _, migration := range m {
+		oldValue, ok := migrated[migration.From]
+		if !ok {
+			continue
+		}
+
+		if migration.Remove {
+			delete(migrated, migration.From)
+			changes = append(changes, Change{From: migration.From, OldValue: oldValue})
+			continue
+		}
+
+		to := migration.To
+		if to == "" {
+			to = migration.From
+		}
+		newValue := oldValue
+		if value, ok := migration.Values[oldValue]; ok {
+			newValue = value
+		}
+		if to == migration.From && newValue == oldValue {
+			continue
+		}
+		if existing, ok := migrated[to]; ok && to != migration.From && existing != newValue {
+			return nil, fmt.Errorf("cannot rename %s to %s: %s is already set to %q", migration.From, to, to, existing)
+		}
+
+		delete(migrated, migration.From)
+		migrated[to] = newValue
+		changes = append(changes, Change{From: migration.From, To: to, OldValue: oldValue, NewValue: newValue})
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	for annotation := range annotations {
+		delete(annotations, annotation)
+	}
+	for annotation, value := range migrated {
+		annotations[annotation] = value
+	}
+
+	return changes, nil
+}
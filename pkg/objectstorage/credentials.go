@@ -0,0 +1,90 @@
+package objectstorage
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hostCredentials names the environment variables holding the
+// credentials of a host. Requests are authenticated with HTTP basic
+// authentication if usernameEnv is set, and with a bearer token
+// otherwise.
+type hostCredentials struct {
+	usernameEnv string
+	secretEnv   string
+}
+
+var (
+	credentialsMu    sync.Mutex
+	credentialsHosts = make(map[string]hostCredentials)
+	reservedHosts    = make(map[string]struct{})
+)
+
+// ReserveHost prevents credentials from being registered for host, for
+// hosts that partner-charts-ci itself sends requests to
+func ReserveHost(host string) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	reservedHosts[strings.ToLower(host)] = struct{}{}
+}
+
+// RegisterBasicAuthHost authenticates every later request to host made
+// through a Transport with HTTP basic authentication, with the username
+// and password read from the environment variables usernameEnv and
+// passwordEnv when each request is made
+func RegisterBasicAuthHost(host, usernameEnv, passwordEnv string) error {
+	return registerCredentials(host, hostCredentials{usernameEnv: usernameEnv, secretEnv: passwordEnv})
+}
+
+// RegisterBearerTokenHost authenticates every later request to host
+// made through a Transport with the bearer token read from the
+// environment variable tokenEnv when each request is made
+func RegisterBearerTokenHost(host, tokenEnv string) error {
+	return registerCredentials(host, hostCredentials{secretEnv: tokenEnv})
+}
+
+// Registers credentials for host. Registrations are shared by every
+// package, so a host that is reserved, or already registered with
+// other credentials, is an error rather than being taken over.
+func registerCredentials(host string, credentials hostCredentials) error {
+	host = strings.ToLower(host)
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	if _, ok := reservedHosts[host]; ok {
+		return fmt.Errorf("can not authenticate requests to %s, which partner-charts-ci uses itself", host)
+	}
+	if registered, ok := credentialsHosts[host]; ok && registered != credentials {
+		return fmt.Errorf("requests to %s are already authenticated with other credentials", host)
+	}
+	if isSigV4Host(host) {
+		return fmt.Errorf("requests to %s are already signed with AWS SigV4", host)
+	}
+	credentialsHosts[host] = credentials
+
+	return nil
+}
+
+// Returns a copy of req with the Authorization header of credentials.
+// Redirects to other hosts are not authenticated, as they are requested
+// without the header.
+func authorize(req *http.Request, credentials hostCredentials) (*http.Request, error) {
+	secret := os.Getenv(credentials.secretEnv)
+	if secret == "" {
+		return nil, fmt.Errorf("failed to authenticate request to %s: environment variable %s is not set", req.URL.Host, credentials.secretEnv)
+	}
+	authorized := req.Clone(req.Context())
+	if credentials.usernameEnv != "" {
+		logrus.Debugf("Authenticating request to %s with basic authentication from %s\n", req.URL.Host, credentials.usernameEnv)
+		authorized.SetBasicAuth(os.Getenv(credentials.usernameEnv), secret)
+	} else {
+		logrus.Debugf("Authenticating request to %s with the bearer token in %s\n", req.URL.Host, credentials.secretEnv)
+		authorized.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	return authorized, nil
+}
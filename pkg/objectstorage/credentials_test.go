@@ -0,0 +1,41 @@
+package objectstorage
+
+import (
+	"testing"
+)
+
+func TestRegisterCredentials(t *testing.T) {
+	ReserveHost("api.github.com")
+	t.Cleanup(func() {
+		credentialsHosts = make(map[string]hostCredentials)
+		sigV4Hosts = make(map[string]sigV4Scope)
+		reservedHosts = make(map[string]struct{})
+	})
+
+	if err := RegisterBearerTokenHost("charts.example.com", "ACME_TOKEN"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		register func() error
+		valid    bool
+	}{
+		{"same credentials", func() error { return RegisterBearerTokenHost("Charts.Example.com", "ACME_TOKEN") }, true},
+		{"other token", func() error { return RegisterBearerTokenHost("charts.example.com", "OTHER_TOKEN") }, false},
+		{"basic authentication", func() error { return RegisterBasicAuthHost("charts.example.com", "ACME_USER", "ACME_TOKEN") }, false},
+		{"SigV4", func() error { return RegisterSigV4Host("charts.example.com", "us-east-1", "execute-api") }, false},
+		{"reserved host", func() error { return RegisterBearerTokenHost("api.github.com", "ACME_TOKEN") }, false},
+		{"reserved host SigV4", func() error { return RegisterSigV4Host("API.github.com", "us-east-1", "execute-api") }, false},
+		{"other host", func() error { return RegisterBearerTokenHost("charts.other.example.com", "OTHER_TOKEN") }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.register(); (err == nil) != test.valid {
+				t.Errorf("expected valid to be %t, got %v", test.valid, err)
+			}
+		})
+	}
+	if credentials := credentialsHosts["charts.example.com"]; credentials.secretEnv != "ACME_TOKEN" || credentials.usernameEnv != "" {
+		t.Errorf("credentials of charts.example.com were replaced: %+v", credentials)
+	}
+}
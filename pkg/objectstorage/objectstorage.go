@@ -0,0 +1,328 @@
+package objectstorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	//AzureAccountEnvVariable sets the environment variable to check for the Azure storage account
+	AzureAccountEnvVariable = "AZURE_STORAGE_ACCOUNT"
+	//AzureKeyEnvVariable sets the environment variable to check for the Azure storage account key
+	AzureKeyEnvVariable = "AZURE_STORAGE_KEY"
+	//AzureSASEnvVariable sets the environment variable to check for an Azure SAS token
+	AzureSASEnvVariable = "AZURE_STORAGE_SAS_TOKEN"
+	//OSSBucketEnvVariable sets the environment variable to check for the Alibaba OSS bucket that is signed for
+	OSSBucketEnvVariable = "OSS_BUCKET"
+	azureBlobHostSuffix  = ".blob.core.windows.net"
+	azureAPIVersion      = "2021-08-06"
+
+	ossHostSuffix = ".aliyuncs.com"
+)
+
+// Environment variables checked for Alibaba OSS credentials, in order
+// of preference
+var (
+	ossAccessKeyIdEnvVariables     = []string{"OSS_ACCESS_KEY_ID", "ALIBABA_CLOUD_ACCESS_KEY_ID"}
+	ossAccessKeySecretEnvVariables = []string{"OSS_ACCESS_KEY_SECRET", "ALIBABA_CLOUD_ACCESS_KEY_SECRET"}
+	ossSessionTokenEnvVariables    = []string{"OSS_SESSION_TOKEN", "ALIBABA_CLOUD_SECURITY_TOKEN"}
+)
+
+// Transport authenticates requests to Azure Blob Storage and Alibaba
+// OSS hosted Helm repositories with credentials from the standard
+// environment variables of their SDKs, signs requests to hosts
+// registered with RegisterSigV4Host, adds the credentials of hosts
+// registered with RegisterBasicAuthHost or RegisterBearerTokenHost,
+// and passes all other requests through to Next unchanged. Requests to object storage hosts are also
+// passed through unchanged when no credentials are set, so that public
+// containers and buckets keep working.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+// sigV4Scope is the region and service that requests to a host are
+// signed for
+type sigV4Scope struct {
+	region  string
+	service string
+}
+
+var (
+	sigV4Mu    sync.Mutex
+	sigV4Hosts = make(map[string]sigV4Scope)
+)
+
+// RegisterSigV4Host signs every later request to host made through a
+// Transport with AWS Signature Version 4 for service in region, using
+// the credentials of ResolveAWSCredentials. As with
+// RegisterBasicAuthHost, reserved hosts and hosts registered otherwise
+// are an error.
+func RegisterSigV4Host(host, region, service string) error {
+	host = strings.ToLower(host)
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	if _, ok := reservedHosts[host]; ok {
+		return fmt.Errorf("can not sign requests to %s, which partner-charts-ci uses itself", host)
+	}
+	if _, ok := credentialsHosts[host]; ok {
+		return fmt.Errorf("requests to %s are already authenticated with other credentials", host)
+	}
+	sigV4Mu.Lock()
+	defer sigV4Mu.Unlock()
+	scope := sigV4Scope{region: region, service: service}
+	if registered, ok := sigV4Hosts[host]; ok && registered != scope {
+		return fmt.Errorf("requests to %s are already signed for %s in %s", host, registered.service, registered.region)
+	}
+	sigV4Hosts[host] = scope
+
+	return nil
+}
+
+func isSigV4Host(host string) bool {
+	sigV4Mu.Lock()
+	defer sigV4Mu.Unlock()
+	_, ok := sigV4Hosts[host]
+
+	return ok
+}
+
+// NewTransport returns a Transport sending requests through next
+func NewTransport(next http.RoundTripper) *Transport {
+	return &Transport{Next: next}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	sigV4Mu.Lock()
+	scope, signV4 := sigV4Hosts[host]
+	sigV4Mu.Unlock()
+	credentialsMu.Lock()
+	credentials, authenticate := credentialsHosts[host]
+	credentialsMu.Unlock()
+	switch {
+	case authenticate:
+		authorized, err := authorize(req, credentials)
+		if err != nil {
+			return nil, err
+		}
+		req = authorized
+	case signV4:
+		signed, err := signSigV4(req, scope)
+		if err != nil {
+			return nil, err
+		}
+		req = signed
+	case strings.HasSuffix(host, azureBlobHostSuffix):
+		signed, err := signAzure(req, strings.TrimSuffix(host, azureBlobHostSuffix))
+		if err != nil {
+			return nil, err
+		}
+		req = signed
+	case strings.HasSuffix(host, ossHostSuffix) && strings.Contains(host, "oss-"):
+		signed, err := signOSS(req, host)
+		if err != nil {
+			return nil, err
+		}
+		req = signed
+	}
+
+	return t.Next.RoundTrip(req)
+}
+
+// Signs a copy of req with AWS Signature Version 4 for scope
+func signSigV4(req *http.Request, scope sigV4Scope) (*http.Request, error) {
+	credentials, err := ResolveAWSCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request to %s: %w", req.URL.Host, err)
+	}
+	signed := req.Clone(req.Context())
+	var payload []byte
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	logrus.Debugf("Signing request to %s with AWS SigV4 for %s in %s\n", req.URL.Host, scope.service, scope.region)
+	SignV4(signed, payload, scope.region, scope.service, credentials, time.Now())
+
+	return signed, nil
+}
+
+// Authenticates req with a SAS token or, failing that, a Shared Key.
+// Only requests to the account named by AzureAccountEnvVariable are
+// authenticated, as any chart or icon URL may point at another account.
+func signAzure(req *http.Request, account string) (*http.Request, error) {
+	if !strings.EqualFold(os.Getenv(AzureAccountEnvVariable), account) {
+		return req, nil
+	}
+	if sasToken := os.Getenv(AzureSASEnvVariable); sasToken != "" {
+		if req.URL.Query().Has("sig") {
+			return req, nil
+		}
+		signed := req.Clone(req.Context())
+		sasToken = strings.TrimPrefix(sasToken, "?")
+		if signed.URL.RawQuery != "" {
+			signed.URL.RawQuery += "&" + sasToken
+		} else {
+			signed.URL.RawQuery = sasToken
+		}
+		logrus.Debugf("Authenticating request to %s with SAS token\n", req.URL.Host)
+		return signed, nil
+	}
+
+	key := os.Getenv(AzureKeyEnvVariable)
+	if key == "" {
+		return req, nil
+	}
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", AzureKeyEnvVariable, err)
+	}
+
+	signed := req.Clone(req.Context())
+	signed.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	signed.Header.Set("x-ms-version", azureAPIVersion)
+
+	stringToSign := strings.Join([]string{
+		signed.Method,
+		signed.Header.Get("Content-Encoding"),
+		signed.Header.Get("Content-Language"),
+		"", // Content-Length, empty for requests without a body
+		signed.Header.Get("Content-MD5"),
+		signed.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		signed.Header.Get("If-Modified-Since"),
+		signed.Header.Get("If-Match"),
+		signed.Header.Get("If-None-Match"),
+		signed.Header.Get("If-Unmodified-Since"),
+		signed.Header.Get("Range"),
+	}, "\n") + "\n" + canonicalHeaders(signed.Header, "x-ms-") + azureCanonicalResource(account, signed.URL)
+
+	mac := hmac.New(sha256.New, decodedKey)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	signed.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, signature))
+	logrus.Debugf("Authenticating request to %s with Shared Key\n", req.URL.Host)
+
+	return signed, nil
+}
+
+func azureCanonicalResource(account string, u *url.URL) string {
+	resource := "/" + account + u.EscapedPath()
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += fmt.Sprintf("\n%s:%s", name, strings.Join(values, ","))
+	}
+
+	return resource
+}
+
+// Returns the bucket of an OSS request, named in the host of virtual
+// hosted style requests and in the first path segment of path style
+// requests
+func ossBucket(host string, u *url.URL) string {
+	if !strings.HasPrefix(host, "oss-") {
+		return strings.SplitN(host, ".", 2)[0]
+	}
+
+	return strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]
+}
+
+// Authenticates req with an OSS V1 signature
+func signOSS(req *http.Request, host string) (*http.Request, error) {
+	accessKeyId := firstEnv(ossAccessKeyIdEnvVariables)
+	accessKeySecret := firstEnv(ossAccessKeySecretEnvVariables)
+	if accessKeyId == "" || accessKeySecret == "" {
+		return req, nil
+	}
+	// only the configured bucket is signed for, as any chart or icon
+	// URL may point at another bucket
+	if bucket := ossBucket(host, req.URL); bucket == "" || bucket != os.Getenv(OSSBucketEnvVariable) {
+		return req, nil
+	}
+
+	signed := req.Clone(req.Context())
+	date := time.Now().UTC().Format(http.TimeFormat)
+	signed.Header.Set("Date", date)
+	if sessionToken := firstEnv(ossSessionTokenEnvVariables); sessionToken != "" {
+		signed.Header.Set("x-oss-security-token", sessionToken)
+	}
+
+	// virtual-hosted style requests name the bucket in the host, path
+	// style requests in the first path segment
+	resource := signed.URL.EscapedPath()
+	if !strings.HasPrefix(host, "oss-") {
+		resource = "/" + strings.SplitN(host, ".", 2)[0] + resource
+	}
+
+	stringToSign := strings.Join([]string{
+		signed.Method,
+		signed.Header.Get("Content-MD5"),
+		signed.Header.Get("Content-Type"),
+		date,
+	}, "\n") + "\n" + canonicalHeaders(signed.Header, "x-oss-") + resource
+
+	mac := hmac.New(sha1.New, []byte(accessKeySecret))
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	signed.Header.Set("Authorization", fmt.Sprintf("OSS %s:%s", accessKeyId, signature))
+	logrus.Debugf("Authenticating request to %s with OSS signature\n", req.URL.Host)
+
+	return signed, nil
+}
+
+// Returns the headers starting with prefix as sorted, lower case
+// "name:value\n" lines
+func canonicalHeaders(header http.Header, prefix string) string {
+	names := make([]string, 0)
+	for name := range header {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	canonical := ""
+	for _, name := range names {
+		canonical += fmt.Sprintf("%s:%s\n", strings.ToLower(name), strings.TrimSpace(strings.Join(header.Values(name), ",")))
+	}
+
+	return canonical
+}
+
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,224 @@
+package objectstorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	amzDateLayout  = "20060102T150405Z"
+)
+
+// Environment variables checked for the AWS region, in order of
+// preference
+var awsRegionEnvVariables = []string{"AWS_REGION", "AWS_DEFAULT_REGION"}
+
+// AWSCredentials sign requests with AWS Signature Version 4
+type AWSCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// The credentials provider of the default credential chain, loaded once
+// and shared by all requests, so that assumed roles and SSO sessions are
+// refreshed only when they expire
+var awsCredentials struct {
+	once     sync.Once
+	provider aws.CredentialsProvider
+	err      error
+}
+
+// ResolveAWSCredentials returns the AWS credentials of the default
+// credential chain of the AWS SDK: the environment variables, the
+// AWS_PROFILE profile of the shared configuration and credentials files
+// (including its assumed role, web identity, SSO and credential_process
+// settings), web identity tokens such as those of GitHub Actions OIDC
+// and EKS service accounts, and the ECS task or EC2 instance role
+func ResolveAWSCredentials() (AWSCredentials, error) {
+	awsCredentials.once.Do(func() {
+		awsCredentials.provider, awsCredentials.err = loadAWSCredentialsProvider(context.Background())
+	})
+	if awsCredentials.err != nil {
+		return AWSCredentials{}, awsCredentials.err
+	}
+
+	return retrieveAWSCredentials(context.Background(), awsCredentials.provider)
+}
+
+// Loads the credentials provider of the default credential chain from
+// the current environment
+func loadAWSCredentialsProvider(ctx context.Context) (aws.CredentialsProvider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	return cfg.Credentials, nil
+}
+
+func retrieveAWSCredentials(ctx context.Context, provider aws.CredentialsProvider) (AWSCredentials, error) {
+	if provider == nil {
+		return AWSCredentials{}, errors.New("no AWS credentials: no credential provider is configured")
+	}
+	credentials, err := provider.Retrieve(ctx)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("no AWS credentials: %w", err)
+	}
+
+	return AWSCredentials{
+		AccessKeyId:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+	}, nil
+}
+
+// AWSRegionFromEnv returns the AWS region set in the standard
+// environment variables of the AWS SDKs
+func AWSRegionFromEnv() string {
+	return firstEnv(awsRegionEnvVariables)
+}
+
+// SignV4 signs req, whose body is payload, for service in region with
+// AWS Signature Version 4. Requests to S3 also carry the payload hash
+// in the X-Amz-Content-Sha256 header, as S3 requires, and have their
+// path escaped like the canonical URI they are signed with.
+func SignV4(req *http.Request, payload []byte, region, service string, credentials AWSCredentials, now time.Time) {
+	if service == "s3" && req.URL.Opaque == "" {
+		req.URL.RawPath = escapeURI(req.URL.Path, false)
+	}
+	amzDate := now.UTC().Format(amzDateLayout)
+	date := amzDate[:8]
+	payloadDigest := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(payloadDigest[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL, service),
+		canonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalDigest := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(canonicalDigest[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, credentials.AccessKeyId, scope, signedHeaders, signature))
+}
+
+// Returns the canonical URI of u. S3 signs the path once URI-encoded,
+// as it is sent; every other service signs it URI-encoded twice, that
+// is the path as sent URI-encoded again.
+func canonicalURI(u *url.URL, service string) string {
+	uri := u.EscapedPath()
+	if u.Opaque != "" {
+		// the path as sent, without the //host prefix of absolute
+		// opaque URLs
+		uri = u.Opaque
+		if strings.HasPrefix(uri, "//") {
+			if i := strings.Index(uri[2:], "/"); i >= 0 {
+				uri = uri[2+i:]
+			} else {
+				uri = ""
+			}
+		}
+	}
+	if uri == "" {
+		return "/"
+	}
+	if service == "s3" {
+		return uri
+	}
+
+	return escapeURI(uri, false)
+}
+
+// Returns the canonical query string of u: its parameters URI-encoded
+// and sorted by name, then value
+func canonicalQuery(u *url.URL) string {
+	parameters := make([]string, 0)
+	for name, values := range u.Query() {
+		for _, value := range values {
+			parameters = append(parameters, escapeURI(name, true)+"="+escapeURI(value, true))
+		}
+	}
+	sort.Strings(parameters)
+
+	return strings.Join(parameters, "&")
+}
+
+// URI-encodes every byte of s but the unreserved characters of RFC
+// 3986, and also slashes unless encodeSlash
+func escapeURI(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Formats of the --output and --format flags
+const (
+	// FormatTable is the human readable output of each command
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// Validate returns an error if format is not one of the known formats
+func Validate(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML:
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format %q: must be %s, %s or %s", format, FormatTable, FormatJSON, FormatYAML)
+}
+
+// Print writes v to stdout as JSON or YAML, or calls table to print the
+// human readable output of FormatTable
+func Print(format string, v interface{}, table func()) error {
+	var data []byte
+	var err error
+	switch format {
+	case FormatTable:
+		table()
+		return nil
+	case FormatJSON:
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	case FormatYAML:
+		data, err = yaml.Marshal(v)
+	default:
+		return Validate(format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err = os.Stdout.Write(data)
+
+	return err
+}
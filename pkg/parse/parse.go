@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/rancher/partner-charts-ci/pkg/interpolate"
 	"github.com/sirupsen/logrus"
 
 	"helm.sh/helm/v3/pkg/chart"
@@ -29,26 +30,51 @@ type PackageYaml struct {
 }
 
 type UpstreamYaml struct {
-	AHPackageName      string         `json:"ArtifactHubPackage"`
-	AHRepoName         string         `json:"ArtifactHubRepo"`
-	AutoInstall        string         `json:"AutoInstall"`
-	ChartYaml          chart.Metadata `json:"ChartMetadata"`
-	DisplayName        string         `json:"DisplayName"`
-	Experimental       bool           `json:"Experimental"`
-	Fetch              string         `json:"Fetch"`
-	GitBranch          string         `json:"GitBranch"`
-	GitHubRelease      bool           `json:"GitHubRelease"`
-	GitRepoUrl         string         `json:"GitRepo"`
-	GitSubDirectory    string         `json:"GitSubdirectory"`
-	HelmChart          string         `json:"HelmChart"`
-	HelmRepoUrl        string         `json:"HelmRepo"`
-	Hidden             bool           `json:"Hidden"`
-	Namespace          string         `json:"Namespace"`
-	PackageVersion     int            `json:"PackageVersion"`
-	RemoteDependencies bool           `json:"RemoteDependencies"`
-	TrackVersions      []string       `json:"TrackVersions"`
-	ReleaseName        string         `json:"ReleaseName"`
-	Vendor             string         `json:"Vendor"`
+	AHPackageName                string            `json:"ArtifactHubPackage"`
+	AHRepoName                   string            `json:"ArtifactHubRepo"`
+	AllowLibrary                 bool              `json:"AllowLibrary"`
+	Aliases                      []string          `json:"Aliases"`
+	Annotations                  map[string]string `json:"Annotations"`
+	Auth                         string            `json:"Auth"`
+	AuthSecretEnv                string            `json:"AuthSecretEnv"`
+	AuthUsernameEnv              string            `json:"AuthUsernameEnv"`
+	AutoInstall                  string            `json:"AutoInstall"`
+	AWSRegion                    string            `json:"AWSRegion"`
+	AWSService                   string            `json:"AWSService"`
+	ChartMuseum                  bool              `json:"ChartMuseum"`
+	ChartYaml                    chart.Metadata    `json:"ChartMetadata"`
+	CreateNamespace              bool              `json:"CreateNamespace"`
+	DescriptionOverride          string            `json:"DescriptionOverride"`
+	DisableIconOverride          bool              `json:"DisableIconOverride"`
+	DisableKubeVersionAnnotation bool              `json:"DisableKubeVersionAnnotation"`
+	DisplayName                  string            `json:"DisplayName"`
+	EOL                          map[string]string `json:"EOL"`
+	EULARequired                 bool              `json:"EULARequired"`
+	EULAUrl                      string            `json:"EULAURL"`
+	ExcludeVersions              []string          `json:"ExcludeVersions"`
+	Experimental                 bool              `json:"Experimental"`
+	Fetch                        string            `json:"Fetch"`
+	GitBranch                    string            `json:"GitBranch"`
+	GitHubRelease                bool              `json:"GitHubRelease"`
+	GitRepoUrl                   string            `json:"GitRepo"`
+	GitSubDirectory              string            `json:"GitSubdirectory"`
+	HelmChart                    string            `json:"HelmChart"`
+	HelmRepoIndex                string            `json:"HelmRepoIndex"`
+	HelmRepoMirrors              []string          `json:"HelmRepoMirrors"`
+	HelmRepoUrl                  string            `json:"HelmRepo"`
+	Hidden                       bool              `json:"Hidden"`
+	Keywords                     []string          `json:"Keywords"`
+	LocalPath                    string            `json:"Path"`
+	Manifest                     string            `json:"Manifest"`
+	Namespace                    string            `json:"Namespace"`
+	NormalizeAPIVersion          bool              `json:"NormalizeAPIVersion"`
+	PackageVersion               int               `json:"PackageVersion"`
+	RemoteDependencies           bool              `json:"RemoteDependencies"`
+	SplitCRDs                    bool              `json:"SplitCRDs"`
+	TrackVersions                []string          `json:"TrackVersions"`
+	VersionConstraint            string            `json:"VersionConstraint"`
+	ReleaseName                  string            `json:"ReleaseName"`
+	Vendor                       string            `json:"Vendor"`
 }
 
 func (packageYaml PackageYaml) Write(overWrite bool) error {
@@ -98,7 +124,18 @@ func ListPackages(packageDirectory string, currentPackage string) (map[string]st
 	}
 
 	if _, err := os.Stat(searchDirectory); os.IsNotExist(err) {
-		return packageList, err
+		if currentPackage == "" {
+			return packageList, err
+		}
+		aliasedPackage, aliasErr := ResolveAlias(packageDirectory, currentPackage)
+		if aliasErr != nil {
+			return packageList, aliasErr
+		}
+		if aliasedPackage == "" {
+			return packageList, err
+		}
+		logrus.Infof("%s is an alias of %s\n", currentPackage, aliasedPackage)
+		searchDirectory = filepath.Join(packageDirectory, aliasedPackage)
 	}
 
 	findPackage := func(filePath string, info os.FileInfo, err error) error {
@@ -119,6 +156,58 @@ func ListPackages(packageDirectory string, currentPackage string) (map[string]st
 	return packageList, filepath.Walk(searchDirectory, findPackage)
 }
 
+// ResolveAlias returns the name of the package that lists alias in the
+// Aliases of its upstream.yaml, or the empty string if no package does.
+// It is an error for more than one package to claim the same alias.
+func ResolveAlias(packageDirectory, alias string) (string, error) {
+	packages, err := ListPackages(packageDirectory, "")
+	if err != nil {
+		return "", err
+	}
+
+	resolved := ""
+	for packageName, packagePath := range packages {
+		upstreamYaml, err := ParseUpstreamYaml(packagePath)
+		if err != nil {
+			continue
+		}
+		for _, packageAlias := range upstreamYaml.Aliases {
+			if strings.Trim(packageAlias, "/") != strings.Trim(alias, "/") {
+				continue
+			}
+			if resolved != "" {
+				return "", fmt.Errorf("alias %s is claimed by both %s and %s", alias, resolved, packageName)
+			}
+			resolved = packageName
+		}
+	}
+
+	return resolved, nil
+}
+
+// The environment variables that upstream.yaml may reference, set by
+// ConfigureEnv
+var allowedEnvVariables []string
+
+// ConfigureEnv sets the environment variables that upstream.yaml may
+// reference. upstream.yaml is contributed by partners, so it may not
+// read any other variable, such as the secrets of the CI job.
+func ConfigureEnv(names []string) {
+	allowedEnvVariables = names
+}
+
+// EnvAllowed returns whether upstream.yaml may reference the
+// environment variable name
+func EnvAllowed(name string) bool {
+	for _, allowed := range allowedEnvVariables {
+		if allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func ParseUpstreamYaml(packagePath string) (UpstreamYaml, error) {
 	upstreamYamlPath := filepath.Join(packagePath, UpstreamOptionsFile)
 	logrus.Debugf("Attempting to parse %s", upstreamYamlPath)
@@ -126,9 +215,71 @@ func ParseUpstreamYaml(packagePath string) (UpstreamYaml, error) {
 	upstreamYaml := UpstreamYaml{}
 	if err != nil {
 		logrus.Debug(err)
-	} else {
-		err = yaml.Unmarshal(upstreamYamlFile, &upstreamYaml)
+		return upstreamYaml, err
+	}
+	upstreamYamlFile, err = interpolate.AllowedEnv(upstreamYamlFile, allowedEnvVariables)
+	if err != nil {
+		return upstreamYaml, fmt.Errorf("failed to interpolate %s: %w", upstreamYamlPath, err)
 	}
+	err = yaml.Unmarshal(upstreamYamlFile, &upstreamYaml)
 
 	return upstreamYaml, err
 }
+
+// SetUpstreamYamlField sets the top-level field of the upstream.yaml in
+// packagePath to value, a YAML scalar, replacing the line that sets it
+// or appending one. The rest of the file, including comments, is kept.
+func SetUpstreamYamlField(packagePath, field, value string) error {
+	upstreamYamlPath := filepath.Join(packagePath, UpstreamOptionsFile)
+	data, err := os.ReadFile(upstreamYamlPath)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, field+":") {
+			lines[i] = fmt.Sprintf("%s: %s", field, value)
+			found = true
+			break
+		}
+	}
+	if !found {
+		lines = append(lines, fmt.Sprintf("%s: %s", field, value))
+	}
+
+	return os.WriteFile(upstreamYamlPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// ChartName returns the name of the charts stored for the package at
+// packagePath, without contacting its upstream: ChartMetadata.name,
+// HelmChart, ArtifactHubPackage or the package directory name, in that
+// order
+func (upstreamYaml UpstreamYaml) ChartName(packagePath string) string {
+	switch {
+	case upstreamYaml.ChartYaml.Name != "":
+		return upstreamYaml.ChartYaml.Name
+	case upstreamYaml.HelmChart != "":
+		return upstreamYaml.HelmChart
+	case upstreamYaml.AHPackageName != "":
+		return upstreamYaml.AHPackageName
+	}
+
+	return filepath.Base(packagePath)
+}
+
+// ChartMetadata returns the Chart.yaml overlay of the package: its
+// ChartMetadata, with the description replaced by DescriptionOverride
+// and Keywords added to its keywords
+func (upstreamYaml UpstreamYaml) ChartMetadata() chart.Metadata {
+	overlay := upstreamYaml.ChartYaml
+	if upstreamYaml.DescriptionOverride != "" {
+		overlay.Description = upstreamYaml.DescriptionOverride
+	}
+	if len(upstreamYaml.Keywords) > 0 {
+		overlay.Keywords = append(append([]string{}, overlay.Keywords...), upstreamYaml.Keywords...)
+	}
+
+	return overlay
+}
@@ -0,0 +1,66 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/yaml"
+)
+
+const VendorOptionsFile = "vendor.yaml"
+
+// VendorYaml holds contact and ownership metadata shared by all
+// packages of a vendor, read from packages/<vendor>/vendor.yaml
+type VendorYaml struct {
+	Contacts []VendorContact `json:"Contacts"`
+	// EULARequired requires every package of the vendor to declare
+	// the EULA that must be accepted to install its charts
+	EULARequired  bool     `json:"EULARequired"`
+	GitHubHandles []string `json:"GitHubHandles"`
+	SupportUrl    string   `json:"SupportURL"`
+}
+
+type VendorContact struct {
+	Name  string `json:"Name"`
+	Email string `json:"Email"`
+}
+
+// ParseVendorYaml reads the vendor.yaml in vendorPath. A missing file
+// yields an error satisfying os.IsNotExist.
+func ParseVendorYaml(vendorPath string) (VendorYaml, error) {
+	vendorYamlPath := filepath.Join(vendorPath, VendorOptionsFile)
+	logrus.Debugf("Attempting to parse %s", vendorYamlPath)
+	vendorYamlFile, err := os.ReadFile(vendorYamlPath)
+	vendorYaml := VendorYaml{}
+	if err != nil {
+		return vendorYaml, err
+	}
+	err = yaml.Unmarshal(vendorYamlFile, &vendorYaml)
+
+	return vendorYaml, err
+}
+
+// ListVendors returns the sorted names of the vendor directories in
+// packageDirectory that have a vendor.yaml
+func ListVendors(packageDirectory string) ([]string, error) {
+	entries, err := os.ReadDir(packageDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	vendors := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(packageDirectory, entry.Name(), VendorOptionsFile)); err == nil {
+			vendors = append(vendors, entry.Name())
+		}
+	}
+	sort.Strings(vendors)
+
+	return vendors, nil
+}
@@ -0,0 +1,175 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reporter receives progress events from long-running commands
+type Reporter interface {
+	// Start begins tracking total items
+	Start(total int)
+	// Phase records that item has entered a new phase of processing
+	Phase(item, phase string)
+	// Done records that item is finished. A non-nil err marks it failed.
+	Done(item string, err error)
+	// Finish ends tracking and prints a summary
+	Finish()
+}
+
+// New returns a live terminal display when running interactively, and
+// a Reporter that writes plain log lines otherwise (for example in CI)
+func New(task string) Reporter {
+	if isInteractive(os.Stderr) {
+		return &liveReporter{task: task, out: os.Stderr}
+	}
+
+	return &logReporter{task: task}
+}
+
+// Discard is a Reporter that ignores all events
+type Discard struct{}
+
+func (Discard) Start(int)            {}
+func (Discard) Phase(string, string) {}
+func (Discard) Done(string, error)   {}
+func (Discard) Finish()              {}
+
+func isInteractive(f *os.File) bool {
+	if os.Getenv("CI") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+type counts struct {
+	mu      sync.Mutex
+	started time.Time
+	total   int
+	done    int
+	failed  int
+}
+
+func (c *counts) start(total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = time.Now()
+	c.total = total
+	c.done = 0
+	c.failed = 0
+}
+
+func (c *counts) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done++
+	if err != nil {
+		c.failed++
+	}
+}
+
+// eta estimates the time remaining from the average time per item so far
+func (c *counts) eta() time.Duration {
+	if c.done == 0 || c.done >= c.total {
+		return 0
+	}
+	perItem := time.Since(c.started) / time.Duration(c.done)
+
+	return (perItem * time.Duration(c.total-c.done)).Round(time.Second)
+}
+
+func (c *counts) String() string {
+	remaining := c.total - c.done
+	if remaining < 0 {
+		remaining = 0
+	}
+	summary := fmt.Sprintf("%d/%d done, %d failed, %d remaining", c.done, c.total, c.failed, remaining)
+	if eta := c.eta(); eta > 0 {
+		summary += fmt.Sprintf(", ETA %s", eta)
+	}
+
+	return summary
+}
+
+type logReporter struct {
+	counts
+	task string
+}
+
+func (r *logReporter) Start(total int) {
+	r.start(total)
+	logrus.Infof("%s: starting %d items", r.task, total)
+}
+
+func (r *logReporter) Phase(item, phase string) {
+	logrus.Debugf("%s: %s: %s", r.task, item, phase)
+}
+
+func (r *logReporter) Done(item string, err error) {
+	r.finish(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		logrus.Infof("%s: %s failed [%s]", r.task, item, &r.counts)
+	} else {
+		logrus.Infof("%s: %s done [%s]", r.task, item, &r.counts)
+	}
+}
+
+func (r *logReporter) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	logrus.Infof("%s: finished in %s [%s]", r.task, time.Since(r.started).Round(time.Second), &r.counts)
+}
+
+type liveReporter struct {
+	counts
+	task  string
+	out   io.Writer
+	item  string
+	phase string
+}
+
+func (r *liveReporter) Start(total int) {
+	r.start(total)
+	r.render()
+}
+
+func (r *liveReporter) Phase(item, phase string) {
+	r.mu.Lock()
+	r.item = item
+	r.phase = phase
+	r.mu.Unlock()
+	r.render()
+}
+
+func (r *liveReporter) Done(item string, err error) {
+	r.finish(err)
+	r.render()
+}
+
+func (r *liveReporter) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "\r\033[K%s: finished in %s [%s]\n", r.task, time.Since(r.started).Round(time.Second), &r.counts)
+}
+
+func (r *liveReporter) render() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line := fmt.Sprintf("%s [%s]", r.task, &r.counts)
+	if r.item != "" {
+		line += fmt.Sprintf(" %s: %s", r.item, r.phase)
+	}
+	fmt.Fprintf(r.out, "\r\033[K%s", line)
+}
@@ -0,0 +1,61 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrDeclined is returned when the user does not confirm
+	ErrDeclined = errors.New("aborted")
+	// ErrNotInteractive is returned when confirmation is needed but
+	// stdin is not a terminal
+	ErrNotInteractive = errors.New("confirmation required; run interactively or pass --assume-yes")
+)
+
+// Confirm prints action followed by the planned changes and asks for
+// confirmation on stdin. It returns nil without asking if assumeYes is
+// set, ErrNotInteractive if stdin is not a terminal, and ErrDeclined
+// unless the answer is yes.
+func Confirm(action string, changes []string, assumeYes bool) error {
+	if assumeYes {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return ErrNotInteractive
+	}
+
+	return confirm(os.Stdin, os.Stderr, action, changes)
+}
+
+func confirm(in io.Reader, out io.Writer, action string, changes []string) error {
+	fmt.Fprintf(out, "%s:\n", action)
+	for _, change := range changes {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+	fmt.Fprint(out, "Continue? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return ErrDeclined
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,135 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/sirupsen/logrus"
+)
+
+// TokenEnvVariable sets the environment variable to check for a GitHub token
+const TokenEnvVariable = "GITHUB_TOKEN"
+
+// Options configures the pull requests opened for package updates
+type Options struct {
+	Repository string
+	Base       string
+	Labels     []string
+	Reviewers  []string
+	Vendors    map[string]VendorOptions
+}
+
+// VendorOptions adds labels and reviewers to the pull requests of a
+// single vendor
+type VendorOptions struct {
+	Labels    []string
+	Reviewers []string
+}
+
+type tokenTransport struct {
+	token string
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Token returns the GitHub token from the environment
+func Token() (string, error) {
+	token := os.Getenv(TokenEnvVariable)
+	if token == "" {
+		return "", fmt.Errorf("%s must be set", TokenEnvVariable)
+	}
+
+	return token, nil
+}
+
+// NewClient returns a GitHub client authenticated with the token from
+// the environment
+func NewClient() (*github.Client, error) {
+	token, err := Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return github.NewClient(&http.Client{Transport: tokenTransport{token: token}}), nil
+}
+
+// SplitRepository splits a repository in the form <owner>/<repo>
+func SplitRepository(repository string) (string, string, error) {
+	owner, repoName, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repoName == "" {
+		return "", "", fmt.Errorf("repository %q is not in the form <owner>/<repo>", repository)
+	}
+
+	return owner, repoName, nil
+}
+
+// Open opens a pull request from head into the configured base branch,
+// with the labels and reviewers configured for vendor. If a pull request
+// from head is already open, it is updated instead.
+func Open(options Options, vendor, head, title, body string) (*github.PullRequest, error) {
+	owner, repoName, err := SplitRepository(options.Repository)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	existing, _, err := client.PullRequests.List(ctx, owner, repoName, &github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", owner, head),
+		Base:  options.Base,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	var pullRequest *github.PullRequest
+	if len(existing) > 0 {
+		logrus.Infof("Updating pull request #%d\n", existing[0].GetNumber())
+		pullRequest, _, err = client.PullRequests.Edit(ctx, owner, repoName, existing[0].GetNumber(), &github.PullRequest{
+			Title: github.String(title),
+			Body:  github.String(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update pull request: %w", err)
+		}
+	} else {
+		pullRequest, _, err = client.PullRequests.Create(ctx, owner, repoName, &github.NewPullRequest{
+			Title: github.String(title),
+			Head:  github.String(head),
+			Base:  github.String(options.Base),
+			Body:  github.String(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pull request: %w", err)
+		}
+		logrus.Infof("Opened pull request #%d\n", pullRequest.GetNumber())
+	}
+
+	labels := append(append([]string{}, options.Labels...), options.Vendors[vendor].Labels...)
+	if len(labels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repoName, pullRequest.GetNumber(), labels); err != nil {
+			return pullRequest, fmt.Errorf("failed to label pull request: %w", err)
+		}
+	}
+
+	reviewers := append(append([]string{}, options.Reviewers...), options.Vendors[vendor].Reviewers...)
+	if len(reviewers) > 0 {
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repoName, pullRequest.GetNumber(), github.ReviewersRequest{Reviewers: reviewers}); err != nil {
+			return pullRequest, fmt.Errorf("failed to request reviewers: %w", err)
+		}
+	}
+
+	return pullRequest, nil
+}
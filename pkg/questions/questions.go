@@ -0,0 +1,192 @@
+package questions
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	//QuestionsFile sets the filename Rancher reads chart questions from
+	QuestionsFile = "questions.yaml"
+	//defaultGroup sets the group of top-level values
+	defaultGroup = "General"
+)
+
+// Question is a single entry of questions.yaml
+type Question struct {
+	Variable    string   `yaml:"variable"`
+	Default     string   `yaml:"default"`
+	Description string   `yaml:"description,omitempty"`
+	Label       string   `yaml:"label"`
+	Type        string   `yaml:"type"`
+	Options     []string `yaml:"options,omitempty"`
+	Group       string   `yaml:"group,omitempty"`
+}
+
+// Questions is the structure of questions.yaml
+type Questions struct {
+	Questions []Question `yaml:"questions"`
+}
+
+var (
+	// matches comments listing allowed values, for example
+	// "Options: a, b, c", "one of: a|b|c" or "Possible values are a, b"
+	optionsPattern  = regexp.MustCompile(`(?i)(?:options|one of|possible values|allowed values|valid values|values)(?: are)?\s*:?\s+(.+)$`)
+	optionSeparator = regexp.MustCompile(`[,|/]|\sor\s`)
+	secretPattern   = regexp.MustCompile(`(?i)(password|secret|token|apikey|api_key|credential)`)
+	// helm-docs style comment prefixes
+	commentPrefix = regexp.MustCompile(`^#+\s*(?:--\s*)?`)
+)
+
+// Generate returns a starter questions.yaml for a chart with the given
+// values.yaml. Every scalar value becomes a question, grouped by its
+// top-level key or in "General" if it is top-level itself, with its type taken from the value and its
+// description and enum options from the comment above it.
+func Generate(valuesYaml []byte) ([]byte, error) {
+	root := yaml.Node{}
+	if err := yaml.Unmarshal(valuesYaml, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+
+	questions := Questions{Questions: make([]Question, 0)}
+	if len(root.Content) > 0 && root.Content[0].Kind == yaml.MappingNode {
+		collect(root.Content[0], "", "", &questions.Questions)
+	}
+	if len(questions.Questions) == 0 {
+		return nil, fmt.Errorf("values.yaml has no scalar values")
+	}
+
+	var questionsYaml bytes.Buffer
+	encoder := yaml.NewEncoder(&questionsYaml)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(questions); err != nil {
+		return nil, err
+	}
+
+	return questionsYaml.Bytes(), encoder.Close()
+}
+
+func collect(mapping *yaml.Node, prefix, group string, questions *[]Question) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		variable := key.Value
+		if prefix != "" {
+			variable = prefix + "." + key.Value
+		}
+
+		switch value.Kind {
+		case yaml.MappingNode:
+			mappingGroup := group
+			if mappingGroup == "" {
+				mappingGroup = label(key.Value)
+			}
+			collect(value, variable, mappingGroup, questions)
+		case yaml.ScalarNode:
+			scalarGroup := group
+			if scalarGroup == "" {
+				scalarGroup = defaultGroup
+			}
+			*questions = append(*questions, newQuestion(variable, key, value, scalarGroup))
+		}
+	}
+}
+
+func newQuestion(variable string, key, value *yaml.Node, group string) Question {
+	description := comment(key.HeadComment)
+	question := Question{
+		Variable:    variable,
+		Default:     value.Value,
+		Description: description,
+		Label:       label(key.Value),
+		Group:       group,
+	}
+
+	switch value.Tag {
+	case "!!bool":
+		question.Type = "boolean"
+	case "!!int":
+		question.Type = "int"
+	case "!!null":
+		question.Type = "string"
+		question.Default = ""
+	default:
+		question.Type = "string"
+	}
+
+	if question.Type == "string" && secretPattern.MatchString(key.Value) {
+		question.Type = "password"
+	}
+
+	if options := parseOptions(description); len(options) > 1 {
+		question.Type = "enum"
+		question.Options = options
+	}
+
+	return question
+}
+
+// Joins the lines of a comment without their comment markers
+func comment(headComment string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(headComment, "\n") {
+		line = strings.TrimSpace(commentPrefix.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, " ")
+}
+
+func parseOptions(description string) []string {
+	match := optionsPattern.FindStringSubmatch(description)
+	if match == nil {
+		return nil
+	}
+
+	options := make([]string, 0)
+	for _, option := range optionSeparator.Split(match[1], -1) {
+		option = strings.Trim(strings.TrimSpace(option), "`'\".")
+		if option == "" || strings.Contains(option, " ") {
+			continue
+		}
+		options = append(options, option)
+	}
+
+	return options
+}
+
+// Turns a camelCase or snake_case key into a label, e.g. "Image Pull Policy"
+// for imagePullPolicy
+func label(key string) string {
+	words := make([]string, 0)
+	current := []rune{}
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.':
+			if len(current) > 0 {
+				words = append(words, string(current))
+			}
+			current = []rune{}
+			continue
+		case i > 0 && r >= 'A' && r <= 'Z' && runes[i-1] >= 'a' && runes[i-1] <= 'z':
+			words = append(words, string(current))
+			current = []rune{}
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/objectstorage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRequestsPerSecond = 10
+	defaultMaxConcurrency    = 4
+	//jitterFraction is the largest random delay added to the interval
+	//between requests to a host, as a fraction of that interval
+	jitterFraction = 0.25
+)
+
+// Limits caps the requests made to a single host
+type Limits struct {
+	// RequestsPerSecond is the sustained request rate. Negative values
+	// disable rate limiting.
+	RequestsPerSecond float64
+	// MaxConcurrency is the number of requests in flight at once.
+	// Negative values disable the cap.
+	MaxConcurrency int
+}
+
+// Options configures the limits applied to upstream hosts. Limits
+// apply to every host; Hosts overrides them for specific hostnames.
+type Options struct {
+	Limits
+	Hosts map[string]Limits
+}
+
+var (
+	mu      sync.Mutex
+	options = Options{}
+	hosts   = make(map[string]*hostLimiter)
+	client  = &http.Client{Transport: &transport{next: objectstorage.NewTransport(http.DefaultTransport)}}
+	//downloaded counts the response body bytes read through Client
+	downloaded atomic.Int64
+)
+
+// Configure replaces the limits used by Client. Zero values use the
+// defaults of 10 requests per second and 4 concurrent requests.
+func Configure(newOptions Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	options = newOptions
+	hosts = make(map[string]*hostLimiter)
+}
+
+// Client returns the HTTP client that all upstream requests should be
+// made through. Requests to object storage hosted repositories are
+// authenticated by objectstorage.Transport.
+func Client() *http.Client {
+	return client
+}
+
+// Downloaded returns the number of response body bytes read through
+// Client during this run
+func Downloaded() int64 {
+	return downloaded.Load()
+}
+
+type hostLimiter struct {
+	interval time.Duration
+	slots    chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func limiterFor(host string) *hostLimiter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if limiter, ok := hosts[host]; ok {
+		return limiter
+	}
+
+	limits := options.Limits
+	if hostLimits, ok := options.Hosts[host]; ok {
+		limits = hostLimits
+	}
+	if limits.RequestsPerSecond == 0 {
+		limits.RequestsPerSecond = defaultRequestsPerSecond
+	}
+	if limits.MaxConcurrency == 0 {
+		limits.MaxConcurrency = defaultMaxConcurrency
+	}
+
+	limiter := &hostLimiter{}
+	if limits.RequestsPerSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / limits.RequestsPerSecond)
+	}
+	if limits.MaxConcurrency > 0 {
+		limiter.slots = make(chan struct{}, limits.MaxConcurrency)
+	}
+	hosts[host] = limiter
+
+	return limiter
+}
+
+// Blocks until a request may be sent, returning the function that
+// releases its concurrency slot
+func (l *hostLimiter) acquire(host string) func() {
+	if l.slots != nil {
+		l.slots <- struct{}{}
+	}
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		jitter := time.Duration(rand.Int63n(int64(float64(l.interval)*jitterFraction) + 1))
+		l.next = start.Add(l.interval + jitter)
+		l.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			logrus.Debugf("Waiting %s before requesting %s\n", wait.Round(time.Millisecond), host)
+			time.Sleep(wait)
+		}
+	}
+
+	return func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	release := limiterFor(host).acquire(host)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+// releasingBody holds a concurrency slot until the response body is
+// read to the end or closed, so that a body that is read but never
+// closed does not hold its slot for the rest of the run
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	downloaded.Add(int64(n))
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,77 @@
+package rendercheck
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/lint"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+// namespace is the namespace charts are linted and rendered for
+const namespace = "default"
+
+// Check lints helmChart like helm lint and renders it with its default
+// values like helm template, returning an error listing the lint errors
+// and the rendering failure, if any. Lint warnings are not errors.
+func Check(helmChart *chart.Chart) error {
+	tempDir, err := os.MkdirTemp("", "render-check")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := chartutil.SaveDir(helmChart, tempDir); err != nil {
+		return fmt.Errorf("failed to save chart: %w", err)
+	}
+	chartPath := filepath.Join(tempDir, helmChart.Name())
+
+	var errs []error
+	linter := lint.All(chartPath, nil, namespace, false)
+	for _, message := range linter.Messages {
+		if message.Severity >= support.ErrorSev {
+			errs = append(errs, fmt.Errorf("helm lint: %s", message))
+		}
+	}
+
+	// the saved chart is rendered, as processing dependencies modifies
+	// the chart
+	savedChart, err := loader.Load(chartPath)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if err := render(savedChart); err != nil {
+		errs = append(errs, fmt.Errorf("helm template: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Renders the templates of helmChart with its default values
+func render(helmChart *chart.Chart) error {
+	values, err := chartutil.CoalesceValues(helmChart, nil)
+	if err != nil {
+		return err
+	}
+	if err := chartutil.ProcessDependencies(helmChart, values); err != nil {
+		return fmt.Errorf("failed to process dependencies: %w", err)
+	}
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      "release-name",
+		Namespace: namespace,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(helmChart, values, releaseOptions, chartutil.DefaultCapabilities)
+	if err != nil {
+		return err
+	}
+	_, err = engine.Render(helmChart, renderValues)
+
+	return err
+}
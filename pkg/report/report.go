@@ -0,0 +1,84 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Statuses of a Package
+const (
+	// StatusUpdated is a package whose new versions were integrated
+	StatusUpdated = "updated"
+	// StatusUpToDate is a package with no new versions to fetch
+	StatusUpToDate = "up-to-date"
+	// StatusFailed is a package that could not be checked or integrated
+	StatusFailed = "failed"
+	// StatusDeferred is a package deferred to the next run by a resource
+	// cap
+	StatusDeferred = "deferred"
+)
+
+// Report is the machine-readable outcome of a run of auto or stage
+type Report struct {
+	Command         string    `json:"command"`
+	DryRun          bool      `json:"dryRun"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Packages        []Package `json:"packages"`
+}
+
+// Package is the outcome of a run for one package
+type Package struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Fetched are the upstream versions selected for integration,
+	// newest first
+	Fetched []string `json:"fetched"`
+	// Skipped are the new upstream versions that were not selected
+	Skipped []Skipped `json:"skipped"`
+	Error   string    `json:"error,omitempty"`
+	// CheckSeconds is the time spent checking the upstream for new
+	// versions, and IntegrationSeconds the time spent integrating them
+	CheckSeconds       float64 `json:"checkSeconds"`
+	IntegrationSeconds float64 `json:"integrationSeconds"`
+}
+
+// Skipped is an upstream version left out of a run
+type Skipped struct {
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+// Write writes r as indented JSON to the file at reportPath, with its
+// packages sorted by name
+func Write(reportPath string, r Report) error {
+	r.Packages = append([]Package(nil), r.Packages...)
+	sort.SliceStable(r.Packages, func(i, j int) bool {
+		return r.Packages[i].Name < r.Packages[j].Name
+	})
+	for i := range r.Packages {
+		if r.Packages[i].Fetched == nil {
+			r.Packages[i].Fetched = []string{}
+		}
+		if r.Packages[i].Skipped == nil {
+			r.Packages[i].Skipped = []Skipped{}
+		}
+	}
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportPath, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write update report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/internal/testutil"
+)
+
+// Returns the report of a fixed run, with its packages in an order
+// that is not sorted
+func testReport() Report {
+	return Report{
+		Command:         "auto",
+		Started:         time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		DurationSeconds: 42.5,
+		Packages: []Package{
+			{
+				Name:               "beta/tool",
+				Status:             StatusUpdated,
+				Fetched:            []string{"1.0.0"},
+				Skipped:            []Skipped{{Version: "1.1.0-rc.1", Reason: "pre-release"}},
+				CheckSeconds:       0.5,
+				IntegrationSeconds: 2,
+			},
+			{
+				Name:   "acme/widget",
+				Status: StatusUpToDate,
+			},
+			{
+				Name:   "gamma/broken",
+				Status: StatusFailed,
+				Error:  "GET https://charts.example.com/index.yaml returned status 500 <html>",
+			},
+			{
+				Name:   "acme/anvil",
+				Status: StatusDeferred,
+			},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	reportPath := filepath.Join(t.TempDir(), "update-report.json")
+	if err := Write(reportPath, testReport()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertGolden(t, "report.golden.json", data)
+
+	reversed := testReport()
+	for i, j := 0, len(reversed.Packages)-1; i < j; i, j = i+1, j-1 {
+		reversed.Packages[i], reversed.Packages[j] = reversed.Packages[j], reversed.Packages[i]
+	}
+	if err := Write(reportPath, reversed); err != nil {
+		t.Fatal(err)
+	}
+	reversedData, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reversedData, data) {
+		t.Errorf("report depends on the order of packages:\n%s", reversedData)
+	}
+}
@@ -0,0 +1,226 @@
+package sandbox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sandbox is a scratch view of a repository. The paths it copies are
+// real copies that can be modified freely; everything else links back
+// to the repository, and must only be read.
+type Sandbox struct {
+	// Root is the directory of the sandbox
+	Root string
+	// Origin is the directory of the repository
+	Origin string
+	copied []string
+}
+
+// Changes are the files added, removed and modified in a sandbox, by
+// slash separated path relative to its root
+type Changes struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// New creates a sandbox of the repository at origin, in which each of
+// the slash separated relative paths copied is a copy. Copied paths
+// that do not exist in origin can be created in the sandbox. Every
+// directory leading to a copied path is a real directory, and all
+// other files and directories are symbolic links to origin.
+func New(origin string, copied []string) (*Sandbox, error) {
+	root, err := os.MkdirTemp("", "sandbox")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sandbox{Root: root, Origin: origin}
+	cleaned := make([]string, 0, len(copied))
+	for _, copiedPath := range copied {
+		cleaned = append(cleaned, path.Clean(copiedPath))
+	}
+	sort.Strings(cleaned)
+	// paths under another copied path are already copied with it
+	for _, copiedPath := range cleaned {
+		if !s.isCopied(copiedPath) {
+			s.copied = append(s.copied, copiedPath)
+		}
+	}
+
+	if err := s.materialize("."); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Remove deletes the sandbox, leaving the repository untouched
+func (s *Sandbox) Remove() error {
+	return os.RemoveAll(s.Root)
+}
+
+// Changes compares the copied paths of the sandbox to the repository
+func (s *Sandbox) Changes() (Changes, error) {
+	changes := Changes{}
+	for _, copiedPath := range s.copied {
+		before, err := digests(filepath.Join(s.Origin, filepath.FromSlash(copiedPath)), copiedPath)
+		if err != nil {
+			return changes, err
+		}
+		after, err := digests(filepath.Join(s.Root, filepath.FromSlash(copiedPath)), copiedPath)
+		if err != nil {
+			return changes, err
+		}
+		for filePath, digest := range after {
+			if previous, ok := before[filePath]; !ok {
+				changes.Added = append(changes.Added, filePath)
+			} else if !bytes.Equal(previous, digest) {
+				changes.Modified = append(changes.Modified, filePath)
+			}
+		}
+		for filePath := range before {
+			if _, ok := after[filePath]; !ok {
+				changes.Removed = append(changes.Removed, filePath)
+			}
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Modified)
+
+	return changes, nil
+}
+
+// Creates the directory relativePath of the sandbox, with copies of
+// the entries that are copied, directories for those leading to copied
+// paths, and links to the others
+func (s *Sandbox) materialize(relativePath string) error {
+	dir := filepath.Join(s.Root, filepath.FromSlash(relativePath))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(filepath.Join(s.Origin, filepath.FromSlash(relativePath)))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryPath := path.Join(relativePath, entry.Name())
+		originPath := filepath.Join(s.Origin, filepath.FromSlash(entryPath))
+		sandboxPath := filepath.Join(s.Root, filepath.FromSlash(entryPath))
+		switch {
+		case s.isCopied(entryPath):
+			if err := copyPath(originPath, sandboxPath); err != nil {
+				return err
+			}
+		case s.leadsToCopied(entryPath) && entry.IsDir():
+			if err := s.materialize(entryPath); err != nil {
+				return err
+			}
+		default:
+			if err := os.Symlink(originPath, sandboxPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Sandbox) isCopied(relativePath string) bool {
+	for _, copiedPath := range s.copied {
+		if relativePath == copiedPath || strings.HasPrefix(relativePath, copiedPath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Sandbox) leadsToCopied(relativePath string) bool {
+	for _, copiedPath := range s.copied {
+		if strings.HasPrefix(copiedPath, relativePath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copies the file or directory at sourcePath to targetPath, keeping
+// symbolic links as they are
+func copyPath(sourcePath, targetPath string) error {
+	return filepath.WalkDir(sourcePath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourcePath, filePath)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(targetPath, relativePath)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(destPath, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			linkTarget, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkTarget, destPath)
+		default:
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(destPath, data, info.Mode().Perm())
+		}
+	})
+}
+
+// Returns the sha256 digest of each file under filePath, by its slash
+// separated path under relativePath. A missing filePath has no files.
+func digests(filePath, relativePath string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	err := filepath.WalkDir(filePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filePath, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		result[path.Join(relativePath, filepath.ToSlash(rel))] = hash.Sum(nil)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+
+	return result, err
+}
@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	//ScheduleFile sets the filename for the featured chart schedule
+	ScheduleFile = "featured-schedule.yaml"
+	//DateLayout sets the format of schedule dates
+	DateLayout = "2006-01-02"
+)
+
+// Entry features a package in a slot from Start until End, inclusive.
+// An empty End keeps the package featured indefinitely.
+type Entry struct {
+	Package string `json:"package"`
+	Slot    int    `json:"slot"`
+	Start   string `json:"start"`
+	End     string `json:"end,omitempty"`
+}
+
+// Schedule is the featured chart rotation read from ScheduleFile
+type Schedule []Entry
+
+// Load reads the schedule file at schedulePath
+func Load(schedulePath string) (Schedule, error) {
+	scheduleFile, err := os.ReadFile(schedulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := Schedule{}
+	if err := yaml.Unmarshal(scheduleFile, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", schedulePath, err)
+	}
+
+	return schedule, nil
+}
+
+// Active returns the packages featured on date, keyed by slot. Slots
+// must be between 1 and maxSlot, and no slot or package may be
+// scheduled twice on the same date.
+func (s Schedule) Active(date time.Time, maxSlot int) (map[int]string, error) {
+	day := date.UTC().Format(DateLayout)
+	active := make(map[int]string)
+	activePackages := make(map[string]int)
+
+	for _, entry := range s {
+		if entry.Package == "" {
+			return nil, fmt.Errorf("schedule entry starting %s has no package", entry.Start)
+		}
+		if entry.Slot < 1 || entry.Slot > maxSlot {
+			return nil, fmt.Errorf("%s: slot %d must be between 1 and %d", entry.Package, entry.Slot, maxSlot)
+		}
+		if _, err := time.Parse(DateLayout, entry.Start); err != nil {
+			return nil, fmt.Errorf("%s: invalid start date %q: %w", entry.Package, entry.Start, err)
+		}
+		if entry.End != "" {
+			if _, err := time.Parse(DateLayout, entry.End); err != nil {
+				return nil, fmt.Errorf("%s: invalid end date %q: %w", entry.Package, entry.End, err)
+			}
+		}
+
+		// dates in DateLayout compare chronologically as strings
+		if day < entry.Start || (entry.End != "" && day > entry.End) {
+			continue
+		}
+
+		if scheduled, ok := active[entry.Slot]; ok {
+			return nil, fmt.Errorf("slot %d is scheduled for both %s and %s on %s", entry.Slot, scheduled, entry.Package, day)
+		}
+		if slot, ok := activePackages[entry.Package]; ok {
+			return nil, fmt.Errorf("%s is scheduled for both slot %d and slot %d on %s", entry.Package, slot, entry.Slot, day)
+		}
+		active[entry.Slot] = entry.Package
+		activePackages[entry.Package] = entry.Slot
+	}
+
+	return active, nil
+}
+
+// Slots returns the slots of active in ascending order
+func Slots(active map[int]string) []int {
+	slots := make([]int, 0, len(active))
+	for slot := range active {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	return slots
+}
@@ -0,0 +1,285 @@
+package selection
+
+import (
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	// FetchLatest selects the latest upstream version, unless it is
+	// already stored
+	FetchLatest = "latest"
+	// FetchNewer selects every upstream version newer than the latest
+	// stored version
+	FetchNewer = "newer"
+	// FetchAll selects every upstream version that is not stored
+	FetchAll = "all"
+	// FetchRange selects every upstream version within the
+	// VersionConstraint of upstream.yaml that is not stored
+	FetchRange = "range"
+)
+
+// VersionSelector selects the upstream versions of a chart to fetch
+type VersionSelector interface {
+	// Name is the Fetch mode of upstream.yaml that selects this
+	// strategy
+	Name() string
+	// Select returns the versions of upstream to fetch, given the
+	// versions already stored. Both lists are sorted newest first.
+	Select(upstream, stored repo.ChartVersions) repo.ChartVersions
+}
+
+// Mode returns the normalized Fetch mode of upstream.yaml, which
+// defaults to latest
+func Mode(fetch string) string {
+	if fetch == "" {
+		return FetchLatest
+	}
+
+	return strings.ToLower(fetch)
+}
+
+// New returns the VersionSelector of the Fetch mode fetch. Empty modes
+// select the latest version, and unknown modes the newest version that
+// is not stored.
+func New(fetch string) VersionSelector {
+	switch mode := Mode(fetch); mode {
+	case FetchLatest:
+		return Latest{}
+	case FetchNewer:
+		return Newer{}
+	case FetchAll:
+		return All{}
+	case FetchRange:
+		return Range{}
+	default:
+		return FirstNotStored{Mode: mode}
+	}
+}
+
+// Latest selects the latest upstream version, unless it is already
+// stored
+type Latest struct{}
+
+func (Latest) Name() string {
+	return FetchLatest
+}
+
+func (Latest) Select(upstream, stored repo.ChartVersions) repo.ChartVersions {
+	selected := make(repo.ChartVersions, 0)
+	if len(upstream) == 0 {
+		return selected
+	}
+	if IsStored(upstream[0], stored) {
+		logrus.Debugf("Latest version already stored")
+		return selected
+	}
+
+	return append(selected, upstream[0])
+}
+
+// FirstNotStored selects the newest upstream version that is not
+// stored, even if newer versions are. It is the selection of unknown
+// Fetch modes.
+type FirstNotStored struct {
+	Mode string
+}
+
+func (s FirstNotStored) Name() string {
+	return s.Mode
+}
+
+func (FirstNotStored) Select(upstream, stored repo.ChartVersions) repo.ChartVersions {
+	selected := make(repo.ChartVersions, 0)
+	for _, version := range upstream {
+		if !IsStored(version, stored) {
+			return append(selected, version)
+		}
+	}
+
+	return selected
+}
+
+// Newer selects every upstream version that is newer than the latest
+// stored version, or every version if none is stored
+type Newer struct{}
+
+func (Newer) Name() string {
+	return FetchNewer
+}
+
+func (Newer) Select(upstream, stored repo.ChartVersions) repo.ChartVersions {
+	selected := make(repo.ChartVersions, 0)
+	var storedLatest *semver.Version
+	if len(stored) > 0 {
+		var err error
+		storedLatest, err = semver.NewVersion(conform.StripPackageVersion(stored[0].Version))
+		if err != nil {
+			logrus.Error(err)
+			return selected
+		}
+	}
+	for _, version := range upstream {
+		if IsStored(version, stored) {
+			continue
+		}
+		if storedLatest == nil {
+			selected = append(selected, version)
+			continue
+		}
+		semVer, err := semver.NewVersion(version.Version)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if semVer.GreaterThan(storedLatest) {
+			logrus.Debugf("Version: %s > %s\n", semVer.String(), stored[0].Version)
+			selected = append(selected, version)
+		}
+	}
+
+	return selected
+}
+
+// All selects every upstream version that is not stored
+type All struct{}
+
+func (All) Name() string {
+	return FetchAll
+}
+
+func (All) Select(upstream, stored repo.ChartVersions) repo.ChartVersions {
+	selected := make(repo.ChartVersions, 0)
+	for _, version := range upstream {
+		if !IsStored(version, stored) {
+			selected = append(selected, version)
+		}
+	}
+
+	return selected
+}
+
+// Range selects every upstream version that is not stored, like All.
+// The upstream versions are restricted to VersionConstraint before
+// selection, so only the versions within it are selected.
+type Range struct{}
+
+func (Range) Name() string {
+	return FetchRange
+}
+
+func (Range) Select(upstream, stored repo.ChartVersions) repo.ChartVersions {
+	return All{}.Select(upstream, stored)
+}
+
+// Constrain returns the versions that satisfy constraint, a semver
+// constraint such as ">=1.2.0 <2.0.0". Versions that are not semantic
+// versions are left out.
+func Constrain(versions repo.ChartVersions, constraint string) (repo.ChartVersions, error) {
+	constraints, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	constrained := make(repo.ChartVersions, 0, len(versions))
+	for _, version := range versions {
+		semVer, err := semver.NewVersion(version.Version)
+		if err != nil {
+			logrus.Errorf("%s: %s", version.Version, err)
+			continue
+		}
+		if constraints.Check(semVer) {
+			constrained = append(constrained, version)
+		}
+	}
+
+	return constrained, nil
+}
+
+// Exclude returns versions without those in excluded. Versions are
+// compared as semantic versions where possible, so that 1.2.0 also
+// excludes v1.2.0.
+func Exclude(versions repo.ChartVersions, excluded []string) repo.ChartVersions {
+	excludedVersions := make(map[string]struct{}, len(excluded))
+	for _, version := range excluded {
+		excludedVersions[normalize(version)] = struct{}{}
+	}
+	kept := make(repo.ChartVersions, 0, len(versions))
+	for _, version := range versions {
+		if _, ok := excludedVersions[normalize(version.Version)]; ok {
+			logrus.Debugf("Excluding version %s\n", version.Version)
+			continue
+		}
+		kept = append(kept, version)
+	}
+
+	return kept
+}
+
+func normalize(version string) string {
+	semVer, err := semver.NewVersion(version)
+	if err != nil {
+		return version
+	}
+
+	return semVer.String()
+}
+
+// IsStored returns true if version is among stored, either as is or
+// with the package version that conforming appends to it
+func IsStored(version *repo.ChartVersion, stored repo.ChartVersions) bool {
+	logrus.Debugf("Checking if version %s is stored\n", version.Version)
+	semVer, err := semver.NewVersion(version.Version)
+	if err != nil {
+		logrus.Error(err)
+		return false
+	}
+	for _, storedVersion := range stored {
+		if storedVersion.Version == semVer.String() {
+			logrus.Debugf("Found version %s\n", storedVersion.Version)
+			return true
+		}
+		if conform.StripPackageVersion(storedVersion.Version) == semVer.String() {
+			logrus.Debugf("Found modified version %s\n", storedVersion.Version)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Track groups versions by the minor version of each entry of tracked
+// that they match. Both versions and the result are sorted newest
+// first.
+func Track(versions repo.ChartVersions, tracked []string) map[string]repo.ChartVersions {
+	trackedVersions := make(map[string]repo.ChartVersions)
+
+	for _, trackedVersion := range tracked {
+		versionList := make(repo.ChartVersions, 0)
+		for _, version := range versions {
+			semVer, err := semver.NewVersion(version.Version)
+			if err != nil {
+				logrus.Errorf("%s: %s", version.Version, err)
+				continue
+			}
+			trackedSemVer, err := semver.NewVersion(trackedVersion)
+			if err != nil {
+				logrus.Errorf("%s: %s", version.Version, err)
+				continue
+			}
+			logrus.Debugf("Comparing upstream version %s (%s) to tracked version %s\n", version.Name, version.Version, trackedVersion)
+			if semVer.Major() == trackedSemVer.Major() && semVer.Minor() == trackedSemVer.Minor() {
+				logrus.Debugf("Appending version %s tracking %s\n", version.Version, trackedVersion)
+				versionList = append(versionList, version)
+			} else if semVer.Major() < trackedSemVer.Major() || (semVer.Major() == trackedSemVer.Major() && semVer.Minor() < trackedSemVer.Minor()) {
+				break
+			}
+		}
+		trackedVersions[trackedVersion] = versionList
+	}
+
+	return trackedVersions
+}
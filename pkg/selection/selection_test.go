@@ -0,0 +1,152 @@
+package selection
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/partner-charts-ci/internal/testutil"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Returns the versions of chartVersions, in order
+func versionsOf(chartVersions repo.ChartVersions) []string {
+	versions := make([]string, 0, len(chartVersions))
+	for _, chartVersion := range chartVersions {
+		versions = append(versions, chartVersion.Version)
+	}
+
+	return versions
+}
+
+func TestSelect(t *testing.T) {
+	upstream := testutil.ChartVersions("1.3.5", "1.2.1", "1.2.0", "1.1.0")
+
+	tests := []struct {
+		name     string
+		fetch    string
+		stored   repo.ChartVersions
+		expected []string
+	}{
+		{"latest with nothing stored", "", nil, []string{"1.3.5"}},
+		{"latest not stored", "latest", testutil.ChartVersions("1.2.1"), []string{"1.3.5"}},
+		{"latest stored", "latest", testutil.ChartVersions("1.3.5"), []string{}},
+		{"latest stored with package version", "Latest", testutil.ChartVersions("1.3.501"), []string{}},
+		{"latest stored as another patch", "latest", testutil.ChartVersions("1.3.4"), []string{"1.3.5"}},
+		{"newer with nothing stored", "newer", nil, []string{"1.3.5", "1.2.1", "1.2.0", "1.1.0"}},
+		{"newer than latest stored", "newer", testutil.ChartVersions("1.2.0"), []string{"1.3.5", "1.2.1"}},
+		{"newer than package versioned latest stored", "newer", testutil.ChartVersions("1.2.101", "1.1.0"), []string{"1.3.5"}},
+		{"newer with latest stored", "newer", testutil.ChartVersions("1.3.5"), []string{}},
+		{"all with nothing stored", "all", nil, []string{"1.3.5", "1.2.1", "1.2.0", "1.1.0"}},
+		{"all not stored", "all", testutil.ChartVersions("1.3.5", "1.2.0"), []string{"1.2.1", "1.1.0"}},
+		{"all with package versioned stored", "all", testutil.ChartVersions("1.3.502", "1.2.101", "1.2.0"), []string{"1.1.0"}},
+		{"range like all", "range", testutil.ChartVersions("1.2.0"), []string{"1.3.5", "1.2.1", "1.1.0"}},
+		{"unknown mode selects the first not stored", "oldest", testutil.ChartVersions("1.3.501"), []string{"1.2.1"}},
+		{"unknown mode with nothing stored", "oldest", nil, []string{"1.3.5"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := New(test.fetch).Select(upstream, test.stored)
+			if actual := versionsOf(selected); !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		fetch    string
+		expected VersionSelector
+	}{
+		{"", Latest{}},
+		{"latest", Latest{}},
+		{"LATEST", Latest{}},
+		{"newer", Newer{}},
+		{"Newer", Newer{}},
+		{"all", All{}},
+		{"range", Range{}},
+		{"oldest", FirstNotStored{Mode: "oldest"}},
+	}
+	for _, test := range tests {
+		t.Run(test.fetch, func(t *testing.T) {
+			if actual := New(test.fetch); actual != test.expected {
+				t.Errorf("expected %#v, got %#v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsStored(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		stored   repo.ChartVersions
+		expected bool
+	}{
+		{"nothing stored", "1.2.3", nil, false},
+		{"stored as is", "1.2.3", testutil.ChartVersions("1.2.3"), true},
+		{"stored with v prefix upstream", "v1.2.3", testutil.ChartVersions("1.2.3"), true},
+		{"not stored", "1.2.3", testutil.ChartVersions("1.2.4", "1.2.2"), false},
+		{"stored with package version", "1.2.3", testutil.ChartVersions("1.2.301"), true},
+		{"stored with second package version", "1.2.3", testutil.ChartVersions("1.2.302"), true},
+		{"package version of another patch", "1.2.3", testutil.ChartVersions("1.2.401", "1.2.201"), false},
+		{"package version of patch 0", "1.2.0", testutil.ChartVersions("1.2.1"), false},
+		{"patch 0 stored with package version", "1.2.0", testutil.ChartVersions("1.2.100"), false},
+		{"invalid version", "latest", testutil.ChartVersions("1.2.3"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version := &repo.ChartVersion{Metadata: &chart.Metadata{Version: test.version}}
+			if actual := IsStored(version, test.stored); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTrack(t *testing.T) {
+	versions := testutil.ChartVersions("2.1.0", "2.0.1", "2.0.0", "1.5.2", "1.5.1", "1.4.0")
+
+	tests := []struct {
+		name     string
+		tracked  []string
+		expected map[string][]string
+	}{
+		{
+			name:     "single minor",
+			tracked:  []string{"2.0"},
+			expected: map[string][]string{"2.0": {"2.0.1", "2.0.0"}},
+		},
+		{
+			name:    "several minors",
+			tracked: []string{"2.1", "1.5"},
+			expected: map[string][]string{
+				"2.1": {"2.1.0"},
+				"1.5": {"1.5.2", "1.5.1"},
+			},
+		},
+		{
+			name:     "untracked minor",
+			tracked:  []string{"1.3"},
+			expected: map[string][]string{"1.3": {}},
+		},
+		{
+			name:     "full version tracks its minor",
+			tracked:  []string{"1.4.0"},
+			expected: map[string][]string{"1.4.0": {"1.4.0"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trackedVersions := Track(versions, test.tracked)
+			actual := make(map[string][]string, len(trackedVersions))
+			for trackedVersion, chartVersions := range trackedVersions {
+				actual[trackedVersion] = versionsOf(chartVersions)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rancher/partner-charts-ci/pkg/tidy"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TagPrefix is prepended to snapshot names to form their git tag
+const TagPrefix = "snapshot/"
+
+// Manifest records the catalog files of a snapshot with their digests.
+// It is stored as the message of the snapshot tag.
+type Manifest struct {
+	Name    string    `json:"name"`
+	Commit  string    `json:"commit"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// File is a single catalog file of a snapshot
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Change is a file that rolling back to a snapshot restores or removes
+type Change struct {
+	Path   string
+	Remove bool
+}
+
+func (c Change) String() string {
+	if c.Remove {
+		return fmt.Sprintf("remove %s", c.Path)
+	}
+
+	return fmt.Sprintf("restore %s", c.Path)
+}
+
+// Create tags HEAD of the repository at repoPath as snapshot name, with
+// a manifest of the files at catalogPaths, which are files or
+// directories relative to the repository root. The catalog must have
+// no uncommitted changes.
+func Create(repoPath, name string, catalogPaths []string) (Manifest, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := r.Tag(TagPrefix + name); err == nil {
+		return Manifest{}, fmt.Errorf("snapshot %q already exists", name)
+	}
+	if err := checkClean(r, catalogPaths); err != nil {
+		return Manifest{}, err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return Manifest{}, err
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return Manifest{}, err
+	}
+	files, err := catalogFiles(commit, catalogPaths)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		Name:    name,
+		Commit:  head.Hash().String(),
+		Created: time.Now().UTC(),
+		Files:   make([]File, 0, len(files)),
+	}
+	for _, filePath := range sortedPaths(files) {
+		file := files[filePath]
+		digest, err := digestFile(file)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+		manifest.Files = append(manifest.Files, File{Path: filePath, SHA256: digest, Size: file.Size})
+	}
+
+	message, err := yaml.Marshal(manifest)
+	if err != nil {
+		return Manifest{}, err
+	}
+	signature, err := tagger(r)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := r.CreateTag(TagPrefix+name, head.Hash(), &git.CreateTagOptions{Tagger: signature, Message: string(message)}); err != nil {
+		return Manifest{}, fmt.Errorf("failed to tag snapshot %q: %w", name, err)
+	}
+
+	return manifest, nil
+}
+
+// Plan returns the manifest of snapshot name and the changes rolling
+// back the catalog at catalogPaths to it would make to the worktree
+func Plan(repoPath, name string, catalogPaths []string) (Manifest, []Change, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	manifest, _, err := load(r, name)
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	changes := make([]Change, 0)
+	snapshotFiles := make(map[string]struct{}, len(manifest.Files))
+	for _, file := range manifest.Files {
+		snapshotFiles[file.Path] = struct{}{}
+		digest, err := digestPath(filepath.Join(repoPath, filepath.FromSlash(file.Path)))
+		if err != nil || digest != file.SHA256 {
+			changes = append(changes, Change{Path: file.Path})
+		}
+	}
+	current, err := worktreeFiles(repoPath, catalogPaths)
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	for _, filePath := range current {
+		if _, ok := snapshotFiles[filePath]; !ok {
+			changes = append(changes, Change{Path: filePath, Remove: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return manifest, changes, nil
+}
+
+// Rollback restores the catalog at catalogPaths in the worktree to
+// snapshot name: files of the snapshot are written from its commit and
+// verified against its manifest, and other catalog files are removed.
+// The changes are left uncommitted.
+func Rollback(repoPath, name string, catalogPaths []string) ([]Change, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest, commit, err := load(r, name)
+	if err != nil {
+		return nil, err
+	}
+	_, changes, err := Plan(repoPath, name, catalogPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[string]string, len(manifest.Files))
+	for _, file := range manifest.Files {
+		digests[file.Path] = file.SHA256
+	}
+	for _, change := range changes {
+		targetPath := filepath.Join(repoPath, filepath.FromSlash(change.Path))
+		if change.Remove {
+			logrus.Debugf("Removing %s\n", change.Path)
+			if err := os.Remove(targetPath); err != nil {
+				return nil, err
+			}
+			topDir := strings.SplitN(change.Path, "/", 2)[0]
+			if err := tidy.RemoveEmptyParents(filepath.Dir(targetPath), filepath.Join(repoPath, topDir)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		logrus.Debugf("Restoring %s\n", change.Path)
+		file, err := commit.File(change.Path)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %q: %w: %s", name, err, change.Path)
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+		digest := fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))
+		if digest != digests[change.Path] {
+			return nil, fmt.Errorf("snapshot %q: %s does not match its manifest digest", name, change.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(targetPath, []byte(contents), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// Loads the manifest and commit of snapshot name
+func load(r *git.Repository, name string) (Manifest, *object.Commit, error) {
+	ref, err := r.Tag(TagPrefix + name)
+	if errors.Is(err, git.ErrTagNotFound) {
+		return Manifest{}, nil, fmt.Errorf("snapshot %q not found", name)
+	} else if err != nil {
+		return Manifest{}, nil, err
+	}
+	tag, err := r.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return Manifest{}, nil, fmt.Errorf("tag %s%s is not a snapshot", TagPrefix, name)
+	} else if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	manifest := Manifest{}
+	if err := yaml.Unmarshal([]byte(tag.Message), &manifest); err != nil {
+		return Manifest{}, nil, fmt.Errorf("failed to parse manifest of snapshot %q: %w", name, err)
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	return manifest, commit, nil
+}
+
+// Returns the git user configured for the repository or globally
+func tagger(r *git.Repository) (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.User.Name == "" || cfg.User.Email == "" {
+		return nil, fmt.Errorf("git user.name and user.email must be set to tag a snapshot")
+	}
+
+	return &object.Signature{Name: cfg.User.Name, Email: cfg.User.Email, When: time.Now()}, nil
+}
+
+func checkClean(r *git.Repository, catalogPaths []string) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return err
+	}
+	for filePath, fileStatus := range status {
+		if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		if inCatalog(filePath, catalogPaths) {
+			return fmt.Errorf("%s has uncommitted changes; commit them before creating a snapshot", filePath)
+		}
+	}
+
+	return nil
+}
+
+func catalogFiles(commit *object.Commit, catalogPaths []string) (map[string]*object.File, error) {
+	files := make(map[string]*object.File)
+	fileIter, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
+	err = fileIter.ForEach(func(file *object.File) error {
+		if inCatalog(file.Name, catalogPaths) {
+			files[file.Name] = file
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func worktreeFiles(repoPath string, catalogPaths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, catalogPath := range catalogPaths {
+		root := filepath.Join(repoPath, filepath.FromSlash(catalogPath))
+		err := filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			relativePath, err := filepath.Rel(repoPath, filePath)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(relativePath))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func inCatalog(filePath string, catalogPaths []string) bool {
+	for _, catalogPath := range catalogPaths {
+		catalogPath = path.Clean(catalogPath)
+		if filePath == catalogPath || strings.HasPrefix(filePath, catalogPath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedPaths(files map[string]*object.File) []string {
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func digestFile(file *object.File) (string, error) {
+	reader, err := file.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func digestPath(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
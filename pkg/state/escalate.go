@@ -0,0 +1,124 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/rancher/partner-charts-ci/pkg/pullrequest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultThreshold       = 3
+	defaultUnreachableDays = 30
+)
+
+// EscalationOptions configures opening GitHub issues for packages that
+// fail repeatedly, and warning about packages whose upstream has been
+// unreachable for UnreachableDays days
+type EscalationOptions struct {
+	Repository      string
+	Threshold       int
+	Labels          []string
+	UnreachableDays int
+}
+
+// GetUnreachableDays returns UnreachableDays, or its default of 30
+func (options EscalationOptions) GetUnreachableDays() int {
+	if options.UnreachableDays <= 0 {
+		return defaultUnreachableDays
+	}
+
+	return options.UnreachableDays
+}
+
+// Escalate opens, or updates, a GitHub issue for every package that has
+// reached the failure threshold. Issue numbers are recorded in the
+// state so later runs update the same issue. The issues of packages
+// that no longer fail are commented on and closed, and their numbers
+// cleared.
+func (s *State) Escalate(options EscalationOptions) error {
+	if options.Repository == "" {
+		return nil
+	}
+	owner, repoName, err := pullrequest.SplitRepository(options.Repository)
+	if err != nil {
+		return err
+	}
+	client, err := pullrequest.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to escalate failing packages: %w", err)
+	}
+	threshold := options.Threshold
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+
+	ctx := context.Background()
+
+	for _, packageName := range s.FailingPackages(threshold) {
+		packageState := s.Packages[packageName]
+		title := fmt.Sprintf("%s: upstream failing for %d consecutive runs", packageName, packageState.ConsecutiveFailures)
+		body := packageState.issueBody(packageName)
+
+		if packageState.IssueNumber != 0 {
+			logrus.Infof("Updating issue #%d for %s\n", packageState.IssueNumber, packageName)
+			_, _, err := client.Issues.Edit(ctx, owner, repoName, packageState.IssueNumber, &github.IssueRequest{
+				Title: github.String(title),
+				Body:  github.String(body),
+				State: github.String("open"),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update issue for %s: %w", packageName, err)
+			}
+			continue
+		}
+
+		logrus.Infof("Opening issue for %s\n", packageName)
+		issueRequest := &github.IssueRequest{
+			Title: github.String(title),
+			Body:  github.String(body),
+		}
+		if len(options.Labels) > 0 {
+			issueRequest.Labels = &options.Labels
+		}
+		issue, _, err := client.Issues.Create(ctx, owner, repoName, issueRequest)
+		if err != nil {
+			return fmt.Errorf("failed to open issue for %s: %w", packageName, err)
+		}
+		packageState.IssueNumber = issue.GetNumber()
+	}
+
+	for _, packageName := range s.RecoveredPackages() {
+		packageState := s.Packages[packageName]
+		logrus.Infof("Closing issue #%d for %s\n", packageState.IssueNumber, packageName)
+		comment := &github.IssueComment{
+			Body: github.String(fmt.Sprintf("Package `%s` updated successfully again, closing.", packageName)),
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repoName, packageState.IssueNumber, comment); err != nil {
+			return fmt.Errorf("failed to comment on issue for %s: %w", packageName, err)
+		}
+		_, _, err := client.Issues.Edit(ctx, owner, repoName, packageState.IssueNumber, &github.IssueRequest{
+			State: github.String("closed"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to close issue for %s: %w", packageName, err)
+		}
+		packageState.IssueNumber = 0
+		if packageState.isEmpty() {
+			delete(s.Packages, packageName)
+		}
+	}
+
+	return nil
+}
+
+func (p *PackageState) issueBody(packageName string) string {
+	body := fmt.Sprintf("Package `%s` has failed to update in %d consecutive CI runs.\n\nRecent errors:\n", packageName, p.ConsecutiveFailures)
+	for i := len(p.Errors) - 1; i >= 0; i-- {
+		body += fmt.Sprintf("- %s: `%s`\n", p.Errors[i].Time.Format("2006-01-02 15:04:05 MST"), p.Errors[i].Error)
+	}
+
+	return body
+}
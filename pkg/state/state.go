@@ -0,0 +1,197 @@
+package state
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	//StateFile sets the filename for the persisted CI state
+	StateFile = "state.yaml"
+	//maxErrorHistory caps the number of errors kept per package
+	maxErrorHistory = 10
+)
+
+// State is CI bookkeeping persisted between runs
+type State struct {
+	Packages map[string]*PackageState `json:"packages,omitempty"`
+	Path     string                   `json:"-"`
+}
+
+// PackageState tracks the health of a single package across runs
+type PackageState struct {
+	ConsecutiveFailures int        `json:"consecutiveFailures,omitempty"`
+	Errors              []Failure  `json:"errors,omitempty"`
+	IssueNumber         int        `json:"issueNumber,omitempty"`
+	UnreachableSince    *time.Time `json:"unreachableSince,omitempty"`
+}
+
+// Failure is a single recorded package error
+type Failure struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// Load reads the state file at statePath. A missing file yields an
+// empty State.
+func Load(statePath string) (*State, error) {
+	s := &State{
+		Packages: make(map[string]*PackageState),
+		Path:     statePath,
+	}
+
+	stateFile, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		logrus.Debugf("No state file at %s\n", statePath)
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(stateFile, s); err != nil {
+		return nil, err
+	}
+	if s.Packages == nil {
+		s.Packages = make(map[string]*PackageState)
+	}
+
+	return s, nil
+}
+
+// Write saves the state to its file. Nothing is written if the state
+// is empty and no file exists yet.
+func (s *State) Write() error {
+	if _, err := os.Stat(s.Path); os.IsNotExist(err) && s.isEmpty() {
+		return nil
+	}
+
+	stateFile, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.Path, stateFile, 0644)
+}
+
+// Package returns the state of packageName, creating it if needed
+func (s *State) Package(packageName string) *PackageState {
+	if _, ok := s.Packages[packageName]; !ok {
+		s.Packages[packageName] = &PackageState{}
+	}
+
+	return s.Packages[packageName]
+}
+
+// RecordFailure increments the consecutive failure count of
+// packageName and appends err to its error history
+func (s *State) RecordFailure(packageName string, err error) {
+	packageState := s.Package(packageName)
+	packageState.ConsecutiveFailures++
+	packageState.Errors = append(packageState.Errors, Failure{
+		Time:  time.Now().UTC(),
+		Error: redact.String(err.Error()),
+	})
+	if len(packageState.Errors) > maxErrorHistory {
+		packageState.Errors = packageState.Errors[len(packageState.Errors)-maxErrorHistory:]
+	}
+}
+
+// RecordUnreachable records a failure of packageName caused by its
+// upstream being unreachable, and marks when the upstream was first
+// found unreachable
+func (s *State) RecordUnreachable(packageName string, err error) {
+	s.RecordFailure(packageName, err)
+	packageState := s.Packages[packageName]
+	if packageState.UnreachableSince == nil {
+		now := time.Now().UTC()
+		packageState.UnreachableSince = &now
+	}
+}
+
+// RecordReachable clears the unreachable mark of packageName, for
+// failures that occurred after its upstream was reached
+func (s *State) RecordReachable(packageName string) {
+	if packageState, ok := s.Packages[packageName]; ok {
+		packageState.UnreachableSince = nil
+	}
+}
+
+// RecordSuccess resets the failure tracking of packageName. The number
+// of its escalation issue is kept until Escalate closes the issue.
+func (s *State) RecordSuccess(packageName string) {
+	packageState, ok := s.Packages[packageName]
+	if !ok {
+		return
+	}
+	packageState.ConsecutiveFailures = 0
+	packageState.Errors = nil
+	packageState.UnreachableSince = nil
+	if packageState.isEmpty() {
+		delete(s.Packages, packageName)
+	}
+}
+
+// FailingPackages returns the sorted names of packages that have failed
+// at least threshold consecutive times
+func (s *State) FailingPackages(threshold int) []string {
+	failing := make([]string, 0)
+	for packageName, packageState := range s.Packages {
+		if packageState.ConsecutiveFailures > 0 && packageState.ConsecutiveFailures >= threshold {
+			failing = append(failing, packageName)
+		}
+	}
+	sort.Strings(failing)
+
+	return failing
+}
+
+// RecoveredPackages returns the sorted names of packages that no longer
+// fail but still have an open escalation issue
+func (s *State) RecoveredPackages() []string {
+	recovered := make([]string, 0)
+	for packageName, packageState := range s.Packages {
+		if packageState.ConsecutiveFailures == 0 && packageState.IssueNumber != 0 {
+			recovered = append(recovered, packageName)
+		}
+	}
+	sort.Strings(recovered)
+
+	return recovered
+}
+
+// UnreachablePackages returns the sorted names of packages whose
+// upstream has been unreachable for at least days days as of now
+func (s *State) UnreachablePackages(days int, now time.Time) []string {
+	unreachable := make([]string, 0)
+	for packageName, packageState := range s.Packages {
+		if packageState.UnreachableSince == nil {
+			continue
+		}
+		if now.Sub(*packageState.UnreachableSince) >= time.Duration(days)*24*time.Hour {
+			unreachable = append(unreachable, packageName)
+		}
+	}
+	sort.Strings(unreachable)
+
+	return unreachable
+}
+
+func (s *State) isEmpty() bool {
+	for _, packageState := range s.Packages {
+		if !packageState.isEmpty() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *PackageState) isEmpty() bool {
+	return p.ConsecutiveFailures == 0 && len(p.Errors) == 0 && p.IssueNumber == 0 && p.UnreachableSince == nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/attest"
+	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/rancher/partner-charts-ci/pkg/tidy"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Filesystem stores archives in the assets directory of the repository,
+// listed in index.yaml by their path relative to the repository root
+type Filesystem struct {
+	assetsPath string
+	assetsDir  string
+}
+
+// NewFilesystem returns a Filesystem backend for the assets directory
+// at assetsPath, which is assetsDir relative to the repository root
+func NewFilesystem(assetsPath, assetsDir string) *Filesystem {
+	return &Filesystem{assetsPath: assetsPath, assetsDir: assetsDir}
+}
+
+// Save writes helmChart to <assets>/<vendor>, leaving an existing
+// archive with identical files untouched
+func (f *Filesystem) Save(helmChart *chart.Chart, vendor string) (*repo.ChartVersion, error) {
+	archivePath, _, err := conform.SaveChartArchive(helmChart, filepath.Join(f.assetsPath, vendor))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := provenance.DigestFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo.ChartVersion{
+		Metadata: helmChart.Metadata,
+		URLs:     []string{path.Join(f.assetsDir, vendor, filepath.Base(archivePath))},
+		Digest:   digest,
+	}, nil
+}
+
+// Load loads the archive at the path of chartVersion relative to the
+// repository root
+func (f *Filesystem) Load(chartVersion *repo.ChartVersion) (*chart.Chart, error) {
+	archivePath, err := f.archivePath(chartVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.LoadFile(archivePath)
+}
+
+// Delete removes the archive of chartVersion and its provenance
+// attestation, and its vendor directory if that is left empty
+func (f *Filesystem) Delete(chartVersion *repo.ChartVersion) error {
+	archivePath, err := f.archivePath(chartVersion)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(archivePath); err != nil {
+		return err
+	}
+	if err := os.Remove(archivePath + attest.Suffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return tidy.RemoveEmptyParents(filepath.Dir(archivePath), f.assetsPath)
+}
+
+func (f *Filesystem) archivePath(chartVersion *repo.ChartVersion) (string, error) {
+	if len(chartVersion.URLs) == 0 {
+		return "", fmt.Errorf("%s %s has no archive", chartVersion.Name, chartVersion.Version)
+	}
+	archivePath := chartVersion.URLs[0]
+	if !filepath.IsAbs(archivePath) {
+		relativePath := strings.TrimPrefix(path.Clean(archivePath), f.assetsDir+"/")
+		archivePath = filepath.Join(f.assetsPath, filepath.FromSlash(relativePath))
+	}
+
+	return archivePath, nil
+}
+
+func (f *Filesystem) Local() bool {
+	return true
+}
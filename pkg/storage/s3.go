@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/objectstorage"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// S3Options configures the S3 backend. Endpoint selects an
+// S3-compatible service, addressed with path-style URLs; by default
+// the AWS endpoint of Region is used. BaseURL is the public URL that
+// index.yaml lists archives under, by default the bucket URL.
+type S3Options struct {
+	Bucket   string
+	Region   string
+	Prefix   string
+	Endpoint string
+	BaseURL  string
+}
+
+// S3 stores archives in an S3 bucket at <prefix>/<vendor>/<archive>,
+// authenticated with the credentials of ResolveAWSCredentials
+type S3 struct {
+	options   S3Options
+	bucketURL string
+}
+
+// NewS3 returns an S3 backend. AWS credentials must be available to
+// ResolveAWSCredentials when archives are loaded or saved.
+func NewS3(options S3Options) (*S3, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("storage.s3.bucket is required")
+	}
+	if options.Region == "" {
+		options.Region = objectstorage.AWSRegionFromEnv()
+	}
+	if options.Region == "" {
+		return nil, fmt.Errorf("storage.s3.region or %s is required", "AWS_REGION")
+	}
+	bucketURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", options.Bucket, options.Region)
+	if options.Endpoint != "" {
+		bucketURL = strings.TrimSuffix(options.Endpoint, "/") + "/" + options.Bucket
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+	options.BaseURL = strings.TrimSuffix(options.BaseURL, "/")
+	if options.BaseURL == "" {
+		options.BaseURL = bucketURL
+	}
+
+	return &S3{options: options, bucketURL: bucketURL}, nil
+}
+
+// Save uploads helmChart, replacing any existing object
+func (s *S3) Save(helmChart *chart.Chart, vendor string) (*repo.ChartVersion, error) {
+	name, data, err := archive(helmChart)
+	if err != nil {
+		return nil, err
+	}
+	key := path.Join(s.options.Prefix, vendor, name)
+	digest := sha256.Sum256(data)
+
+	logrus.Debugf("Uploading %s to s3://%s/%s\n", name, s.options.Bucket, key)
+	req, err := http.NewRequest(http.MethodPut, s.bucketURL+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if _, err := s.do(req, data); err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	return &repo.ChartVersion{
+		Metadata: helmChart.Metadata,
+		URLs:     []string{s.options.BaseURL + "/" + key},
+		Created:  time.Now(),
+		Digest:   hex.EncodeToString(digest[:]),
+	}, nil
+}
+
+// Load downloads the archive of chartVersion, from the bucket if its URL
+// is under BaseURL and from the URL itself otherwise
+func (s *S3) Load(chartVersion *repo.ChartVersion) (*chart.Chart, error) {
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("%s %s has no archive", chartVersion.Name, chartVersion.Version)
+	}
+	archiveURL := chartVersion.URLs[0]
+
+	var data []byte
+	var err error
+	if key, ok := strings.CutPrefix(archiveURL, s.options.BaseURL+"/"); ok {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, s.bucketURL+"/"+key, nil)
+		if err != nil {
+			return nil, err
+		}
+		data, err = s.do(req, nil)
+	} else {
+		var resp *http.Response
+		resp, err = ratelimit.Client().Get(archiveURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s returned status %d", archiveURL, resp.StatusCode)
+		}
+		data, err = io.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.LoadArchive(bytes.NewReader(data))
+}
+
+// Delete removes the object of chartVersion from the bucket. Archives
+// not under BaseURL are left untouched.
+func (s *S3) Delete(chartVersion *repo.ChartVersion) error {
+	for _, archiveURL := range chartVersion.URLs {
+		key, ok := strings.CutPrefix(archiveURL, s.options.BaseURL+"/")
+		if !ok {
+			logrus.Warnf("Not deleting %s, which is not stored in s3://%s", archiveURL, s.options.Bucket)
+			continue
+		}
+		req, err := http.NewRequest(http.MethodDelete, s.bucketURL+"/"+key, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := s.do(req, nil); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *S3) Local() bool {
+	return false
+}
+
+// Signs and sends req, whose body is payload, and returns the response
+// body
+func (s *S3) do(req *http.Request, payload []byte) ([]byte, error) {
+	// resolved for every request, so that temporary credentials are
+	// refreshed when they expire during a run
+	credentials, err := objectstorage.ResolveAWSCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve credentials for S3 storage: %w", err)
+	}
+	objectstorage.SignV4(req, payload, s.options.Region, "s3", credentials, time.Now())
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s returned status %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
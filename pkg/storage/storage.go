@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	TypeFilesystem = "filesystem"
+	TypeS3         = "s3"
+)
+
+// Backend stores the chart archives of the repository
+type Backend interface {
+	// Save stores helmChart as an archive of vendor and returns its
+	// index entry
+	Save(helmChart *chart.Chart, vendor string) (*repo.ChartVersion, error)
+	// Load loads the chart archive of an index entry
+	Load(chartVersion *repo.ChartVersion) (*chart.Chart, error)
+	// Delete removes the chart archive of an index entry
+	Delete(chartVersion *repo.ChartVersion) error
+	// Local reports whether archives are kept in the assets directory,
+	// from which index.yaml is generated
+	Local() bool
+}
+
+// Options selects the storage backend in configuration.yaml. An empty
+// Type stores archives in the assets directory.
+type Options struct {
+	Type string
+	S3   S3Options
+}
+
+var (
+	mu             sync.Mutex
+	defaultBackend Backend
+)
+
+// Configure sets the backend returned by Default. assetsPath is the
+// absolute path of the assets directory, whose path relative to the
+// repository root is assetsDir.
+func Configure(options Options, assetsPath, assetsDir string) error {
+	var backend Backend
+	switch options.Type {
+	case "", TypeFilesystem:
+		backend = NewFilesystem(assetsPath, assetsDir)
+	case TypeS3:
+		s3, err := NewS3(options.S3)
+		if err != nil {
+			return err
+		}
+		backend = s3
+	default:
+		return fmt.Errorf("unknown storage type %q: must be %s or %s", options.Type, TypeFilesystem, TypeS3)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	defaultBackend = backend
+
+	return nil
+}
+
+// Default returns the configured backend. Without configuration,
+// archives are stored in the assets directory of the working directory.
+func Default() Backend {
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultBackend == nil {
+		wd, _ := os.Getwd()
+		defaultBackend = NewFilesystem(filepath.Join(wd, "assets"), "assets")
+	}
+
+	return defaultBackend
+}
+
+// Archives helmChart in memory, returning the archive name and contents
+func archive(helmChart *chart.Chart) (string, []byte, error) {
+	tempDir, err := os.MkdirTemp("", "chartArchive")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath, err := chartutil.Save(helmChart, tempDir)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filepath.Base(archivePath), data, nil
+}
@@ -0,0 +1,190 @@
+package summary
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/redact"
+)
+
+// EnvVariable is set by GitHub Actions to the file that the Markdown
+// job summary of the current step is appended to
+const EnvVariable = "GITHUB_STEP_SUMMARY"
+
+// Version is a chart version added by a run, with the page describing
+// its upstream release, if known
+type Version struct {
+	Version    string
+	ReleaseURL string
+}
+
+// Package is a package updated by a run
+type Package struct {
+	Name     string
+	Versions []Version
+	// Duration is the time spent integrating the package
+	Duration time.Duration
+}
+
+// Rejected is a chart version left out of a run because it failed the
+// render check
+type Rejected struct {
+	Package string
+	Version string
+	Err     error
+}
+
+// Summary describes a run of auto or stage
+type Summary struct {
+	Command  string
+	Checked  int
+	Updated  []Package
+	Failed   map[string]error
+	Rejected []Rejected
+	Deferred []string
+	// DeferReason is the resource cap that deferred packages
+	DeferReason string
+	Duration    time.Duration
+	// Base and Head are the commits before and after the run, if it
+	// committed its changes
+	Base string
+	Head string
+}
+
+// Write appends the Markdown rendering of s to the job summary when
+// running in GitHub Actions, and does nothing otherwise
+func Write(s Summary) error {
+	summaryPath := os.Getenv(EnvVariable)
+	if summaryPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(summaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s.Markdown()); err != nil {
+		return fmt.Errorf("failed to write job summary: %w", err)
+	}
+
+	return nil
+}
+
+// Sorted returns a copy of s with the updated and deferred packages
+// sorted by name, and the rejected versions by package and version, so
+// that renderings do not depend on the order in which packages were
+// processed
+func (s Summary) Sorted() Summary {
+	sorted := s
+	sorted.Updated = make([]Package, len(s.Updated))
+	copy(sorted.Updated, s.Updated)
+	sort.SliceStable(sorted.Updated, func(i, j int) bool {
+		return sorted.Updated[i].Name < sorted.Updated[j].Name
+	})
+	sorted.Deferred = make([]string, len(s.Deferred))
+	copy(sorted.Deferred, s.Deferred)
+	sort.Strings(sorted.Deferred)
+	sorted.Rejected = make([]Rejected, len(s.Rejected))
+	copy(sorted.Rejected, s.Rejected)
+	sort.SliceStable(sorted.Rejected, func(i, j int) bool {
+		if sorted.Rejected[i].Package != sorted.Rejected[j].Package {
+			return sorted.Rejected[i].Package < sorted.Rejected[j].Package
+		}
+		return sorted.Rejected[i].Version < sorted.Rejected[j].Version
+	})
+
+	return sorted
+}
+
+// Markdown renders s as a job summary
+func (s Summary) Markdown() string {
+	s = s.Sorted()
+	var b strings.Builder
+	fmt.Fprintf(&b, "## partner-charts-ci %s\n\n", s.Command)
+	packages := "packages"
+	if s.Checked == 1 {
+		packages = "package"
+	}
+	fmt.Fprintf(&b, "Checked %d %s in %s: %d updated, %d failed, %d deferred.\n",
+		s.Checked, packages, s.Duration.Round(time.Second), len(s.Updated), len(s.Failed), len(s.Deferred))
+	if s.Head != "" && s.Head != s.Base {
+		fmt.Fprintf(&b, "\nChanges: %s\n", compareLink(s.Base, s.Head))
+	}
+
+	if len(s.Updated) > 0 {
+		b.WriteString("\n### Updated\n\n")
+		b.WriteString("| Package | Versions | Duration |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, updated := range s.Updated {
+			versions := make([]string, 0, len(updated.Versions))
+			for _, version := range updated.Versions {
+				if version.ReleaseURL != "" {
+					versions = append(versions, fmt.Sprintf("[%s](%s)", version.Version, version.ReleaseURL))
+				} else {
+					versions = append(versions, version.Version)
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", updated.Name, strings.Join(versions, ", "), updated.Duration.Round(time.Millisecond))
+		}
+	}
+
+	if len(s.Failed) > 0 {
+		names := make([]string, 0, len(s.Failed))
+		for name := range s.Failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("\n### Failed\n\n")
+		b.WriteString("| Package | Error |\n")
+		b.WriteString("| --- | --- |\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "| %s | %s |\n", name, cell(redact.String(s.Failed[name].Error())))
+		}
+	}
+
+	if len(s.Rejected) > 0 {
+		b.WriteString("\n### Rejected\n\n")
+		b.WriteString("| Package | Version | Error |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, rejected := range s.Rejected {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", rejected.Package, rejected.Version, cell(redact.String(rejected.Err.Error())))
+		}
+	}
+
+	if len(s.Deferred) > 0 {
+		fmt.Fprintf(&b, "\n### Deferred\n\nDeferred to the next run because %s: %s\n", s.DeferReason, strings.Join(s.Deferred, ", "))
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// Returns a link to the diff between the commits base and head on
+// GitHub, or the range itself outside of GitHub Actions
+func compareLink(base, head string) string {
+	serverURL := os.Getenv("GITHUB_SERVER_URL")
+	repository := os.Getenv("GITHUB_REPOSITORY")
+	if serverURL == "" || repository == "" {
+		return fmt.Sprintf("`%s..%s`", short(base), short(head))
+	}
+
+	return fmt.Sprintf("[%s..%s](%s/%s/compare/%s...%s)", short(base), short(head), serverURL, repository, base, head)
+}
+
+func short(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
+
+// Renders value as a single line table cell
+func cell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+
+	return strings.ReplaceAll(value, "\n", " ")
+}
@@ -0,0 +1,250 @@
+package tgzdiff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/rancher/partner-charts-ci/pkg/validate"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// contextLines is the number of unchanged lines shown around each
+// change in a patch
+const contextLines = 3
+
+// Diff is the difference between the files of two chart archives
+type Diff struct {
+	Old      string
+	New      string
+	Added    []string
+	Removed  []string
+	Modified []string
+	// Patches holds the unified diff of each modified text file; binary
+	// files have none
+	Patches map[string]string
+}
+
+// Compare unpacks the archives at oldArchive and newArchive and
+// compares their files. Paths are relative to the chart directory of
+// each archive, so that renamed charts can be compared. Nested chart
+// archives that only differ in catalog.cattle.io annotations are
+// considered unchanged.
+func Compare(oldArchive, newArchive string) (Diff, error) {
+	result := Diff{Old: oldArchive, New: newArchive, Patches: make(map[string]string)}
+
+	tempDir, err := os.MkdirTemp("", "tgz-diff")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldPath := filepath.Join(tempDir, "old")
+	newPath := filepath.Join(tempDir, "new")
+	if err := conform.Gunzip(oldArchive, oldPath); err != nil {
+		return result, fmt.Errorf("failed to unpack %s: %w", oldArchive, err)
+	}
+	if err := conform.Gunzip(newArchive, newPath); err != nil {
+		return result, fmt.Errorf("failed to unpack %s: %w", newArchive, err)
+	}
+
+	comparison, err := validate.CompareDirectories(oldPath, newPath, nil, false)
+	if err != nil {
+		return result, err
+	}
+	result.Added = trimLeadingSlashes(comparison.Added)
+	result.Removed = trimLeadingSlashes(comparison.Removed)
+	result.Modified = trimLeadingSlashes(comparison.Modified)
+
+	for _, relativePath := range result.Modified {
+		oldData, err := os.ReadFile(filepath.Join(oldPath, filepath.FromSlash(relativePath)))
+		if err != nil {
+			return result, err
+		}
+		newData, err := os.ReadFile(filepath.Join(newPath, filepath.FromSlash(relativePath)))
+		if err != nil {
+			return result, err
+		}
+		if isBinary(oldData) || isBinary(newData) {
+			continue
+		}
+		result.Patches[relativePath] = unified("a/"+relativePath, "b/"+relativePath, string(oldData), string(newData))
+	}
+
+	return result, nil
+}
+
+// Empty returns true if the archives have the same files
+func (d Diff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Modified) == 0
+}
+
+// Text renders d like diff -r: a line for each added or removed file,
+// and the patch of each modified one
+func (d Diff) Text() string {
+	var b strings.Builder
+	for _, relativePath := range d.Added {
+		fmt.Fprintf(&b, "Only in %s: %s\n", d.New, relativePath)
+	}
+	for _, relativePath := range d.Removed {
+		fmt.Fprintf(&b, "Only in %s: %s\n", d.Old, relativePath)
+	}
+	for _, relativePath := range d.Modified {
+		patch, ok := d.Patches[relativePath]
+		if !ok {
+			fmt.Fprintf(&b, "Binary files a/%s and b/%s differ\n", relativePath, relativePath)
+			continue
+		}
+		b.WriteString(patch)
+	}
+
+	return b.String()
+}
+
+// Markdown renders d for pull request comments, with the patch of each
+// modified file in a collapsed section
+func (d Diff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### `%s` → `%s`\n\n", filepath.Base(d.Old), filepath.Base(d.New))
+	if d.Empty() {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "%d added, %d removed, %d modified.\n", len(d.Added), len(d.Removed), len(d.Modified))
+	for _, list := range []struct {
+		title string
+		paths []string
+	}{{"Added", d.Added}, {"Removed", d.Removed}} {
+		if len(list.paths) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", list.title)
+		for _, relativePath := range list.paths {
+			fmt.Fprintf(&b, "- `%s`\n", relativePath)
+		}
+	}
+	if len(d.Modified) > 0 {
+		b.WriteString("\nModified:\n")
+	}
+	for _, relativePath := range d.Modified {
+		patch, ok := d.Patches[relativePath]
+		if !ok {
+			fmt.Fprintf(&b, "- `%s` (binary)\n", relativePath)
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details><summary><code>%s</code></summary>\n\n```diff\n%s```\n\n</details>\n", relativePath, patch)
+	}
+
+	return b.String()
+}
+
+type line struct {
+	op   byte
+	text string
+}
+
+// Renders the changes between oldText and newText as a unified diff
+func unified(oldName, newName, oldText, newText string) string {
+	lines := make([]line, 0)
+	for _, d := range diff.Do(oldText, newText) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, line{op: op, text: strings.TrimSuffix(text, "\n")})
+			}
+		}
+	}
+
+	// line numbers in the old and new file of each line
+	oldAt := make([]int, len(lines)+1)
+	newAt := make([]int, len(lines)+1)
+	oldLine, newLine := 1, 1
+	for i, l := range lines {
+		oldAt[i], newAt[i] = oldLine, newLine
+		if l.op != '+' {
+			oldLine++
+		}
+		if l.op != '-' {
+			newLine++
+		}
+	}
+	oldAt[len(lines)], newAt[len(lines)] = oldLine, newLine
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// a hunk spans changes separated by at most twice the context
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(lines) && lines[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' && next-end < 2*contextLines {
+				next++
+			}
+			if next < len(lines) && lines[next].op != ' ' {
+				end = next
+				continue
+			}
+			break
+		}
+		stop := end + contextLines
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		oldCount := oldAt[stop] - oldAt[start]
+		newCount := newAt[stop] - newAt[start]
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldAt[start], oldCount), hunkRange(newAt[start], newCount))
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&b, "%c%s\n", l.op, l.text)
+		}
+		i = stop
+	}
+
+	return b.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Files with NUL bytes or invalid UTF-8 are not diffed line by line
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+func trimLeadingSlashes(paths []string) []string {
+	trimmed := make([]string, 0, len(paths))
+	for _, p := range paths {
+		trimmed = append(trimmed, strings.TrimPrefix(filepath.ToSlash(p), "/"))
+	}
+
+	return trimmed
+}
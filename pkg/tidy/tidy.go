@@ -0,0 +1,95 @@
+package tidy
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RemoveEmptyParents removes dir and each of its parents that is empty,
+// stopping at the first one that is not and never removing root or
+// anything outside it. It is called after removing a file, so that a
+// vendor directory does not linger once its last chart is gone.
+func RemoveEmptyParents(dir, root string) error {
+	dir = filepath.Clean(dir)
+	root = filepath.Clean(root)
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		empty, err := isEmpty(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			dir = filepath.Dir(dir)
+			continue
+		} else if err != nil {
+			return err
+		} else if !empty {
+			return nil
+		}
+		if err := os.Remove(dir); err != nil {
+			return err
+		}
+		logrus.Debugf("Removed empty directory %s\n", dir)
+		dir = filepath.Dir(dir)
+	}
+
+	return nil
+}
+
+// RemoveEmptyDirs removes every directory below root that is empty, or
+// that only holds empty directories, and returns their paths, deepest
+// first. root itself is kept. A root that does not exist has nothing
+// to remove.
+func RemoveEmptyDirs(root string) ([]string, error) {
+	dirs := make([]string, 0)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != root {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// WalkDir visits parents before their children, so walking backwards
+	// empties each directory before it is checked
+	removed := make([]string, 0)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		empty, err := isEmpty(dirs[i])
+		if err != nil {
+			return removed, err
+		} else if !empty {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			return removed, err
+		}
+		removed = append(removed, dirs[i])
+	}
+
+	return removed, nil
+}
+
+func isEmpty(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(1)
+	if len(names) > 0 {
+		return false, nil
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	return true, nil
+}
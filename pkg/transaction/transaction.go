@@ -0,0 +1,161 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transaction records the contents of files and directories before
+// they are modified, so that a multi-step operation can restore them if
+// any step fails
+type Transaction struct {
+	snapshots map[string]*snapshot
+	order     []string
+	// parent also tracks every path tracked by a nested transaction
+	parent *Transaction
+}
+
+// snapshot is the state of a tracked path before the transaction.
+// A nil files map means the path did not exist.
+type snapshot struct {
+	files map[string]file
+	dirs  map[string]fs.FileMode
+}
+
+type file struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// New returns an empty Transaction
+func New() *Transaction {
+	return &Transaction{
+		snapshots: make(map[string]*snapshot),
+	}
+}
+
+// Nest returns a transaction nested in t. Every path it tracks is also
+// tracked by t, so that rolling back t restores the changes of the
+// nested transaction even after it was committed.
+func (t *Transaction) Nest() *Transaction {
+	nested := New()
+	nested.parent = t
+
+	return nested
+}
+
+// Track records the current contents of filePath, which may be a file,
+// a directory or not exist yet. Paths already tracked keep their first
+// snapshot.
+func (t *Transaction) Track(filePath string) error {
+	filePath = filepath.Clean(filePath)
+	if t.parent != nil {
+		if err := t.parent.Track(filePath); err != nil {
+			return err
+		}
+	}
+	if _, ok := t.snapshots[filePath]; ok {
+		return nil
+	}
+
+	s := &snapshot{}
+	if _, err := os.Lstat(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	} else if err == nil {
+		s.files = make(map[string]file)
+		s.dirs = make(map[string]fs.FileMode)
+		err := filepath.WalkDir(filePath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				s.dirs[p] = info.Mode().Perm()
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			s.files[p] = file{data: data, mode: info.Mode().Perm()}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", filePath, err)
+		}
+	}
+
+	t.snapshots[filePath] = s
+	t.order = append(t.order, filePath)
+
+	return nil
+}
+
+// Rollback restores every tracked path to its recorded contents,
+// removing anything created since
+func (t *Transaction) Rollback() error {
+	var errs []error
+	for i := len(t.order) - 1; i >= 0; i-- {
+		filePath := t.order[i]
+		logrus.Debugf("Rolling back %s\n", filePath)
+		if err := t.snapshots[filePath].restore(filePath); err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back %s: %w", filePath, err))
+		}
+	}
+	t.Commit()
+
+	return errors.Join(errs...)
+}
+
+// Commit discards the recorded snapshots, keeping all changes
+func (t *Transaction) Commit() {
+	t.snapshots = make(map[string]*snapshot)
+	t.order = nil
+}
+
+// Run calls fn, rolling back the transaction if it fails and
+// committing it otherwise
+func (t *Transaction) Run(fn func() error) error {
+	if err := fn(); err != nil {
+		if rollbackErr := t.Rollback(); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	t.Commit()
+
+	return nil
+}
+
+func (s *snapshot) restore(filePath string) error {
+	if err := os.RemoveAll(filePath); err != nil {
+		return err
+	}
+	if s.files == nil {
+		return nil
+	}
+
+	for dir, mode := range s.dirs {
+		if err := os.MkdirAll(dir, mode); err != nil {
+			return err
+		}
+	}
+	for p, f := range s.files {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultAllowedAnnotationPrefixes is used when configuration.yaml does
+// not set allowedAnnotationPrefixes
+var DefaultAllowedAnnotationPrefixes = []string{"catalog.cattle.io/"}
+
+// managedAnnotations are set by the CI itself and can not be passed
+// through from upstream.yaml
+var managedAnnotations = map[string]struct{}{
+	"catalog.cattle.io/aliases":          {},
+	"catalog.cattle.io/auto-install":     {},
+	"catalog.cattle.io/certified":        {},
+	"catalog.cattle.io/create-namespace": {},
+	"catalog.cattle.io/deprecated":       {},
+	"catalog.cattle.io/display-name":     {},
+	"catalog.cattle.io/eol-date":         {},
+	"catalog.cattle.io/eula-required":    {},
+	"catalog.cattle.io/eula-url":         {},
+	"catalog.cattle.io/experimental":     {},
+	"catalog.cattle.io/featured":         {},
+	"catalog.cattle.io/hidden":           {},
+	"catalog.cattle.io/kube-version":     {},
+	"catalog.cattle.io/namespace":        {},
+	"catalog.cattle.io/release-name":     {},
+}
+
+// CheckAnnotations verifies that every annotation to be passed through
+// from upstream.yaml starts with one of allowedPrefixes and is not one
+// managed by the CI
+func CheckAnnotations(annotations map[string]string, allowedPrefixes []string) []error {
+	if len(allowedPrefixes) == 0 {
+		allowedPrefixes = DefaultAllowedAnnotationPrefixes
+	}
+
+	names := make([]string, 0, len(annotations))
+	for name := range annotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if _, ok := managedAnnotations[name]; ok {
+			errs = append(errs, fmt.Errorf("annotation %q is managed by partner-charts-ci and can not be set directly", name))
+			continue
+		}
+		allowed := false
+		for _, prefix := range allowedPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Errorf("annotation %q does not start with an allowed prefix (%s)", name, strings.Join(allowedPrefixes, ", ")))
+		}
+	}
+
+	return errs
+}
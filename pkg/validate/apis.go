@@ -0,0 +1,397 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	//kubeVersionAnnotation is checked for the supported Kubernetes
+	//versions of charts that do not set kubeVersion
+	kubeVersionAnnotation = "catalog.cattle.io/kube-version"
+	//lastKubeMinor bounds the Kubernetes minor versions that are
+	//considered when a kube-version range has no upper bound
+	lastKubeMinor = 50
+	//testValuesPattern matches the values files that charts ship as
+	//additional rendering scenarios, following the chart-testing
+	//convention
+	testValuesPattern = "ci/*-values.yaml"
+)
+
+// RemovedAPI is a Kubernetes API that is no longer served as of the
+// Kubernetes minor version RemovedIn
+type RemovedAPI struct {
+	APIVersion  string
+	Kind        string
+	RemovedIn   int
+	Replacement string
+}
+
+// RemovedAPIs lists the APIs removed from Kubernetes 1.16 onwards
+var RemovedAPIs = []RemovedAPI{
+	{"extensions/v1beta1", "DaemonSet", 16, "apps/v1"},
+	{"extensions/v1beta1", "Deployment", 16, "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", 16, "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", 16, "policy/v1beta1"},
+	{"extensions/v1beta1", "ReplicaSet", 16, "apps/v1"},
+	{"apps/v1beta1", "Deployment", 16, "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", 16, "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", 16, "apps/v1"},
+	{"apps/v1beta2", "Deployment", 16, "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", 16, "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", 16, "apps/v1"},
+	{"extensions/v1beta1", "Ingress", 22, "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", 22, "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass", 22, "networking.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", 22, "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", 22, "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", 22, "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", 22, "apiregistration.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", 22, "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", 22, "coordination.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", 22, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", 22, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", 22, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", 22, "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", 22, "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", 22, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", 22, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", 22, "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", 22, "storage.k8s.io/v1"},
+	{"batch/v1beta1", "CronJob", 25, "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", 25, "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event", 25, "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", 25, "autoscaling/v2"},
+	{"policy/v1beta1", "PodDisruptionBudget", 25, "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", 25, "Pod Security Admission"},
+	{"node.k8s.io/v1beta1", "RuntimeClass", 25, "node.k8s.io/v1"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", 26, "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", 26, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", 26, "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", 27, "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", 29, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", 29, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", 32, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", 32, "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// RemovedAPIUsage is a manifest of a chart that uses a removed API.
+// Values names the test values file the manifest was rendered with, and
+// is empty for the default values.
+type RemovedAPIUsage struct {
+	Template string
+	Values   string
+	RemovedAPI
+}
+
+func (u RemovedAPIUsage) String() string {
+	usage := fmt.Sprintf("%s uses %s %s, removed in Kubernetes 1.%d (use %s)", u.Template, u.APIVersion, u.Kind, u.RemovedIn, u.Replacement)
+	if u.Values != "" {
+		usage += fmt.Sprintf(" with %s", u.Values)
+	}
+
+	return usage
+}
+
+// RenderScenario is a set of values to render a chart with
+type RenderScenario struct {
+	// Name is the values file of the scenario, or empty for the
+	// default values of the chart
+	Name   string
+	Values chartutil.Values
+}
+
+// RenderScenarios returns the default values of helmChart followed by
+// one scenario for each ci/*-values.yaml file it ships, in name order
+func RenderScenarios(helmChart *chart.Chart) ([]RenderScenario, error) {
+	scenarios := []RenderScenario{{Values: chartutil.Values{}}}
+	files := make([]*chart.File, 0)
+	for _, file := range helmChart.Files {
+		if ok, _ := path.Match(testValuesPattern, file.Name); ok {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	for _, file := range files {
+		values, err := chartutil.ReadValues(file.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file.Name, err)
+		}
+		scenarios = append(scenarios, RenderScenario{Name: file.Name, Values: values})
+	}
+
+	return scenarios, nil
+}
+
+// CheckRemovedAPIs renders helmChart for each Kubernetes version in its
+// kube-version range at which APIs were removed, and returns the
+// manifests, including those in crds/, that use an API removed at that
+// version. Charts without a kube-version range are checked against
+// every removal. Each version is rendered with the default values and
+// with every test values file of the chart; a usage found with the
+// default values is not reported again for a test values file.
+func CheckRemovedAPIs(helmChart *chart.Chart) ([]RemovedAPIUsage, error) {
+	kubeVersion := helmChart.Metadata.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = helmChart.Metadata.Annotations[kubeVersionAnnotation]
+	}
+	var constraint *semver.Constraints
+	if kubeVersion != "" {
+		var err error
+		constraint, err = semver.NewConstraint(kubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube-version %q: %w", kubeVersion, err)
+		}
+	}
+
+	scenarios, err := RenderScenarios(helmChart)
+	if err != nil {
+		return nil, err
+	}
+
+	removals := make(map[int]struct{})
+	for _, removedAPI := range RemovedAPIs {
+		removals[removedAPI.RemovedIn] = struct{}{}
+	}
+	minors := make([]int, 0, len(removals))
+	renderedMinors := make(map[int]struct{})
+	for removedIn := range removals {
+		minor, ok := firstAllowedMinor(constraint, removedIn)
+		if !ok {
+			continue
+		}
+		if _, ok := renderedMinors[minor]; ok {
+			continue
+		}
+		renderedMinors[minor] = struct{}{}
+		minors = append(minors, minor)
+	}
+
+	// usages are keyed without their values file, so that the
+	// scenario reported for each is the first that renders it
+	found := make(map[RemovedAPIUsage]RemovedAPIUsage)
+	for _, scenario := range scenarios {
+		for _, minor := range minors {
+			manifests, err := renderManifests(helmChart, scenario.Values, minor)
+			if err != nil && scenario.Name != "" {
+				return nil, fmt.Errorf("%s: %w", scenario.Name, err)
+			} else if err != nil {
+				return nil, err
+			}
+			for template, content := range manifests {
+				for _, usage := range removedAPIsIn(template, content, minor) {
+					if _, ok := found[usage]; !ok {
+						usage.Values = scenario.Name
+						found[RemovedAPIUsage{Template: usage.Template, RemovedAPI: usage.RemovedAPI}] = usage
+					}
+				}
+			}
+		}
+	}
+
+	usages := make([]RemovedAPIUsage, 0, len(found))
+	for _, usage := range found {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].String() < usages[j].String()
+	})
+
+	return usages, nil
+}
+
+// Returns the first Kubernetes 1.x minor version from minor onwards
+// that constraint allows. A nil constraint allows every version.
+func firstAllowedMinor(constraint *semver.Constraints, minor int) (int, bool) {
+	if constraint == nil {
+		return minor, true
+	}
+	for ; minor <= lastKubeMinor; minor++ {
+		// the -0 prerelease matches ranges such as ">=1.21-0" that
+		// admit the prerelease versions reported by some distributions
+		for _, candidate := range []string{fmt.Sprintf("1.%d.0", minor), fmt.Sprintf("1.%d.0-0", minor)} {
+			if constraint.Check(semver.MustParse(candidate)) {
+				return minor, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// Renders the manifests of helmChart with values over its default
+// values for a cluster running Kubernetes 1.minor, which does not serve
+// the APIs removed by then
+func renderManifests(helmChart *chart.Chart, values chartutil.Values, minor int) (map[string]string, error) {
+	kubeVersion, err := chartutil.ParseKubeVersion(fmt.Sprintf("v1.%d.0", minor))
+	if err != nil {
+		return nil, err
+	}
+	capabilities := chartutil.DefaultCapabilities.Copy()
+	capabilities.KubeVersion = *kubeVersion
+	capabilities.APIVersions = servedAPIVersions(minor)
+
+	// processing drops the dependencies that values disable, which
+	// other scenarios may enable
+	defer restoreDependencies(helmChart)()
+	if err := chartutil.ProcessDependencies(helmChart, values); err != nil {
+		return nil, fmt.Errorf("failed to process dependencies: %w", err)
+	}
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      "release-name",
+		Namespace: "default",
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(helmChart, values, releaseOptions, capabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := engine.Engine{LintMode: true}.Render(helmChart, renderValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render templates for Kubernetes 1.%d: %w", minor, err)
+	}
+	for _, crd := range helmChart.CRDObjects() {
+		manifests[crd.Filename] = string(crd.File.Data)
+	}
+
+	return manifests, nil
+}
+
+// Records the dependencies of helmChart and its dependencies, returning
+// a function that restores them
+func restoreDependencies(helmChart *chart.Chart) func() {
+	dependencies := make(map[*chart.Chart][]*chart.Chart)
+	var record func(*chart.Chart)
+	record = func(c *chart.Chart) {
+		dependencies[c] = c.Dependencies()
+		for _, dependency := range c.Dependencies() {
+			record(dependency)
+		}
+	}
+	record(helmChart)
+
+	return func() {
+		for c, deps := range dependencies {
+			c.SetDependencies(deps...)
+		}
+	}
+}
+
+// Returns the default API versions without those removed by 1.minor
+func servedAPIVersions(minor int) chartutil.VersionSet {
+	removed := make(map[string]struct{})
+	lastRemoval := make(map[string]int)
+	for _, removedAPI := range RemovedAPIs {
+		if removedAPI.RemovedIn <= minor {
+			removed[removedAPI.APIVersion+"/"+removedAPI.Kind] = struct{}{}
+		}
+		if removedAPI.RemovedIn > lastRemoval[removedAPI.APIVersion] {
+			lastRemoval[removedAPI.APIVersion] = removedAPI.RemovedIn
+		}
+	}
+	for apiVersion, removedIn := range lastRemoval {
+		if removedIn <= minor {
+			removed[apiVersion] = struct{}{}
+		}
+	}
+
+	served := make(chartutil.VersionSet, 0, len(chartutil.DefaultVersionSet))
+	for _, apiVersion := range chartutil.DefaultVersionSet {
+		if _, ok := removed[apiVersion]; !ok {
+			served = append(served, apiVersion)
+		}
+	}
+	// templates commonly check for a kind with
+	// .Capabilities.APIVersions.Has "<group>/<version>/<kind>"
+	for _, removedAPI := range RemovedAPIs {
+		if removedAPI.RemovedIn > minor {
+			served = append(served, removedAPI.APIVersion+"/"+removedAPI.Kind)
+		}
+		if strings.Contains(removedAPI.Replacement, "/") && !served.Has(removedAPI.Replacement+"/"+removedAPI.Kind) {
+			served = append(served, removedAPI.Replacement+"/"+removedAPI.Kind)
+		}
+	}
+
+	return served
+}
+
+// Returns the uses of APIs removed by 1.minor in the manifests of a
+// rendered template
+func removedAPIsIn(template, content string, minor int) []RemovedAPIUsage {
+	if ext := path.Ext(template); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+		return nil
+	}
+
+	var usages []RemovedAPIUsage
+	for _, manifest := range releaseutil.SplitManifests(content) {
+		var typeMeta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest), &typeMeta); err != nil {
+			continue
+		}
+		for _, removedAPI := range RemovedAPIs {
+			if removedAPI.RemovedIn <= minor && removedAPI.APIVersion == typeMeta.APIVersion && removedAPI.Kind == typeMeta.Kind {
+				usages = append(usages, RemovedAPIUsage{Template: template, RemovedAPI: removedAPI})
+			}
+		}
+	}
+
+	return usages
+}
+
+func checkRemovedAPIs(ctx *Context) []error {
+	indexed := make(map[string]struct{})
+	if ctx.Index != nil {
+		for _, chartVersions := range ctx.Index.Entries {
+			for _, chartVersion := range chartVersions {
+				if len(chartVersion.URLs) > 0 {
+					indexed[chartVersion.URLs[0]] = struct{}{}
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, addedAsset := range ctx.AddedAssets {
+		assetPath := path.Join("assets", addedAsset)
+		if path.Ext(assetPath) != ".tgz" {
+			continue
+		}
+		if _, ok := indexed[assetPath]; ctx.Index != nil && !ok {
+			continue
+		}
+
+		helmChart, err := loader.Load(filepath.Join(ctx.RepoRoot, filepath.FromSlash(assetPath)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		usages, err := CheckRemovedAPIs(helmChart)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		for _, usage := range usages {
+			errs = append(errs, fmt.Errorf("%s: %s", assetPath, usage))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// AppVersionRegression returns a description of the regression if the
+// appVersion of current is lower than that of previous, the chart
+// version before it, or "" otherwise. AppVersions that are not semantic
+// versions can not be ordered and are never reported.
+func AppVersionRegression(previous, current *repo.ChartVersion) string {
+	if previous == nil || previous.Metadata == nil || current.Metadata == nil {
+		return ""
+	}
+	previousAppVersion, err := semver.NewVersion(previous.AppVersion)
+	if err != nil {
+		return ""
+	}
+	currentAppVersion, err := semver.NewVersion(current.AppVersion)
+	if err != nil {
+		return ""
+	}
+	if !currentAppVersion.LessThan(previousAppVersion) {
+		return ""
+	}
+
+	return fmt.Sprintf("appVersion %s is lower than appVersion %s of %s", current.AppVersion, previous.AppVersion, previous.Version)
+}
+
+// Compares the appVersion of every chart version added since the
+// released repository to that of the previous version of the chart in
+// the index
+func checkAppVersions(ctx *Context) []error {
+	if ctx.Index == nil || len(ctx.AddedAssets) == 0 {
+		return nil
+	}
+
+	added := make(map[string]struct{}, len(ctx.AddedAssets))
+	for _, addedAsset := range ctx.AddedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		chartVersions := ctx.Index.Entries[chartName]
+		for i, chartVersion := range chartVersions {
+			if i+1 >= len(chartVersions) || len(chartVersion.URLs) == 0 {
+				continue
+			}
+			if _, ok := added[chartVersion.URLs[0]]; !ok {
+				continue
+			}
+			if regression := AppVersionRegression(chartVersions[i+1], chartVersion); regression != "" {
+				errs = append(errs, fmt.Errorf("%s %s: %s", chartName, chartVersion.Version, regression))
+			}
+		}
+	}
+
+	return errs
+}
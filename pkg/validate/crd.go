@@ -0,0 +1,51 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const annotationAutoInstall = "catalog.cattle.io/auto-install"
+
+// CheckCRDChartVersions verifies that CRD charts and their parent
+// charts stay version-aligned. Every chart version that auto-installs
+// another chart with "=match" must have that chart at the same version,
+// and every version of a "-crd" chart must have a matching parent.
+func CheckCRDChartVersions(indexFile *repo.IndexFile) []error {
+	var errs []error
+	matchedCRDVersions := make(map[string]map[string]struct{})
+
+	for _, entries := range indexFile.Entries {
+		for _, chartVersion := range entries {
+			autoInstall, ok := chartVersion.Annotations[annotationAutoInstall]
+			if !ok || !strings.HasSuffix(autoInstall, "=match") {
+				continue
+			}
+			crdChartName := strings.TrimSuffix(autoInstall, "=match")
+			if _, err := indexFile.Get(crdChartName, chartVersion.Version); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s auto-installs %s %s which is not in the index", chartVersion.Name, chartVersion.Version, crdChartName, chartVersion.Version))
+				continue
+			}
+			if _, ok := matchedCRDVersions[crdChartName]; !ok {
+				matchedCRDVersions[crdChartName] = make(map[string]struct{})
+			}
+			matchedCRDVersions[crdChartName][chartVersion.Version] = struct{}{}
+		}
+	}
+
+	for crdChartName, entries := range indexFile.Entries {
+		parentName := strings.TrimSuffix(crdChartName, "-crd")
+		if _, ok := indexFile.Entries[parentName]; !ok || parentName == crdChartName {
+			continue
+		}
+		for _, chartVersion := range entries {
+			if _, ok := matchedCRDVersions[crdChartName][chartVersion.Version]; !ok {
+				errs = append(errs, fmt.Errorf("%s %s has no matching version of parent chart %s", crdChartName, chartVersion.Version, parentName))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// MaxDescriptionLength is the longest chart description the Rancher UI
+// shows in full on a chart card
+const MaxDescriptionLength = 300
+
+// CheckDescriptions verifies that the latest version of every chart
+// shown in the Rancher UI has a non-empty description no longer than
+// MaxDescriptionLength
+func CheckDescriptions(indexFile *repo.IndexFile) []error {
+	chartNames := make([]string, 0, len(indexFile.Entries))
+	for chartName := range indexFile.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		entries := indexFile.Entries[chartName]
+		if len(entries) == 0 || entries[0].Annotations[annotationHidden] == "true" {
+			continue
+		}
+		latest := entries[0]
+
+		description := strings.TrimSpace(latest.Description)
+		switch {
+		case description == "":
+			errs = append(errs, fmt.Errorf("%s %s has an empty description; set DescriptionOverride in upstream.yaml", chartName, latest.Version))
+		case len(description) > MaxDescriptionLength:
+			errs = append(errs, fmt.Errorf("%s %s description is %d characters, longer than %d", chartName, latest.Version, len(description), MaxDescriptionLength))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,117 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	annotationDisplayName = "catalog.cattle.io/display-name"
+	annotationHidden      = "catalog.cattle.io/hidden"
+	//MaxDisplayNameLength is the longest display name the Rancher UI renders well
+	MaxDisplayNameLength = 64
+)
+
+// CheckDisplayNames verifies that the latest version of every chart
+// shown in the Rancher UI has a display name that is non-empty and not
+// used by any other chart. Display names of versions among addedAssets,
+// relative to the assets directory, must also be no longer than
+// MaxDisplayNameLength; released versions are left to
+// CheckReleasedDisplayNameLengths.
+func CheckDisplayNames(indexFile *repo.IndexFile, addedAssets []string) []error {
+	added := addedAssetPaths(addedAssets)
+
+	var errs []error
+	displayNames := make(map[string]string)
+	for _, chartName := range sortedChartNames(indexFile) {
+		latest, ok := latestVisible(indexFile, chartName)
+		if !ok {
+			continue
+		}
+
+		displayName, ok := latest.Annotations[annotationDisplayName]
+		displayName = strings.TrimSpace(displayName)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s %s has no %s annotation", chartName, latest.Version, annotationDisplayName))
+			continue
+		case displayName == "":
+			errs = append(errs, fmt.Errorf("%s %s has an empty %s annotation", chartName, latest.Version, annotationDisplayName))
+			continue
+		case len(displayName) > MaxDisplayNameLength && isAdded(latest, added):
+			errs = append(errs, fmt.Errorf("%s %s display name %q is longer than %d characters", chartName, latest.Version, displayName, MaxDisplayNameLength))
+		}
+
+		key := strings.ToLower(displayName)
+		if otherChart, ok := displayNames[key]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s share display name %q", otherChart, chartName, displayName))
+			continue
+		}
+		displayNames[key] = chartName
+	}
+
+	return errs
+}
+
+// CheckReleasedDisplayNameLengths reports the charts whose latest
+// version, already released as it is not among addedAssets, has a
+// display name longer than MaxDisplayNameLength
+func CheckReleasedDisplayNameLengths(indexFile *repo.IndexFile, addedAssets []string) []error {
+	added := addedAssetPaths(addedAssets)
+
+	var errs []error
+	for _, chartName := range sortedChartNames(indexFile) {
+		latest, ok := latestVisible(indexFile, chartName)
+		if !ok || isAdded(latest, added) {
+			continue
+		}
+		displayName := strings.TrimSpace(latest.Annotations[annotationDisplayName])
+		if len(displayName) > MaxDisplayNameLength {
+			errs = append(errs, fmt.Errorf("%s %s display name %q is longer than %d characters", chartName, latest.Version, displayName, MaxDisplayNameLength))
+		}
+	}
+
+	return errs
+}
+
+func sortedChartNames(indexFile *repo.IndexFile) []string {
+	chartNames := make([]string, 0, len(indexFile.Entries))
+	for chartName := range indexFile.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	return chartNames
+}
+
+// Returns the latest version of chartName, unless it is hidden
+func latestVisible(indexFile *repo.IndexFile, chartName string) (*repo.ChartVersion, bool) {
+	entries := indexFile.Entries[chartName]
+	if len(entries) == 0 || entries[0].Annotations[annotationHidden] == "true" {
+		return nil, false
+	}
+
+	return entries[0], true
+}
+
+func addedAssetPaths(addedAssets []string) map[string]struct{} {
+	added := make(map[string]struct{}, len(addedAssets))
+	for _, addedAsset := range addedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	return added
+}
+
+func isAdded(chartVersion *repo.ChartVersion, added map[string]struct{}) bool {
+	if len(chartVersion.URLs) == 0 {
+		return false
+	}
+	_, ok := added[chartVersion.URLs[0]]
+
+	return ok
+}
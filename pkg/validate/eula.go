@@ -0,0 +1,49 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+)
+
+// packagesDir is the directory of the package configurations, with a
+// vendor.yaml in each vendor directory
+const packagesDir = "packages"
+
+// Checks the EULA declared in the upstream.yaml of every package: a
+// required EULA needs a URL, the URL must be http(s), and packages of
+// vendors whose vendor.yaml sets EULARequired must declare both
+func checkEULA(ctx *Context) []error {
+	var errs []error
+	vendorRequires := make(map[string]bool)
+	for _, packageName := range sortedPackageNames(ctx.Packages) {
+		upstreamYaml := ctx.Packages[packageName]
+		if upstreamYaml.EULAUrl != "" {
+			if eulaURL, err := url.Parse(upstreamYaml.EULAUrl); err != nil || (eulaURL.Scheme != "http" && eulaURL.Scheme != "https") || eulaURL.Host == "" {
+				errs = append(errs, fmt.Errorf("%s: EULAURL %q is not an http(s) URL", packageName, upstreamYaml.EULAUrl))
+			}
+		} else if upstreamYaml.EULARequired {
+			errs = append(errs, fmt.Errorf("%s: EULARequired is set without EULAURL", packageName))
+		}
+
+		vendor := strings.SplitN(packageName, "/", 2)[0]
+		required, ok := vendorRequires[vendor]
+		if !ok {
+			vendorYaml, err := parse.ParseVendorYaml(filepath.Join(ctx.RepoRoot, packagesDir, vendor))
+			if err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("%s: failed to parse %s: %w", vendor, parse.VendorOptionsFile, err))
+			}
+			required = vendorYaml.EULARequired
+			vendorRequires[vendor] = required
+		}
+		if required && (!upstreamYaml.EULARequired || upstreamYaml.EULAUrl == "") {
+			errs = append(errs, fmt.Errorf("%s: vendor %s requires an EULA; set EULARequired and EULAURL", packageName, vendor))
+		}
+	}
+
+	return errs
+}
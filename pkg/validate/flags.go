@@ -0,0 +1,119 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FlagHidden is the hidden state, set by Hidden in upstream.yaml
+	FlagHidden = "Hidden"
+	// FlagDeprecated is the deprecated state, set by
+	// ChartMetadata.deprecated in upstream.yaml
+	FlagDeprecated = "Deprecated"
+)
+
+// FlagDrift is a stored artifact of a package whose hidden or
+// deprecated state differs from its upstream.yaml
+type FlagDrift struct {
+	Package  string
+	Chart    string
+	Version  string
+	Artifact string
+	Flag     string
+	Expected bool
+}
+
+func (d FlagDrift) String() string {
+	setting := d.Flag
+	if d.Flag == FlagDeprecated {
+		setting = "ChartMetadata.deprecated"
+	}
+	if d.Expected {
+		return fmt.Sprintf("%s: %s %s %s is not %s, but upstream.yaml sets %s", d.Package, d.Artifact, d.Chart, d.Version, strings.ToLower(d.Flag), setting)
+	}
+
+	return fmt.Sprintf("%s: %s %s %s is %s, but upstream.yaml does not set %s", d.Package, d.Artifact, d.Chart, d.Version, strings.ToLower(d.Flag), setting)
+}
+
+// CheckFlagConsistency compares the hidden and deprecated state of the
+// latest stored version of every package, in index.yaml and in its
+// Chart.yaml under the charts directory, to the Hidden and
+// ChartMetadata.deprecated settings of its upstream.yaml
+func CheckFlagConsistency(ctx *Context) ([]FlagDrift, error) {
+	drift := make([]FlagDrift, 0)
+	for _, packageName := range sortedPackageNames(ctx.Packages) {
+		upstreamYaml := ctx.Packages[packageName]
+		chartName := upstreamYaml.ChartName(packageName)
+		chartVersions := ctx.Index.Entries[chartName]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		latest := chartVersions[0]
+
+		expected := map[string]bool{
+			FlagHidden:     upstreamYaml.Hidden,
+			FlagDeprecated: upstreamYaml.ChartYaml.Deprecated,
+		}
+		compare := func(artifact string, annotations map[string]string, deprecated bool) {
+			actual := map[string]bool{
+				FlagHidden:     annotations[annotationHidden] == "true",
+				FlagDeprecated: deprecated,
+			}
+			for _, flag := range []string{FlagHidden, FlagDeprecated} {
+				if actual[flag] != expected[flag] {
+					drift = append(drift, FlagDrift{
+						Package:  packageName,
+						Chart:    chartName,
+						Version:  latest.Version,
+						Artifact: artifact,
+						Flag:     flag,
+						Expected: expected[flag],
+					})
+				}
+			}
+		}
+		compare("index.yaml", latest.Annotations, latest.Deprecated)
+
+		if len(latest.URLs) == 0 || !strings.HasPrefix(latest.URLs[0], "assets/") {
+			continue
+		}
+		vendor := path.Base(path.Dir(latest.URLs[0]))
+		chartYamlPath := filepath.Join(ctx.RepoRoot, "charts", vendor, chartName, "Chart.yaml")
+		data, err := os.ReadFile(chartYamlPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		metadata := chart.Metadata{}
+		if err := yaml.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", chartYamlPath, err)
+		}
+		if metadata.Version != latest.Version {
+			continue
+		}
+		compare(path.Join("charts", vendor, chartName, "Chart.yaml"), metadata.Annotations, metadata.Deprecated)
+	}
+
+	return drift, nil
+}
+
+func checkFlagConsistency(ctx *Context) []error {
+	drift, err := CheckFlagConsistency(ctx)
+	if err != nil {
+		return []error{err}
+	}
+	errs := make([]error, 0, len(drift))
+	for _, d := range drift {
+		errs = append(errs, fmt.Errorf("%s; run reconcile-flags to update the stored charts", d))
+	}
+
+	return errs
+}
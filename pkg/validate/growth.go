@@ -0,0 +1,196 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/releaseutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultMaxGrowth is the default of GrowthOptions.MaxRatio
+const defaultMaxGrowth = 10
+
+// GrowthOptions configures the chart-growth rule. A chart version is
+// flagged if its archive size, template count or rendered object count
+// is at least MaxRatio times that of the previous version.
+type GrowthOptions struct {
+	MaxRatio float64
+}
+
+// GetMaxRatio returns MaxRatio, or its default of 10
+func (options GrowthOptions) GetMaxRatio() float64 {
+	if options.MaxRatio <= 1 {
+		return defaultMaxGrowth
+	}
+
+	return options.MaxRatio
+}
+
+// ChartSize measures the size and complexity of a chart version. A
+// negative Objects means the chart could not be rendered.
+type ChartSize struct {
+	Bytes     int64
+	Templates int
+	Objects   int
+}
+
+// MeasureChart returns the size of the chart archive at archivePath
+func MeasureChart(archivePath string) (ChartSize, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return ChartSize{}, err
+	}
+	helmChart, err := loader.Load(archivePath)
+	if err != nil {
+		return ChartSize{}, err
+	}
+
+	size := ChartSize{
+		Bytes:     info.Size(),
+		Templates: countTemplates(helmChart),
+		Objects:   -1,
+	}
+	if objects, err := countObjects(helmChart); err == nil {
+		size.Objects = objects
+	} else {
+		logrus.Debugf("Not counting objects of %s: %s\n", archivePath, err)
+	}
+
+	return size, nil
+}
+
+// Counts the templates of helmChart and its dependencies
+func countTemplates(helmChart *chart.Chart) int {
+	count := len(helmChart.Templates)
+	for _, dependency := range helmChart.Dependencies() {
+		count += countTemplates(dependency)
+	}
+
+	return count
+}
+
+// Counts the Kubernetes objects rendered from helmChart with its default
+// values, including CRDs
+func countObjects(helmChart *chart.Chart) (int, error) {
+	minor, err := defaultKubeMinor()
+	if err != nil {
+		return 0, err
+	}
+	manifests, err := renderManifests(helmChart, chartutil.Values{}, minor)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for template, content := range manifests {
+		if ext := path.Ext(template); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		for _, manifest := range releaseutil.SplitManifests(content) {
+			var typeMeta struct {
+				Kind string `json:"kind"`
+			}
+			if err := yaml.Unmarshal([]byte(manifest), &typeMeta); err == nil && typeMeta.Kind != "" {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// Returns the Kubernetes minor version charts are rendered for when no
+// specific version is needed
+func defaultKubeMinor() (int, error) {
+	return strconv.Atoi(strings.TrimSuffix(chartutil.DefaultCapabilities.KubeVersion.Minor, "+"))
+}
+
+// Returns a description of every measure of current that is at least
+// maxRatio times that of previous
+func growthOf(previous, current ChartSize, maxRatio float64) []string {
+	var jumps []string
+	check := func(name string, before, after float64) {
+		if before > 0 && after/before >= maxRatio {
+			jumps = append(jumps, fmt.Sprintf("%s grew %.1fx (%.0f to %.0f)", name, after/before, before, after))
+		}
+	}
+	check("archive size", float64(previous.Bytes), float64(current.Bytes))
+	check("template count", float64(previous.Templates), float64(current.Templates))
+	if previous.Objects >= 0 && current.Objects >= 0 {
+		check("rendered object count", float64(previous.Objects), float64(current.Objects))
+	}
+
+	return jumps
+}
+
+func (s ChartSize) String() string {
+	objects := "not rendered"
+	if s.Objects >= 0 {
+		objects = strconv.Itoa(s.Objects)
+	}
+
+	return fmt.Sprintf("%d bytes, %d templates, %s objects", s.Bytes, s.Templates, objects)
+}
+
+// Compares every chart version added since the released repository to
+// the previous version of the chart in the index
+func checkChartGrowth(ctx *Context) []error {
+	if ctx.Index == nil || len(ctx.AddedAssets) == 0 {
+		return nil
+	}
+	maxRatio := ctx.Config.Growth.GetMaxRatio()
+
+	added := make(map[string]struct{}, len(ctx.AddedAssets))
+	for _, addedAsset := range ctx.AddedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		chartVersions := ctx.Index.Entries[chartName]
+		for i, chartVersion := range chartVersions {
+			if i+1 >= len(chartVersions) || len(chartVersion.URLs) == 0 || len(chartVersions[i+1].URLs) == 0 {
+				continue
+			}
+			if _, ok := added[chartVersion.URLs[0]]; !ok {
+				continue
+			}
+			previousVersion := chartVersions[i+1]
+
+			current, err := MeasureChart(filepath.Join(ctx.RepoRoot, filepath.FromSlash(chartVersion.URLs[0])))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", chartVersion.URLs[0], err))
+				continue
+			}
+			previous, err := MeasureChart(filepath.Join(ctx.RepoRoot, filepath.FromSlash(previousVersion.URLs[0])))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", previousVersion.URLs[0], err))
+				continue
+			}
+			logrus.Infof("%s %s: %s (%s: %s)", chartName, chartVersion.Version, current, previousVersion.Version, previous)
+
+			for _, jump := range growthOf(previous, current, maxRatio) {
+				errs = append(errs, fmt.Errorf("%s %s: %s since %s", chartName, chartVersion.Version, jump, previousVersion.Version))
+			}
+		}
+	}
+
+	return errs
+}
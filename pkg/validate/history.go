@@ -0,0 +1,167 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rancher/partner-charts-ci/pkg/checksums"
+	"github.com/sirupsen/logrus"
+)
+
+// RewrittenAsset is a file whose content was changed after the commit
+// that first introduced it
+type RewrittenAsset struct {
+	Path        string
+	FirstCommit string
+	Commit      string
+}
+
+func (r RewrittenAsset) String() string {
+	return fmt.Sprintf("%s: introduced in %s, changed in %s", r.Path, r.FirstCommit, r.Commit)
+}
+
+// CheckAssetHistory walks the history of the repository at repoPath,
+// oldest commit first, and returns every file under assetsDir whose
+// content differs from the content it was first introduced with.
+// Deletions are ignored, as is re-adding a file with its original
+// content. Merge commits are compared against their first parent.
+func CheckAssetHistory(repoPath, assetsDir string) ([]RewrittenAsset, error) {
+	type introduction struct {
+		commit string
+		hash   plumbing.Hash
+	}
+	introduced := make(map[string]introduction)
+	reported := make(map[string]map[plumbing.Hash]struct{})
+	rewritten := make([]RewrittenAsset, 0)
+
+	err := forEachAssetChange(repoPath, assetsDir, func(c *object.Commit, filePath string, hash plumbing.Hash) {
+		first, ok := introduced[filePath]
+		if !ok {
+			introduced[filePath] = introduction{commit: c.Hash.String(), hash: hash}
+			return
+		}
+		if first.hash == hash {
+			return
+		}
+		if _, ok := reported[filePath][hash]; ok {
+			return
+		}
+		if reported[filePath] == nil {
+			reported[filePath] = make(map[plumbing.Hash]struct{})
+		}
+		reported[filePath][hash] = struct{}{}
+
+		logrus.Debugf("%s changed in %s\n", filePath, c.Hash)
+		rewritten = append(rewritten, RewrittenAsset{
+			Path:        filePath,
+			FirstCommit: first.commit,
+			Commit:      c.Hash.String(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rewritten, nil
+}
+
+// AssetIntroductionTimes walks the history of the repository at
+// repoPath and returns the commit time of the commit that first
+// introduced each file under assetsDir, keyed by its path relative to
+// the repository root
+func AssetIntroductionTimes(repoPath, assetsDir string) (map[string]time.Time, error) {
+	introduced := make(map[string]time.Time)
+	err := forEachAssetChange(repoPath, assetsDir, func(c *object.Commit, filePath string, hash plumbing.Hash) {
+		if _, ok := introduced[filePath]; !ok {
+			introduced[filePath] = c.Committer.When
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return introduced, nil
+}
+
+// Calls fn for every file added or modified under assetsDir in the
+// history of the repository at repoPath, oldest commit first. Merge
+// commits are compared against their first parent.
+func forEachAssetChange(repoPath, assetsDir string, fn func(c *object.Commit, filePath string, hash plumbing.Hash)) error {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	commitIter, err := r.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return err
+	}
+	commits := make([]*object.Commit, 0)
+	err = commitIter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		assetsTree, err := subtree(c, assetsDir)
+		if err != nil {
+			return err
+		}
+		var parentTree *object.Tree
+		if c.NumParents() > 0 {
+			parent, err := c.Parent(0)
+			if err != nil {
+				return err
+			}
+			parentTree, err = subtree(parent, assetsDir)
+			if err != nil {
+				return err
+			}
+		}
+		if assetsTree == nil && parentTree == nil {
+			continue
+		}
+
+		changes, err := object.DiffTree(parentTree, assetsTree)
+		if err != nil {
+			return fmt.Errorf("failed to diff commit %s: %w", c.Hash, err)
+		}
+
+		for _, change := range changes {
+			// checksum manifests are rewritten whenever assets change
+			if change.To.Name == "" || path.Base(change.To.Name) == checksums.File {
+				continue
+			}
+			fn(c, path.Join(assetsDir, change.To.Name), change.To.TreeEntry.Hash)
+		}
+	}
+
+	return nil
+}
+
+// Returns the tree at dirPath in commit c, or nil if it does not exist
+func subtree(c *object.Commit, dirPath string) (*object.Tree, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	dirTree, err := tree.Tree(dirPath)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	}
+
+	return dirTree, err
+}
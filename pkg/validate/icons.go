@@ -0,0 +1,169 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	//iconsDir is the directory of downloaded icons, relative to the
+	//repository root
+	iconsDir   = "assets/icons"
+	fileScheme = "file://"
+	//embeddedIconPrefix marks icons stored inside the chart archive
+	embeddedIconPrefix = "files/"
+)
+
+// formats of the raster images decoded by image.DecodeConfig, keyed
+// by the extensions they may be stored with
+var iconFormats = map[string]string{
+	".png":  "png",
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".gif":  "gif",
+}
+
+// CheckIconFile returns an error if data is not an image of the format
+// named by the extension of filename
+func CheckIconFile(filename string, data []byte) error {
+	ext := strings.ToLower(path.Ext(filename))
+	switch ext {
+	case ".svg":
+		return checkSVG(data)
+	case ".ico":
+		if len(data) < 6 || !bytes.Equal(data[:4], []byte{0, 0, 1, 0}) {
+			return errors.New("not a valid ICO image")
+		}
+		return nil
+	}
+
+	expected, ok := iconFormats[ext]
+	if !ok {
+		return fmt.Errorf("unsupported icon extension %q", ext)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("not a valid %s image: %w", expected, err)
+	}
+	if format != expected {
+		return fmt.Errorf("is a %s image, not %s", format, expected)
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return errors.New("image has no pixels")
+	}
+
+	return nil
+}
+
+// Returns an error unless the root element of data is <svg>
+func checkSVG(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return errors.New("not a valid SVG image: no root element")
+		}
+		if err != nil {
+			return fmt.Errorf("not a valid SVG image: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local != "svg" {
+				return fmt.Errorf("not a valid SVG image: root element is <%s>", start.Name.Local)
+			}
+			return nil
+		}
+	}
+}
+
+func checkIcons(ctx *Context) []error {
+	var errs []error
+	iconsPath := filepath.Join(ctx.RepoRoot, filepath.FromSlash(iconsDir))
+
+	entries, err := os.ReadDir(iconsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return []error{err}
+	}
+
+	// icon files of the same chart, keyed by their name without
+	// extension, must not disagree
+	contents := make(map[string]map[string][]byte)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		iconPath := path.Join(iconsDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(iconsPath, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := CheckIconFile(entry.Name(), data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", iconPath, err))
+		}
+		stem := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		if contents[stem] == nil {
+			contents[stem] = make(map[string][]byte)
+		}
+		contents[stem][iconPath] = data
+	}
+	stems := make([]string, 0, len(contents))
+	for stem := range contents {
+		stems = append(stems, stem)
+	}
+	sort.Strings(stems)
+	for _, stem := range stems {
+		iconPaths := make([]string, 0, len(contents[stem]))
+		for iconPath := range contents[stem] {
+			iconPaths = append(iconPaths, iconPath)
+		}
+		sort.Strings(iconPaths)
+		for _, iconPath := range iconPaths[1:] {
+			if !bytes.Equal(contents[stem][iconPaths[0]], contents[stem][iconPath]) {
+				errs = append(errs, fmt.Errorf("%s and %s claim the icon of %s with different content", iconPaths[0], iconPath, stem))
+			}
+		}
+	}
+
+	if ctx.Index == nil {
+		return errs
+	}
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+	for _, chartName := range chartNames {
+		missing := make(map[string]struct{})
+		for _, chartVersion := range ctx.Index.Entries[chartName] {
+			icon := chartVersion.Icon
+			if !strings.HasPrefix(icon, fileScheme) {
+				continue
+			}
+			iconPath := strings.TrimPrefix(icon, fileScheme)
+			if strings.HasPrefix(iconPath, embeddedIconPrefix) {
+				continue
+			}
+			if _, ok := missing[iconPath]; ok {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(ctx.RepoRoot, filepath.FromSlash(iconPath))); err != nil {
+				missing[iconPath] = struct{}{}
+				errs = append(errs, fmt.Errorf("%s: icon %s does not exist", chartName, icon))
+			}
+		}
+	}
+
+	return errs
+}
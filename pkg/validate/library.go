@@ -0,0 +1,36 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// chartTypeLibrary is the Chart.yaml type of charts that provide
+// templates to other charts and can not be installed on their own
+const chartTypeLibrary = "library"
+
+// CheckLibraryCharts verifies that every library chart version in the
+// index is hidden, since installing one from the Rancher UI fails
+func CheckLibraryCharts(indexFile *repo.IndexFile) []error {
+	chartNames := make([]string, 0, len(indexFile.Entries))
+	for chartName := range indexFile.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		for _, chartVersion := range indexFile.Entries[chartName] {
+			if chartVersion.Metadata == nil || chartVersion.Type != chartTypeLibrary {
+				continue
+			}
+			if chartVersion.Annotations[annotationHidden] != "true" {
+				errs = append(errs, fmt.Errorf("%s %s is a library chart and must have the %s annotation", chartName, chartVersion.Version, annotationHidden))
+			}
+		}
+	}
+
+	return errs
+}
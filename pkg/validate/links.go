@@ -0,0 +1,168 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// linkTimeout bounds each request of the dead-links rule
+const linkTimeout = 30 * time.Second
+
+// LinkOptions configures the dead-links rule
+type LinkOptions struct {
+	// Enabled runs the rule, which is off by default as it makes a
+	// request for every link of every new chart version
+	Enabled bool
+	// Ignore are URL prefixes that are never checked, for hosts that
+	// reject automated requests
+	Ignore []string
+}
+
+// Link is a URL found in a chart version, with the field it was found
+// in
+type Link struct {
+	Field string
+	URL   string
+}
+
+// ChartLinks returns the http(s) links of chartVersion: its home,
+// sources and icon, and the annotations whose value is a URL, such as
+// the EULA. Icons downloaded or embedded by partner-charts-ci are
+// file:// URLs, so only upstream icon URLs are returned.
+func ChartLinks(chartVersion *repo.ChartVersion) []Link {
+	if chartVersion.Metadata == nil {
+		return nil
+	}
+
+	links := make([]Link, 0)
+	add := func(field, value string) {
+		if isHTTPURL(value) {
+			links = append(links, Link{Field: field, URL: value})
+		}
+	}
+	add("home", chartVersion.Home)
+	for _, source := range chartVersion.Sources {
+		add("sources", source)
+	}
+	add("icon", chartVersion.Icon)
+	annotations := make([]string, 0, len(chartVersion.Annotations))
+	for annotation := range chartVersion.Annotations {
+		annotations = append(annotations, annotation)
+	}
+	sort.Strings(annotations)
+	for _, annotation := range annotations {
+		add(annotation, chartVersion.Annotations[annotation])
+	}
+
+	return links
+}
+
+// CheckLink returns an error if target can not be reached or answers
+// with a client or server error. Servers that do not support HEAD
+// requests are asked again with GET.
+func CheckLink(target string) error {
+	status, err := requestLink(http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusForbidden || status == http.StatusNotImplemented) {
+		status, err = requestLink(http.MethodGet, target)
+	}
+	if err != nil {
+		return err
+	}
+	// rate limited links are alive
+	if status >= http.StatusBadRequest && status != http.StatusTooManyRequests {
+		return fmt.Errorf("returned status %d", status)
+	}
+
+	return nil
+}
+
+func requestLink(method, target string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), linkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := ratelimit.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// Checks the links of every chart version added since the released
+// repository, requesting each URL once
+func checkLinks(ctx *Context) []error {
+	if !ctx.Config.Links.Enabled || ctx.Index == nil || len(ctx.AddedAssets) == 0 {
+		return nil
+	}
+
+	added := make(map[string]struct{}, len(ctx.AddedAssets))
+	for _, addedAsset := range ctx.AddedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	checked := make(map[string]error)
+	for _, chartName := range chartNames {
+		for _, chartVersion := range ctx.Index.Entries[chartName] {
+			if len(chartVersion.URLs) == 0 {
+				continue
+			}
+			if _, ok := added[chartVersion.URLs[0]]; !ok {
+				continue
+			}
+			for _, link := range ChartLinks(chartVersion) {
+				if ignoredLink(link.URL, ctx.Config.Links.Ignore) {
+					continue
+				}
+				err, ok := checked[link.URL]
+				if !ok {
+					err = CheckLink(link.URL)
+					checked[link.URL] = err
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s %s: %s link %s is dead: %w", chartName, chartVersion.Version, link.Field, link.URL, err))
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func ignoredLink(link string, ignore []string) bool {
+	for _, prefix := range ignore {
+		if strings.HasPrefix(link, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
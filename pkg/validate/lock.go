@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// CheckDependencyLock compares the dependencies locked in the
+// Chart.lock of helmChart with the subcharts vendored in its charts
+// directory, returning a finding for each locked dependency that is
+// missing or vendored at another version, and for each subchart that
+// is not locked. Charts without a Chart.lock have nothing to check.
+func CheckDependencyLock(helmChart *chart.Chart) []string {
+	if helmChart.Lock == nil {
+		return nil
+	}
+
+	vendored := make(map[string]string)
+	for _, subchart := range helmChart.Dependencies() {
+		vendored[subchart.Name()] = subchart.Metadata.Version
+	}
+
+	findings := make([]string, 0)
+	locked := make(map[string]struct{}, len(helmChart.Lock.Dependencies))
+	for _, dependency := range helmChart.Lock.Dependencies {
+		locked[dependency.Name] = struct{}{}
+		version, ok := vendored[dependency.Name]
+		if !ok {
+			findings = append(findings, fmt.Sprintf("dependency %s %s is locked but not vendored under charts", dependency.Name, dependency.Version))
+		} else if version != dependency.Version {
+			findings = append(findings, fmt.Sprintf("dependency %s is locked at %s but vendored at %s", dependency.Name, dependency.Version, version))
+		}
+	}
+	names := make([]string, 0, len(vendored))
+	for name := range vendored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := locked[name]; !ok {
+			findings = append(findings, fmt.Sprintf("subchart %s %s is vendored under charts but not locked", name, vendored[name]))
+		}
+	}
+
+	return findings
+}
+
+// Checks the Chart.lock of the chart versions added since the released
+// repository against their vendored subcharts
+func checkDependencyLocks(ctx *Context) []error {
+	if ctx.Index == nil {
+		return nil
+	}
+	indexed := make(map[string]struct{})
+	for _, chartVersions := range ctx.Index.Entries {
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) > 0 {
+				indexed[chartVersion.URLs[0]] = struct{}{}
+			}
+		}
+	}
+
+	var errs []error
+	for _, addedAsset := range ctx.AddedAssets {
+		assetPath := path.Join("assets", addedAsset)
+		if _, ok := indexed[assetPath]; !ok {
+			continue
+		}
+
+		// a subchart truncated during fetch fails to load here
+		helmChart, err := loader.Load(filepath.Join(ctx.RepoRoot, filepath.FromSlash(assetPath)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		for _, finding := range CheckDependencyLock(helmChart) {
+			errs = append(errs, fmt.Errorf("%s: %s", assetPath, finding))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,175 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// namespaceAnnotation is the namespace that Rancher installs a chart
+	// into
+	namespaceAnnotation = "catalog.cattle.io/namespace"
+	// createNamespaceAnnotation makes Rancher create the namespace of
+	// namespaceAnnotation if it does not exist
+	createNamespaceAnnotation = "catalog.cattle.io/create-namespace"
+)
+
+// builtinNamespaces exist in every cluster, so charts installed into
+// them have no namespace to create
+var builtinNamespaces = map[string]struct{}{
+	"default":         {},
+	"kube-node-lease": {},
+	"kube-public":     {},
+	"kube-system":     {},
+}
+
+// DefaultReservedNamespaces are the namespaces of Kubernetes and
+// Rancher itself, which partner charts must not be installed into
+var DefaultReservedNamespaces = []string{"cattle-system", "fleet-system", "kube-system"}
+
+// NamespaceOptions configures the namespaces charts are installed into
+type NamespaceOptions struct {
+	// Reserved namespaces can not be the namespace of a chart, unless
+	// the package is exempted from the reserved-namespaces rule. Nil
+	// uses DefaultReservedNamespaces.
+	Reserved []string
+	// Default is the namespace of new chart versions that neither
+	// upstream.yaml nor the upstream chart gives one, with <vendor>
+	// and <chart> replaced by those of the package. Empty leaves them
+	// without a namespace.
+	Default string
+}
+
+// ReservedNamespaces returns the configured reserved namespaces, or
+// DefaultReservedNamespaces if none are configured
+func (o NamespaceOptions) ReservedNamespaces() []string {
+	if o.Reserved == nil {
+		return DefaultReservedNamespaces
+	}
+
+	return o.Reserved
+}
+
+// DefaultNamespace returns the default namespace of the chart of
+// vendor, or "" if there is none
+func (o NamespaceOptions) DefaultNamespace(vendor, chart string) string {
+	return strings.NewReplacer("<vendor>", vendor, "<chart>", chart).Replace(o.Default)
+}
+
+// Checks that neither the namespace of each package, from upstream.yaml
+// or the default namespace, nor the namespace annotation of the latest
+// version of each chart in the index is reserved
+func checkReservedNamespaces(ctx *Context) []error {
+	reserved := make(map[string]struct{})
+	for _, namespace := range ctx.Config.Namespaces.ReservedNamespaces() {
+		reserved[namespace] = struct{}{}
+	}
+
+	var errs []error
+	for _, packageName := range sortedPackageNames(ctx.Packages) {
+		namespace := ctx.Packages[packageName].Namespace
+		source := "Namespace"
+		if namespace == "" {
+			vendor, chart, _ := strings.Cut(packageName, "/")
+			namespace = ctx.Config.Namespaces.DefaultNamespace(vendor, chart)
+			source = "default namespace"
+		}
+		if _, ok := reserved[namespace]; ok {
+			errs = append(errs, fmt.Errorf("%s: %s %s is reserved", packageName, source, namespace))
+		}
+	}
+
+	if ctx.Index == nil {
+		return errs
+	}
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+	for _, chartName := range chartNames {
+		chartVersions := ctx.Index.Entries[chartName]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		latest := chartVersions[0]
+		namespace := latest.Annotations[namespaceAnnotation]
+		if _, ok := reserved[namespace]; ok {
+			errs = append(errs, fmt.Errorf("%s %s: %s %s is reserved", chartName, latest.Version, namespaceAnnotation, namespace))
+		}
+	}
+
+	return errs
+}
+
+// BuiltinNamespace returns true if namespace exists in every cluster
+func BuiltinNamespace(namespace string) bool {
+	_, ok := builtinNamespaces[namespace]
+
+	return ok
+}
+
+// CheckNamespaceCreation returns a finding if the annotations of a
+// chart version do not combine the namespace and namespace creation
+// annotations correctly: a chart installed into a namespace that is
+// not built into Kubernetes must have it created, and a chart without
+// a namespace has none to create.
+func CheckNamespaceCreation(annotations map[string]string) string {
+	namespace := annotations[namespaceAnnotation]
+	createNamespace := annotations[createNamespaceAnnotation] == "true"
+	if namespace == "" {
+		if createNamespace {
+			return fmt.Sprintf("%s is set without %s", createNamespaceAnnotation, namespaceAnnotation)
+		}
+		return ""
+	}
+	if BuiltinNamespace(namespace) {
+		if createNamespace {
+			return fmt.Sprintf("%s is set but namespace %s is built into Kubernetes", createNamespaceAnnotation, namespace)
+		}
+		return ""
+	}
+	if !createNamespace {
+		return fmt.Sprintf("installs into namespace %s without %s, which fails on clusters where it does not exist", namespace, createNamespaceAnnotation)
+	}
+
+	return ""
+}
+
+// Checks the namespace annotations of the chart versions added since
+// the released repository
+func checkNamespaceCreation(ctx *Context) []error {
+	if ctx.Index == nil || len(ctx.AddedAssets) == 0 {
+		return nil
+	}
+
+	added := make(map[string]struct{}, len(ctx.AddedAssets))
+	for _, addedAsset := range ctx.AddedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		for _, chartVersion := range ctx.Index.Entries[chartName] {
+			if len(chartVersion.URLs) == 0 {
+				continue
+			}
+			if _, ok := added[chartVersion.URLs[0]]; !ok {
+				continue
+			}
+			if finding := CheckNamespaceCreation(chartVersion.Annotations); finding != "" {
+				errs = append(errs, fmt.Errorf("%s %s: %s", chartName, chartVersion.Version, finding))
+			}
+		}
+	}
+
+	return errs
+}
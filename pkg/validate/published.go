@@ -0,0 +1,156 @@
+package validate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// Drift is a difference between the index.yaml of the repository and
+// its published copy
+type Drift struct {
+	Chart   string
+	Version string
+	Problem string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Chart, d.Version, d.Problem)
+}
+
+// CheckPublished downloads the index.yaml published at publishedURL and
+// compares its entries to those of localIndex. The archives of the
+// sample most recently created versions are downloaded as well, and
+// their digests compared to localIndex, to catch a stale CDN or assets
+// that were never uploaded.
+func CheckPublished(localIndex *repo.IndexFile, publishedURL string, sample int) ([]Drift, error) {
+	publishedURL = strings.TrimSuffix(publishedURL, "/")
+	indexURL := publishedURL + "/index.yaml"
+	indexData, status, err := httpGet(indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", indexURL, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", indexURL, status)
+	}
+	publishedIndex := repo.NewIndexFile()
+	if err := yaml.Unmarshal(indexData, publishedIndex); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", indexURL, err)
+	}
+
+	drift := make([]Drift, 0)
+	for chartName, chartVersions := range localIndex.Entries {
+		for _, chartVersion := range chartVersions {
+			publishedVersion, err := publishedIndex.Get(chartName, chartVersion.Version)
+			if err != nil {
+				drift = append(drift, Drift{Chart: chartName, Version: chartVersion.Version, Problem: "not in published index.yaml"})
+				continue
+			}
+			if publishedVersion.Digest != chartVersion.Digest {
+				drift = append(drift, Drift{
+					Chart:   chartName,
+					Version: chartVersion.Version,
+					Problem: fmt.Sprintf("published digest %s does not match %s", publishedVersion.Digest, chartVersion.Digest),
+				})
+			}
+		}
+	}
+	for chartName, chartVersions := range publishedIndex.Entries {
+		for _, chartVersion := range chartVersions {
+			if !localIndex.Has(chartName, chartVersion.Version) {
+				drift = append(drift, Drift{Chart: chartName, Version: chartVersion.Version, Problem: "published but not in index.yaml"})
+			}
+		}
+	}
+
+	for _, chartVersion := range newestVersions(localIndex, sample) {
+		if len(chartVersion.URLs) == 0 {
+			continue
+		}
+		assetURL, err := resolveAssetURL(publishedURL, chartVersion.URLs[0])
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Verifying published asset %s\n", assetURL)
+		data, status, err := httpGet(assetURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", assetURL, err)
+		}
+		switch {
+		case status == http.StatusNotFound:
+			drift = append(drift, Drift{Chart: chartVersion.Name, Version: chartVersion.Version, Problem: fmt.Sprintf("asset %s is missing", assetURL)})
+		case status != http.StatusOK:
+			drift = append(drift, Drift{Chart: chartVersion.Name, Version: chartVersion.Version, Problem: fmt.Sprintf("asset %s returned status %d", assetURL, status)})
+		default:
+			digest := sha256.Sum256(data)
+			if hex.EncodeToString(digest[:]) != chartVersion.Digest {
+				drift = append(drift, Drift{Chart: chartVersion.Name, Version: chartVersion.Version, Problem: fmt.Sprintf("asset %s does not match its digest", assetURL)})
+			}
+		}
+	}
+
+	sort.SliceStable(drift, func(i, j int) bool {
+		if drift[i].Chart != drift[j].Chart {
+			return drift[i].Chart < drift[j].Chart
+		}
+		return drift[i].Version < drift[j].Version
+	})
+
+	return drift, nil
+}
+
+// Returns the count most recently created versions of index
+func newestVersions(index *repo.IndexFile, count int) repo.ChartVersions {
+	all := make(repo.ChartVersions, 0)
+	for _, chartVersions := range index.Entries {
+		all = append(all, chartVersions...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Created.After(all[j].Created)
+	})
+	if count < len(all) {
+		all = all[:count]
+	}
+
+	return all
+}
+
+// Resolves an index.yaml URL, which is usually relative to the
+// repository root, against the published repository URL
+func resolveAssetURL(publishedURL, assetURL string) (string, error) {
+	base, err := url.Parse(publishedURL + "/")
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(assetURL)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+func httpGet(target string) ([]byte, int, error) {
+	resp, err := ratelimit.Client().Get(target)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+
+	return data, resp.StatusCode, err
+}
@@ -0,0 +1,156 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/releaseutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	//SystemDefaultRegistryValue is the value Rancher sets to the
+	//registry that charts must pull their images from
+	SystemDefaultRegistryValue = "global.cattle.systemDefaultRegistry"
+	//testRegistry is the registry charts are rendered with to check
+	//that they honor SystemDefaultRegistryValue
+	testRegistry = "system-default-registry.invalid"
+)
+
+// containerKeys are the fields of a pod spec that list containers
+var containerKeys = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// RegistryViolation is an image of a rendered manifest that is not
+// pulled from the system default registry
+type RegistryViolation struct {
+	Template string
+	Image    string
+}
+
+func (v RegistryViolation) String() string {
+	return fmt.Sprintf("%s: image %s ignores %s", v.Template, v.Image, SystemDefaultRegistryValue)
+}
+
+// CheckSystemDefaultRegistry renders helmChart with
+// global.cattle.systemDefaultRegistry set and returns the container
+// images of the rendered manifests that are not prefixed with it
+func CheckSystemDefaultRegistry(helmChart *chart.Chart) ([]RegistryViolation, error) {
+	minor, err := defaultKubeMinor()
+	if err != nil {
+		return nil, err
+	}
+	values := chartutil.Values{
+		"global": map[string]interface{}{
+			"cattle": map[string]interface{}{
+				"systemDefaultRegistry": testRegistry,
+			},
+		},
+	}
+	manifests, err := renderManifests(helmChart, values, minor)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := make([]RegistryViolation, 0)
+	for template, content := range manifests {
+		if ext := path.Ext(template); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		for _, manifest := range releaseutil.SplitManifests(content) {
+			var object map[string]interface{}
+			if err := yaml.Unmarshal([]byte(manifest), &object); err != nil {
+				continue
+			}
+			for _, image := range containerImages(object) {
+				if !strings.HasPrefix(image, testRegistry+"/") {
+					violations = append(violations, RegistryViolation{Template: template, Image: image})
+				}
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].String() < violations[j].String()
+	})
+
+	return violations, nil
+}
+
+// Returns the images of the containers found anywhere in value, which
+// covers pod templates of every workload kind
+func containerImages(value interface{}) []string {
+	var images []string
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			isContainerList := false
+			for _, containerKey := range containerKeys {
+				if key == containerKey {
+					isContainerList = true
+				}
+			}
+			containers, ok := child.([]interface{})
+			if !isContainerList || !ok {
+				images = append(images, containerImages(child)...)
+				continue
+			}
+			for _, container := range containers {
+				if fields, ok := container.(map[string]interface{}); ok {
+					if image, ok := fields["image"].(string); ok && image != "" {
+						images = append(images, image)
+					}
+				}
+			}
+		}
+	case []interface{}:
+		for _, child := range typed {
+			images = append(images, containerImages(child)...)
+		}
+	}
+
+	return images
+}
+
+func checkSystemDefaultRegistry(ctx *Context) []error {
+	if ctx.Index == nil {
+		return nil
+	}
+	indexed := make(map[string]struct{})
+	for _, chartVersions := range ctx.Index.Entries {
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) > 0 {
+				indexed[chartVersion.URLs[0]] = struct{}{}
+			}
+		}
+	}
+
+	var errs []error
+	for _, addedAsset := range ctx.AddedAssets {
+		assetPath := path.Join("assets", addedAsset)
+		if _, ok := indexed[assetPath]; !ok {
+			continue
+		}
+
+		helmChart, err := loader.Load(filepath.Join(ctx.RepoRoot, filepath.FromSlash(assetPath)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		violations, err := CheckSystemDefaultRegistry(helmChart)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		for _, violation := range violations {
+			errs = append(errs, fmt.Errorf("%s: %s", assetPath, violation))
+		}
+	}
+
+	return errs
+}
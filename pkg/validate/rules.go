@@ -0,0 +1,646 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rancher/partner-charts-ci/pkg/checksums"
+	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/rancher/partner-charts-ci/pkg/parse"
+	"github.com/rancher/partner-charts-ci/pkg/progress"
+	"github.com/rancher/partner-charts-ci/pkg/state"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Severity decides whether the findings of a rule fail validation
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule is a single named validation check
+type Rule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	Check       func(ctx *Context) []error
+	// Released rules check the changes since the released repository,
+	// which Run compares the repository with before the first of them
+	Released bool
+}
+
+// RuleOptions selects rules in configuration.yaml. Disabled rules are
+// never run, and Exemptions skips rules for single packages, keyed by
+// the <vendor>/<chart> package name.
+type RuleOptions struct {
+	Disabled   []string
+	Exemptions map[string][]string
+}
+
+// Context holds the repository state that rules check
+type Context struct {
+	RepoRoot string
+	Config   ConfigurationYaml
+	// Packages are the parsed upstream.yaml files keyed by package name
+	Packages map[string]parse.UpstreamYaml
+	// PackageErrors are the upstream.yaml files that failed to parse
+	PackageErrors map[string]error
+	Index         *repo.IndexFile
+	State         *state.State
+	Reporter      progress.Reporter
+	// FailFast stops validation at the first finding of a rule with
+	// SeverityError
+	FailFast bool
+	// AddedAssets is set by CompareReleased to the assets not present
+	// in the released repository, relative to the assets directory
+	AddedAssets []string
+	// Findings are set by Run to the findings of every rule run
+	Findings []Finding
+	// released is set by CompareReleased to the comparison of the
+	// assets directory with that of the released repository
+	released *DirectoryComparison
+}
+
+// Finding is a problem reported by a rule
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Path is the file the finding is about, relative to the
+	// repository root, if it names a package, an asset or a chart
+	// version in the index
+	Path string `json:"path,omitempty"`
+}
+
+// Rules is the catalog of all validation rules, in the order they run
+var Rules = []Rule{
+	{
+		ID:          "upstream-yaml",
+		Description: "upstream.yaml files can be parsed",
+		Severity:    SeverityError,
+		Check:       checkUpstreamYaml,
+	},
+	{
+		ID:          "upstream-annotations",
+		Description: "Annotations in upstream.yaml and defaultAnnotations in configuration.yaml use allowed prefixes and are not managed by partner-charts-ci",
+		Severity:    SeverityError,
+		Check:       checkUpstreamAnnotations,
+	},
+	{
+		ID:          "package-aliases",
+		Description: "Package aliases do not shadow existing packages and are claimed by one package only",
+		Severity:    SeverityError,
+		Check:       checkAliases,
+	},
+	{
+		ID:          "eula",
+		Description: "Declared EULAs have an http(s) URL, and packages of vendors requiring an EULA declare one",
+		Severity:    SeverityError,
+		Check:       checkEULA,
+	},
+	{
+		ID:          "unreachable-upstream",
+		Description: "Package upstreams have not been unreachable for longer than escalation.unreachableDays",
+		Severity:    SeverityWarning,
+		Check:       checkUnreachable,
+	},
+	{
+		ID:          "released-assets",
+		Description: "Assets released in the repository configured under validate are not modified",
+		Severity:    SeverityError,
+		Check:       checkReleasedAssets,
+		Released:    true,
+	},
+	{
+		ID:          "removed-apis",
+		Description: "Chart versions added since the released repository do not use Kubernetes APIs removed within their kube-version range",
+		Severity:    SeverityError,
+		Check:       checkRemovedAPIs,
+		Released:    true,
+	},
+	{
+		ID:          "strict-new-packages",
+		Description: "The latest version of charts added since the released repository passes the strict checks configured under strict",
+		Severity:    SeverityError,
+		Check:       checkStrictNewPackages,
+		Released:    true,
+	},
+	{
+		ID:          "chart-growth",
+		Description: "Chart versions added since the released repository have not grown suspiciously compared to the previous version",
+		Severity:    SeverityWarning,
+		Check:       checkChartGrowth,
+		Released:    true,
+	},
+	{
+		ID:          "app-version-order",
+		Description: "Chart versions added since the released repository do not have a lower appVersion than the previous version",
+		Severity:    SeverityWarning,
+		Check:       checkAppVersions,
+		Released:    true,
+	},
+	{
+		ID:          "dead-links",
+		Description: "The home, sources, icon and annotation URLs of chart versions added since the released repository can be reached",
+		Severity:    SeverityWarning,
+		Check:       checkLinks,
+		Released:    true,
+	},
+	{
+		ID:          "system-default-registry",
+		Description: "Chart versions added since the released repository prefix their images with " + SystemDefaultRegistryValue,
+		Severity:    SeverityWarning,
+		Check:       checkSystemDefaultRegistry,
+		Released:    true,
+	},
+	{
+		ID:          "dependency-lock",
+		Description: "Chart versions added since the released repository vendor exactly the subchart versions locked in their Chart.lock",
+		Severity:    SeverityError,
+		Check:       checkDependencyLocks,
+		Released:    true,
+	},
+	{
+		ID:          "reserved-namespaces",
+		Description: "Packages and the latest version of each chart do not use a reserved namespace",
+		Severity:    SeverityError,
+		Check:       checkReservedNamespaces,
+	},
+	{
+		ID:          "namespace-creation",
+		Description: "Chart versions added since the released repository that install into a custom namespace have it created",
+		Severity:    SeverityWarning,
+		Check:       checkNamespaceCreation,
+		Released:    true,
+	},
+	{
+		ID:          "crd-chart-versions",
+		Description: "CRD charts are version-aligned with their parent charts",
+		Severity:    SeverityError,
+		Check: func(ctx *Context) []error {
+			return CheckCRDChartVersions(ctx.Index)
+		},
+	},
+	{
+		ID:          "flag-consistency",
+		Description: "The hidden and deprecated state of the latest stored version of each package, in index.yaml and under charts, matches its upstream.yaml",
+		Severity:    SeverityWarning,
+		Check:       checkFlagConsistency,
+	},
+	{
+		ID:          "library-charts",
+		Description: "Library charts, which can not be installed, are hidden",
+		Severity:    SeverityError,
+		Check: func(ctx *Context) []error {
+			return CheckLibraryCharts(ctx.Index)
+		},
+	},
+	{
+		ID:          "icons",
+		Description: "Icon files are valid images, local icons referenced in the index exist, and icons of the same chart agree",
+		Severity:    SeverityError,
+		Check:       checkIcons,
+	},
+	{
+		ID:          "display-names",
+		Description: fmt.Sprintf("Visible charts have unique display names, of at most %d characters for chart versions added since the released repository", MaxDisplayNameLength),
+		Severity:    SeverityError,
+		Check: func(ctx *Context) []error {
+			return CheckDisplayNames(ctx.Index, ctx.AddedAssets)
+		},
+		Released: true,
+	},
+	{
+		ID:          "released-display-names",
+		Description: fmt.Sprintf("Released chart versions have display names of at most %d characters", MaxDisplayNameLength),
+		Severity:    SeverityWarning,
+		Check: func(ctx *Context) []error {
+			return CheckReleasedDisplayNameLengths(ctx.Index, ctx.AddedAssets)
+		},
+		Released: true,
+	},
+	{
+		ID:          "max-versions",
+		Description: "Charts have no more versions than maxVersions",
+		Severity:    SeverityError,
+		Check: func(ctx *Context) []error {
+			return CheckMaxVersions(ctx.Index, ctx.Config.MaxVersions)
+		},
+	},
+	{
+		ID:          "descriptions",
+		Description: fmt.Sprintf("Visible charts have a description of at most %d characters", MaxDescriptionLength),
+		Severity:    SeverityError,
+		Check: func(ctx *Context) []error {
+			return CheckDescriptions(ctx.Index)
+		},
+	},
+}
+
+// SelectRules returns the rules to run. If enabled is not empty, only
+// those rules run; otherwise every rule runs except those in disabled
+// and options.Disabled. Unknown rule IDs are an error.
+func SelectRules(enabled, disabled []string, options RuleOptions) ([]Rule, error) {
+	known := make(map[string]struct{}, len(Rules))
+	for _, rule := range Rules {
+		known[rule.ID] = struct{}{}
+	}
+	exempted := make([]string, 0)
+	for _, ruleIDs := range options.Exemptions {
+		exempted = append(exempted, ruleIDs...)
+	}
+	for _, ids := range [][]string{enabled, disabled, options.Disabled, exempted} {
+		for _, id := range ids {
+			if _, ok := known[id]; !ok {
+				return nil, fmt.Errorf("unknown validation rule %q", id)
+			}
+		}
+	}
+
+	skipped := make(map[string]struct{})
+	for _, id := range append(append([]string{}, disabled...), options.Disabled...) {
+		skipped[id] = struct{}{}
+	}
+	only := make(map[string]struct{})
+	for _, id := range enabled {
+		only[id] = struct{}{}
+	}
+
+	selected := make([]Rule, 0, len(Rules))
+	for _, rule := range Rules {
+		if len(only) > 0 {
+			if _, ok := only[rule.ID]; !ok {
+				continue
+			}
+		} else if _, ok := skipped[rule.ID]; ok {
+			continue
+		}
+		selected = append(selected, rule)
+	}
+
+	return selected, nil
+}
+
+// Run runs rules against ctx, skipping packages exempted from each rule
+// by options, and logs their findings. The repository is compared with
+// the released one before the first Released rule; if that fails, it is
+// an error and the Released rules are skipped. Returns the number of findings
+// of rules with SeverityError. With ctx.FailFast, returns after the
+// first such finding.
+func Run(rules []Rule, ctx *Context, options RuleOptions) int {
+	errorCount := 0
+	// records a finding and reports whether validation stops
+	report := func(ruleID string, severity Severity, finding error) bool {
+		ctx.Findings = append(ctx.Findings, Finding{
+			Rule:     ruleID,
+			Severity: severity,
+			Message:  finding.Error(),
+			Path:     ctx.findingPath(finding.Error()),
+		})
+		if severity == SeverityWarning {
+			logrus.Warnf("[%s] %s", ruleID, finding)
+			return false
+		}
+		logrus.Errorf("[%s] %s", ruleID, finding)
+		errorCount++
+		return ctx.FailFast
+	}
+
+	var releasedErr error
+	for _, rule := range rules {
+		if rule.Released && ctx.released == nil {
+			// the rules that need the comparison can not run without
+			// it, which fails validation whatever their severity
+			if releasedErr == nil {
+				releasedErr = ctx.CompareReleased()
+				if releasedErr != nil && report(rule.ID, SeverityError, releasedErr) {
+					return errorCount
+				}
+			}
+			if releasedErr != nil {
+				logrus.Warnf("[%s] skipped without a comparison with the released repository", rule.ID)
+				continue
+			}
+		}
+
+		logrus.Debugf("Running validation rule %s\n", rule.ID)
+		for _, finding := range rule.Check(ctx.without(exemptedPackages(rule.ID, options))) {
+			if report(rule.ID, rule.Severity, finding) {
+				return errorCount
+			}
+		}
+	}
+
+	return errorCount
+}
+
+// Returns the file that a finding message starts with, by naming it,
+// the package whose upstream.yaml it is about, or the chart version of
+// an asset in the index, or "" if it starts with none of them
+func (ctx *Context) findingPath(message string) string {
+	message = strings.TrimPrefix(message, "released file ")
+	message = strings.TrimPrefix(message, "new chart ")
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return ""
+	}
+	subject := strings.TrimRight(fields[0], ":;")
+	for _, prefix := range []string{"assets/", "charts/", "packages/"} {
+		if strings.HasPrefix(subject, prefix) {
+			return subject
+		}
+	}
+	_, parsed := ctx.Packages[subject]
+	_, failed := ctx.PackageErrors[subject]
+	if parsed || failed {
+		return path.Join("packages", subject, "upstream.yaml")
+	}
+	if ctx.Index == nil || len(fields) < 2 {
+		return ""
+	}
+	chartVersion, err := ctx.Index.Get(subject, strings.TrimRight(fields[1], ":;"))
+	if err != nil || len(chartVersion.URLs) == 0 || strings.Contains(chartVersion.URLs[0], "://") {
+		return ""
+	}
+
+	return chartVersion.URLs[0]
+}
+
+func exemptedPackages(ruleID string, options RuleOptions) []string {
+	exempted := make([]string, 0)
+	for packageName, ruleIDs := range options.Exemptions {
+		for _, id := range ruleIDs {
+			if id == ruleID {
+				exempted = append(exempted, packageName)
+			}
+		}
+	}
+	sort.Strings(exempted)
+
+	return exempted
+}
+
+// Returns a copy of ctx without the given packages, their charts in the
+// index and their assets, or their state
+func (ctx *Context) without(packageNames []string) *Context {
+	if len(packageNames) == 0 {
+		return ctx
+	}
+
+	filtered := *ctx
+	filtered.Packages = make(map[string]parse.UpstreamYaml, len(ctx.Packages))
+	filtered.PackageErrors = make(map[string]error, len(ctx.PackageErrors))
+	excluded := make(map[string]struct{})
+	excludedCharts := make(map[string]struct{})
+	excludedAssets := make(map[string][]string)
+	for _, packageName := range packageNames {
+		excluded[packageName] = struct{}{}
+		chartName := path.Base(packageName)
+		if upstreamYaml, ok := ctx.Packages[packageName]; ok && upstreamYaml.ChartYaml.Name != "" {
+			chartName = upstreamYaml.ChartYaml.Name
+		}
+		excludedCharts[chartName] = struct{}{}
+		vendor := path.Dir(packageName)
+		excludedAssets[vendor] = append(excludedAssets[vendor], chartName)
+	}
+
+	for packageName, upstreamYaml := range ctx.Packages {
+		if _, ok := excluded[packageName]; !ok {
+			filtered.Packages[packageName] = upstreamYaml
+		}
+	}
+	for packageName, err := range ctx.PackageErrors {
+		if _, ok := excluded[packageName]; !ok {
+			filtered.PackageErrors[packageName] = err
+		}
+	}
+	if ctx.Index != nil {
+		filtered.Index = repo.NewIndexFile()
+		for chartName, chartVersions := range ctx.Index.Entries {
+			if _, ok := excludedCharts[chartName]; !ok {
+				filtered.Index.Entries[chartName] = chartVersions
+			}
+		}
+	}
+	if ctx.State != nil {
+		filteredState := *ctx.State
+		filteredState.Packages = make(map[string]*state.PackageState, len(ctx.State.Packages))
+		for packageName, packageState := range ctx.State.Packages {
+			if _, ok := excluded[packageName]; !ok {
+				filteredState.Packages[packageName] = packageState
+			}
+		}
+		filtered.State = &filteredState
+	}
+	filtered.AddedAssets = withoutPackageAssets(ctx.AddedAssets, excludedAssets)
+	if ctx.released != nil {
+		released := *ctx.released
+		released.Modified = withoutPackageAssets(ctx.released.Modified, excludedAssets)
+		released.Added = withoutPackageAssets(ctx.released.Added, excludedAssets)
+		released.Removed = withoutPackageAssets(ctx.released.Removed, excludedAssets)
+		filtered.released = &released
+	}
+
+	return &filtered
+}
+
+// Returns assets, relative to the assets directory, without those of
+// the charts in excluded, which are keyed by vendor
+func withoutPackageAssets(assets []string, excluded map[string][]string) []string {
+	if assets == nil {
+		return nil
+	}
+
+	kept := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		if !isChartAsset(asset, excluded) {
+			kept = append(kept, asset)
+		}
+	}
+
+	return kept
+}
+
+// Reports whether asset is an archive, or a file beside it such as its
+// provenance attestation, of a version of one of charts or of its CRD
+// chart, which are keyed by vendor
+func isChartAsset(asset string, charts map[string][]string) bool {
+	vendor, name := path.Split(strings.TrimPrefix(asset, "/"))
+	if i := strings.Index(name, ".tgz"); i >= 0 {
+		name = name[:i]
+	}
+	for _, chartName := range charts[strings.TrimSuffix(vendor, "/")] {
+		for _, prefix := range []string{chartName + conform.CRDChartSuffix + "-", chartName + "-"} {
+			if version := strings.TrimPrefix(name, prefix); version != name {
+				if _, err := semver.NewVersion(version); err == nil {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func sortedPackageNames(packages map[string]parse.UpstreamYaml) []string {
+	packageNames := make([]string, 0, len(packages))
+	for packageName := range packages {
+		packageNames = append(packageNames, packageName)
+	}
+	sort.Strings(packageNames)
+
+	return packageNames
+}
+
+func checkUpstreamYaml(ctx *Context) []error {
+	packageNames := make([]string, 0, len(ctx.PackageErrors))
+	for packageName := range ctx.PackageErrors {
+		packageNames = append(packageNames, packageName)
+	}
+	sort.Strings(packageNames)
+
+	var errs []error
+	for _, packageName := range packageNames {
+		errs = append(errs, fmt.Errorf("%s: failed to parse upstream.yaml: %w", packageName, ctx.PackageErrors[packageName]))
+	}
+
+	return errs
+}
+
+func checkUpstreamAnnotations(ctx *Context) []error {
+	var errs []error
+	for _, err := range CheckAnnotations(ctx.Config.DefaultAnnotations, ctx.Config.AllowedAnnotationPrefixes) {
+		errs = append(errs, fmt.Errorf("defaultAnnotations: %w", err))
+	}
+	for _, packageName := range sortedPackageNames(ctx.Packages) {
+		for _, err := range CheckAnnotations(ctx.Packages[packageName].Annotations, ctx.Config.AllowedAnnotationPrefixes) {
+			errs = append(errs, fmt.Errorf("%s: %w", packageName, err))
+		}
+	}
+
+	return errs
+}
+
+func checkAliases(ctx *Context) []error {
+	var errs []error
+	aliasOwners := make(map[string]string)
+	for _, packageName := range sortedPackageNames(ctx.Packages) {
+		for _, alias := range ctx.Packages[packageName].Aliases {
+			alias = strings.Trim(alias, "/")
+			if _, ok := ctx.Packages[alias]; ok {
+				errs = append(errs, fmt.Errorf("%s: alias %s is an existing package", packageName, alias))
+			}
+			if owner, ok := aliasOwners[alias]; ok {
+				errs = append(errs, fmt.Errorf("%s: alias %s is already claimed by %s", packageName, alias, owner))
+			}
+			aliasOwners[alias] = packageName
+		}
+	}
+
+	return errs
+}
+
+func checkUnreachable(ctx *Context) []error {
+	if ctx.State == nil {
+		return nil
+	}
+
+	var errs []error
+	unreachableDays := ctx.Config.Escalation.GetUnreachableDays()
+	for _, packageName := range ctx.State.UnreachablePackages(unreachableDays, time.Now()) {
+		errs = append(errs, fmt.Errorf("%s upstream unreachable for more than %d days; consider deprecating it", packageName, unreachableDays))
+	}
+
+	return errs
+}
+
+// CompareReleased compares the assets directory with that of the
+// released repository configured under validate, setting AddedAssets.
+// It only compares once.
+func (ctx *Context) CompareReleased() error {
+	const assetsDir = "assets"
+
+	if ctx.released != nil {
+		return nil
+	}
+	if len(ctx.Config.Validate) == 0 || ctx.Config.Validate[0].Branch == "" || ctx.Config.Validate[0].Url == "" {
+		return fmt.Errorf("invalid validation configuration")
+	}
+
+	cloneDir, err := os.MkdirTemp("", "gitRepo")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(cloneDir); err != nil {
+			logrus.Error(err)
+		}
+	}()
+
+	if err := CloneRepo(ctx.Config.Validate[0].Url, ctx.Config.Validate[0].Branch, cloneDir); err != nil {
+		return fmt.Errorf("failed to clone %s: %w", ctx.Config.Validate[0].Url, err)
+	}
+
+	reporter := ctx.Reporter
+	if reporter == nil {
+		reporter = progress.Discard{}
+	}
+	reporter.Start(1)
+	reporter.Phase(assetsDir, "comparing")
+	upstreamPath := path.Join(cloneDir, assetsDir)
+	updatePath := path.Join(ctx.RepoRoot, assetsDir)
+	if _, err := os.Stat(updatePath); os.IsNotExist(err) {
+		logrus.Infof("Directory '%s' not in source. Skipping...", assetsDir)
+		reporter.Done(assetsDir, nil)
+		reporter.Finish()
+		ctx.released = &DirectoryComparison{Match: true}
+		return nil
+	}
+	if _, err := os.Stat(upstreamPath); os.IsNotExist(err) {
+		logrus.Infof("Directory '%s' not in upstream. Skipping...", assetsDir)
+		reporter.Done(assetsDir, nil)
+		reporter.Finish()
+		ctx.released = &DirectoryComparison{Match: true}
+		return nil
+	}
+	comparison, err := CompareDirectories(upstreamPath, updatePath, map[string]struct{}{"README.md": {}, checksums.File: {}}, ctx.FailFast)
+	reporter.Done(assetsDir, err)
+	reporter.Finish()
+	if err != nil {
+		return err
+	}
+
+	if len(comparison.Added) > 0 {
+		logrus.Infof("Files Added:\n - %s%s", assetsDir, strings.Join(comparison.Added, "\n - "+assetsDir))
+	}
+	ctx.released = &comparison
+	ctx.AddedAssets = comparison.Added
+
+	return nil
+}
+
+func checkReleasedAssets(ctx *Context) []error {
+	const assetsDir = "assets"
+
+	if ctx.released == nil {
+		return nil
+	}
+	if len(ctx.released.Removed) > 0 {
+		logrus.Warnf("Files Removed:\n - %s%s", assetsDir, strings.Join(ctx.released.Removed, "\n - "+assetsDir))
+	}
+
+	var errs []error
+	for _, modified := range ctx.released.Modified {
+		errs = append(errs, fmt.Errorf("released file %s%s was modified", assetsDir, modified))
+	}
+
+	return errs
+}
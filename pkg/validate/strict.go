@@ -0,0 +1,163 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// Strict checks applied to new packages
+const (
+	StrictLicense     = "license"
+	StrictReadme      = "readme"
+	StrictQuestions   = "questions"
+	StrictSchema      = "schema"
+	StrictIcon        = "icon"
+	StrictKubeVersion = "kube-version"
+)
+
+// StrictChecks lists every strict check, in the order they run
+var StrictChecks = []string{StrictLicense, StrictReadme, StrictQuestions, StrictSchema, StrictIcon, StrictKubeVersion}
+
+// StrictOptions configures the checks that packages new relative to the
+// released repository must pass. An empty Checks runs every check.
+type StrictOptions struct {
+	Checks []string
+}
+
+// CheckStrict returns an error for every check in checks that
+// helmChart fails
+func CheckStrict(helmChart *chart.Chart, checks []string) []error {
+	var errs []error
+	for _, check := range checks {
+		switch check {
+		case StrictLicense:
+			if !hasFile(helmChart, "LICENSE", "LICENSE.md", "LICENSE.txt") {
+				errs = append(errs, fmt.Errorf("has no LICENSE file"))
+			}
+		case StrictReadme:
+			if !hasFile(helmChart, "README.md") {
+				errs = append(errs, fmt.Errorf("has no README.md"))
+			}
+		case StrictQuestions:
+			if !hasFile(helmChart, "questions.yaml", "questions.yml") {
+				errs = append(errs, fmt.Errorf("has no questions.yaml"))
+			}
+		case StrictSchema:
+			if len(helmChart.Schema) == 0 {
+				errs = append(errs, fmt.Errorf("has no values.schema.json"))
+			}
+		case StrictIcon:
+			if helmChart.Metadata.Icon == "" {
+				errs = append(errs, fmt.Errorf("has no icon"))
+			}
+		case StrictKubeVersion:
+			if helmChart.Metadata.KubeVersion == "" && helmChart.Metadata.Annotations[kubeVersionAnnotation] == "" {
+				errs = append(errs, fmt.Errorf("declares no kubeVersion or %s", kubeVersionAnnotation))
+			}
+		}
+	}
+
+	return errs
+}
+
+func hasFile(helmChart *chart.Chart, names ...string) bool {
+	for _, file := range helmChart.Files {
+		for _, name := range names {
+			if strings.EqualFold(file.Name, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the strict checks selected by options, or an error for
+// unknown checks
+func (options StrictOptions) checks() ([]string, error) {
+	if len(options.Checks) == 0 {
+		return StrictChecks, nil
+	}
+	for _, check := range options.Checks {
+		known := false
+		for _, strictCheck := range StrictChecks {
+			if check == strictCheck {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown strict check %q", check)
+		}
+	}
+
+	return options.Checks, nil
+}
+
+// Runs the strict checks against the latest version of every chart
+// whose versions are all added since the released repository. CRD
+// charts are checked along with their parent charts only.
+func checkStrictNewPackages(ctx *Context) []error {
+	checks, err := ctx.Config.Strict.checks()
+	if err != nil {
+		return []error{err}
+	}
+	if ctx.Index == nil || len(ctx.AddedAssets) == 0 {
+		return nil
+	}
+
+	added := make(map[string]struct{}, len(ctx.AddedAssets))
+	for _, addedAsset := range ctx.AddedAssets {
+		added[path.Join("assets", addedAsset)] = struct{}{}
+	}
+
+	chartNames := make([]string, 0, len(ctx.Index.Entries))
+	for chartName := range ctx.Index.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		chartVersions := ctx.Index.Entries[chartName]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		if parentName := strings.TrimSuffix(chartName, "-crd"); parentName != chartName {
+			if _, ok := ctx.Index.Entries[parentName]; ok {
+				continue
+			}
+		}
+		isNew := true
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) == 0 {
+				continue
+			}
+			if _, ok := added[chartVersion.URLs[0]]; !ok {
+				isNew = false
+				break
+			}
+		}
+		if !isNew || len(chartVersions[0].URLs) == 0 {
+			continue
+		}
+
+		assetPath := chartVersions[0].URLs[0]
+		helmChart, err := loader.Load(filepath.Join(ctx.RepoRoot, filepath.FromSlash(assetPath)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", assetPath, err))
+			continue
+		}
+		for _, err := range CheckStrict(helmChart, checks) {
+			errs = append(errs, fmt.Errorf("new chart %s %s %w", chartName, chartVersions[0].Version, err))
+		}
+	}
+
+	return errs
+}
@@ -7,11 +7,21 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/rancher/partner-charts-ci/pkg/conform"
+	"github.com/rancher/partner-charts-ci/pkg/dialer"
+	"github.com/rancher/partner-charts-ci/pkg/hooks"
+	"github.com/rancher/partner-charts-ci/pkg/interpolate"
+	"github.com/rancher/partner-charts-ci/pkg/pullrequest"
+	"github.com/rancher/partner-charts-ci/pkg/ratelimit"
+	"github.com/rancher/partner-charts-ci/pkg/state"
+	"github.com/rancher/partner-charts-ci/pkg/storage"
 	"github.com/sirupsen/logrus"
 	"helm.sh/helm/v3/pkg/chart/loader"
 
@@ -19,7 +29,29 @@ import (
 )
 
 type ConfigurationYaml struct {
-	Validate []ValidateUpstream
+	AllowedAnnotationPrefixes []string
+	AWSSigV4Hosts             []string
+	BackfillCreated           bool
+	Checksums                 string
+	DefaultAnnotations        map[string]string
+	Dialer                    dialer.Options
+	EmbedIcons                bool
+	Escalation                state.EscalationOptions
+	Growth                    GrowthOptions
+	Hooks                     hooks.Options
+	Links                     LinkOptions
+	MaxVersions               int
+	Namespaces                NamespaceOptions
+	Provenance                bool
+	PublishedURL              string
+	PullRequests              pullrequest.Options
+	RateLimits                ratelimit.Options
+	ReadThroughMirror         string
+	Storage                   storage.Options
+	Strict                    StrictOptions
+	UpstreamEnvVariables      []string
+	Validate                  []ValidateUpstream
+	ValidationRules           RuleOptions
 }
 
 type ValidateUpstream struct {
@@ -52,9 +84,13 @@ func ReadConfig(configYamlPath string) (ConfigurationYaml, error) {
 	configYaml := ConfigurationYaml{}
 	if err != nil {
 		logrus.Debug(err)
-	} else {
-		err = yaml.Unmarshal(upstreamYamlFile, &configYaml)
+		return configYaml, err
 	}
+	upstreamYamlFile, err = interpolate.Env(upstreamYamlFile)
+	if err != nil {
+		return configYaml, fmt.Errorf("failed to interpolate %s: %w", configYamlPath, err)
+	}
+	err = yaml.Unmarshal(upstreamYamlFile, &configYaml)
 
 	return configYaml, err
 }
@@ -93,7 +129,12 @@ func ChecksumFile(filePath string) (string, error) {
 	return hash, nil
 }
 
-func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{}) (DirectoryComparison, error) {
+// CompareDirectories compares the files of leftPath to those of
+// rightPath. Files present in both are checksummed in parallel, and
+// chart archives that differ are compared ignoring catalog.cattle.io
+// annotations. With failFast, comparison stops at the first modified
+// file, so Modified and Unchanged may be incomplete.
+func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{}, failFast bool) (DirectoryComparison, error) {
 	logrus.Debugf("Comparing directories %s and %s", leftPath, rightPath)
 	directoryComparison := DirectoryComparison{
 		Match: true,
@@ -108,6 +149,7 @@ func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{})
 		return directoryComparison, err
 	}
 
+	compared := make([]string, 0)
 	compareLeft := func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			logrus.Error(err)
@@ -121,30 +163,7 @@ func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{})
 				directoryComparison.Removed = append(directoryComparison.Removed, relativePath)
 				return nil
 			}
-			leftCheckSum, err := ChecksumFile(filePath)
-			if err != nil {
-				logrus.Error(err)
-			}
-			rightCheckSum, err := ChecksumFile(rightFilePath)
-			if err != nil {
-				logrus.Error(err)
-			}
-
-			if leftCheckSum != rightCheckSum && strings.HasSuffix(filePath, ".tgz") {
-				chartMatch, err := matchHelmCharts(filePath, rightFilePath)
-				if chartMatch {
-					directoryComparison.Unchanged = append(directoryComparison.Unchanged, relativePath)
-				} else {
-					directoryComparison.Modified = append(directoryComparison.Modified, relativePath)
-				}
-				if err != nil {
-					logrus.Debug(err)
-				}
-			} else if leftCheckSum != rightCheckSum {
-				directoryComparison.Modified = append(directoryComparison.Modified, relativePath)
-			} else {
-				directoryComparison.Unchanged = append(directoryComparison.Unchanged, relativePath)
-			}
+			compared = append(compared, relativePath)
 		}
 
 		return nil
@@ -170,6 +189,16 @@ func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{})
 		return DirectoryComparison{}, fmt.Errorf("failed while walking %q: %w", rightPath, err)
 	}
 
+	modified := compareFiles(leftPath, rightPath, compared, failFast)
+	for i, relativePath := range compared {
+		switch modified[i] {
+		case fileModified:
+			directoryComparison.Modified = append(directoryComparison.Modified, relativePath)
+		case fileUnchanged:
+			directoryComparison.Unchanged = append(directoryComparison.Unchanged, relativePath)
+		}
+	}
+
 	if len(directoryComparison.Modified)+len(directoryComparison.Added)+len(directoryComparison.Removed) > 0 {
 		directoryComparison.Match = false
 	}
@@ -177,6 +206,76 @@ func CompareDirectories(leftPath, rightPath string, exclude map[string]struct{})
 	return directoryComparison, nil
 }
 
+type fileResult int
+
+const (
+	fileSkipped fileResult = iota
+	fileUnchanged
+	fileModified
+)
+
+// Compares the files at relativePaths under leftPath and rightPath with
+// one worker per CPU. With failFast, files not yet compared when a
+// modified file is found are skipped.
+func compareFiles(leftPath, rightPath string, relativePaths []string, failFast bool) []fileResult {
+	results := make([]fileResult, len(relativePaths))
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	next := make(chan int)
+
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if failFast && stop.Load() {
+					continue
+				}
+				results[i] = compareFile(path.Join(leftPath, relativePaths[i]), path.Join(rightPath, relativePaths[i]))
+				if results[i] == fileModified {
+					stop.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range relativePaths {
+		if failFast && stop.Load() {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+func compareFile(leftFilePath, rightFilePath string) fileResult {
+	leftCheckSum, err := ChecksumFile(leftFilePath)
+	if err != nil {
+		logrus.Error(err)
+	}
+	rightCheckSum, err := ChecksumFile(rightFilePath)
+	if err != nil {
+		logrus.Error(err)
+	}
+
+	if leftCheckSum != rightCheckSum && strings.HasSuffix(leftFilePath, ".tgz") {
+		chartMatch, err := matchHelmCharts(leftFilePath, rightFilePath)
+		if err != nil {
+			logrus.Debug(err)
+		}
+		if chartMatch {
+			return fileUnchanged
+		}
+		return fileModified
+	} else if leftCheckSum != rightCheckSum {
+		return fileModified
+	}
+
+	return fileUnchanged
+}
+
 func matchHelmCharts(leftPath, rightPath string) (bool, error) {
 	leftFile, err := os.Open(leftPath)
 	if err != nil {
@@ -231,7 +330,7 @@ func matchHelmCharts(leftPath, rightPath string) (bool, error) {
 		return false, err
 	}
 
-	directoryComparison, err := CompareDirectories(leftOut, rightOut, map[string]struct{}{})
+	directoryComparison, err := CompareDirectories(leftOut, rightOut, map[string]struct{}{}, true)
 
 	return directoryComparison.Match, err
 
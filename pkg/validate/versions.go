@@ -0,0 +1,67 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// MaxVersionsError reports a chart with more versions than maxVersions
+// allows. Added is the number of versions about to be added, if any.
+type MaxVersionsError struct {
+	Chart       string
+	Versions    int
+	Added       int
+	MaxVersions int
+}
+
+func (e MaxVersionsError) Error() string {
+	count := fmt.Sprintf("has %d versions", e.Versions)
+	if e.Added > 0 {
+		count = fmt.Sprintf("would have %d versions after adding %d", e.Versions, e.Added)
+	}
+
+	return fmt.Sprintf("%s %s, more than maxVersions %d; remove old versions with `partner-charts-ci cull %s <days>`", e.Chart, count, e.MaxVersions, e.Chart)
+}
+
+// CheckMaxVersions verifies that no chart in indexFile has more than
+// maxVersions versions. CRD charts are covered by their parent chart.
+// A maxVersions of 0 disables the check.
+func CheckMaxVersions(indexFile *repo.IndexFile, maxVersions int) []error {
+	if maxVersions <= 0 {
+		return nil
+	}
+
+	chartNames := make([]string, 0, len(indexFile.Entries))
+	for chartName := range indexFile.Entries {
+		chartNames = append(chartNames, chartName)
+	}
+	sort.Strings(chartNames)
+
+	var errs []error
+	for _, chartName := range chartNames {
+		parentName := strings.TrimSuffix(chartName, "-crd")
+		if _, ok := indexFile.Entries[parentName]; ok && parentName != chartName {
+			continue
+		}
+		if versions := len(indexFile.Entries[chartName]); versions > maxVersions {
+			errs = append(errs, MaxVersionsError{Chart: chartName, Versions: versions, MaxVersions: maxVersions})
+		}
+	}
+
+	return errs
+}
+
+// IsExempted reports whether packageName is exempted from the rule
+// ruleID by options
+func IsExempted(options RuleOptions, ruleID, packageName string) bool {
+	for _, exempted := range exemptedPackages(ruleID, options) {
+		if exempted == packageName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package valuesdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	KindAdded   = "added"
+	KindRemoved = "removed"
+	KindChanged = "changed"
+
+	//maxValueLength truncates values rendered in the Markdown report
+	maxValueLength = 60
+	//maxRows caps the number of changes listed in the Markdown report
+	maxRows = 100
+)
+
+// Change is a single difference between two values.yaml files, at the
+// dotted path of Key
+type Change struct {
+	Key  string
+	Kind string
+	Old  interface{}
+	New  interface{}
+}
+
+// Diff compares the values of two chart versions key by key and returns
+// the added, removed and changed keys, sorted by key. Maps are compared
+// recursively; lists and scalars are compared as a whole.
+func Diff(oldValues, newValues map[string]interface{}) []Change {
+	changes := make([]Change, 0)
+	diffMaps("", oldValues, newValues, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+func diffMaps(prefix string, oldValues, newValues map[string]interface{}, changes *[]Change) {
+	for key, oldValue := range oldValues {
+		keyPath := joinKey(prefix, key)
+		newValue, ok := newValues[key]
+		if !ok {
+			*changes = append(*changes, Change{Key: keyPath, Kind: KindRemoved, Old: oldValue})
+			continue
+		}
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			diffMaps(keyPath, oldMap, newMap, changes)
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, Change{Key: keyPath, Kind: KindChanged, Old: oldValue, New: newValue})
+		}
+	}
+	for key, newValue := range newValues {
+		if _, ok := oldValues[key]; !ok {
+			*changes = append(*changes, Change{Key: joinKey(prefix, key), Kind: KindAdded, New: newValue})
+		}
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if strings.ContainsAny(key, ". ") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// Markdown renders changes as a Markdown table, titled with the versions
+// compared
+func Markdown(oldVersion, newVersion string, changes []Change) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### values.yaml changes from %s to %s\n\n", oldVersion, newVersion)
+	if len(changes) == 0 {
+		b.WriteString("No changes to default values.\n")
+		return b.String()
+	}
+
+	b.WriteString("| Key | Change | Previous default | New default |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for i, change := range changes {
+		if i == maxRows {
+			fmt.Fprintf(&b, "\nand %d more changes\n", len(changes)-maxRows)
+			break
+		}
+		oldValue, newValue := "", ""
+		if change.Kind != KindAdded {
+			oldValue = render(change.Old)
+		}
+		if change.Kind != KindRemoved {
+			newValue = render(change.New)
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", change.Key, change.Kind, oldValue, newValue)
+	}
+
+	return b.String()
+}
+
+// Renders value as compact JSON in a code span
+func render(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprint(value))
+	}
+	rendered := string(data)
+	if runes := []rune(rendered); len(runes) > maxValueLength {
+		rendered = string(runes[:maxValueLength]) + "…"
+	}
+	rendered = strings.ReplaceAll(rendered, "|", "\\|")
+	rendered = strings.ReplaceAll(rendered, "`", "'")
+
+	return "`" + rendered + "`"
+}